@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	// Embedded so APP_TIMEZONE and ?tz= work in images without a zoneinfo database.
+	_ "time/tzdata"
 
+	"github.com/billdaws/moneymanager/internal/buildinfo"
 	"github.com/billdaws/moneymanager/internal/config"
 	"github.com/billdaws/moneymanager/internal/server"
 )
@@ -50,8 +52,11 @@ func main() {
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
+	build := buildinfo.Get()
 	logger.Info("starting money manager",
-		"version", "0.1.0",
+		"version", build.Version,
+		"commit", build.Commit,
+		"build_time", build.BuildTime,
 		"port", cfg.Server.Port,
 	)
 
@@ -79,8 +84,8 @@ func main() {
 	case sig := <-shutdown:
 		logger.Info("shutdown signal received", "signal", sig.String())
 
-		// Give the server 30 seconds to shut down gracefully
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		// Give the server SERVER_SHUTDOWN_TIMEOUT to shut down gracefully
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
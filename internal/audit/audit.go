@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/billdaws/moneymanager/internal/auth"
+	"github.com/billdaws/moneymanager/internal/clientip"
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionUpload          = "statement.upload"
+	ActionInternalType    = "statement.upload.internal_type"
+	ActionDelete          = "statement.delete"
+	ActionReconcile       = "statement.reconcile"
+	ActionMerge           = "statement.merge"
+	ActionCommit          = "statement.commit"
+	ActionLegalHoldSet    = "statement.legal_hold.set"
+	ActionLegalHoldClear  = "statement.legal_hold.clear"
+	ActionTransactionEdit = "transaction.edit"
+	ActionCategorize      = "transaction.categorize"
+	ActionRuleCreate      = "category_rule.create"
+
+	ActionHeaderProfilePut    = "header_profile.put"
+	ActionHeaderProfileDelete = "header_profile.delete"
+
+	ActionTagCreate = "tag.create"
+	ActionTagAttach = "statement.tag"
+	ActionTagDetach = "statement.untag"
+
+	ActionNoteAdd    = "statement.note.add"
+	ActionNoteDelete = "statement.note.delete"
+
+	ActionVacuum  = "database.vacuum"
+	ActionMigrate = "database.migrate"
+)
+
+// Target types recorded in the audit log.
+const (
+	TargetStatement     = "statement"
+	TargetTransaction   = "transaction"
+	TargetCategoryRule  = "category_rule"
+	TargetHeaderProfile = "header_profile"
+	TargetTag           = "tag"
+)
+
+// Anonymous is the actor recorded for requests without an API key.
+const Anonymous = "anonymous"
+
+// Recorder appends mutations to the audit log. A nil Recorder records nothing,
+// which is how auditing is disabled.
+type Recorder struct {
+	db     *database.DB
+	logger *slog.Logger
+}
+
+// NewRecorder creates a Recorder that writes to db.
+func NewRecorder(db *database.DB, logger *slog.Logger) *Recorder {
+	return &Recorder{db: db, logger: logger}
+}
+
+// Record appends an entry for a mutation by the principal in ctx, along with the
+// client IP of the request. Failures are logged rather than returned so a
+// completed change is never reported as failed.
+func (r *Recorder) Record(ctx context.Context, action, targetType, targetID string, details map[string]any) {
+	ip, _ := clientip.FromContext(ctx)
+	r.record(Actor(ctx), ip, action, targetType, targetID, details)
+}
+
+// RecordAs appends an entry for a mutation by a named actor, such as a
+// background job.
+func (r *Recorder) RecordAs(actor, action, targetType, targetID string, details map[string]any) {
+	r.record(actor, "", action, targetType, targetID, details)
+}
+
+func (r *Recorder) record(actor, clientIP, action, targetType, targetID string, details map[string]any) {
+	if r == nil {
+		return
+	}
+
+	encoded := []byte("{}")
+	if len(details) > 0 {
+		var err error
+		if encoded, err = json.Marshal(details); err != nil {
+			r.logger.Error("encode audit details failed", "action", action, "error", err)
+			encoded = []byte("{}")
+		}
+	}
+
+	if err := r.db.InsertAuditEntry(actor, clientIP, action, targetType, targetID, string(encoded)); err != nil {
+		r.logger.Error("audit log write failed",
+			"actor", actor,
+			"action", action,
+			"target_id", targetID,
+			"error", err,
+		)
+	}
+}
+
+// Actor returns the name of the principal in ctx, or Anonymous.
+func Actor(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok && p.Name != "" {
+		return p.Name
+	}
+	return Anonymous
+}
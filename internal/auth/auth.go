@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Principal identifies a caller authenticated by an API key.
+type Principal struct {
+	// Name is the label configured for the API key, used as the actor in logs.
+	Name string
+	// Internal is set for keys granted the internal scope, held by trusted
+	// pipelines that may upload types outside the public allow-list.
+	Internal bool
+}
+
+type contextKey struct{}
+
+type tenantKey struct{}
+
+// FromContext returns the authenticated principal, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// Tenant returns the tenant whose data a request is scoped to. ok is false when
+// tenant isolation is off and every caller sees all data.
+func Tenant(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(tenantKey{}).(string)
+	return t, ok
+}
+
+// WithTenant returns a copy of ctx scoped to the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Isolate scopes each request to the tenant of its principal, which is the
+// name of the API key. Keys sharing a name share a tenant. It must be wrapped
+// by Middleware.
+func Isolate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), p.Name)))
+	})
+}
+
+// Middleware rejects requests that don't present one of the configured API keys,
+// either as "Authorization: Bearer <key>" or "X-API-Key: <key>". keys maps each
+// API key to its name; keys whose name is listed in internal get the internal
+// scope. With no keys configured every request is rejected.
+func Middleware(keys map[string]string, internal []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := authenticate(keys, internal, r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// Identify is Middleware for routes open to anonymous callers: requests
+// presenting a configured key carry its principal, and any others pass through
+// without one.
+func Identify(keys map[string]string, internal []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, ok := authenticate(keys, internal, r); ok {
+				r = r.WithContext(WithPrincipal(r.Context(), p))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate returns the principal of the API key presented with r.
+func authenticate(keys map[string]string, internal []string, r *http.Request) (Principal, bool) {
+	name, ok := lookup(keys, presentedKey(r))
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Name: name, Internal: slices.Contains(internal, name)}, true
+}
+
+func presentedKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// lookup compares the presented key against every configured key in constant time.
+func lookup(keys map[string]string, presented string) (string, bool) {
+	if presented == "" {
+		return "", false
+	}
+
+	var name string
+	found := false
+	for key, n := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(presented)) == 1 {
+			name = n
+			found = true
+		}
+	}
+	return name, found
+}
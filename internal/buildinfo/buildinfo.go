@@ -0,0 +1,82 @@
+// Package buildinfo reports which build of the server is running.
+//
+// Set the values at build time with -ldflags, for example:
+//
+//	go build -ldflags "-X github.com/billdaws/moneymanager/internal/buildinfo.Version=1.2.0 \
+//	  -X github.com/billdaws/moneymanager/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/billdaws/moneymanager/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// Values that aren't set fall back to the module and VCS information embedded by
+// the Go toolchain.
+package buildinfo
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags "-X".
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	// Modified reports uncommitted changes in the build's working tree. It is
+	// only known from the toolchain's VCS information.
+	Modified  bool
+	GoVersion string
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build information, read once on first use.
+func Get() Info {
+	once.Do(func() {
+		info = read()
+		if info.Version == "" {
+			info.Version = "dev"
+		}
+	})
+	return info
+}
+
+// read combines the -ldflags values with the toolchain's build information.
+// Without a BuildTime from -ldflags, the commit time is reported instead.
+func read() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+
+	if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
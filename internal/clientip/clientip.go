@@ -0,0 +1,108 @@
+// Package clientip resolves the address of the client behind trusted proxies.
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey struct{}
+
+// FromContext returns the client IP resolved by Middleware, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(contextKey{}).(string)
+	return ip, ok
+}
+
+// WithClientIP returns a copy of ctx carrying the client IP.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// ClientIP returns the client IP for r: the address resolved by Middleware, or
+// the host part of RemoteAddr when the request didn't pass through it.
+func ClientIP(r *http.Request) string {
+	if ip, ok := FromContext(r.Context()); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// Middleware resolves the client IP of each request and stores it in the
+// request context. Proxy headers are only believed when RemoteAddr is one of the
+// trusted proxies; they're checked in the given order, and the first one
+// yielding an address wins. A header may hold a comma-separated chain, which is
+// walked from the right so entries appended by trusted proxies are skipped and
+// values a client put in front can't be spoofed.
+func Middleware(trusted []netip.Prefix, headers []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := Resolve(r, trusted, headers)
+			next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+// Resolve returns the client IP for r, consulting headers only when the
+// immediate peer is trusted.
+func Resolve(r *http.Request, trusted []netip.Prefix, headers []string) string {
+	remote := remoteIP(r)
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+
+	for _, name := range headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		chain := strings.Split(strings.Join(values, ","), ",")
+		var leftmost string
+		for i := len(chain) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(chain[i]))
+			if err != nil {
+				// A malformed hop can't be traced any further.
+				break
+			}
+			ip := addr.Unmap().String()
+			if !isTrusted(ip, trusted) {
+				return ip
+			}
+			leftmost = ip
+		}
+		if leftmost != "" {
+			// Every hop read is a trusted proxy; the leftmost is closest to the client.
+			return leftmost
+		}
+	}
+
+	return remote
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,26 @@ package config
 
 import (
 	"fmt"
+	"maps"
+	"net/netip"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// headerName matches a valid HTTP header field name.
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// currencyCode matches an ISO 4217 currency code; rateKey matches a lowercased
+// code with an optional effective date, as in CURRENCY_RATES.
+var (
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+	rateKey      = regexp.MustCompile(`^[a-z]{3}(@\d{4}-\d{2}-\d{2})?$`)
+)
+
 // Config holds all application configuration
 type Config struct {
 	Server    ServerConfig
@@ -15,6 +30,13 @@ type Config struct {
 	Upload    UploadConfig
 	Logging   LoggingConfig
 	GnuCash   GnuCashConfig
+	Pipeline  PipelineConfig
+	Auth      AuthConfig
+	Retention RetentionConfig
+	Redaction RedactionConfig
+	Audit     AuditConfig
+	CORS      CORSConfig
+	Currency  CurrencyConfig
 }
 
 // ServerConfig holds HTTP server configuration
@@ -23,31 +45,197 @@ type ServerConfig struct {
 	Port         int
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// ReadHeaderTimeout bounds how long a client may take to send the request
+	// headers. It's kept well below ReadTimeout so slowloris clients, which
+	// trickle headers to hold connections open, are dropped quickly
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout closes keep-alive connections left idle that long, so idle
+	// clients can't pin connections and file descriptors indefinitely
+	IdleTimeout time.Duration
+	// ShutdownTimeout bounds how long in-flight requests and background work
+	// get to finish after a shutdown signal
+	ShutdownTimeout time.Duration
+	// BasePath is prepended to every route, e.g. "/api/moneymanager" when
+	// the service is reverse-proxied under a sub-path. Empty means root.
+	BasePath string
+	// TrustedProxies are the peers whose ProxyHeaders are believed when
+	// resolving the client IP; requests from anywhere else use RemoteAddr
+	TrustedProxies []netip.Prefix
+	// ProxyHeaders carry the client IP set by a trusted proxy, checked in order
+	ProxyHeaders []string
+	// Compression gzips JSON and text responses of at least CompressionMinBytes
+	// for clients that accept it
+	Compression         bool
+	CompressionMinBytes int
+	// ResponseEnvelope wraps every JSON response in {data, meta}; clients can
+	// also ask for it per request through the Accept header
+	ResponseEnvelope bool
+	// PendingAccepted answers transaction listings of statements still
+	// pending or processing with 202 Accepted instead of an empty 200 OK
+	PendingAccepted bool
+	// Pprof serves the runtime profiles of net/http/pprof under /debug/pprof
+	// to callers with an API key
+	Pprof bool
+	// Timezone renders the times in responses and reads date-only filters
+	// and statement dates; storage stays in UTC
+	Timezone *time.Location
+	// OutboundBlocked are the ranges outbound fetches of client-supplied URLs
+	// may not connect to; empty uses the built-in list of internal ranges.
+	// OutboundAllowed are exceptions to them
+	OutboundBlocked []netip.Prefix
+	OutboundAllowed []netip.Prefix
 }
 
 // KreuzbergConfig holds Kreuzberg service configuration
 type KreuzbergConfig struct {
-	URL     string
-	Timeout time.Duration
+	URL         string
+	ExtractPath string
+	Timeout     time.Duration
+	// TimeoutByType overrides Timeout for specific MIME types
+	TimeoutByType map[string]time.Duration
+	// TimeoutRetries is how many times a timed out extraction is retried
+	TimeoutRetries int
+	// RetryDelay is the wait before each retry
+	RetryDelay time.Duration
+	// AuthToken is sent in AuthHeader on every request, as a bearer token when
+	// AuthHeader is Authorization; empty sends no credentials
+	AuthHeader string
+	AuthToken  string
+	// MaxResponseMB caps the size of an extraction response; 0 means unlimited
+	MaxResponseMB int
+	// MaxIdleConnsPerHost connections are kept open for reuse between
+	// extractions, and at most MaxConnsPerHost opened (0 = unlimited)
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	// IdleConnTimeout closes idle connections (0 = never); KeepAlive is the
+	// TCP keep-alive probe interval (negative disables them)
+	IdleConnTimeout time.Duration
+	KeepAlive       time.Duration
 }
 
 // DatabaseConfig holds database paths
 type DatabaseConfig struct {
 	GnuCashPath  string
 	MetadataPath string
+	// CheckpointInterval periodically checkpoints the metadata WAL; 0 only checkpoints on shutdown
+	CheckpointInterval time.Duration
+	// ReadConnection serves list and reporting queries from a separate
+	// read-only connection to the metadata database
+	ReadConnection bool
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime size the connection
+	// pool of each metadata database connection (0 = unlimited open
+	// connections, connections kept indefinitely)
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
 // UploadConfig holds file upload configuration
 type UploadConfig struct {
-	MaxSizeMB     int
-	AllowedTypes  []string
-	TempDir       string
+	MaxSizeMB int
+	// MaxSizeMBByType overrides MaxSizeMB for specific MIME types
+	MaxSizeMBByType map[string]int
+	MaxBatchFiles   int
+	AllowedTypes    []string
+	// InternalAllowedTypes are accepted in addition to AllowedTypes from
+	// callers with an internal API key
+	InternalAllowedTypes []string
+	// StrictMIME rejects files whose extension maps, in ExtensionTypes, to a
+	// different type than the one detected from their content
+	StrictMIME     bool
+	ExtensionTypes map[string]string
+	// DetectCharset transcodes text uploads to UTF-8 from the charset
+	// detected for them, unless the upload names one
+	DetectCharset bool
+	// TempDir receives multipart file parts beyond MultipartMemoryMB
+	TempDir           string
+	MultipartMemoryMB int
+	// MaxFormKB bounds the fields of a multipart upload other than its
+	// files, with the multipart framing, on top of MaxSizeMB per file
+	MaxFormKB int
+	// KeepOriginals stores uploaded files for download: in StorageDir with
+	// the local StorageBackend, in the S3 bucket with s3
+	KeepOriginals  bool
+	StorageBackend string
+	StorageDir     string
+	S3             S3Config
+	// AccountTypes is the allow-list for the account_type field; "*" allows any value
+	AccountTypes []string
+	// AccountTypeSynonyms maps alternative spellings to an allowed account type
+	AccountTypeSynonyms map[string]string
+	// AccountNameMatching resolves the account name of an upload to the
+	// existing account it matches, ignoring case, whitespace runs and
+	// punctuation as listed: case, space, punctuation, or off
+	AccountNameMatching []string
+	// MaxConcurrent caps extractions in flight across all accounts (0 = unlimited)
+	MaxConcurrent int
+	// MaxConcurrentPerAccount caps extractions in flight per account name (0 = unlimited)
+	MaxConcurrentPerAccount int
+	// PriorityScheduling hands free extraction slots to high priority and
+	// cheap uploads first: cost is file size times CostWeights by MIME type.
+	// Uploads waiting PriorityMaxWait or longer go first (0 = never)
+	PriorityScheduling bool
+	CostWeights        map[string]float64
+	PriorityMaxWait    time.Duration
+	// HashAlgorithm selects the dedup hash: "sha256" over the raw bytes or
+	// "normalized" over the content with metadata removed
+	HashAlgorithm string
+	// HashSalt is prepended to the content before hashing
+	HashSalt string
+	// DuplicateConflict answers duplicate uploads with 409 Conflict instead of 200 OK
+	DuplicateConflict bool
+	// Stage leaves the transactions of every upload staged, out of reports
+	// until the statement is committed, as the stage form field does for one
+	Stage bool
+	// DeterministicIDs derives each statement's ID from its file hash and
+	// account, so the same file under the same account gets the same ID
+	DeterministicIDs bool
+	// PeriodOverlap checks the transaction dates of each upload against the
+	// other statements of its account: off, warn (report overlaps in the
+	// response) or block (fail the statement)
+	PeriodOverlap string
+	// URLEnabled serves POST /upload/url, which downloads the file from a URL.
+	// Downloads time out after URLTimeout; URLAllowPrivate permits loopback,
+	// private and other internal addresses
+	URLEnabled      bool
+	URLTimeout      time.Duration
+	URLAllowPrivate bool
+	// MinFreeMemoryMB rejects uploads with 503 while less memory is available
+	// (0 = never); clients are told to retry after MemoryRetryAfter
+	MinFreeMemoryMB  int
+	MemoryRetryAfter time.Duration
+	// MaxStatementsPerAccount rejects uploads to an account that already
+	// has that many live statements (0 = unlimited); MaxStatementsByAccount
+	// overrides it by lowercased account name
+	MaxStatementsPerAccount int
+	MaxStatementsByAccount  map[string]int
+}
+
+// S3Config locates the S3 bucket original files are kept in
+type S3Config struct {
+	// Endpoint is the base URL of an S3-compatible service; empty uses AWS
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every object key
+	Prefix string
+	// PathStyle puts the bucket in the URL path rather than the host name
+	PathStyle bool
+	// AccessKeyID and SecretAccessKey default to the standard AWS variables
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Timeout         time.Duration
 }
 
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
 	Level  string
 	Format string
+	// ExcludePaths are never request-logged, except for server errors
+	ExcludePaths []string
+	// SampleRates logs only a fraction, from 0 to 1, of the requests to a path
+	SampleRates map[string]float64
 }
 
 // GnuCashConfig holds GNU Cash specific configuration
@@ -56,6 +244,169 @@ type GnuCashConfig struct {
 	AutoCreateAccounts bool
 }
 
+// PipelineConfig holds statement processing pipeline configuration
+type PipelineConfig struct {
+	// StoreImages persists images extracted by Kreuzberg
+	StoreImages bool
+	// StoreContent keeps the text extracted from each statement for
+	// GET /statements/{id}/content and full-text search
+	StoreContent bool
+	// TableExport stores the extracted tables of each statement as CSV: off,
+	// on, or only (export the tables without parsing transactions)
+	TableExport string
+	// MergeTables joins consecutive extracted tables with the same headers,
+	// dropping the header rows repeated on each page
+	MergeTables bool
+	// FailOnHookError marks a statement as failed when a pipeline hook errors
+	FailOnHookError bool
+	// FailOnEmpty marks statements without data rows as failed rather than processed_empty
+	FailOnEmpty bool
+	// ReconcileToleranceCents is the largest discrepancy that still reconciles
+	ReconcileToleranceCents int64
+	// ExpectedCountTolerance is how many transactions the parsed count may
+	// differ by from an upload's expected_count before it's flagged
+	ExpectedCountTolerance int
+	// TableFilter selects the extracted tables parsed into rows:
+	// all, largest, index=0|2 or headers=date|amount
+	TableFilter string
+	// TableFiltersByAccount overrides TableFilter by lowercased account name
+	TableFiltersByAccount map[string]string
+	// InvertDebitCredit lists the lowercased account names whose statements'
+	// debit columns add to the account and credit columns take from it
+	InvertDebitCredit []string
+	// NormalizeHeaders trims table headers and collapses their whitespace
+	// before rows are stored and parsed; LowercaseHeaders also lowercases them
+	NormalizeHeaders bool
+	LowercaseHeaders bool
+	// HeaderRows skips table rows repeating the header: off, first (the first
+	// row of each table) or any
+	HeaderRows string
+	// FallbackExtractors are tried in order when the extracted tables hold no
+	// data rows: text finds transaction lines in the extracted text
+	FallbackExtractors []string
+	// ExtractionRoutes maps MIME types to how their uploads are extracted:
+	// tables (Kreuzberg's tables, the default), csv (parsed here without
+	// Kreuzberg, text types only) or text (lines of Kreuzberg's text or OCR)
+	ExtractionRoutes map[string]string
+	// ProcessingTimeout cancels a statement's extraction attempt that runs
+	// longer and marks it timed_out (0 = no limit); RetryProcessingTimeout
+	// retries it like a Kreuzberg timeout
+	ProcessingTimeout      time.Duration
+	RetryProcessingTimeout bool
+	// FailedRetries is how many times a statement whose extraction failed for
+	// a transient reason is retried automatically (0 = never), waiting
+	// FailedRetryDelay before the first retry and doubling up to
+	// FailedRetryMaxDelay; due retries are looked for every FailedRetryInterval
+	FailedRetries       int
+	FailedRetryDelay    time.Duration
+	FailedRetryMaxDelay time.Duration
+	FailedRetryInterval time.Duration
+	// StatementDate fills in the statement date of uploads without one: off,
+	// max (latest transaction date) or month (latest date in the month with
+	// the most transactions)
+	StatementDate string
+	// CategoryRulesFile is a JSON file of category rules applied after the
+	// stored rules; empty means none
+	CategoryRulesFile string
+	// DetectAccountType infers the account type of uploads without one from
+	// the extracted content, matching AccountTypeKeywords
+	DetectAccountType   bool
+	AccountTypeKeywords map[string][]string
+	// SplitAccounts splits combined statements into accounts by the section
+	// headings matching AccountSections, phrases keyed by account type
+	SplitAccounts   bool
+	AccountSections map[string][]string
+	// MaxImages and MaxChunks cap the images and text chunks kept from each
+	// statement's extraction results; 0 means unlimited
+	MaxImages int
+	MaxChunks int
+	// MaxTableColumns drops extracted tables with more columns, and
+	// MaxHeaderLength truncates longer header names; 0 means unlimited
+	MaxTableColumns int
+	MaxHeaderLength int
+}
+
+// AuthConfig holds API key authentication configuration
+type AuthConfig struct {
+	// APIKeys maps each accepted API key to a name identifying its holder
+	APIKeys map[string]string
+	// TenantIsolation scopes statements, transactions and account data to the
+	// name of the API key that uploaded them; uploads then require a key too
+	TenantIsolation bool
+	// InternalKeys names the API keys granted the internal scope, which may
+	// upload the types in Upload.InternalAllowedTypes
+	InternalKeys []string
+}
+
+// RetentionConfig holds the statement retention policy
+type RetentionConfig struct {
+	// Days is how long statements are kept; 0 disables purging
+	Days       int
+	HardDelete bool
+	DryRun     bool
+	Interval   time.Duration
+}
+
+// RedactionConfig holds sensitive-data redaction configuration
+type RedactionConfig struct {
+	// Enabled masks Luhn-valid card numbers in logs and error messages
+	Enabled bool
+	// Pattern is an optional extra regular expression whose matches are masked
+	Pattern string
+	// RawData also redacts extracted rows and stored Kreuzberg responses
+	RawData bool
+}
+
+// AuditConfig holds audit logging configuration
+type AuditConfig struct {
+	// Enabled records mutations in the append-only audit log
+	Enabled bool
+}
+
+// CurrencyConfig holds base currency conversion configuration
+type CurrencyConfig struct {
+	// Conversion stores each transaction's amount in Base as well, at the
+	// exchange rate on the transaction date
+	Conversion bool
+	// Base is the ISO 4217 reporting currency, and the currency of uploads
+	// that don't name one
+	Base string
+	// Rates are static rates: the price of one unit of a currency in Base,
+	// keyed by lowercased code or code@YYYY-MM-DD for the date it takes effect
+	Rates map[string]string
+	// RatesURL is a Frankfurter-compatible API consulted for rates missing
+	// from Rates; empty uses the static rates only
+	RatesURL     string
+	RatesTimeout time.Duration
+	// SplitAmounts reads a currency symbol or code printed in amount cells,
+	// e.g. "$1,234.56 USD", as the currency of the transaction
+	SplitAmounts bool
+}
+
+// CORSConfig holds cross-origin request configuration
+type CORSConfig struct {
+	// AllowedOrigins lists the origins browsers may call from; "*" allows any
+	AllowedOrigins []string
+	// MaxAge is how long browsers may cache a preflight response (0 = don't send)
+	MaxAge time.Duration
+	// AllowCredentials lets browsers send cookies and Authorization headers;
+	// it requires explicit AllowedOrigins
+	AllowCredentials bool
+}
+
+// defaultAccountTypeKeywords are the phrases that suggest each account type
+// when detecting it from a statement's content.
+const defaultAccountTypeKeywords = "credit:credit limit|minimum payment|available credit|payment due date," +
+	"checking:available balance|checks paid|direct deposit|overdraft," +
+	"savings:interest earned|annual percentage yield|savings account," +
+	"investment:market value|holdings|dividends|unrealized gain"
+
+// defaultAccountSections are the phrases of the section headings that open each
+// account of a combined statement.
+const defaultAccountSections = "checking:checking account|checking summary," +
+	"savings:savings account|savings summary|money market account," +
+	"credit:credit card account|credit card summary"
+
 // Load reads configuration from environment variables with defaults
 func Load() (*Config, error) {
 	cfg := &Config{
@@ -64,29 +415,325 @@ func Load() (*Config, error) {
 			Port:         getEnvInt("SERVER_PORT", 3000),
 			ReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
 			WriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 60*time.Second),
+
+			ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+			IdleTimeout:       getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+
+			ShutdownTimeout: getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+
+			Compression:         getEnvBool("SERVER_COMPRESSION", false),
+			CompressionMinBytes: getEnvInt("SERVER_COMPRESSION_MIN_BYTES", 1024),
+
+			ResponseEnvelope: getEnvBool("SERVER_RESPONSE_ENVELOPE", false),
+			PendingAccepted:  getEnvBool("SERVER_PENDING_ACCEPTED", false),
+
+			Pprof: getEnvBool("PPROF_ENABLED", false),
+
+			BasePath:     normalizeBasePath(getEnv("BASE_PATH", "")),
+			ProxyHeaders: getEnvList("TRUSTED_PROXY_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"}),
 		},
 		Kreuzberg: KreuzbergConfig{
-			URL:     getEnv("KREUZBERG_URL", "http://localhost:8080"),
-			Timeout: getEnvDuration("KREUZBERG_TIMEOUT", 60*time.Second),
+			URL:         getEnv("KREUZBERG_URL", "http://localhost:8080"),
+			ExtractPath: "/" + strings.TrimLeft(getEnv("KREUZBERG_EXTRACT_PATH", "/extract"), "/"),
+			Timeout:     getEnvDuration("KREUZBERG_TIMEOUT", 60*time.Second),
+
+			TimeoutRetries: getEnvInt("KREUZBERG_TIMEOUT_RETRIES", 2),
+			RetryDelay:     getEnvDuration("KREUZBERG_RETRY_DELAY", 30*time.Second),
+
+			AuthHeader: getEnv("KREUZBERG_AUTH_HEADER", "Authorization"),
+			AuthToken:  getEnv("KREUZBERG_AUTH_TOKEN", ""),
+
+			MaxResponseMB: getEnvInt("KREUZBERG_MAX_RESPONSE_MB", 64),
+
+			MaxIdleConnsPerHost: getEnvInt("KREUZBERG_MAX_IDLE_CONNS_PER_HOST", 16),
+			MaxConnsPerHost:     getEnvInt("KREUZBERG_MAX_CONNS_PER_HOST", 0),
+			IdleConnTimeout:     getEnvDuration("KREUZBERG_IDLE_CONN_TIMEOUT", 90*time.Second),
+			KeepAlive:           getEnvDuration("KREUZBERG_KEEP_ALIVE", 30*time.Second),
 		},
 		Database: DatabaseConfig{
-			GnuCashPath:  getEnv("GNUCASH_DB_PATH", "./data/finance.gnucash"),
-			MetadataPath: getEnv("METADATA_DB_PATH", "./data/metadata.db"),
+			GnuCashPath:        getEnv("GNUCASH_DB_PATH", "./data/finance.gnucash"),
+			MetadataPath:       getEnv("METADATA_DB_PATH", "./data/metadata.db"),
+			CheckpointInterval: getEnvDuration("METADATA_DB_CHECKPOINT_INTERVAL", 0),
+			ReadConnection:     getEnvBool("METADATA_DB_READ_CONNECTION", false),
+
+			MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 0),
+			MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 2),
+			ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 0),
 		},
 		Upload: UploadConfig{
-			MaxSizeMB:    getEnvInt("UPLOAD_MAX_SIZE_MB", 50),
-			AllowedTypes: []string{"application/pdf", "text/csv", "application/vnd.ms-excel"},
-			TempDir:      getEnv("UPLOAD_TEMP_DIR", "./uploads"),
+			MaxSizeMB:     getEnvInt("UPLOAD_MAX_SIZE_MB", 50),
+			MaxBatchFiles: getEnvInt("UPLOAD_MAX_BATCH_FILES", 10),
+			AllowedTypes:  []string{"application/pdf", "text/csv", "application/vnd.ms-excel"},
+			TempDir:       getEnv("UPLOAD_TEMP_DIR", "./uploads"),
+			KeepOriginals: getEnvBool("UPLOAD_KEEP_ORIGINALS", true),
+			StorageDir:    getEnv("UPLOAD_STORAGE_DIR", "./data/files"),
+			AccountTypes:  getEnvList("UPLOAD_ACCOUNT_TYPES", []string{"checking", "savings", "credit", "investment"}),
+
+			AccountNameMatching: getEnvList("UPLOAD_ACCOUNT_NAME_MATCHING", []string{"case", "space"}),
+
+			StorageBackend: strings.ToLower(getEnv("UPLOAD_STORAGE_BACKEND", "local")),
+			S3: S3Config{
+				Endpoint:        getEnv("S3_ENDPOINT", ""),
+				Region:          getEnv("S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+				Bucket:          getEnv("S3_BUCKET", ""),
+				Prefix:          getEnv("S3_PREFIX", ""),
+				PathStyle:       getEnvBool("S3_PATH_STYLE", false),
+				AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", getEnv("AWS_ACCESS_KEY_ID", "")),
+				SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", getEnv("AWS_SECRET_ACCESS_KEY", "")),
+				SessionToken:    getEnv("S3_SESSION_TOKEN", getEnv("AWS_SESSION_TOKEN", "")),
+				Timeout:         getEnvDuration("S3_TIMEOUT", 60*time.Second),
+			},
+
+			InternalAllowedTypes: getEnvList("UPLOAD_INTERNAL_ALLOWED_TYPES", nil),
+
+			MultipartMemoryMB: getEnvInt("UPLOAD_MULTIPART_MEMORY_MB", 10),
+			MaxFormKB:         getEnvInt("UPLOAD_MAX_FORM_KB", 64),
+
+			MaxConcurrent:           getEnvInt("UPLOAD_MAX_CONCURRENT", 4),
+			MaxConcurrentPerAccount: getEnvInt("UPLOAD_MAX_CONCURRENT_PER_ACCOUNT", 2),
+			PriorityScheduling:      getEnvBool("UPLOAD_PRIORITY_SCHEDULING", false),
+			PriorityMaxWait:         getEnvDuration("UPLOAD_PRIORITY_MAX_WAIT", 5*time.Minute),
+
+			HashAlgorithm: strings.ToLower(getEnv("UPLOAD_HASH_ALGORITHM", "sha256")),
+			HashSalt:      getEnv("UPLOAD_HASH_SALT", ""),
+
+			DuplicateConflict: getEnvBool("UPLOAD_DUPLICATE_CONFLICT", false),
+			PeriodOverlap:     strings.ToLower(getEnv("UPLOAD_PERIOD_OVERLAP", "off")),
+			Stage:             getEnvBool("UPLOAD_STAGE", false),
+			DeterministicIDs:  getEnvBool("UPLOAD_DETERMINISTIC_IDS", false),
+
+			StrictMIME: getEnvBool("UPLOAD_STRICT_MIME", false),
+
+			DetectCharset: getEnvBool("UPLOAD_DETECT_CHARSET", true),
+
+			URLEnabled:      getEnvBool("UPLOAD_URL_ENABLED", false),
+			URLTimeout:      getEnvDuration("UPLOAD_URL_TIMEOUT", 60*time.Second),
+			URLAllowPrivate: getEnvBool("UPLOAD_URL_ALLOW_PRIVATE", false),
+
+			MinFreeMemoryMB:  getEnvInt("UPLOAD_MIN_FREE_MEMORY_MB", 0),
+			MemoryRetryAfter: getEnvDuration("UPLOAD_MEMORY_RETRY_AFTER", 30*time.Second),
+
+			MaxStatementsPerAccount: getEnvInt("UPLOAD_MAX_STATEMENTS_PER_ACCOUNT", 0),
 		},
 		Logging: LoggingConfig{
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
+
+			ExcludePaths: getEnvList("LOG_EXCLUDE_PATHS", []string{"/health", "/metrics"}),
 		},
 		GnuCash: GnuCashConfig{
 			DefaultCurrency:    getEnv("GNUCASH_DEFAULT_CURRENCY", "USD"),
 			AutoCreateAccounts: getEnvBool("GNUCASH_AUTO_CREATE_ACCOUNTS", true),
 		},
+		Retention: RetentionConfig{
+			Days:       getEnvInt("RETENTION_DAYS", 0),
+			HardDelete: getEnvBool("RETENTION_HARD_DELETE", false),
+			DryRun:     getEnvBool("RETENTION_DRY_RUN", false),
+			Interval:   getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+		},
+		Redaction: RedactionConfig{
+			Enabled: getEnvBool("REDACTION_ENABLED", true),
+			Pattern: getEnv("REDACTION_PATTERN", ""),
+			RawData: getEnvBool("REDACTION_RAW_DATA", false),
+		},
+		Audit: AuditConfig{
+			Enabled: getEnvBool("AUDIT_LOG_ENABLED", true),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+			MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+			AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		},
+		Pipeline: PipelineConfig{
+			StoreImages:     getEnvBool("PIPELINE_STORE_IMAGES", true),
+			StoreContent:    getEnvBool("PIPELINE_STORE_CONTENT", false),
+			TableExport:     strings.ToLower(getEnv("PIPELINE_TABLE_EXPORT", "off")),
+			MergeTables:     getEnvBool("PIPELINE_MERGE_TABLES", false),
+			FailOnHookError: getEnvBool("PIPELINE_FAIL_ON_HOOK_ERROR", false),
+			FailOnEmpty:     getEnvBool("PIPELINE_FAIL_ON_EMPTY", false),
+
+			ReconcileToleranceCents: int64(getEnvInt("PIPELINE_RECONCILE_TOLERANCE_CENTS", 1)),
+			ExpectedCountTolerance:  getEnvInt("PIPELINE_EXPECTED_COUNT_TOLERANCE", 0),
+			TableFilter:             getEnv("PIPELINE_TABLE_FILTER", "all"),
+			NormalizeHeaders:        getEnvBool("PIPELINE_NORMALIZE_HEADERS", true),
+			LowercaseHeaders:        getEnvBool("PIPELINE_LOWERCASE_HEADERS", false),
+			HeaderRows:              strings.ToLower(getEnv("PIPELINE_HEADER_ROWS", "first")),
+			CategoryRulesFile:       getEnv("PIPELINE_CATEGORY_RULES_FILE", ""),
+
+			MaxImages: getEnvInt("PIPELINE_MAX_IMAGES", 100),
+			MaxChunks: getEnvInt("PIPELINE_MAX_CHUNKS", 1000),
+
+			ProcessingTimeout:      getEnvDuration("PIPELINE_PROCESSING_TIMEOUT", 10*time.Minute),
+			RetryProcessingTimeout: getEnvBool("PIPELINE_PROCESSING_TIMEOUT_RETRY", false),
+			StatementDate:          strings.ToLower(getEnv("PIPELINE_STATEMENT_DATE", "max")),
+
+			FailedRetries:       getEnvInt("PIPELINE_FAILED_RETRIES", 0),
+			FailedRetryDelay:    getEnvDuration("PIPELINE_FAILED_RETRY_DELAY", time.Minute),
+			FailedRetryMaxDelay: getEnvDuration("PIPELINE_FAILED_RETRY_MAX_DELAY", time.Hour),
+			FailedRetryInterval: getEnvDuration("PIPELINE_FAILED_RETRY_INTERVAL", 30*time.Second),
+
+			MaxTableColumns: getEnvInt("PIPELINE_MAX_TABLE_COLUMNS", 100),
+			MaxHeaderLength: getEnvInt("PIPELINE_MAX_HEADER_LENGTH", 200),
+		},
+	}
+
+	apiKeys, err := parseAPIKeys(getEnv("API_KEYS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	cfg.Auth.APIKeys = apiKeys
+	cfg.Auth.TenantIsolation = getEnvBool("AUTH_TENANT_ISOLATION", false)
+	cfg.Auth.InternalKeys = getEnvList("AUTH_INTERNAL_KEYS", nil)
+
+	synonyms, err := parsePairs(getEnv("UPLOAD_ACCOUNT_TYPE_SYNONYMS",
+		"cc:credit,credit_card:credit,creditcard:credit,chequing:checking,check:checking,brokerage:investment"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: account type synonyms: %w", err)
+	}
+	cfg.Upload.AccountTypeSynonyms = synonyms
+
+	tableFilters, err := parsePairs(getEnv("PIPELINE_TABLE_FILTER_BY_ACCOUNT", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: table filter by account: %w", err)
+	}
+	cfg.Pipeline.TableFiltersByAccount = tableFilters
+
+	for _, account := range getEnvList("PIPELINE_INVERT_DEBIT_CREDIT", nil) {
+		cfg.Pipeline.InvertDebitCredit = append(cfg.Pipeline.InvertDebitCredit, strings.ToLower(account))
+	}
+
+	cfg.Pipeline.FallbackExtractors = getEnvList("PIPELINE_FALLBACK_EXTRACTORS", nil)
+
+	routes, err := parsePairs(getEnv("PIPELINE_EXTRACTION_ROUTES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: extraction routes: %w", err)
+	}
+	cfg.Pipeline.ExtractionRoutes = routes
+
+	cfg.Pipeline.DetectAccountType = getEnvBool("PIPELINE_DETECT_ACCOUNT_TYPE", false)
+	keywords, err := parsePhrases(getEnv("PIPELINE_ACCOUNT_TYPE_KEYWORDS", defaultAccountTypeKeywords))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: account type keywords: %w", err)
 	}
+	cfg.Pipeline.AccountTypeKeywords = keywords
+
+	cfg.Pipeline.SplitAccounts = getEnvBool("PIPELINE_SPLIT_ACCOUNTS", false)
+	sections, err := parsePhrases(getEnv("PIPELINE_ACCOUNT_SECTIONS", defaultAccountSections))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: account sections: %w", err)
+	}
+	cfg.Pipeline.AccountSections = sections
+
+	proxies, err := parsePrefixes(getEnvList("TRUSTED_PROXIES", nil))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: trusted proxies: %w", err)
+	}
+	cfg.Server.TrustedProxies = proxies
+
+	if cfg.Server.Timezone, err = time.LoadLocation(getEnv("APP_TIMEZONE", "UTC")); err != nil {
+		return nil, fmt.Errorf("invalid configuration: app timezone: %w", err)
+	}
+
+	if cfg.Server.OutboundBlocked, err = parsePrefixes(getEnvList("OUTBOUND_BLOCKED_RANGES", nil)); err != nil {
+		return nil, fmt.Errorf("invalid configuration: outbound blocked ranges: %w", err)
+	}
+	if cfg.Server.OutboundAllowed, err = parsePrefixes(getEnvList("OUTBOUND_ALLOWED_RANGES", nil)); err != nil {
+		return nil, fmt.Errorf("invalid configuration: outbound allowed ranges: %w", err)
+	}
+
+	extensionTypes, err := parsePairs(getEnv("UPLOAD_EXTENSION_TYPES",
+		".pdf:application/pdf,.csv:text/csv,.xls:application/vnd.ms-excel"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: upload extension types: %w", err)
+	}
+	cfg.Upload.ExtensionTypes = make(map[string]string, len(extensionTypes))
+	for ext, mimeType := range extensionTypes {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		cfg.Upload.ExtensionTypes[ext] = mimeType
+	}
+
+	sizes, err := parsePairs(getEnv("UPLOAD_MAX_SIZE_MB_BY_TYPE", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: upload max size by type: %w", err)
+	}
+	cfg.Upload.MaxSizeMBByType = make(map[string]int, len(sizes))
+	for mimeType, v := range sizes {
+		mb, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: upload max size for %s: %w", mimeType, err)
+		}
+		cfg.Upload.MaxSizeMBByType[mimeType] = mb
+	}
+
+	statementLimits, err := parsePairs(getEnv("UPLOAD_MAX_STATEMENTS_BY_ACCOUNT", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: upload max statements by account: %w", err)
+	}
+	cfg.Upload.MaxStatementsByAccount = make(map[string]int, len(statementLimits))
+	for account, v := range statementLimits {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: upload max statements for %s: %w", account, err)
+		}
+		cfg.Upload.MaxStatementsByAccount[account] = n
+	}
+
+	sampleRates, err := parsePairs(getEnv("LOG_SAMPLE_RATES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: log sample rates: %w", err)
+	}
+	cfg.Logging.SampleRates = make(map[string]float64, len(sampleRates))
+	for path, v := range sampleRates {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: log sample rate for %s: %w", path, err)
+		}
+		cfg.Logging.SampleRates[path] = rate
+	}
+
+	weights, err := parsePairs(getEnv("UPLOAD_COST_WEIGHTS", "application/pdf:10,application/vnd.ms-excel:2,text/csv:1"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: upload cost weights: %w", err)
+	}
+	cfg.Upload.CostWeights = make(map[string]float64, len(weights))
+	for mimeType, v := range weights {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: upload cost weight for %s: %w", mimeType, err)
+		}
+		cfg.Upload.CostWeights[mimeType] = w
+	}
+
+	timeouts, err := parsePairs(getEnv("KREUZBERG_TIMEOUT_BY_TYPE", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: kreuzberg timeout by type: %w", err)
+	}
+	cfg.Kreuzberg.TimeoutByType = make(map[string]time.Duration, len(timeouts))
+	for mimeType, v := range timeouts {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: kreuzberg timeout for %s: %w", mimeType, err)
+		}
+		cfg.Kreuzberg.TimeoutByType[mimeType] = d
+	}
+	for i, t := range cfg.Upload.AccountTypes {
+		cfg.Upload.AccountTypes[i] = strings.ToLower(t)
+	}
+
+	cfg.Currency = CurrencyConfig{
+		Conversion:   getEnvBool("CURRENCY_CONVERSION", false),
+		Base:         strings.ToUpper(getEnv("CURRENCY_BASE", cfg.GnuCash.DefaultCurrency)),
+		RatesURL:     getEnv("CURRENCY_RATES_URL", ""),
+		RatesTimeout: getEnvDuration("CURRENCY_RATES_TIMEOUT", 10*time.Second),
+		SplitAmounts: getEnvBool("CURRENCY_SPLIT_AMOUNTS", false),
+	}
+	rates, err := parsePairs(getEnv("CURRENCY_RATES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: currency rates: %w", err)
+	}
+	cfg.Currency.Rates = rates
 
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -101,14 +748,315 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
 
+	if c.Server.ReadHeaderTimeout <= 0 {
+		return fmt.Errorf("invalid server read header timeout: %s", c.Server.ReadHeaderTimeout)
+	}
+	if c.Server.IdleTimeout <= 0 {
+		return fmt.Errorf("invalid server idle timeout: %s", c.Server.IdleTimeout)
+	}
+
+	if c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid server shutdown timeout: %s", c.Server.ShutdownTimeout)
+	}
+
+	if c.Server.CompressionMinBytes < 0 {
+		return fmt.Errorf("invalid compression min bytes: %d", c.Server.CompressionMinBytes)
+	}
+
+	if c.Database.MaxOpenConns < 0 {
+		return fmt.Errorf("invalid database max open connections: %d", c.Database.MaxOpenConns)
+	}
+	if c.Database.MaxIdleConns < 0 {
+		return fmt.Errorf("invalid database max idle connections: %d", c.Database.MaxIdleConns)
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		return fmt.Errorf("database max idle connections %d exceeds max open connections %d", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		return fmt.Errorf("invalid database connection max lifetime: %s", c.Database.ConnMaxLifetime)
+	}
+
 	if c.Upload.MaxSizeMB < 1 {
 		return fmt.Errorf("invalid upload max size: %d", c.Upload.MaxSizeMB)
 	}
 
+	if c.Upload.MultipartMemoryMB < 1 {
+		return fmt.Errorf("invalid upload multipart memory: %d", c.Upload.MultipartMemoryMB)
+	}
+
+	if c.Upload.MaxFormKB < 1 {
+		return fmt.Errorf("invalid upload max form size: %d", c.Upload.MaxFormKB)
+	}
+
+	if c.Upload.MaxBatchFiles < 1 {
+		return fmt.Errorf("invalid upload max batch files: %d", c.Upload.MaxBatchFiles)
+	}
+
+	if c.Upload.MinFreeMemoryMB < 0 {
+		return fmt.Errorf("invalid upload minimum free memory: %d", c.Upload.MinFreeMemoryMB)
+	}
+	if c.Upload.MinFreeMemoryMB > 0 && c.Upload.MemoryRetryAfter < time.Second {
+		return fmt.Errorf("invalid upload memory retry after: %s (must be at least 1s)", c.Upload.MemoryRetryAfter)
+	}
+
+	if !slices.Contains(c.Upload.AccountTypes, "*") {
+		for synonym, accountType := range c.Upload.AccountTypeSynonyms {
+			if !slices.Contains(c.Upload.AccountTypes, accountType) {
+				return fmt.Errorf("account type synonym %q maps to %q, which is not an allowed account type", synonym, accountType)
+			}
+		}
+	}
+
+	for _, rule := range c.Upload.AccountNameMatching {
+		if !slices.Contains([]string{"case", "space", "punctuation", "off"}, strings.ToLower(rule)) {
+			return fmt.Errorf("invalid account name matching rule: %q (must be case, space, punctuation or off)", rule)
+		}
+	}
+
+	for mimeType, mb := range c.Upload.MaxSizeMBByType {
+		if !slices.Contains(c.Upload.AllowedTypes, mimeType) {
+			return fmt.Errorf("upload max size override for %q, which is not an allowed type", mimeType)
+		}
+		if mb <= 0 {
+			return fmt.Errorf("invalid upload max size for %s: %d", mimeType, mb)
+		}
+	}
+
+	if c.Upload.MaxStatementsPerAccount < 0 {
+		return fmt.Errorf("invalid upload max statements per account: %d", c.Upload.MaxStatementsPerAccount)
+	}
+	for account, n := range c.Upload.MaxStatementsByAccount {
+		if n < 0 {
+			return fmt.Errorf("invalid upload max statements for %s: %d", account, n)
+		}
+	}
+
+	if c.Pipeline.DetectAccountType && !slices.Contains(c.Upload.AccountTypes, "*") {
+		for accountType := range c.Pipeline.AccountTypeKeywords {
+			if !slices.Contains(c.Upload.AccountTypes, accountType) {
+				return fmt.Errorf("account type keywords for %q, which is not an allowed account type", accountType)
+			}
+		}
+	}
+
+	if c.Pipeline.SplitAccounts && !slices.Contains(c.Upload.AccountTypes, "*") {
+		for accountType := range c.Pipeline.AccountSections {
+			if !slices.Contains(c.Upload.AccountTypes, accountType) {
+				return fmt.Errorf("account sections for %q, which is not an allowed account type", accountType)
+			}
+		}
+	}
+
+	for ext, mimeType := range c.Upload.ExtensionTypes {
+		if !slices.Contains(c.Upload.AllowedTypes, mimeType) && !slices.Contains(c.Upload.InternalAllowedTypes, mimeType) {
+			return fmt.Errorf("upload extension %q maps to %q, which is not an allowed type", ext, mimeType)
+		}
+	}
+
+	for mimeType, route := range c.Pipeline.ExtractionRoutes {
+		if !slices.Contains(c.Upload.AllowedTypes, mimeType) && !slices.Contains(c.Upload.InternalAllowedTypes, mimeType) {
+			return fmt.Errorf("extraction route for %q, which is not an allowed type", mimeType)
+		}
+		if !slices.Contains([]string{"tables", "csv", "text"}, route) {
+			return fmt.Errorf("invalid extraction route for %s: %q (must be tables, csv or text)", mimeType, route)
+		}
+		if route == "csv" && !strings.HasPrefix(mimeType, "text/") {
+			return fmt.Errorf("invalid extraction route for %s: csv needs a text type", mimeType)
+		}
+	}
+
+	for mimeType, d := range c.Kreuzberg.TimeoutByType {
+		if !slices.Contains(c.Upload.AllowedTypes, mimeType) {
+			return fmt.Errorf("kreuzberg timeout override for %q, which is not an allowed type", mimeType)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid kreuzberg timeout for %s: %s", mimeType, d)
+		}
+	}
+
+	if c.Upload.MaxConcurrent < 0 {
+		return fmt.Errorf("invalid upload max concurrent: %d", c.Upload.MaxConcurrent)
+	}
+
+	if c.Upload.MaxConcurrentPerAccount < 0 {
+		return fmt.Errorf("invalid upload max concurrent per account: %d", c.Upload.MaxConcurrentPerAccount)
+	}
+
+	for path, rate := range c.Logging.SampleRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid log sample rate for %s: %g, must be between 0 and 1", path, rate)
+		}
+	}
+
+	for mimeType, w := range c.Upload.CostWeights {
+		if w < 0 {
+			return fmt.Errorf("invalid upload cost weight for %s: %g", mimeType, w)
+		}
+	}
+
+	if c.Upload.PriorityMaxWait < 0 {
+		return fmt.Errorf("invalid upload priority max wait: %s", c.Upload.PriorityMaxWait)
+	}
+
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("invalid CORS max age: %s", c.CORS.MaxAge)
+	}
+
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		return fmt.Errorf("CORS_ALLOW_CREDENTIALS requires explicit CORS_ALLOWED_ORIGINS, not *")
+	}
+
+	if c.Upload.URLTimeout <= 0 {
+		return fmt.Errorf("invalid upload URL timeout: %s", c.Upload.URLTimeout)
+	}
+
+	if c.Upload.HashAlgorithm != "sha256" && c.Upload.HashAlgorithm != "normalized" {
+		return fmt.Errorf("invalid upload hash algorithm: %q (must be sha256 or normalized)", c.Upload.HashAlgorithm)
+	}
+
+	if !slices.Contains([]string{"off", "warn", "block"}, c.Upload.PeriodOverlap) {
+		return fmt.Errorf("invalid upload period overlap mode: %q (must be off, warn or block)", c.Upload.PeriodOverlap)
+	}
+
+	if !slices.Contains([]string{"local", "s3"}, c.Upload.StorageBackend) {
+		return fmt.Errorf("invalid upload storage backend: %q (must be local or s3)", c.Upload.StorageBackend)
+	}
+	if c.Upload.KeepOriginals && c.Upload.StorageBackend == "s3" {
+		if c.Upload.S3.Bucket == "" {
+			return fmt.Errorf("S3_BUCKET is required with the s3 storage backend")
+		}
+		if c.Upload.S3.AccessKeyID == "" || c.Upload.S3.SecretAccessKey == "" {
+			return fmt.Errorf("S3 credentials are required with the s3 storage backend")
+		}
+		if c.Upload.S3.Timeout <= 0 {
+			return fmt.Errorf("invalid S3 timeout: %s", c.Upload.S3.Timeout)
+		}
+	}
+
+	if c.Pipeline.ReconcileToleranceCents < 0 {
+		return fmt.Errorf("invalid reconcile tolerance: %d", c.Pipeline.ReconcileToleranceCents)
+	}
+	if c.Pipeline.ExpectedCountTolerance < 0 {
+		return fmt.Errorf("invalid expected count tolerance: %d", c.Pipeline.ExpectedCountTolerance)
+	}
+
+	if c.Pipeline.MaxImages < 0 {
+		return fmt.Errorf("invalid max images: %d", c.Pipeline.MaxImages)
+	}
+
+	if c.Pipeline.MaxChunks < 0 {
+		return fmt.Errorf("invalid max chunks: %d", c.Pipeline.MaxChunks)
+	}
+
+	if !slices.Contains([]string{"off", "on", "only"}, c.Pipeline.TableExport) {
+		return fmt.Errorf("invalid table export mode: %q (must be off, on or only)", c.Pipeline.TableExport)
+	}
+
+	if !slices.Contains([]string{"off", "first", "any"}, c.Pipeline.HeaderRows) {
+		return fmt.Errorf("invalid header rows mode: %q (must be off, first or any)", c.Pipeline.HeaderRows)
+	}
+
+	if !slices.Contains([]string{"off", "max", "month"}, c.Pipeline.StatementDate) {
+		return fmt.Errorf("invalid statement date strategy: %q (must be off, max or month)", c.Pipeline.StatementDate)
+	}
+
+	if c.Pipeline.ProcessingTimeout < 0 {
+		return fmt.Errorf("invalid processing timeout: %s", c.Pipeline.ProcessingTimeout)
+	}
+
+	if c.Pipeline.FailedRetries < 0 {
+		return fmt.Errorf("invalid failed retries: %d", c.Pipeline.FailedRetries)
+	}
+	if c.Pipeline.FailedRetries > 0 {
+		if c.Pipeline.FailedRetryDelay <= 0 || c.Pipeline.FailedRetryMaxDelay < c.Pipeline.FailedRetryDelay {
+			return fmt.Errorf("invalid failed retry delays: %s up to %s", c.Pipeline.FailedRetryDelay, c.Pipeline.FailedRetryMaxDelay)
+		}
+		if c.Pipeline.FailedRetryInterval <= 0 {
+			return fmt.Errorf("invalid failed retry interval: %s", c.Pipeline.FailedRetryInterval)
+		}
+		// Retries reprocess the stored original.
+		if !c.Upload.KeepOriginals {
+			return fmt.Errorf("failed retries require UPLOAD_KEEP_ORIGINALS")
+		}
+	}
+
+	if c.Pipeline.MaxTableColumns < 0 {
+		return fmt.Errorf("invalid max table columns: %d", c.Pipeline.MaxTableColumns)
+	}
+
+	if c.Pipeline.MaxHeaderLength < 0 {
+		return fmt.Errorf("invalid max header length: %d", c.Pipeline.MaxHeaderLength)
+	}
+
 	if c.Kreuzberg.URL == "" {
 		return fmt.Errorf("kreuzberg URL is required")
 	}
 
+	if c.Kreuzberg.MaxResponseMB < 0 {
+		return fmt.Errorf("invalid kreuzberg max response size: %d MB", c.Kreuzberg.MaxResponseMB)
+	}
+
+	if c.Kreuzberg.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("invalid kreuzberg max idle connections: %d", c.Kreuzberg.MaxIdleConnsPerHost)
+	}
+	if c.Kreuzberg.MaxConnsPerHost < 0 {
+		return fmt.Errorf("invalid kreuzberg max connections: %d", c.Kreuzberg.MaxConnsPerHost)
+	}
+	if c.Kreuzberg.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid kreuzberg idle connection timeout: %s", c.Kreuzberg.IdleConnTimeout)
+	}
+
+	if c.Kreuzberg.TimeoutRetries < 0 {
+		return fmt.Errorf("invalid kreuzberg timeout retries: %d", c.Kreuzberg.TimeoutRetries)
+	}
+
+	if c.Kreuzberg.TimeoutRetries > 0 && c.Kreuzberg.RetryDelay <= 0 {
+		return fmt.Errorf("invalid kreuzberg retry delay: %s", c.Kreuzberg.RetryDelay)
+	}
+
+	if c.Kreuzberg.AuthToken != "" && !headerName.MatchString(c.Kreuzberg.AuthHeader) {
+		return fmt.Errorf("invalid kreuzberg auth header: %q", c.Kreuzberg.AuthHeader)
+	}
+
+	if !currencyCode.MatchString(c.Currency.Base) {
+		return fmt.Errorf("invalid base currency: %q", c.Currency.Base)
+	}
+
+	for key, v := range c.Currency.Rates {
+		if !rateKey.MatchString(key) {
+			return fmt.Errorf("invalid currency rate %q: want CODE or CODE@YYYY-MM-DD", key)
+		}
+		if rate, err := strconv.ParseFloat(v, 64); err != nil || rate <= 0 {
+			return fmt.Errorf("invalid currency rate for %s: %q", key, v)
+		}
+	}
+
+	if c.Auth.TenantIsolation && len(c.Auth.APIKeys) == 0 {
+		return fmt.Errorf("tenant isolation requires API keys")
+	}
+
+	for _, name := range c.Auth.InternalKeys {
+		if !slices.Contains(slices.Collect(maps.Values(c.Auth.APIKeys)), name) {
+			return fmt.Errorf("internal API key %q is not a configured API key name", name)
+		}
+	}
+
+	if c.Retention.Days < 0 {
+		return fmt.Errorf("invalid retention days: %d", c.Retention.Days)
+	}
+
+	if c.Retention.Days > 0 && c.Retention.Interval <= 0 {
+		return fmt.Errorf("invalid retention interval: %s", c.Retention.Interval)
+	}
+
+	if _, err := regexp.Compile(c.Redaction.Pattern); err != nil {
+		return fmt.Errorf("invalid redaction pattern: %w", err)
+	}
+
+	if strings.ContainsAny(c.Server.BasePath, "?#{} ") {
+		return fmt.Errorf("invalid base path: %q", c.Server.BasePath)
+	}
+
 	return nil
 }
 
@@ -130,6 +1078,22 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvList reads a comma-separated list, trimming whitespace and dropping empty entries.
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -139,6 +1103,91 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// normalizeBasePath ensures a non-empty base path has a single leading slash
+// and no trailing slash, so "api/", "/api" and "/api/" are all "/api".
+func normalizeBasePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// parsePairs parses a comma-separated list of "key:value" pairs, lower-casing both.
+func parsePairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(entry, ":")
+		k, v = strings.ToLower(strings.TrimSpace(k)), strings.ToLower(strings.TrimSpace(v))
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid entry %q: expected key:value", entry)
+		}
+		pairs[k] = v
+	}
+	return pairs, nil
+}
+
+// parsePhrases parses "key:phrase|phrase" pairs, as parsePairs, into the
+// lists of phrases for each key with whitespace collapsed.
+func parsePhrases(value string) (map[string][]string, error) {
+	pairs, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+	phrases := make(map[string][]string, len(pairs))
+	for k, list := range pairs {
+		for _, phrase := range strings.Split(list, "|") {
+			if phrase = strings.Join(strings.Fields(phrase), " "); phrase != "" {
+				phrases[k] = append(phrases[k], phrase)
+			}
+		}
+	}
+	return phrases, nil
+}
+
+// parsePrefixes parses CIDR ranges; a bare address is a single-host range.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %q: expected an IP address or CIDR", v)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseAPIKeys parses a comma-separated list of "name:key" pairs.
+func parseAPIKeys(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key entry %q: expected name:key", entry)
+		}
+		if _, exists := keys[key]; exists {
+			return nil, fmt.Errorf("duplicate API key for %q", name)
+		}
+		keys[key] = name
+	}
+	return keys, nil
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
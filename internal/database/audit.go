@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry represents a row in the audit_log table.
+type AuditEntry struct {
+	ID         int64
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    string // JSON object
+	ClientIP   string
+	CreatedAt  time.Time
+}
+
+// AuditFilter narrows ListAuditEntries. Zero fields don't filter.
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	TargetID string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// InsertAuditEntry appends an entry to the audit log. Entries can't be updated
+// or deleted afterwards.
+func (db *DB) InsertAuditEntry(actor, clientIP, action, targetType, targetID, details string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.exec(`
+		INSERT INTO audit_log (actor, client_ip, action, target_type, target_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		actor, clientIP, action, targetType, targetID, details, now,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns audit entries matching f, newest first.
+func (db *DB) ListAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	var where []string
+	var args []any
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.Until.UTC().Format(time.RFC3339))
+	}
+
+	query := `SELECT id, actor, client_ip, action, target_type, target_id, details, created_at FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.reads.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &e.Actor, &e.ClientIP, &e.Action, &e.TargetType, &e.TargetID, &e.Details, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			e.CreatedAt = t
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeleteFilter selects the statements SoftDeleteStatements deletes: those
+// matching every criterion set.
+type DeleteFilter struct {
+	// Owner restricts the deletion to a tenant's statements when non-empty.
+	Owner string
+	IDs   []string
+	// Status matches the processing status exactly.
+	Status string
+	// Account matches the account name as AccountKey does.
+	Account string
+	// From and To bound the upload time, To exclusively; zero for no bound.
+	From, To time.Time
+}
+
+// Empty reports whether f sets no criterion besides the owner, and so would
+// match every statement.
+func (f DeleteFilter) Empty() bool {
+	return len(f.IDs) == 0 && f.Status == "" && f.Account == "" && f.From.IsZero() && f.To.IsZero()
+}
+
+// SoftDeleteStatements soft-deletes every live statement matching f in a
+// single database transaction, as SoftDeleteStatement does one. Statements
+// under legal hold are kept and counted in held. Returns the statements
+// deleted, as they were before.
+func (db *DB) SoftDeleteStatements(f DeleteFilter) (deleted []Statement, held int, err error) {
+	where := `deleted_at = ''`
+	var args []any
+	if f.Owner != "" {
+		where += ` AND owner_id = ?`
+		args = append(args, f.Owner)
+	}
+	if len(f.IDs) > 0 {
+		where += ` AND id IN (?` + strings.Repeat(", ?", len(f.IDs)-1) + `)`
+		for _, id := range f.IDs {
+			args = append(args, id)
+		}
+	}
+	if f.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, f.Status)
+	}
+	if f.Account != "" {
+		where += ` AND lower(trim(account_name)) = ?`
+		args = append(args, AccountKey(f.Account))
+	}
+	if !f.From.IsZero() {
+		where += ` AND upload_time >= ?`
+		args = append(args, f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		where += ` AND upload_time < ?`
+		args = append(args, f.To.UTC().Format(time.RFC3339))
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err = db.inTx(func(tx *sql.Tx) error {
+		deleted, held = nil, 0
+
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM statements WHERE `+where+` AND legal_hold = 1`, args...).Scan(&held); err != nil {
+			return fmt.Errorf("count held statements: %w", err)
+		}
+
+		rows, err := tx.Query(`SELECT `+statementColumns+` FROM statements WHERE `+where+` AND legal_hold = 0 ORDER BY upload_time`, args...)
+		if err != nil {
+			return fmt.Errorf("query statements: %w", err)
+		}
+		for rows.Next() {
+			s, err := scanStatement(rows)
+			if err != nil {
+				_ = rows.Close()
+				return err
+			}
+			deleted = append(deleted, *s)
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("query statements: %w", err)
+		}
+
+		for _, s := range deleted {
+			if err := softDelete(tx, s.ID, now); err != nil {
+				return fmt.Errorf("statement %s: %w", s.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return deleted, held, nil
+}
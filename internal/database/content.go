@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatementContent represents a row in the statement_content table: the text
+// extracted from a statement.
+type StatementContent struct {
+	StatementID string
+	Content     string
+	CreatedAt   time.Time
+}
+
+// ReplaceContent stores the text extracted from a statement, replacing any it
+// already has, and indexes it for search.
+func (db *DB) ReplaceContent(statementID, content string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.exec(`
+		INSERT INTO statement_content (statement_id, content, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (statement_id) DO UPDATE SET content = excluded.content, created_at = excluded.created_at`,
+		statementID, content, now,
+	)
+	if err != nil {
+		return fmt.Errorf("store statement content: %w", err)
+	}
+	return nil
+}
+
+// GetContent returns the text stored for a statement, or nil if none was.
+func (db *DB) GetContent(statementID string) (*StatementContent, error) {
+	c := StatementContent{StatementID: statementID}
+	var createdAt string
+
+	err := db.reads.QueryRow(`SELECT content, created_at FROM statement_content WHERE statement_id = ?`, statementID).
+		Scan(&c.Content, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query statement content: %w", err)
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		c.CreatedAt = parsed
+	}
+	return &c, nil
+}
+
+// ftsQuery turns a search into a full-text query matching content that has
+// every word of it. Each word is quoted, so the search can't use or trip over
+// the full-text query syntax.
+func ftsQuery(search string) string {
+	words := strings.Fields(search)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
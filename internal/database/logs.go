@@ -0,0 +1,147 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLevel is returned for a processing log level other than info, warn
+// or error.
+var ErrInvalidLevel = errors.New("invalid log level")
+
+// Level is the severity of a processing log entry. Each level corresponds to
+// the slog level of the same name, so the processing log and the application
+// log agree on how serious an event is.
+type Level string
+
+// Processing log levels.
+const (
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// ParseLevel parses a processing log level.
+func ParseLevel(s string) (Level, error) {
+	if l := Level(s); l.Valid() {
+		return l, nil
+	}
+	return "", fmt.Errorf("%w %q: must be info, warn or error", ErrInvalidLevel, s)
+}
+
+// Valid reports whether l is one of the processing log levels.
+func (l Level) Valid() bool {
+	return l == LevelInfo || l == LevelWarn || l == LevelError
+}
+
+// Slog returns the slog level corresponding to l.
+func (l Level) Slog() slog.Level {
+	switch l {
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// LogFilter narrows RecentLogs and StatementLogs. Zero fields don't filter.
+type LogFilter struct {
+	Level Level
+	Stage string
+	Since time.Time
+	// After keeps entries with a greater ID, so a poller can fetch only the
+	// entries written since its last request.
+	After int64
+	// Owner restricts entries to a tenant's statements.
+	Owner  string
+	Limit  int
+	Offset int
+}
+
+// recentLogsOrder orders RecentLogs newest first, following the created_at
+// index.
+const recentLogsOrder = "created_at DESC, id DESC"
+
+// RecentLogs returns processing log entries across all statements matching f,
+// newest first.
+func (db *DB) RecentLogs(f LogFilter) ([]LogEntry, error) {
+	where, args := f.conditions()
+	return db.queryLogs(where, args, recentLogsOrder, f)
+}
+
+// StatementLogs returns the processing log entries of a statement matching f,
+// oldest first.
+func (db *DB) StatementLogs(statementID string, f LogFilter) ([]LogEntry, error) {
+	where, args := f.conditions()
+	where = append(where, "statement_id = ?")
+	args = append(args, statementID)
+	return db.queryLogs(where, args, "id", f)
+}
+
+// logsQuery builds a processing log query from conditions and an ordering.
+func logsQuery(where []string, args []any, order string, f LogFilter) (string, []any) {
+	query := `SELECT id, statement_id, level, stage, message, created_at FROM processing_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + order
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+	return query, args
+}
+
+func (f LogFilter) conditions() ([]string, []any) {
+	var where []string
+	var args []any
+	if f.Level != "" {
+		where = append(where, "level = ?")
+		args = append(args, f.Level)
+	}
+	if f.Stage != "" {
+		where = append(where, "stage = ?")
+		args = append(args, f.Stage)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
+	if f.After > 0 {
+		where = append(where, "id > ?")
+		args = append(args, f.After)
+	}
+	if f.Owner != "" {
+		where = append(where, "statement_id IN (SELECT id FROM statements WHERE owner_id = ?)")
+		args = append(args, f.Owner)
+	}
+	return where, args
+}
+
+func (db *DB) queryLogs(where []string, args []any, order string, f LogFilter) ([]LogEntry, error) {
+	query, args := logsQuery(where, args, order, f)
+	rows, err := db.reads.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query processing log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []LogEntry
+	for rows.Next() {
+		var e LogEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &e.StatementID, &e.Level, &e.Stage, &e.Message, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan log entry: %w", err)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			e.CreatedAt = t
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MergeStatements folds secondary into primary: its transactions, raw rows,
+// images and exported tables move to primary, numbered after primary's own
+// rows and tables, its stored content is appended to primary's, and its
+// transaction count is added to primary's. Moved transactions keep the ID of
+// the statement they were extracted from in source_statement_id. secondary is
+// soft-deleted with merged_into set, as are statements previously merged into
+// it, so re-uploads of their files are matched to primary.
+func (db *DB) MergeStatements(primaryID, secondaryID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	return db.inTx(func(tx *sql.Tx) error {
+		var offset int
+		if err := tx.QueryRow(`
+			SELECT COALESCE(MAX(row_index) + 1, 0) FROM (
+				SELECT row_index FROM transactions WHERE statement_id = ?
+				UNION ALL
+				SELECT row_index FROM transactions_raw WHERE statement_id = ?
+			)`, primaryID, primaryID,
+		).Scan(&offset); err != nil {
+			return fmt.Errorf("find last row: %w", err)
+		}
+
+		for _, step := range []struct {
+			query string
+			args  []any
+		}{
+			{`UPDATE transactions
+			  SET statement_id = ?, row_index = row_index + ?,
+			      source_statement_id = CASE WHEN source_statement_id = '' THEN ? ELSE source_statement_id END
+			  WHERE statement_id = ?`, []any{primaryID, offset, secondaryID, secondaryID}},
+			{`UPDATE transactions_raw SET statement_id = ?, row_index = row_index + ? WHERE statement_id = ?`, []any{primaryID, offset, secondaryID}},
+			{`UPDATE statement_images SET statement_id = ? WHERE statement_id = ?`, []any{primaryID, secondaryID}},
+			{`UPDATE statement_tables
+			  SET statement_id = ?,
+			      table_index = table_index + (SELECT COALESCE(MAX(table_index) + 1, 0) FROM statement_tables WHERE statement_id = ?)
+			  WHERE statement_id = ?`, []any{primaryID, primaryID, secondaryID}},
+			{`INSERT INTO statement_content (statement_id, content, created_at)
+			  SELECT ?, content, created_at FROM statement_content WHERE statement_id = ?
+			  ON CONFLICT (statement_id) DO UPDATE SET content = content || char(10) || char(10) || excluded.content`, []any{primaryID, secondaryID}},
+			{`DELETE FROM statement_content WHERE statement_id = ?`, []any{secondaryID}},
+			{`DELETE FROM extraction_results WHERE statement_id = ?`, []any{secondaryID}},
+			{`UPDATE statements
+			  SET transaction_count = transaction_count + (SELECT transaction_count FROM statements WHERE id = ?),
+			      status = CASE WHEN transaction_count + (SELECT transaction_count FROM statements WHERE id = ?) > 0 THEN 'processed' ELSE status END
+			  WHERE id = ?`, []any{secondaryID, secondaryID, primaryID}},
+			{`UPDATE statements SET merged_into = ? WHERE merged_into = ?`, []any{primaryID, secondaryID}},
+			{`UPDATE statements SET merged_into = ?, deleted_at = ? WHERE id = ?`, []any{primaryID, now, secondaryID}},
+		} {
+			if _, err := tx.Exec(step.query, step.args...); err != nil {
+				return fmt.Errorf("merge statements: %w", err)
+			}
+		}
+		return nil
+	})
+}
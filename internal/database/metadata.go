@@ -2,9 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +18,30 @@ import (
 // DB wraps a SQLite connection for the metadata database.
 type DB struct {
 	conn *sql.DB
+	// reads serves list and reporting queries: a separate read-only
+	// connection when OpenReadConnection was called, conn otherwise.
+	reads *sql.DB
+
+	// maintenance is shared by every write and held exclusively by Vacuum, so
+	// a vacuum waits for in-flight writes and holds new ones until it is done.
+	maintenance sync.RWMutex
+
+	pool Pool
+}
+
+// Pool sizes the connection pool of a database connection. Zero MaxOpenConns
+// allows any number of connections, and zero ConnMaxLifetime keeps them open
+// indefinitely.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func (p Pool) apply(conn *sql.DB) {
+	conn.SetMaxOpenConns(p.MaxOpenConns)
+	conn.SetMaxIdleConns(p.MaxIdleConns)
+	conn.SetConnMaxLifetime(p.ConnMaxLifetime)
 }
 
 // Statement represents a row in the statements table.
@@ -21,6 +49,9 @@ type Statement struct {
 	ID               string
 	Filename         string
 	FileHash         string
+	HashAlgorithm    string // algorithm that produced FileHash
+	DuplicateOf      string // original statement of a forced re-upload; empty otherwise
+	OwnerID          string // tenant that uploaded it; empty without tenant isolation
 	FileSize         int64
 	MimeType         string
 	Status           string
@@ -31,6 +62,57 @@ type Statement struct {
 	ErrorMessage     string
 	UploadTime       time.Time
 	ProcessedTime    time.Time
+	DeletedTime      time.Time // zero unless soft-deleted
+	LegalHold        bool
+
+	// Balances printed on the statement, in cents; nil when not provided.
+	OpeningBalanceCents *int64
+	ClosingBalanceCents *int64
+	// Reconciled is nil until the balances have been checked against the transactions.
+	Reconciled       *bool
+	DiscrepancyCents int64
+	NeedsReview      bool
+
+	// ExpectedCount is the number of transactions the upload said the
+	// statement holds; nil when not given. CountMismatch is set when the
+	// parsed count differed from it by more than the tolerance.
+	ExpectedCount *int
+	CountMismatch bool
+
+	// AccountTypeConfidence is set, from 0 to 1, when AccountType was inferred
+	// from the statement's content rather than supplied with the upload.
+	AccountTypeConfidence *float64
+
+	// Currency is the ISO 4217 code of the statement's amounts; empty for
+	// statements uploaded before it was recorded.
+	Currency string
+
+	// StatementDateInferredFrom is how StatementDate was derived when the
+	// upload didn't supply one: max, month or upload_time. Empty otherwise.
+	StatementDateInferredFrom string
+
+	// RetryAttempts counts the automatic retries of a failed statement.
+	// NextRetryAt is when the next is due; zero when none is scheduled.
+	RetryAttempts int
+	NextRetryAt   time.Time
+
+	// SourceCharset is the character encoding of a text statement's original
+	// file, which was transcoded to UTF-8 for extraction; empty otherwise.
+	SourceCharset string
+
+	// MergedInto is the statement this one's transactions were merged into;
+	// such statements are soft-deleted. Empty otherwise.
+	MergedInto string
+
+	// Stage keeps the statement staged once processed, its transactions out
+	// of reports until it's committed.
+	Stage bool
+
+	// ParseStrategy is the parse strategy the statement was uploaded with;
+	// empty for auto.
+	ParseStrategy string
+
+	Tags []string // sorted
 }
 
 // TransactionRaw represents a row in the transactions_raw table.
@@ -38,23 +120,93 @@ type TransactionRaw struct {
 	ID          string
 	StatementID string
 	RowIndex    int
-	Headers     string // JSON array
+	Headers     string // JSON array, normalized
+	RawHeaders  string // JSON array, as extracted
 	RawData     string // JSON array
 	CreatedAt   time.Time
 }
 
+// Transaction represents a row in the transactions table.
+type Transaction struct {
+	ID          string
+	StatementID string
+	RowIndex    int
+	Date        string // YYYY-MM-DD
+	Description string
+	AmountCents int64
+	Category    string
+	Merchant    string
+	Reference   string
+	Type        string
+	Edited      bool // manually corrected; preserved on reprocessing
+	EditedAt    time.Time
+	CreatedAt   time.Time
+
+	// BalanceCents is the running balance after the transaction; nil when unknown.
+	BalanceCents *int64
+	// BalanceDiscrepancyCents is the printed balance minus the computed one.
+	BalanceDiscrepancyCents int64
+
+	// BaseAmountCents is the amount converted to the base currency; nil when
+	// conversion is off or RateMissing is set.
+	BaseAmountCents *int64
+	RateMissing     bool
+	// Currency is the currency printed with the amount; empty for the
+	// statement's.
+	Currency string
+
+	// AccountName and AccountType identify the account a transaction belongs
+	// to on a statement combining several; empty otherwise.
+	AccountName string
+	AccountType string
+
+	// SourceStatementID is the statement the transaction was extracted from,
+	// when it has since been merged into StatementID; empty otherwise.
+	SourceStatementID string
+}
+
+// CategoryRule represents a row in the category_rules table.
+type CategoryRule struct {
+	ID        string
+	Pattern   string
+	Category  string
+	CreatedAt time.Time
+}
+
 // LogEntry represents a row in the processing_log table.
 type LogEntry struct {
 	ID          int64
 	StatementID string
-	Level       string
+	Level       Level
 	Stage       string
 	Message     string
 	CreatedAt   time.Time
 }
 
-// Open creates a connection to the metadata SQLite database and runs migrations.
-func Open(dbPath string) (*DB, error) {
+// Image represents a row in the statement_images table.
+type Image struct {
+	ID          string
+	StatementID string
+	SourceID    string // image ID reported by Kreuzberg
+	MimeType    string
+	Size        int64
+	Content     []byte // only populated by GetImage
+	CreatedAt   time.Time
+}
+
+// statementColumns is the column list scanned by scanStatement.
+const statementColumns = `id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		       account_type, account_name, statement_date, error_message, upload_time, processed_time,
+		       deleted_at, legal_hold,
+		       opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review,
+		       hash_algorithm, duplicate_of, owner_id, account_type_confidence, currency,
+		       statement_date_inferred_from, retry_attempts, next_retry_at, source_charset,
+		       expected_count, count_mismatch, merged_into, stage, parse_strategy,
+		       COALESCE((SELECT GROUP_CONCAT(tag) FROM statement_tags WHERE statement_tags.statement_id = statements.id), '')`
+
+// Open creates a connection to the metadata SQLite database, sized by pool, and
+// runs migrations.
+func Open(dbPath string, pool Pool) (*DB, error) {
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create database directory: %w", err)
@@ -64,23 +216,60 @@ func Open(dbPath string) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
+	pool.apply(conn)
 
 	if err := conn.Ping(); err != nil {
 		_ = conn.Close()
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	if _, err := conn.Exec(schema); err != nil {
+	if err := migrate(conn); err != nil {
 		_ = conn.Close()
 		return nil, fmt.Errorf("run migrations: %w", err)
 	}
 
-	return &DB{conn: conn}, nil
+	return &DB{conn: conn, reads: conn, pool: pool}, nil
+}
+
+// OpenReadConnection opens a second, read-only connection to the database for
+// list and reporting queries, so they don't contend with ingestion writes on
+// the primary connection. Its pool is sized like the primary's.
+func (db *DB) OpenReadConnection(dbPath string) error {
+	reads, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_foreign_keys=ON")
+	if err != nil {
+		return fmt.Errorf("open read connection: %w", err)
+	}
+	db.pool.apply(reads)
+	if err := reads.Ping(); err != nil {
+		_ = reads.Close()
+		return fmt.Errorf("ping read connection: %w", err)
+	}
+	db.reads = reads
+	return nil
 }
 
-// Close closes the database connection.
+// Close checkpoints the write-ahead log into the main database file and closes
+// the connection, so the file on disk is complete and the WAL is reset.
 func (db *DB) Close() error {
-	return db.conn.Close()
+	var readsErr error
+	if db.reads != db.conn {
+		readsErr = db.reads.Close()
+	}
+	checkpointErr := db.Checkpoint()
+	return errors.Join(readsErr, checkpointErr, db.conn.Close())
+}
+
+// Checkpoint copies the write-ahead log into the main database file and
+// truncates the WAL, keeping it from growing without bound.
+func (db *DB) Checkpoint() error {
+	var busy, logFrames, checkpointed int
+	if err := db.conn.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("wal checkpoint: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("wal checkpoint: database busy, %d of %d frames checkpointed", checkpointed, logFrames)
+	}
+	return nil
 }
 
 // Ping checks that the database is reachable.
@@ -88,78 +277,371 @@ func (db *DB) Ping() error {
 	return db.conn.Ping()
 }
 
-// CreateStatement inserts a new statement record and returns its ID.
-func (db *DB) CreateStatement(filename, fileHash string, fileSize int64, mimeType, accountType, accountName, statementDate string) (string, error) {
-	id := uuid.New().String()
+// ErrAccountFull is returned by CreateStatement when the account already holds
+// as many live statements as its limit allows.
+var ErrAccountFull = errors.New("account statement limit reached")
+
+// CreateStatement inserts a new statement record and returns its ID: id, or a
+// random one when empty. duplicateOf is the ID of the statement a forced
+// re-upload duplicates, or empty. ownerID is the tenant uploading it, or empty
+// without tenant isolation. A positive accountLimit refuses the statement with
+// ErrAccountFull when the account already has that many live statements, as
+// CountAccountStatements counts them; the count and insert are one statement,
+// so concurrent uploads can't overshoot it.
+func (db *DB) CreateStatement(id, filename, fileHash, hashAlgorithm string, fileSize int64, mimeType, accountType, accountName, statementDate, duplicateOf, ownerID string, accountLimit int) (string, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	_, err := db.conn.Exec(`
-		INSERT INTO statements (id, filename, file_hash, file_size, mime_type, status, account_type, account_name, statement_date, upload_time)
-		VALUES (?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?)`,
-		id, filename, fileHash, fileSize, mimeType, accountType, accountName, statementDate, now,
+	res, err := db.exec(`
+		INSERT INTO statements (id, filename, file_hash, hash_algorithm, file_size, mime_type, status, account_type, account_name, statement_date, upload_time, duplicate_of, owner_id)
+		SELECT ?, ?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?, ?, ?
+		WHERE ? <= 0 OR (
+			SELECT COUNT(*) FROM statements WHERE lower(trim(account_name)) = ? AND deleted_at = ''
+				AND (? = '' OR owner_id = ?)
+		) < ?`,
+		id, filename, fileHash, hashAlgorithm, fileSize, mimeType, accountType, accountName, statementDate, now, duplicateOf, ownerID,
+		accountLimit, AccountKey(accountName), ownerID, ownerID, accountLimit,
 	)
 	if err != nil {
 		return "", fmt.Errorf("insert statement: %w", err)
 	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("insert statement: %w", err)
+	}
+	if n == 0 {
+		return "", ErrAccountFull
+	}
 
 	return id, nil
 }
 
-// GetStatementByHash returns a statement by its file hash, or nil if not found.
-func (db *DB) GetStatementByHash(fileHash string) (*Statement, error) {
+// GetStatementByHash returns the original statement with a file hash and the
+// algorithm that produced it, or nil if not found. Forced re-uploads and
+// soft-deleted statements are skipped, except those merged into another
+// statement, which the caller follows to it. A live statement is preferred
+// over a merged one. A non-empty ownerID only matches that tenant's statements.
+func (db *DB) GetStatementByHash(ownerID, fileHash, hashAlgorithm string) (*Statement, error) {
 	row := db.conn.QueryRow(`
-		SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
-		       account_type, account_name, statement_date, error_message, upload_time, processed_time
-		FROM statements WHERE file_hash = ?`, fileHash)
+		SELECT `+statementColumns+`
+		FROM statements WHERE file_hash = ? AND hash_algorithm = ? AND duplicate_of = ''
+		AND (deleted_at = '' OR merged_into != '')
+		AND (? = '' OR owner_id = ?)
+		ORDER BY deleted_at = '' DESC LIMIT 1`, fileHash, hashAlgorithm, ownerID, ownerID)
 
 	return scanStatement(row)
 }
 
-// GetStatement returns a statement by its ID, or nil if not found.
+// FileInUse reports whether a statement that isn't soft-deleted still uses the
+// original file with this hash.
+func (db *DB) FileInUse(fileHash string) (bool, error) {
+	var inUse bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM statements WHERE file_hash = ? AND deleted_at = '')`,
+		fileHash,
+	).Scan(&inUse)
+	if err != nil {
+		return false, fmt.Errorf("query file hash: %w", err)
+	}
+	return inUse, nil
+}
+
+// StatementIDTaken reports whether a statement, soft-deleted or not, has the ID.
+func (db *DB) StatementIDTaken(id string) (bool, error) {
+	var taken bool
+	err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM statements WHERE id = ?)`, id).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("query statement id: %w", err)
+	}
+	return taken, nil
+}
+
+// GetStatement returns a statement by its ID, or nil if not found or soft-deleted.
 func (db *DB) GetStatement(id string) (*Statement, error) {
 	row := db.conn.QueryRow(`
-		SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
-		       account_type, account_name, statement_date, error_message, upload_time, processed_time
-		FROM statements WHERE id = ?`, id)
+		SELECT `+statementColumns+`
+		FROM statements WHERE id = ? AND deleted_at = ''`, id)
 
 	return scanStatement(row)
 }
 
 // UpdateStatus sets the status of a statement.
 func (db *DB) UpdateStatus(id, status string) error {
-	_, err := db.conn.Exec(`UPDATE statements SET status = ? WHERE id = ?`, status, id)
+	_, err := db.exec(`UPDATE statements SET status = ? WHERE id = ?`, status, id)
 	return err
 }
 
 // MarkProcessed marks a statement as processed with a transaction count.
 func (db *DB) MarkProcessed(id string, transactionCount int) error {
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := db.conn.Exec(`
-		UPDATE statements SET status = 'processed', transaction_count = ?, processed_time = ? WHERE id = ?`,
+	_, err := db.exec(`
+		UPDATE statements SET status = 'processed', transaction_count = ?, processed_time = ?, error_message = '' WHERE id = ?`,
+		transactionCount, now, id,
+	)
+	return err
+}
+
+// MarkStaged marks a statement as staged with a transaction count: processed,
+// but held out of reports until CommitStatement.
+func (db *DB) MarkStaged(id string, transactionCount int) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.exec(`
+		UPDATE statements SET status = 'staged', transaction_count = ?, processed_time = ?, error_message = '' WHERE id = ?`,
 		transactionCount, now, id,
 	)
 	return err
 }
 
+// CommitStatement promotes a staged statement to processed, reporting false
+// if it isn't staged.
+func (db *DB) CommitStatement(id string) (bool, error) {
+	res, err := db.exec(`UPDATE statements SET status = 'processed' WHERE id = ? AND status = 'staged' AND deleted_at = ''`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkProcessedEmpty marks a statement as processed_empty: extraction succeeded
+// but found no data rows.
+func (db *DB) MarkProcessedEmpty(id string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.exec(`
+		UPDATE statements SET status = 'processed_empty', transaction_count = 0, processed_time = ?, error_message = '' WHERE id = ?`,
+		now, id,
+	)
+	return err
+}
+
 // MarkFailed marks a statement as failed with an error message.
 func (db *DB) MarkFailed(id, errorMessage string) error {
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := db.conn.Exec(`
+	_, err := db.exec(`
 		UPDATE statements SET status = 'failed', error_message = ?, processed_time = ? WHERE id = ?`,
 		errorMessage, now, id,
 	)
 	return err
 }
 
-// InsertTransactionRaw inserts a raw transaction row.
-func (db *DB) InsertTransactionRaw(statementID string, rowIndex int, headers, rawData string) (string, error) {
+// MarkTimedOut marks a statement whose extraction timed out. Unlike MarkFailed
+// it leaves processed_time unset, since the extraction may still be retried.
+func (db *DB) MarkTimedOut(id, errorMessage string) error {
+	_, err := db.exec(`
+		UPDATE statements SET status = 'timed_out', error_message = ? WHERE id = ?`,
+		errorMessage, id,
+	)
+	return err
+}
+
+// SetBalances records the opening and closing balances printed on a statement.
+func (db *DB) SetBalances(id string, openingCents, closingCents int64) error {
+	_, err := db.exec(`
+		UPDATE statements SET opening_balance_cents = ?, closing_balance_cents = ? WHERE id = ?`,
+		openingCents, closingCents, id,
+	)
+	return err
+}
+
+// SetCurrency records the ISO 4217 currency of a statement's amounts.
+func (db *DB) SetCurrency(id, currency string) error {
+	_, err := db.exec(`UPDATE statements SET currency = ? WHERE id = ?`, currency, id)
+	return err
+}
+
+// SetReconciliation records the outcome of reconciling a statement. Statements
+// that don't reconcile, or whose transaction count is off, are flagged for
+// manual review.
+func (db *DB) SetReconciliation(id string, reconciled bool, discrepancyCents int64) error {
+	_, err := db.exec(`
+		UPDATE statements SET reconciled = ?, discrepancy_cents = ?, needs_review = (? OR count_mismatch) WHERE id = ?`,
+		reconciled, discrepancyCents, !reconciled, id,
+	)
+	return err
+}
+
+// SetExpectedCount records the number of transactions an upload said its
+// statement holds.
+func (db *DB) SetExpectedCount(id string, count int) error {
+	_, err := db.exec(`UPDATE statements SET expected_count = ? WHERE id = ?`, count, id)
+	return err
+}
+
+// SetStage marks a statement to be staged once processed.
+func (db *DB) SetStage(id string) error {
+	_, err := db.exec(`UPDATE statements SET stage = 1 WHERE id = ?`, id)
+	return err
+}
+
+// SetParseStrategy records the parse strategy a statement was uploaded with.
+func (db *DB) SetParseStrategy(id, strategy string) error {
+	_, err := db.exec(`UPDATE statements SET parse_strategy = ? WHERE id = ?`, strategy, id)
+	return err
+}
+
+// SetCountMismatch records whether a statement's parsed transaction count
+// missed its expected count. Mismatched statements are flagged for manual
+// review, as are those that still don't reconcile.
+func (db *DB) SetCountMismatch(id string, mismatch bool) error {
+	_, err := db.exec(`
+		UPDATE statements SET count_mismatch = ?, needs_review = (? OR COALESCE(reconciled = 0, 0)) WHERE id = ?`,
+		mismatch, mismatch, id,
+	)
+	return err
+}
+
+// SetLegalHold sets or clears the legal hold flag, which exempts a statement from retention purges.
+func (db *DB) SetLegalHold(id string, hold bool) error {
+	_, err := db.exec(`UPDATE statements SET legal_hold = ? WHERE id = ?`, hold, id)
+	return err
+}
+
+// SetSourceCharset records the character encoding a text statement's original
+// file was decoded from.
+func (db *DB) SetSourceCharset(id, charset string) error {
+	_, err := db.exec(`UPDATE statements SET source_charset = ? WHERE id = ?`, charset, id)
+	return err
+}
+
+// SetInferredStatementDate records a statement date derived from the
+// statement's transactions or upload time, and how it was derived.
+func (db *DB) SetInferredStatementDate(id, date, inferredFrom string) error {
+	_, err := db.exec(`UPDATE statements SET statement_date = ?, statement_date_inferred_from = ? WHERE id = ?`, date, inferredFrom, id)
+	return err
+}
+
+// SetInferredAccountType records an account type detected from a statement's
+// content and the detector's confidence in it.
+func (db *DB) SetInferredAccountType(id, accountType string, confidence float64) error {
+	_, err := db.exec(`UPDATE statements SET account_type = ?, account_type_confidence = ? WHERE id = ?`, accountType, confidence, id)
+	return err
+}
+
+// ListExpiredStatements returns the IDs of live statements uploaded before cutoff
+// that are not under legal hold.
+func (db *DB) ListExpiredStatements(cutoff time.Time) ([]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT id FROM statements
+		WHERE upload_time < ? AND legal_hold = 0 AND deleted_at = ''
+		ORDER BY upload_time`,
+		cutoff.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query expired statements: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan expired statement: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ScheduleRetry sets when a failed statement is next retried automatically.
+func (db *DB) ScheduleRetry(id string, at time.Time) error {
+	_, err := db.exec(`UPDATE statements SET next_retry_at = ? WHERE id = ?`, at.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// ListDueRetries returns the failed statements whose automatic retry is due as
+// of now, longest overdue first.
+func (db *DB) ListDueRetries(now time.Time) ([]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT id FROM statements
+		WHERE status = 'failed' AND deleted_at = '' AND next_retry_at != '' AND next_retry_at <= ?
+		ORDER BY next_retry_at`,
+		now.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query due retries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan due retry: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// StartRetry claims a failed statement with a scheduled retry: it's marked
+// processing, its retry attempts counted and the schedule cleared. ok is false
+// when the statement is no longer waiting for a retry, e.g. because it was
+// deleted in the meantime.
+func (db *DB) StartRetry(id string) (ok bool, err error) {
+	res, err := db.exec(`
+		UPDATE statements
+		SET status = 'processing', error_message = '', retry_attempts = retry_attempts + 1, next_retry_at = ''
+		WHERE id = ? AND status = 'failed' AND deleted_at = '' AND next_retry_at != ''`,
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SoftDeleteStatement marks a statement as deleted and removes its extracted data,
+// keeping only the statement record itself.
+func (db *DB) SoftDeleteStatement(id string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	return db.inTx(func(tx *sql.Tx) error {
+		return softDelete(tx, id, now)
+	})
+}
+
+// softDelete soft-deletes a statement within tx.
+func softDelete(tx *sql.Tx, id, now string) error {
+	for _, query := range []string{
+		`DELETE FROM transactions_raw WHERE statement_id = ?`,
+		`DELETE FROM transactions WHERE statement_id = ?`,
+		`DELETE FROM extraction_results WHERE statement_id = ?`,
+		`DELETE FROM statement_images WHERE statement_id = ?`,
+		`DELETE FROM statement_tables WHERE statement_id = ?`,
+		`DELETE FROM statement_content WHERE statement_id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("delete statement data: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE statements SET deleted_at = ? WHERE id = ?`, now, id); err != nil {
+		return fmt.Errorf("mark statement deleted: %w", err)
+	}
+	return nil
+}
+
+// DeleteStatement permanently removes a statement and, via cascade, all of its data.
+func (db *DB) DeleteStatement(id string) error {
+	_, err := db.exec(`DELETE FROM statements WHERE id = ?`, id)
+	return err
+}
+
+// InsertTransactionRaw inserts a raw transaction row with its normalized and
+// original headers.
+func (db *DB) InsertTransactionRaw(statementID string, rowIndex int, headers, rawHeaders, rawData string) (string, error) {
 	id := uuid.New().String()
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	_, err := db.conn.Exec(`
-		INSERT INTO transactions_raw (id, statement_id, row_index, headers, raw_data, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		id, statementID, rowIndex, headers, rawData, now,
+	_, err := db.exec(`
+		INSERT INTO transactions_raw (id, statement_id, row_index, headers, raw_headers, raw_data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, statementID, rowIndex, headers, rawHeaders, rawData, now,
 	)
 	if err != nil {
 		return "", fmt.Errorf("insert transaction_raw: %w", err)
@@ -168,11 +650,222 @@ func (db *DB) InsertTransactionRaw(statementID string, rowIndex int, headers, ra
 	return id, nil
 }
 
-// InsertLogEntry inserts a processing log entry.
-func (db *DB) InsertLogEntry(statementID, level, stage, message string) error {
+// transactionColumns is the column list scanned by scanTransaction.
+const transactionColumns = `id, statement_id, row_index, date, description, amount_cents, category,
+	balance_cents, balance_discrepancy_cents, base_amount_cents, rate_missing, currency, account_name, account_type,
+	merchant, reference, txn_type, source_statement_id, edited, edited_at, created_at`
+
+// ReplaceTransactions replaces the parsed transactions of a statement in a single
+// database transaction. Manually edited rows are kept: a new transaction for the
+// same row index is dropped, and its row index is reported as a conflict when it
+// differs from the edited values.
+func (db *DB) ReplaceTransactions(statementID string, txns []Transaction) (conflicts []int, err error) {
+	err = db.inTx(func(tx *sql.Tx) error {
+		conflicts = nil
+
+		rows, err := tx.Query(`SELECT `+transactionColumns+` FROM transactions WHERE statement_id = ? AND edited = 1`, statementID)
+		if err != nil {
+			return fmt.Errorf("query edited transactions: %w", err)
+		}
+		edited := make(map[int]Transaction)
+		for rows.Next() {
+			t, err := scanTransaction(rows)
+			if err != nil {
+				_ = rows.Close()
+				return err
+			}
+			edited[t.RowIndex] = *t
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("query edited transactions: %w", err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM transactions WHERE statement_id = ? AND edited = 0`, statementID); err != nil {
+			return fmt.Errorf("delete transactions: %w", err)
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, t := range txns {
+			if e, ok := edited[t.RowIndex]; ok {
+				if e.Date != t.Date || e.Description != t.Description || e.AmountCents != t.AmountCents {
+					conflicts = append(conflicts, t.RowIndex)
+				}
+				continue
+			}
+
+			_, err := tx.Exec(`
+				INSERT INTO transactions (id, statement_id, row_index, date, description, amount_cents, category,
+					balance_cents, balance_discrepancy_cents, base_amount_cents, rate_missing, currency, account_name, account_type,
+					merchant, reference, txn_type, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				uuid.New().String(), statementID, t.RowIndex, t.Date, t.Description, t.AmountCents, t.Category,
+				t.BalanceCents, t.BalanceDiscrepancyCents, t.BaseAmountCents, t.RateMissing, t.Currency, t.AccountName, t.AccountType,
+				t.Merchant, t.Reference, t.Type, now,
+			)
+			if err != nil {
+				return fmt.Errorf("insert transaction row %d: %w", t.RowIndex, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// SumTransactions returns the total amount of a statement's transactions in cents.
+func (db *DB) SumTransactions(statementID string) (int64, error) {
+	var total int64
+	err := db.conn.QueryRow(`
+		SELECT COALESCE(SUM(amount_cents), 0) FROM transactions WHERE statement_id = ?`,
+		statementID,
+	).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("sum transactions: %w", err)
+	}
+	return total, nil
+}
+
+// ListTransactions returns the transactions of a statement in row order.
+func (db *DB) ListTransactions(statementID string) ([]Transaction, error) {
+	rows, err := db.reads.Query(`SELECT `+transactionColumns+` FROM transactions WHERE statement_id = ? ORDER BY row_index`, statementID)
+	if err != nil {
+		return nil, fmt.Errorf("query transactions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var txns []Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, *t)
+	}
+
+	return txns, rows.Err()
+}
+
+// GetTransaction returns a transaction by its ID, or nil if not found.
+func (db *DB) GetTransaction(id string) (*Transaction, error) {
+	return scanTransaction(db.conn.QueryRow(`SELECT `+transactionColumns+` FROM transactions WHERE id = ?`, id))
+}
+
+// UpdateTransaction saves a manual correction and flags the transaction as edited.
+func (db *DB) UpdateTransaction(t *Transaction) error {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	_, err := db.conn.Exec(`
+	_, err := db.exec(`
+		UPDATE transactions
+		SET date = ?, description = ?, amount_cents = ?, category = ?, base_amount_cents = ?, rate_missing = ?,
+			edited = 1, edited_at = ?
+		WHERE id = ?`,
+		t.Date, t.Description, t.AmountCents, t.Category, t.BaseAmountCents, t.RateMissing, now, t.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CategorizeTransactions sets the category of the transactions with the given IDs
+// and, if pattern is non-empty, of every transaction whose description contains
+// pattern (case-insensitively). The update runs in a single statement and marks
+// the rows as edited. A non-empty ownerID limits it to that tenant's statements.
+// Returns the number of transactions updated.
+func (db *DB) CategorizeTransactions(ownerID string, ids []string, pattern, category string) (int64, error) {
+	var conditions []string
+	var args []any
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	args = append(args, category, now)
+
+	if len(ids) > 0 {
+		conditions = append(conditions, "id IN (?"+strings.Repeat(", ?", len(ids)-1)+")")
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if pattern != "" {
+		conditions = append(conditions, `LOWER(description) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(pattern))+"%")
+	}
+	if len(conditions) == 0 {
+		return 0, nil
+	}
+	where := "(" + strings.Join(conditions, " OR ") + ")"
+	if ownerID != "" {
+		where += " AND statement_id IN (SELECT id FROM statements WHERE owner_id = ?)"
+		args = append(args, ownerID)
+	}
+
+	res, err := db.exec(`
+		UPDATE transactions SET category = ?, edited = 1, edited_at = ?
+		WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("categorize transactions: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// InsertCategoryRule stores a categorization rule of a tenant, or a shared one
+// when ownerID is empty, and returns its ID.
+func (db *DB) InsertCategoryRule(ownerID, pattern, category string) (string, error) {
+	id := uuid.New().String()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := db.exec(`
+		INSERT INTO category_rules (id, pattern, category, created_at, owner_id) VALUES (?, ?, ?, ?, ?)`,
+		id, pattern, category, now, ownerID,
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert category_rule: %w", err)
+	}
+
+	return id, nil
+}
+
+// ListCategoryRules returns the categorization rules of a tenant, or the shared
+// ones when ownerID is empty, oldest first.
+func (db *DB) ListCategoryRules(ownerID string) ([]CategoryRule, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, pattern, category, created_at FROM category_rules
+		WHERE owner_id = ? ORDER BY created_at, rowid`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("query category_rules: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var rules []CategoryRule
+	for rows.Next() {
+		var r CategoryRule
+		var createdAt string
+		if err := rows.Scan(&r.ID, &r.Pattern, &r.Category, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan category_rule: %w", err)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			r.CreatedAt = t
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
+
+// InsertLogEntry inserts a processing log entry. It fails with ErrInvalidLevel
+// for an unknown level.
+func (db *DB) InsertLogEntry(statementID string, level Level, stage, message string) error {
+	if !level.Valid() {
+		return fmt.Errorf("%w %q", ErrInvalidLevel, level)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := db.exec(`
 		INSERT INTO processing_log (statement_id, level, stage, message, created_at)
 		VALUES (?, ?, ?, ?, ?)`,
 		statementID, level, stage, message, now,
@@ -180,15 +873,121 @@ func (db *DB) InsertLogEntry(statementID, level, stage, message string) error {
 	return err
 }
 
-func scanStatement(row *sql.Row) (*Statement, error) {
+// InsertExtractionResults stores the full Kreuzberg response (as JSON) for a statement.
+func (db *DB) InsertExtractionResults(statementID, resultsJSON string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := db.exec(`
+		INSERT INTO extraction_results (statement_id, results, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(statement_id) DO UPDATE SET results = excluded.results, created_at = excluded.created_at`,
+		statementID, resultsJSON, now,
+	)
+	if err != nil {
+		return fmt.Errorf("insert extraction_results: %w", err)
+	}
+
+	return nil
+}
+
+// GetExtractionResults returns the stored Kreuzberg response JSON for a statement,
+// or an empty string if none was stored.
+func (db *DB) GetExtractionResults(statementID string) (string, error) {
+	var results string
+	err := db.conn.QueryRow(`SELECT results FROM extraction_results WHERE statement_id = ?`, statementID).Scan(&results)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query extraction_results: %w", err)
+	}
+
+	return results, nil
+}
+
+// InsertImage stores an image extracted from a statement and returns its ID.
+func (db *DB) InsertImage(statementID, sourceID, mimeType string, content []byte) (string, error) {
+	id := uuid.New().String()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := db.exec(`
+		INSERT INTO statement_images (id, statement_id, source_id, mime_type, size, content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, statementID, sourceID, mimeType, len(content), content, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert statement_image: %w", err)
+	}
+
+	return id, nil
+}
+
+// ListImages returns the images stored for a statement, without their content.
+func (db *DB) ListImages(statementID string) ([]Image, error) {
+	rows, err := db.reads.Query(`
+		SELECT id, statement_id, source_id, mime_type, size, created_at
+		FROM statement_images WHERE statement_id = ? ORDER BY created_at, rowid`, statementID)
+	if err != nil {
+		return nil, fmt.Errorf("query statement_images: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var images []Image
+	for rows.Next() {
+		var img Image
+		var createdAt string
+		if err := rows.Scan(&img.ID, &img.StatementID, &img.SourceID, &img.MimeType, &img.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan statement_image: %w", err)
+		}
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			img.CreatedAt = t
+		}
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// GetImage returns a single image of a statement including its content, or nil if not found.
+func (db *DB) GetImage(statementID, imageID string) (*Image, error) {
+	var img Image
+	var createdAt string
+
+	err := db.conn.QueryRow(`
+		SELECT id, statement_id, source_id, mime_type, size, content, created_at
+		FROM statement_images WHERE statement_id = ? AND id = ?`, statementID, imageID,
+	).Scan(&img.ID, &img.StatementID, &img.SourceID, &img.MimeType, &img.Size, &img.Content, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan statement_image: %w", err)
+	}
+
+	if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		img.CreatedAt = t
+	}
+
+	return &img, nil
+}
+
+func scanStatement(row rowScanner) (*Statement, error) {
 	var s Statement
-	var uploadTime, processedTime string
+	var uploadTime, processedTime, deletedTime, nextRetryAt, tags string
+	var opening, closing, expectedCount sql.NullInt64
+	var reconciled sql.NullBool
+	var confidence sql.NullFloat64
 
 	err := row.Scan(
 		&s.ID, &s.Filename, &s.FileHash, &s.FileSize, &s.MimeType,
 		&s.Status, &s.TransactionCount,
 		&s.AccountType, &s.AccountName, &s.StatementDate,
 		&s.ErrorMessage, &uploadTime, &processedTime,
+		&deletedTime, &s.LegalHold,
+		&opening, &closing, &reconciled, &s.DiscrepancyCents, &s.NeedsReview,
+		&s.HashAlgorithm, &s.DuplicateOf, &s.OwnerID, &confidence, &s.Currency,
+		&s.StatementDateInferredFrom, &s.RetryAttempts, &nextRetryAt, &s.SourceCharset,
+		&expectedCount, &s.CountMismatch, &s.MergedInto, &s.Stage, &s.ParseStrategy, &tags,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -203,6 +1002,79 @@ func scanStatement(row *sql.Row) (*Statement, error) {
 	if t, err := time.Parse(time.RFC3339, processedTime); err == nil {
 		s.ProcessedTime = t
 	}
+	if t, err := time.Parse(time.RFC3339, deletedTime); err == nil {
+		s.DeletedTime = t
+	}
+	if t, err := time.Parse(time.RFC3339, nextRetryAt); err == nil {
+		s.NextRetryAt = t
+	}
+	if opening.Valid {
+		s.OpeningBalanceCents = &opening.Int64
+	}
+	if closing.Valid {
+		s.ClosingBalanceCents = &closing.Int64
+	}
+	if reconciled.Valid {
+		s.Reconciled = &reconciled.Bool
+	}
+	if expectedCount.Valid {
+		n := int(expectedCount.Int64)
+		s.ExpectedCount = &n
+	}
+	if confidence.Valid {
+		s.AccountTypeConfidence = &confidence.Float64
+	}
+	if tags != "" {
+		// Tag names can't contain commas, see ValidTagName.
+		s.Tags = strings.Split(tags, ",")
+		slices.Sort(s.Tags)
+	}
 
 	return &s, nil
 }
+
+// escapeLike escapes the LIKE wildcards in s using a backslash.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTransaction scans a transactionColumns row, returning nil if there is none.
+func scanTransaction(row rowScanner) (*Transaction, error) {
+	var t Transaction
+	var editedAt, createdAt string
+	var balance, baseAmount sql.NullInt64
+
+	err := row.Scan(
+		&t.ID, &t.StatementID, &t.RowIndex, &t.Date, &t.Description,
+		&t.AmountCents, &t.Category, &balance, &t.BalanceDiscrepancyCents,
+		&baseAmount, &t.RateMissing, &t.Currency, &t.AccountName, &t.AccountType,
+		&t.Merchant, &t.Reference, &t.Type, &t.SourceStatementID, &t.Edited, &editedAt, &createdAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan transaction: %w", err)
+	}
+
+	if balance.Valid {
+		t.BalanceCents = &balance.Int64
+	}
+	if baseAmount.Valid {
+		t.BaseAmountCents = &baseAmount.Int64
+	}
+
+	if ts, err := time.Parse(time.RFC3339, editedAt); err == nil {
+		t.EditedAt = ts
+	}
+	if ts, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		t.CreatedAt = ts
+	}
+
+	return &t, nil
+}
@@ -1,5 +1,12 @@
 package database
 
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// schema is the base schema. It is applied on every start and must stay idempotent.
 const schema = `
 PRAGMA journal_mode=WAL;
 PRAGMA foreign_keys=ON;
@@ -46,4 +53,543 @@ CREATE TABLE IF NOT EXISTS processing_log (
 );
 
 CREATE INDEX IF NOT EXISTS idx_processing_log_statement_id ON processing_log(statement_id);
+
+CREATE TABLE IF NOT EXISTS extraction_results (
+	statement_id TEXT PRIMARY KEY,
+	results      TEXT NOT NULL,
+	created_at   TEXT NOT NULL,
+	FOREIGN KEY (statement_id) REFERENCES statements(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS statement_images (
+	id           TEXT PRIMARY KEY,
+	statement_id TEXT NOT NULL,
+	source_id    TEXT NOT NULL DEFAULT '',
+	mime_type    TEXT NOT NULL DEFAULT '',
+	size         INTEGER NOT NULL,
+	content      BLOB NOT NULL,
+	created_at   TEXT NOT NULL,
+	FOREIGN KEY (statement_id) REFERENCES statements(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_statement_images_statement_id ON statement_images(statement_id);
 `
+
+// migrations are applied in order on top of the base schema. The number of
+// applied migrations is recorded in SQLite's user_version pragma, so new
+// migrations must only ever be appended.
+var migrations = []string{
+	// 1: soft deletes and legal hold for the retention policy.
+	`ALTER TABLE statements ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+	ALTER TABLE statements ADD COLUMN legal_hold INTEGER NOT NULL DEFAULT 0;`,
+
+	// 2: normalized transactions parsed from raw rows.
+	`CREATE TABLE transactions (
+		id           TEXT PRIMARY KEY,
+		statement_id TEXT NOT NULL,
+		row_index    INTEGER NOT NULL,
+		date         TEXT NOT NULL,
+		description  TEXT NOT NULL DEFAULT '',
+		amount_cents INTEGER NOT NULL,
+		category     TEXT NOT NULL DEFAULT '',
+		edited       INTEGER NOT NULL DEFAULT 0,
+		edited_at    TEXT NOT NULL DEFAULT '',
+		created_at   TEXT NOT NULL,
+		FOREIGN KEY (statement_id) REFERENCES statements(id) ON DELETE CASCADE
+	);
+	CREATE INDEX idx_transactions_statement_id ON transactions(statement_id);`,
+
+	// 3: categorization rules created from bulk categorization.
+	`CREATE TABLE category_rules (
+		id         TEXT PRIMARY KEY,
+		pattern    TEXT NOT NULL,
+		category   TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);`,
+
+	// 4: allow the timed_out status. SQLite can't alter a CHECK constraint, so
+	// the table is rebuilt.
+	`CREATE TABLE statements_new (
+		id              TEXT PRIMARY KEY,
+		filename        TEXT NOT NULL,
+		file_hash       TEXT NOT NULL UNIQUE,
+		file_size       INTEGER NOT NULL,
+		mime_type       TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','processing','processed','failed','timed_out')),
+		transaction_count INTEGER NOT NULL DEFAULT 0,
+		account_type    TEXT NOT NULL DEFAULT '',
+		account_name    TEXT NOT NULL DEFAULT '',
+		statement_date  TEXT NOT NULL DEFAULT '',
+		error_message   TEXT NOT NULL DEFAULT '',
+		upload_time     TEXT NOT NULL,
+		processed_time  TEXT NOT NULL DEFAULT '',
+		deleted_at      TEXT NOT NULL DEFAULT '',
+		legal_hold      INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT INTO statements_new (id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold)
+	SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold
+	FROM statements;
+	DROP TABLE statements;
+	ALTER TABLE statements_new RENAME TO statements;
+	CREATE INDEX idx_statements_file_hash ON statements(file_hash);
+	CREATE INDEX idx_statements_status ON statements(status);`,
+
+	// 5: printed balances and the outcome of reconciling them with the transactions.
+	`ALTER TABLE statements ADD COLUMN opening_balance_cents INTEGER;
+	ALTER TABLE statements ADD COLUMN closing_balance_cents INTEGER;
+	ALTER TABLE statements ADD COLUMN reconciled INTEGER;
+	ALTER TABLE statements ADD COLUMN discrepancy_cents INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE statements ADD COLUMN needs_review INTEGER NOT NULL DEFAULT 0;`,
+
+	// 6: append-only audit log of mutations. The triggers reject any change to
+	// existing entries.
+	`CREATE TABLE audit_log (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor       TEXT NOT NULL,
+		action      TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id   TEXT NOT NULL DEFAULT '',
+		details     TEXT NOT NULL DEFAULT '{}',
+		created_at  TEXT NOT NULL
+	);
+	CREATE INDEX idx_audit_log_target_id ON audit_log(target_id);
+	CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;
+	CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+
+	// 7: per-account header mapping profiles used when parsing transactions.
+	`CREATE TABLE header_profiles (
+		account_name       TEXT PRIMARY KEY,
+		date_header        TEXT NOT NULL DEFAULT '',
+		description_header TEXT NOT NULL DEFAULT '',
+		amount_header      TEXT NOT NULL DEFAULT '',
+		created_at         TEXT NOT NULL,
+		updated_at         TEXT NOT NULL
+	);`,
+
+	// 8: the algorithm that produced each file hash. Existing hashes are SHA256.
+	`ALTER TABLE statements ADD COLUMN hash_algorithm TEXT NOT NULL DEFAULT 'sha256';`,
+
+	// 9: free-form tags grouping statements across accounts.
+	`CREATE TABLE tags (
+		name       TEXT PRIMARY KEY,
+		created_at TEXT NOT NULL
+	);
+	CREATE TABLE statement_tags (
+		statement_id TEXT NOT NULL REFERENCES statements(id) ON DELETE CASCADE,
+		tag          TEXT NOT NULL REFERENCES tags(name) ON DELETE CASCADE,
+		created_at   TEXT NOT NULL,
+		PRIMARY KEY (statement_id, tag)
+	);
+	CREATE INDEX idx_statement_tags_tag ON statement_tags(tag);`,
+
+	// 10: forced re-uploads share their original's file hash and link to it with
+	// duplicate_of. The UNIQUE constraint on file_hash is replaced by a partial
+	// unique index over originals only, which needs a rebuild.
+	`CREATE TABLE statements_new (
+		id              TEXT PRIMARY KEY,
+		filename        TEXT NOT NULL,
+		file_hash       TEXT NOT NULL,
+		file_size       INTEGER NOT NULL,
+		mime_type       TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','processing','processed','failed','timed_out')),
+		transaction_count INTEGER NOT NULL DEFAULT 0,
+		account_type    TEXT NOT NULL DEFAULT '',
+		account_name    TEXT NOT NULL DEFAULT '',
+		statement_date  TEXT NOT NULL DEFAULT '',
+		error_message   TEXT NOT NULL DEFAULT '',
+		upload_time     TEXT NOT NULL,
+		processed_time  TEXT NOT NULL DEFAULT '',
+		deleted_at      TEXT NOT NULL DEFAULT '',
+		legal_hold      INTEGER NOT NULL DEFAULT 0,
+		opening_balance_cents INTEGER,
+		closing_balance_cents INTEGER,
+		reconciled      INTEGER,
+		discrepancy_cents INTEGER NOT NULL DEFAULT 0,
+		needs_review    INTEGER NOT NULL DEFAULT 0,
+		hash_algorithm  TEXT NOT NULL DEFAULT 'sha256',
+		duplicate_of    TEXT NOT NULL DEFAULT ''
+	);
+	INSERT INTO statements_new (id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm)
+	SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm
+	FROM statements;
+	DROP TABLE statements;
+	ALTER TABLE statements_new RENAME TO statements;
+	CREATE INDEX idx_statements_file_hash ON statements(file_hash);
+	CREATE INDEX idx_statements_status ON statements(status);
+	CREATE UNIQUE INDEX idx_statements_original_hash ON statements(file_hash, hash_algorithm) WHERE duplicate_of = '';`,
+
+	// 11: recent processing logs across all statements, for GET /logs.
+	`CREATE INDEX idx_processing_log_created_at ON processing_log(created_at);`,
+
+	// 12: statements by upload time, for listings and retention. Timestamps are
+	// UTC RFC 3339 strings, so they sort lexicographically in time order.
+	`CREATE INDEX idx_statements_upload_time ON statements(upload_time);`,
+
+	// 13: client IP of the request behind each audit entry; empty for background jobs.
+	`ALTER TABLE audit_log ADD COLUMN client_ip TEXT NOT NULL DEFAULT '';`,
+
+	// 14: reviewer notes on statements, kept apart from the processing log.
+	`CREATE TABLE statement_notes (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		statement_id TEXT NOT NULL REFERENCES statements(id) ON DELETE CASCADE,
+		author       TEXT NOT NULL,
+		body         TEXT NOT NULL,
+		created_at   TEXT NOT NULL
+	);
+	CREATE INDEX idx_statement_notes_statement_id ON statement_notes(statement_id);`,
+
+	// 15: processed_empty marks statements whose tables held no data rows. Widening
+	// the status CHECK constraint needs a rebuild.
+	`CREATE TABLE statements_new (
+		id              TEXT PRIMARY KEY,
+		filename        TEXT NOT NULL,
+		file_hash       TEXT NOT NULL,
+		file_size       INTEGER NOT NULL,
+		mime_type       TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','processing','processed','failed','timed_out','processed_empty')),
+		transaction_count INTEGER NOT NULL DEFAULT 0,
+		account_type    TEXT NOT NULL DEFAULT '',
+		account_name    TEXT NOT NULL DEFAULT '',
+		statement_date  TEXT NOT NULL DEFAULT '',
+		error_message   TEXT NOT NULL DEFAULT '',
+		upload_time     TEXT NOT NULL,
+		processed_time  TEXT NOT NULL DEFAULT '',
+		deleted_at      TEXT NOT NULL DEFAULT '',
+		legal_hold      INTEGER NOT NULL DEFAULT 0,
+		opening_balance_cents INTEGER,
+		closing_balance_cents INTEGER,
+		reconciled      INTEGER,
+		discrepancy_cents INTEGER NOT NULL DEFAULT 0,
+		needs_review    INTEGER NOT NULL DEFAULT 0,
+		hash_algorithm  TEXT NOT NULL DEFAULT 'sha256',
+		duplicate_of    TEXT NOT NULL DEFAULT ''
+	);
+	INSERT INTO statements_new (id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm, duplicate_of)
+	SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm, duplicate_of
+	FROM statements;
+	DROP TABLE statements;
+	ALTER TABLE statements_new RENAME TO statements;
+	CREATE INDEX idx_statements_file_hash ON statements(file_hash);
+	CREATE INDEX idx_statements_status ON statements(status);
+	CREATE INDEX idx_statements_upload_time ON statements(upload_time);
+	CREATE UNIQUE INDEX idx_statements_original_hash ON statements(file_hash, hash_algorithm) WHERE duplicate_of = '';`,
+
+	// 16: running balance after each transaction, and how far a printed balance
+	// is from the computed one.
+	`ALTER TABLE transactions ADD COLUMN balance_cents INTEGER;
+	ALTER TABLE transactions ADD COLUMN balance_discrepancy_cents INTEGER NOT NULL DEFAULT 0;`,
+
+	// 17: the tenant owning each statement, category rule and header profile;
+	// empty when tenant isolation is off. Duplicates are detected per tenant, and
+	// header profiles are keyed by tenant and account, which needs a rebuild.
+	`ALTER TABLE statements ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_statements_owner_id ON statements(owner_id);
+	DROP INDEX idx_statements_original_hash;
+	CREATE UNIQUE INDEX idx_statements_original_hash ON statements(owner_id, file_hash, hash_algorithm) WHERE duplicate_of = '';
+	ALTER TABLE category_rules ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+	CREATE TABLE header_profiles_new (
+		owner_id           TEXT NOT NULL DEFAULT '',
+		account_name       TEXT NOT NULL,
+		date_header        TEXT NOT NULL DEFAULT '',
+		description_header TEXT NOT NULL DEFAULT '',
+		amount_header      TEXT NOT NULL DEFAULT '',
+		created_at         TEXT NOT NULL,
+		updated_at         TEXT NOT NULL,
+		PRIMARY KEY (owner_id, account_name)
+	);
+	INSERT INTO header_profiles_new (account_name, date_header, description_header, amount_header, created_at, updated_at)
+	SELECT account_name, date_header, description_header, amount_header, created_at, updated_at FROM header_profiles;
+	DROP TABLE header_profiles;
+	ALTER TABLE header_profiles_new RENAME TO header_profiles;`,
+
+	// 18: how confident the detector was in an account type inferred from the
+	// statement's content; NULL when the uploader supplied it.
+	`ALTER TABLE statements ADD COLUMN account_type_confidence REAL;`,
+
+	// 19: the currency of each statement, and each transaction's amount in the
+	// base currency; NULL base amounts are unconverted, flagged by rate_missing
+	// when no exchange rate was found.
+	`ALTER TABLE statements ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN base_amount_cents INTEGER;
+	ALTER TABLE transactions ADD COLUMN rate_missing INTEGER NOT NULL DEFAULT 0;`,
+
+	// 20: raw rows keep the headers as extracted alongside the normalized ones
+	// in headers. Rows stored before normalization have the same in both.
+	`ALTER TABLE transactions_raw ADD COLUMN raw_headers TEXT NOT NULL DEFAULT '[]';
+	UPDATE transactions_raw SET raw_headers = headers;`,
+
+	// 21: how the statement date was derived when the upload didn't supply
+	// one; empty when it did.
+	`ALTER TABLE statements ADD COLUMN statement_date_inferred_from TEXT NOT NULL DEFAULT '';`,
+
+	// 22: the account each transaction belongs to on a statement combining
+	// several; empty for single-account statements.
+	`ALTER TABLE transactions ADD COLUMN account_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN account_type TEXT NOT NULL DEFAULT '';`,
+
+	// 23: automatic retries of failed statements: how many were made, and when
+	// the next is due; empty when none is scheduled.
+	`ALTER TABLE statements ADD COLUMN retry_attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE statements ADD COLUMN next_retry_at TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_statements_next_retry_at ON statements(next_retry_at) WHERE next_retry_at != '';`,
+
+	// 24: the character encoding text statements were decoded from; empty
+	// for other files and those uploaded before it was recorded.
+	`ALTER TABLE statements ADD COLUMN source_charset TEXT NOT NULL DEFAULT '';`,
+
+	// 25: the merchant, reference and transaction type of statements with
+	// columns for them, and the headers naming those columns in profiles.
+	`ALTER TABLE transactions ADD COLUMN merchant TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN reference TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN txn_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE header_profiles ADD COLUMN merchant_header TEXT NOT NULL DEFAULT '';
+	ALTER TABLE header_profiles ADD COLUMN reference_header TEXT NOT NULL DEFAULT '';
+	ALTER TABLE header_profiles ADD COLUMN type_header TEXT NOT NULL DEFAULT '';`,
+
+	// 26: the transaction count an upload expected, and whether the parsed
+	// count missed it. count_mismatch also keeps needs_review set.
+	`ALTER TABLE statements ADD COLUMN expected_count INTEGER;
+	ALTER TABLE statements ADD COLUMN count_mismatch INTEGER NOT NULL DEFAULT 0;`,
+
+	// 27: the statement a merged statement was folded into, and the statement
+	// each transaction was extracted from once it has moved to another.
+	`ALTER TABLE statements ADD COLUMN merged_into TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN source_statement_id TEXT NOT NULL DEFAULT '';`,
+
+	// 28: extracted tables exported as CSV, numbered across all documents of
+	// a statement's extraction results.
+	`CREATE TABLE statement_tables (
+		statement_id TEXT NOT NULL,
+		table_index  INTEGER NOT NULL,
+		column_count INTEGER NOT NULL,
+		row_count    INTEGER NOT NULL,
+		content      BLOB NOT NULL,
+		created_at   TEXT NOT NULL,
+		PRIMARY KEY (statement_id, table_index),
+		FOREIGN KEY (statement_id) REFERENCES statements(id) ON DELETE CASCADE
+	);`,
+
+	// 29: staged holds the transactions of statements uploaded with stage set
+	// out of reports until they're committed. Widening the status CHECK
+	// constraint needs a rebuild.
+	`CREATE TABLE statements_new (
+		id              TEXT PRIMARY KEY,
+		filename        TEXT NOT NULL,
+		file_hash       TEXT NOT NULL,
+		file_size       INTEGER NOT NULL,
+		mime_type       TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','processing','processed','failed','timed_out','processed_empty','staged')),
+		transaction_count INTEGER NOT NULL DEFAULT 0,
+		account_type    TEXT NOT NULL DEFAULT '',
+		account_name    TEXT NOT NULL DEFAULT '',
+		statement_date  TEXT NOT NULL DEFAULT '',
+		error_message   TEXT NOT NULL DEFAULT '',
+		upload_time     TEXT NOT NULL,
+		processed_time  TEXT NOT NULL DEFAULT '',
+		deleted_at      TEXT NOT NULL DEFAULT '',
+		legal_hold      INTEGER NOT NULL DEFAULT 0,
+		opening_balance_cents INTEGER,
+		closing_balance_cents INTEGER,
+		reconciled      INTEGER,
+		discrepancy_cents INTEGER NOT NULL DEFAULT 0,
+		needs_review    INTEGER NOT NULL DEFAULT 0,
+		hash_algorithm  TEXT NOT NULL DEFAULT 'sha256',
+		duplicate_of    TEXT NOT NULL DEFAULT '',
+		owner_id        TEXT NOT NULL DEFAULT '',
+		account_type_confidence REAL,
+		currency        TEXT NOT NULL DEFAULT '',
+		statement_date_inferred_from TEXT NOT NULL DEFAULT '',
+		retry_attempts  INTEGER NOT NULL DEFAULT 0,
+		next_retry_at   TEXT NOT NULL DEFAULT '',
+		source_charset  TEXT NOT NULL DEFAULT '',
+		expected_count  INTEGER,
+		count_mismatch  INTEGER NOT NULL DEFAULT 0,
+		merged_into     TEXT NOT NULL DEFAULT '',
+		stage           INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT INTO statements_new (id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm, duplicate_of,
+		owner_id, account_type_confidence, currency, statement_date_inferred_from, retry_attempts, next_retry_at,
+		source_charset, expected_count, count_mismatch, merged_into)
+	SELECT id, filename, file_hash, file_size, mime_type, status, transaction_count,
+		account_type, account_name, statement_date, error_message, upload_time, processed_time, deleted_at, legal_hold,
+		opening_balance_cents, closing_balance_cents, reconciled, discrepancy_cents, needs_review, hash_algorithm, duplicate_of,
+		owner_id, account_type_confidence, currency, statement_date_inferred_from, retry_attempts, next_retry_at,
+		source_charset, expected_count, count_mismatch, merged_into
+	FROM statements;
+	DROP TABLE statements;
+	ALTER TABLE statements_new RENAME TO statements;
+	CREATE INDEX idx_statements_file_hash ON statements(file_hash);
+	CREATE INDEX idx_statements_status ON statements(status);
+	CREATE INDEX idx_statements_upload_time ON statements(upload_time);
+	CREATE INDEX idx_statements_owner_id ON statements(owner_id);
+	CREATE UNIQUE INDEX idx_statements_original_hash ON statements(owner_id, file_hash, hash_algorithm) WHERE duplicate_of = '';
+	CREATE INDEX idx_statements_next_retry_at ON statements(next_retry_at) WHERE next_retry_at != '';`,
+
+	// 30: the extracted text of statements, kept when content storage is on,
+	// and a full-text index over it kept in sync by triggers.
+	`CREATE TABLE statement_content (
+		statement_id TEXT PRIMARY KEY,
+		content      TEXT NOT NULL,
+		created_at   TEXT NOT NULL,
+		FOREIGN KEY (statement_id) REFERENCES statements(id) ON DELETE CASCADE
+	);
+	CREATE VIRTUAL TABLE statement_content_fts USING fts4(content='statement_content', content);
+	CREATE TRIGGER statement_content_bu BEFORE UPDATE ON statement_content BEGIN
+		DELETE FROM statement_content_fts WHERE docid = old.rowid;
+	END;
+	CREATE TRIGGER statement_content_bd BEFORE DELETE ON statement_content BEGIN
+		DELETE FROM statement_content_fts WHERE docid = old.rowid;
+	END;
+	CREATE TRIGGER statement_content_au AFTER UPDATE ON statement_content BEGIN
+		INSERT INTO statement_content_fts (docid, content) VALUES (new.rowid, new.content);
+	END;
+	CREATE TRIGGER statement_content_ai AFTER INSERT ON statement_content BEGIN
+		INSERT INTO statement_content_fts (docid, content) VALUES (new.rowid, new.content);
+	END;`,
+
+	// 31: the currency printed with a transaction's amount, when it's split
+	// from the amount; empty for the statement's currency.
+	`ALTER TABLE transactions ADD COLUMN currency TEXT NOT NULL DEFAULT '';`,
+
+	// 32: the parse strategy a statement was uploaded with, when not auto.
+	`ALTER TABLE statements ADD COLUMN parse_strategy TEXT NOT NULL DEFAULT '';`,
+
+	// 33: soft-deleted statements no longer hold their file's hash, so the
+	// file can be uploaded again once its statement is deleted.
+	`DROP INDEX idx_statements_original_hash;
+	CREATE UNIQUE INDEX idx_statements_original_hash ON statements(owner_id, file_hash, hash_algorithm) WHERE duplicate_of = '' AND deleted_at = '';`,
+
+	// 34: tags belong to a tenant, so each tenant has its own names. Existing
+	// tags are kept ownerless and copied to every tenant whose statements
+	// carry them; statement tags take their statement's owner.
+	`CREATE TABLE tags_new (
+		owner_id   TEXT NOT NULL DEFAULT '',
+		name       TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (owner_id, name)
+	);
+	INSERT INTO tags_new (owner_id, name, created_at)
+		SELECT '', name, created_at FROM tags
+		UNION
+		SELECT DISTINCT s.owner_id, t.name, t.created_at
+		FROM tags t
+		JOIN statement_tags st ON st.tag = t.name
+		JOIN statements s ON s.id = st.statement_id;
+	CREATE TABLE statement_tags_new (
+		statement_id TEXT NOT NULL REFERENCES statements(id) ON DELETE CASCADE,
+		owner_id     TEXT NOT NULL DEFAULT '',
+		tag          TEXT NOT NULL,
+		created_at   TEXT NOT NULL,
+		PRIMARY KEY (statement_id, tag),
+		FOREIGN KEY (owner_id, tag) REFERENCES tags(owner_id, name) ON DELETE CASCADE
+	);
+	INSERT INTO statement_tags_new (statement_id, owner_id, tag, created_at)
+		SELECT st.statement_id, s.owner_id, st.tag, st.created_at
+		FROM statement_tags st JOIN statements s ON s.id = st.statement_id;
+	DROP TABLE statement_tags;
+	DROP TABLE tags;
+	ALTER TABLE tags_new RENAME TO tags;
+	ALTER TABLE statement_tags_new RENAME TO statement_tags;
+	CREATE INDEX idx_statement_tags_tag ON statement_tags(owner_id, tag);`,
+}
+
+// migrate applies the base schema and any pending migrations.
+func migrate(conn *sql.DB) error {
+	if _, err := conn.Exec(schema); err != nil {
+		return fmt.Errorf("apply schema: %w", err)
+	}
+
+	var version int
+	if err := conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	if version >= len(migrations) {
+		return nil
+	}
+
+	// Foreign keys must be off while a table is rebuilt, or dropping it would
+	// cascade to its children. The pragma is ignored inside a transaction and is
+	// per connection, so migrations run on a dedicated connection.
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if _, err := c.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return fmt.Errorf("disable foreign keys: %w", err)
+	}
+	defer func() { _, _ = c.ExecContext(ctx, `PRAGMA foreign_keys = ON`) }()
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := c.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+
+		if err := checkForeignKeys(tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA doesn't accept bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// checkForeignKeys reports an error if any foreign key is violated, which
+// can happen when a migration runs with enforcement disabled.
+func checkForeignKeys(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return fmt.Errorf("check foreign keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	if rows.Next() {
+		var table string
+		var rowID sql.NullInt64
+		var parent string
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return fmt.Errorf("check foreign keys: %w", err)
+		}
+		return fmt.Errorf("foreign key violation in %s referencing %s", table, parent)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Note represents a row in the statement_notes table.
+type Note struct {
+	ID          int64
+	StatementID string
+	Author      string
+	Body        string
+	CreatedAt   time.Time
+}
+
+const noteColumns = `id, statement_id, author, body, created_at`
+
+// AddNote appends a note to a statement and returns it.
+func (db *DB) AddNote(statementID, author, body string) (*Note, error) {
+	res, err := db.exec(`
+		INSERT INTO statement_notes (statement_id, author, body, created_at)
+		VALUES (?, ?, ?, ?)`,
+		statementID, author, body, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert note: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("insert note: %w", err)
+	}
+	return db.GetNote(statementID, id)
+}
+
+// GetNote returns a note on a statement, or nil if it doesn't exist.
+func (db *DB) GetNote(statementID string, id int64) (*Note, error) {
+	row := db.conn.QueryRow(`SELECT `+noteColumns+` FROM statement_notes WHERE id = ? AND statement_id = ?`, id, statementID)
+	return scanNote(row)
+}
+
+// ListNotes returns the notes on a statement, oldest first.
+func (db *DB) ListNotes(statementID string) ([]Note, error) {
+	rows, err := db.reads.Query(`
+		SELECT `+noteColumns+` FROM statement_notes
+		WHERE statement_id = ?
+		ORDER BY created_at, id`, statementID)
+	if err != nil {
+		return nil, fmt.Errorf("query notes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var notes []Note
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, *n)
+	}
+
+	return notes, rows.Err()
+}
+
+// DeleteNote removes a note from a statement. It reports false if the
+// statement has no such note.
+func (db *DB) DeleteNote(statementID string, id int64) (bool, error) {
+	res, err := db.exec(`DELETE FROM statement_notes WHERE id = ? AND statement_id = ?`, id, statementID)
+	if err != nil {
+		return false, fmt.Errorf("delete note: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete note: %w", err)
+	}
+	return n > 0, nil
+}
+
+// scanNote scans a noteColumns row, returning nil if there is none.
+func scanNote(row rowScanner) (*Note, error) {
+	var n Note
+	var createdAt string
+	err := row.Scan(&n.ID, &n.StatementID, &n.Author, &n.Body, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan note: %w", err)
+	}
+	if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		n.CreatedAt = t
+	}
+	return &n, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestDB opens a migrated database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "metadata.db"), Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// queryPlan returns the details of the EXPLAIN QUERY PLAN rows for query.
+func queryPlan(t *testing.T, db *DB, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.conn.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestOrderedListsUseIndexes(t *testing.T) {
+	db := openTestDB(t)
+
+	logs := LogFilter{Limit: 50}
+	where, args := logs.conditions()
+	logsQuery, logsArgs := logsQuery(where, args, recentLogsOrder, logs)
+
+	statementsQuery, statementsArgs := StatementFilter{Limit: 50}.query()
+
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+		index string
+	}{
+		{"recent logs", logsQuery, logsArgs, "idx_processing_log_created_at"},
+		{"statements", statementsQuery, statementsArgs, "idx_statements_upload_time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := queryPlan(t, db, tt.query, tt.args...)
+			joined := strings.Join(plan, "\n")
+			if !strings.Contains(joined, "INDEX "+tt.index) {
+				t.Errorf("plan doesn't use %s:\n%s", tt.index, joined)
+			}
+			if strings.Contains(joined, "TEMP B-TREE") {
+				t.Errorf("plan sorts rows instead of following the index:\n%s", joined)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// HeaderProfile represents a row in the header_profiles table. It maps an
+// account's source column headers to the canonical transaction fields.
+type HeaderProfile struct {
+	OwnerID           string // tenant the profile belongs to; empty without tenant isolation
+	AccountName       string // lowercased
+	DateHeader        string
+	DescriptionHeader string
+	AmountHeader      string
+	MerchantHeader    string
+	ReferenceHeader   string
+	TypeHeader        string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+const headerProfileColumns = `owner_id, account_name, date_header, description_header, amount_header,
+	merchant_header, reference_header, type_header, created_at, updated_at`
+
+// ProfileKey normalizes an account name for use as a header profile key.
+func ProfileKey(accountName string) string {
+	return AccountKey(accountName)
+}
+
+// GetHeaderProfile returns a tenant's header profile of an account, or nil if
+// it has none.
+func (db *DB) GetHeaderProfile(ownerID, accountName string) (*HeaderProfile, error) {
+	row := db.conn.QueryRow(`
+		SELECT `+headerProfileColumns+`
+		FROM header_profiles WHERE owner_id = ? AND account_name = ?`,
+		ownerID, ProfileKey(accountName),
+	)
+	return scanHeaderProfile(row)
+}
+
+// ListHeaderProfiles returns a tenant's header profiles ordered by account name.
+func (db *DB) ListHeaderProfiles(ownerID string) ([]HeaderProfile, error) {
+	rows, err := db.reads.Query(`SELECT `+headerProfileColumns+` FROM header_profiles WHERE owner_id = ? ORDER BY account_name`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("query header profiles: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var profiles []HeaderProfile
+	for rows.Next() {
+		p, err := scanHeaderProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *p)
+	}
+	return profiles, rows.Err()
+}
+
+// UpsertHeaderProfile creates or replaces p.OwnerID's header profile of p.AccountName.
+func (db *DB) UpsertHeaderProfile(p HeaderProfile) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.exec(`
+		INSERT INTO header_profiles (owner_id, account_name, date_header, description_header, amount_header,
+			merchant_header, reference_header, type_header, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(owner_id, account_name) DO UPDATE SET
+			date_header = excluded.date_header,
+			description_header = excluded.description_header,
+			amount_header = excluded.amount_header,
+			merchant_header = excluded.merchant_header,
+			reference_header = excluded.reference_header,
+			type_header = excluded.type_header,
+			updated_at = excluded.updated_at`,
+		p.OwnerID, ProfileKey(p.AccountName), p.DateHeader, p.DescriptionHeader, p.AmountHeader,
+		p.MerchantHeader, p.ReferenceHeader, p.TypeHeader, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("upsert header profile: %w", err)
+	}
+	return nil
+}
+
+// DeleteHeaderProfile removes a tenant's header profile of an account. It
+// reports whether there was one.
+func (db *DB) DeleteHeaderProfile(ownerID, accountName string) (bool, error) {
+	res, err := db.exec(`DELETE FROM header_profiles WHERE owner_id = ? AND account_name = ?`, ownerID, ProfileKey(accountName))
+	if err != nil {
+		return false, fmt.Errorf("delete header profile: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ListRawHeaders returns the distinct header rows of a statement's raw
+// transactions, in the order they first appear.
+func (db *DB) ListRawHeaders(statementID string) ([][]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT headers FROM transactions_raw
+		WHERE statement_id = ?
+		GROUP BY headers
+		ORDER BY MIN(row_index)`,
+		statementID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query raw headers: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var headers [][]string
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, fmt.Errorf("scan raw headers: %w", err)
+		}
+		var h []string
+		if err := json.Unmarshal([]byte(encoded), &h); err != nil {
+			return nil, fmt.Errorf("decode raw headers: %w", err)
+		}
+		headers = append(headers, h)
+	}
+	return headers, rows.Err()
+}
+
+func scanHeaderProfile(row rowScanner) (*HeaderProfile, error) {
+	var p HeaderProfile
+	var createdAt, updatedAt string
+
+	err := row.Scan(&p.OwnerID, &p.AccountName, &p.DateHeader, &p.DescriptionHeader, &p.AmountHeader,
+		&p.MerchantHeader, &p.ReferenceHeader, &p.TypeHeader, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan header profile: %w", err)
+	}
+
+	if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		p.CreatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+		p.UpdatedAt = t
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Granularities of the periods category spending is grouped by.
+const (
+	GranularityDay   = "day"
+	GranularityMonth = "month"
+	GranularityYear  = "year"
+)
+
+// periodFormats is the strftime format labelling the periods of each
+// granularity: 2024-01-31, 2024-01 and 2024.
+var periodFormats = map[string]string{
+	GranularityDay:   "%Y-%m-%d",
+	GranularityMonth: "%Y-%m",
+	GranularityYear:  "%Y",
+}
+
+// CategoryPeriodTotal aggregates the transactions of one category in one
+// period. Amounts are in cents; OutflowCents is the magnitude of the money
+// leaving the accounts.
+type CategoryPeriodTotal struct {
+	CategoryTotal
+	Period string
+}
+
+// CategorySpending totals transactions by category and period, for
+// transaction dates between from and to inclusive (YYYY-MM-DD; empty for no
+// bound). Periods are labelled by granularity, e.g. 2024-01 by month, and only
+// those with transactions are returned, ordered by category then period. A
+// non-empty accounts limits the totals to statements of those account names;
+// a non-empty ownerID to that tenant's statements. Staged statements are left
+// out until committed.
+func (db *DB) CategorySpending(ownerID string, accounts []string, from, to, granularity string) ([]CategoryPeriodTotal, error) {
+	format, ok := periodFormats[granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown granularity %q", granularity)
+	}
+
+	query := `
+		SELECT t.category, strftime(?, t.date) AS period,
+		       COALESCE(SUM(CASE WHEN t.amount_cents > 0 THEN t.amount_cents END), 0),
+		       COALESCE(SUM(CASE WHEN t.amount_cents < 0 THEN -t.amount_cents END), 0),
+		       COUNT(*)
+		FROM transactions t
+		JOIN statements s ON s.id = t.statement_id
+		WHERE s.deleted_at = '' AND s.status != 'staged' AND period IS NOT NULL`
+	args := []any{format}
+
+	if len(accounts) > 0 {
+		query += ` AND lower(trim(s.account_name)) IN (?` + strings.Repeat(`, ?`, len(accounts)-1) + `)`
+		for _, a := range accounts {
+			args = append(args, AccountKey(a))
+		}
+	}
+	if ownerID != "" {
+		query += ` AND s.owner_id = ?`
+		args = append(args, ownerID)
+	}
+	if from != "" {
+		query += ` AND t.date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND t.date <= ?`
+		args = append(args, to)
+	}
+	query += ` GROUP BY t.category, period ORDER BY t.category, period`
+
+	rows, err := db.reads.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("category spending: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var totals []CategoryPeriodTotal
+	for rows.Next() {
+		var c CategoryPeriodTotal
+		if err := rows.Scan(&c.Category, &c.Period, &c.InflowCents, &c.OutflowCents, &c.Count); err != nil {
+			return nil, fmt.Errorf("scan category period total: %w", err)
+		}
+		totals = append(totals, c)
+	}
+
+	return totals, rows.Err()
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Writes that fail because another connection holds the database lock are
+// retried a few times with exponential backoff. Other errors, including
+// constraint violations, are returned immediately.
+var (
+	busyRetries = 5
+	busyBackoff = 25 * time.Millisecond
+)
+
+// isBusy reports whether err is a transient SQLITE_BUSY or SQLITE_LOCKED error.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// retryBusy runs fn, running it again while it fails with a busy error.
+func retryBusy(fn func() error) error {
+	backoff := busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) {
+			return err
+		}
+		if attempt == busyRetries {
+			return fmt.Errorf("database busy after %d attempts: %w", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// exec runs a write statement, retrying while the database is busy.
+func (db *DB) exec(query string, args ...any) (sql.Result, error) {
+	db.maintenance.RLock()
+	defer db.maintenance.RUnlock()
+
+	var res sql.Result
+	err := retryBusy(func() error {
+		var err error
+		res, err = db.conn.Exec(query, args...)
+		return err
+	})
+	return res, err
+}
+
+// inTx runs fn in a database transaction and commits it. The whole transaction
+// is retried while the database is busy, so fn must not have side effects
+// outside tx.
+func (db *DB) inTx(fn func(tx *sql.Tx) error) error {
+	db.maintenance.RLock()
+	defer db.maintenance.RUnlock()
+
+	return retryBusy(func() error {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// openBusyTest opens a migrated database that reports SQLITE_BUSY at once
+// rather than waiting on the lock, and a second connection to the same file
+// that can hold its write lock. Retries back off for a millisecond.
+func openBusyTest(t *testing.T) (db *DB, locker *sql.DB) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "metadata.db")
+
+	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_foreign_keys=ON&_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	if err := migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`CREATE TABLE names (name TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+
+	locker, err = sql.Open("sqlite3", path+"?_busy_timeout=0&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = locker.Close() })
+
+	retries, backoff := busyRetries, busyBackoff
+	busyBackoff = time.Millisecond
+	t.Cleanup(func() { busyRetries, busyBackoff = retries, backoff })
+
+	return &DB{conn: conn, reads: conn}, locker
+}
+
+// lock takes the database's write lock from the locker connection until the
+// returned function is called.
+func lock(t *testing.T, locker *sql.DB) (unlock func()) {
+	t.Helper()
+	tx, err := locker.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() { _ = tx.Rollback() }
+}
+
+const insertName = `INSERT INTO names (name) VALUES (?)`
+
+func TestRetryBusyRetriesUntilUnlocked(t *testing.T) {
+	db, locker := openBusyTest(t)
+	busyRetries = 100
+	unlock := lock(t, locker)
+
+	// The first two attempts find the database locked.
+	attempts := 0
+	err := retryBusy(func() error {
+		attempts++
+		if attempts == 3 {
+			unlock()
+		}
+		_, err := db.conn.Exec(insertName, "groceries")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("write took %d attempts, want 3", attempts)
+	}
+}
+
+func TestExecWaitsOutBusyDatabase(t *testing.T) {
+	db, locker := openBusyTest(t)
+	busyRetries = 100
+	unlock := lock(t, locker)
+	time.AfterFunc(20*time.Millisecond, unlock)
+
+	if _, err := db.CreateStatement("", "jan.csv", "hash", "sha256", 10, "text/csv", "checking", "Checking", "", "", "", 0); err != nil {
+		t.Fatalf("create statement while locked: %v", err)
+	}
+}
+
+func TestRetryBusyDoesNotRetryConstraintViolations(t *testing.T) {
+	db, _ := openBusyTest(t)
+	if _, err := db.conn.Exec(insertName, "groceries"); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err := retryBusy(func() error {
+		attempts++
+		_, err := db.conn.Exec(insertName, "groceries")
+		return err
+	})
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		t.Fatalf("got error %v, want a constraint violation", err)
+	}
+	if attempts != 1 {
+		t.Errorf("constraint violation attempted %d times, want 1", attempts)
+	}
+}
+
+func TestRetryBusyGivesUpAfterCap(t *testing.T) {
+	db, locker := openBusyTest(t)
+	busyRetries = 3
+	defer lock(t, locker)()
+
+	attempts := 0
+	err := retryBusy(func() error {
+		attempts++
+		_, err := db.conn.Exec(insertName, "groceries")
+		return err
+	})
+	if !isBusy(err) {
+		t.Fatalf("got error %v, want a busy error", err)
+	}
+	if attempts != busyRetries+1 {
+		t.Errorf("write attempted %d times, want %d", attempts, busyRetries+1)
+	}
+}
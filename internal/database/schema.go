@@ -0,0 +1,47 @@
+package database
+
+import "fmt"
+
+// SchemaStatus reports how far the metadata database has been migrated.
+type SchemaStatus struct {
+	// Version is the number of migrations applied to the database; Latest is
+	// the number this build knows. A Version above Latest means a newer
+	// build has migrated the database.
+	Version int
+	Latest  int
+}
+
+// Pending lists the numbers of the migrations not yet applied.
+func (s SchemaStatus) Pending() []int {
+	pending := []int{}
+	for n := s.Version + 1; n <= s.Latest; n++ {
+		pending = append(pending, n)
+	}
+	return pending
+}
+
+// SchemaStatus reads the schema version of the database.
+func (db *DB) SchemaStatus() (SchemaStatus, error) {
+	status := SchemaStatus{Latest: len(migrations)}
+	if err := db.conn.QueryRow(`PRAGMA user_version`).Scan(&status.Version); err != nil {
+		return status, fmt.Errorf("read schema version: %w", err)
+	}
+	return status, nil
+}
+
+// Migrate applies any pending migrations, as opening the database does, and
+// returns the numbers of those applied; none when the schema is up to date.
+// Writes through this DB are held until it finishes.
+func (db *DB) Migrate() ([]int, error) {
+	db.maintenance.Lock()
+	defer db.maintenance.Unlock()
+
+	before, err := db.SchemaStatus()
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db.conn); err != nil {
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+	return before.Pending(), nil
+}
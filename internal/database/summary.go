@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CategoryTotal aggregates an account's transactions in one category. Amounts
+// are in cents; OutflowCents is the magnitude of the money leaving the account.
+type CategoryTotal struct {
+	Category     string
+	InflowCents  int64
+	OutflowCents int64
+	Count        int
+}
+
+// AccountKey normalizes an account name for matching statements to an account.
+func AccountKey(accountName string) string {
+	return strings.ToLower(strings.TrimSpace(accountName))
+}
+
+// HasAccount reports whether any statement that isn't soft-deleted was uploaded
+// under the account name. A non-empty ownerID only considers that tenant's
+// statements.
+func (db *DB) HasAccount(ownerID, accountName string) (bool, error) {
+	var exists bool
+	err := db.reads.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM statements WHERE lower(trim(account_name)) = ? AND deleted_at = ''
+			AND (? = '' OR owner_id = ?))`,
+		AccountKey(accountName), ownerID, ownerID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query account: %w", err)
+	}
+	return exists, nil
+}
+
+// AccountNames returns the account names statements that aren't soft-deleted
+// were uploaded under, each spelling once, in the order they were first
+// used. A non-empty ownerID only considers that tenant's statements.
+func (db *DB) AccountNames(ownerID string) ([]string, error) {
+	rows, err := db.reads.Query(`
+		SELECT account_name FROM statements
+		WHERE account_name != '' AND deleted_at = '' AND (? = '' OR owner_id = ?)
+		GROUP BY account_name
+		ORDER BY MIN(upload_time), MIN(rowid)`,
+		ownerID, ownerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query account names: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan account name: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// CountAccountStatements counts the statements that aren't soft-deleted
+// uploaded under the account name. A non-empty ownerID only counts that
+// tenant's statements.
+func (db *DB) CountAccountStatements(ownerID, accountName string) (int, error) {
+	var n int
+	err := db.reads.QueryRow(`
+		SELECT COUNT(*) FROM statements WHERE lower(trim(account_name)) = ? AND deleted_at = ''
+			AND (? = '' OR owner_id = ?)`,
+		AccountKey(accountName), ownerID, ownerID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count account statements: %w", err)
+	}
+	return n, nil
+}
+
+// AccountPeriod returns the range of transaction dates across the statements
+// of an account that aren't soft-deleted (YYYY-MM-DD), or empty strings when
+// they have no transactions. A non-empty ownerID only considers that tenant's
+// statements.
+func (db *DB) AccountPeriod(ownerID, accountName string) (from, to string, err error) {
+	err = db.reads.QueryRow(`
+		SELECT COALESCE(MIN(t.date), ''), COALESCE(MAX(t.date), '')
+		FROM statements s JOIN transactions t ON t.statement_id = s.id
+		WHERE lower(trim(s.account_name)) = ? AND s.deleted_at = ''
+			AND (? = '' OR s.owner_id = ?)`,
+		AccountKey(accountName), ownerID, ownerID,
+	).Scan(&from, &to)
+	if err != nil {
+		return "", "", fmt.Errorf("query account period: %w", err)
+	}
+	return from, to, nil
+}
+
+// StatementPeriod is the range of transaction dates of a statement.
+type StatementPeriod struct {
+	StatementID string
+	From        string // YYYY-MM-DD
+	To          string
+}
+
+// OverlappingStatements returns the statements of an account, other than
+// excludeID, with transaction dates overlapping from..to (YYYY-MM-DD,
+// inclusive), earliest first. Soft-deleted statements are left out, and a
+// non-empty ownerID only considers that tenant's statements.
+func (db *DB) OverlappingStatements(ownerID, accountName, from, to, excludeID string) ([]StatementPeriod, error) {
+	rows, err := db.reads.Query(`
+		SELECT s.id, MIN(t.date), MAX(t.date)
+		FROM statements s JOIN transactions t ON t.statement_id = s.id
+		WHERE lower(trim(s.account_name)) = ? AND s.deleted_at = '' AND s.id != ?
+			AND (? = '' OR s.owner_id = ?)
+		GROUP BY s.id
+		HAVING MIN(t.date) <= ? AND MAX(t.date) >= ?
+		ORDER BY MIN(t.date), s.id`,
+		AccountKey(accountName), excludeID, ownerID, ownerID, to, from,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query overlapping statements: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var periods []StatementPeriod
+	for rows.Next() {
+		var p StatementPeriod
+		if err := rows.Scan(&p.StatementID, &p.From, &p.To); err != nil {
+			return nil, fmt.Errorf("scan statement period: %w", err)
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+// SummarizeAccount totals the transactions of an account's statements by
+// category, for transaction dates between from and to inclusive (YYYY-MM-DD;
+// empty for no bound). Categories are returned in name order, uncategorized
+// transactions under "". Staged statements are left out until committed. A
+// non-empty ownerID only totals that tenant's statements.
+func (db *DB) SummarizeAccount(ownerID, accountName, from, to string) ([]CategoryTotal, error) {
+	query := `
+		SELECT t.category,
+		       COALESCE(SUM(CASE WHEN t.amount_cents > 0 THEN t.amount_cents END), 0),
+		       COALESCE(SUM(CASE WHEN t.amount_cents < 0 THEN -t.amount_cents END), 0),
+		       COUNT(*)
+		FROM transactions t
+		JOIN statements s ON s.id = t.statement_id
+		WHERE lower(trim(s.account_name)) = ? AND s.deleted_at = '' AND s.status != 'staged'`
+	args := []any{AccountKey(accountName)}
+
+	if ownerID != "" {
+		query += ` AND s.owner_id = ?`
+		args = append(args, ownerID)
+	}
+
+	if from != "" {
+		query += ` AND t.date >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND t.date <= ?`
+		args = append(args, to)
+	}
+	query += ` GROUP BY t.category ORDER BY t.category`
+
+	rows, err := db.reads.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("summarize account: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var totals []CategoryTotal
+	for rows.Next() {
+		var c CategoryTotal
+		if err := rows.Scan(&c.Category, &c.InflowCents, &c.OutflowCents, &c.Count); err != nil {
+			return nil, fmt.Errorf("scan category total: %w", err)
+		}
+		totals = append(totals, c)
+	}
+
+	return totals, rows.Err()
+}
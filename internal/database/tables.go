@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TableExport represents a row in the statement_tables table: an extracted
+// table kept as CSV.
+type TableExport struct {
+	StatementID string
+	// Index numbers the tables of a statement across all documents of its
+	// extraction results, from zero.
+	Index     int
+	Columns   int
+	Rows      int // data rows, not counting the header
+	Size      int64
+	Content   []byte // only populated by GetTableExport
+	CreatedAt time.Time
+}
+
+// ReplaceTableExports stores the tables exported from a statement, replacing
+// any it already has.
+func (db *DB) ReplaceTableExports(statementID string, tables []TableExport) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	return db.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM statement_tables WHERE statement_id = ?`, statementID); err != nil {
+			return fmt.Errorf("delete statement_tables: %w", err)
+		}
+		for _, t := range tables {
+			if _, err := tx.Exec(`
+				INSERT INTO statement_tables (statement_id, table_index, column_count, row_count, content, created_at)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				statementID, t.Index, t.Columns, t.Rows, t.Content, now,
+			); err != nil {
+				return fmt.Errorf("insert statement_table: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListTableExports returns the tables exported from a statement in index
+// order, without their content.
+func (db *DB) ListTableExports(statementID string) ([]TableExport, error) {
+	rows, err := db.reads.Query(`
+		SELECT statement_id, table_index, column_count, row_count, length(content), created_at
+		FROM statement_tables WHERE statement_id = ? ORDER BY table_index`, statementID)
+	if err != nil {
+		return nil, fmt.Errorf("query statement_tables: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tables []TableExport
+	for rows.Next() {
+		var t TableExport
+		var createdAt string
+		if err := rows.Scan(&t.StatementID, &t.Index, &t.Columns, &t.Rows, &t.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan statement_table: %w", err)
+		}
+		if parsed, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			t.CreatedAt = parsed
+		}
+		tables = append(tables, t)
+	}
+
+	return tables, rows.Err()
+}
+
+// GetTableExport returns a table exported from a statement including its
+// content, or nil if not found.
+func (db *DB) GetTableExport(statementID string, index int) (*TableExport, error) {
+	var t TableExport
+	var createdAt string
+
+	err := db.reads.QueryRow(`
+		SELECT statement_id, table_index, column_count, row_count, length(content), content, created_at
+		FROM statement_tables WHERE statement_id = ? AND table_index = ?`, statementID, index,
+	).Scan(&t.StatementID, &t.Index, &t.Columns, &t.Rows, &t.Size, &t.Content, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan statement_table: %w", err)
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		t.CreatedAt = parsed
+	}
+
+	return &t, nil
+}
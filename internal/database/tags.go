@@ -0,0 +1,227 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Tag represents a row in the tags table.
+type Tag struct {
+	OwnerID        string // tenant that created it; empty without tenant isolation
+	Name           string
+	StatementCount int
+	CreatedAt      time.Time
+}
+
+var tagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,63}$`)
+
+// NormalizeTagName lowercases and trims a tag name.
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ValidTagName reports whether a normalized tag name is acceptable: up to 64
+// lowercase letters, digits, '.', '_', ':' and '-', starting with a letter or digit.
+func ValidTagName(name string) bool {
+	return tagNamePattern.MatchString(name)
+}
+
+// CreateTag inserts a tenant's tag. It reports false if the tenant already
+// has the tag.
+func (db *DB) CreateTag(ownerID, name string) (bool, error) {
+	res, err := db.exec(`
+		INSERT INTO tags (owner_id, name, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (owner_id, name) DO NOTHING`,
+		ownerID, NormalizeTagName(name), time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert tag: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("insert tag: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetTag returns a tenant's tag by name, or nil if it doesn't exist.
+func (db *DB) GetTag(ownerID, name string) (*Tag, error) {
+	tags, err := db.listTags(ownerID, `AND t.name = ?`, NormalizeTagName(name))
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	return &tags[0], nil
+}
+
+// ListTags returns a tenant's tags in name order with the number of live
+// statements carrying each.
+func (db *DB) ListTags(ownerID string) ([]Tag, error) {
+	return db.listTags(ownerID, "")
+}
+
+func (db *DB) listTags(ownerID, where string, args ...any) ([]Tag, error) {
+	rows, err := db.reads.Query(`
+		SELECT t.owner_id, t.name, t.created_at, COUNT(s.id)
+		FROM tags t
+		LEFT JOIN statement_tags st ON st.owner_id = t.owner_id AND st.tag = t.name
+		LEFT JOIN statements s ON s.id = st.statement_id AND s.deleted_at = ''
+		WHERE t.owner_id = ? `+where+`
+		GROUP BY t.owner_id, t.name
+		ORDER BY t.name`, append([]any{ownerID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tags []Tag
+	for rows.Next() {
+		var t Tag
+		var createdAt string
+		if err := rows.Scan(&t.OwnerID, &t.Name, &createdAt, &t.StatementCount); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		if ts, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			t.CreatedAt = ts
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// TagStatement attaches a tenant's existing tag to a statement. Attaching a
+// tag twice is a no-op.
+func (db *DB) TagStatement(ownerID, statementID, tag string) error {
+	_, err := db.exec(`
+		INSERT INTO statement_tags (statement_id, owner_id, tag, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (statement_id, tag) DO NOTHING`,
+		statementID, ownerID, NormalizeTagName(tag), time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("tag statement: %w", err)
+	}
+	return nil
+}
+
+// UntagStatement detaches a tag from a statement. It reports false if the
+// statement didn't have the tag.
+func (db *DB) UntagStatement(statementID, tag string) (bool, error) {
+	res, err := db.exec(`DELETE FROM statement_tags WHERE statement_id = ? AND tag = ?`, statementID, NormalizeTagName(tag))
+	if err != nil {
+		return false, fmt.Errorf("untag statement: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("untag statement: %w", err)
+	}
+	return n > 0, nil
+}
+
+// StatementFilter selects statements for ListStatements.
+type StatementFilter struct {
+	// Tags restricts the list to statements carrying all of Owner's tags of
+	// these names, or any of them when AnyTag is set.
+	Tags   []string
+	AnyTag bool
+	// Owner restricts the list to a tenant's statements when non-empty.
+	Owner string
+	// Account restricts the list to the statements of an account name,
+	// matched as AccountKey does, when non-empty.
+	Account string
+	// Search restricts the list to statements whose stored content has
+	// every word of it, matched by the full-text index, when non-empty.
+	Search string
+	Limit  int
+	Offset int
+}
+
+// ListStatements returns live statements matching f, most recently uploaded first.
+func (db *DB) ListStatements(f StatementFilter) ([]Statement, error) {
+	var statements []Statement
+	err := db.EachStatement(f, func(s *Statement) error {
+		statements = append(statements, *s)
+		return nil
+	})
+	return statements, err
+}
+
+// EachStatement calls fn for each live statement matching f, most recently
+// uploaded first, as they are read from the database rather than loading them
+// all first. An error from fn stops the iteration and is returned.
+func (db *DB) EachStatement(f StatementFilter, fn func(*Statement) error) error {
+	query, args := f.query()
+	rows, err := db.reads.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("query statements: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		s, err := scanStatement(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// query builds the statement list query for f.
+func (f StatementFilter) query() (string, []any) {
+	query := `SELECT ` + statementColumns + ` FROM statements WHERE deleted_at = ''`
+	var args []any
+
+	if f.Owner != "" {
+		query += ` AND owner_id = ?`
+		args = append(args, f.Owner)
+	}
+	if f.Account != "" {
+		query += ` AND lower(trim(account_name)) = ?`
+		args = append(args, AccountKey(f.Account))
+	}
+
+	if search := ftsQuery(f.Search); search != "" {
+		query += ` AND id IN (SELECT c.statement_id FROM statement_content c
+			JOIN statement_content_fts f ON f.docid = c.rowid WHERE statement_content_fts MATCH ?)`
+		args = append(args, search)
+	}
+
+	var tags []string
+	for _, tag := range f.Tags {
+		tags = append(tags, NormalizeTagName(tag))
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+
+	if len(tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+		sub := `SELECT statement_id FROM statement_tags WHERE owner_id = ? AND tag IN (` + placeholders + `)`
+		args = append(args, f.Owner)
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		if !f.AnyTag {
+			sub += ` GROUP BY statement_id HAVING COUNT(*) = ?`
+			args = append(args, len(tags))
+		}
+		query += ` AND id IN (` + sub + `)`
+	}
+
+	query += ` ORDER BY upload_time DESC, rowid DESC`
+	if f.Limit > 0 || f.Offset > 0 {
+		// SQLite takes an offset only after a limit; -1 means none.
+		limit := f.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, f.Offset)
+	}
+	return query, args
+}
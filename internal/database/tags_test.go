@@ -0,0 +1,68 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTagsPerTenant(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, owner := range []string{"alice", "bob"} {
+		created, err := db.CreateTag(owner, "Taxes")
+		if err != nil || !created {
+			t.Fatalf("CreateTag(%q) = %v, %v; want created", owner, created, err)
+		}
+	}
+	if created, err := db.CreateTag("alice", "taxes"); err != nil || created {
+		t.Errorf("creating alice's tag again = %v, %v; want not created", created, err)
+	}
+	if _, err := db.CreateTag("bob", "receipts"); err != nil {
+		t.Fatal(err)
+	}
+
+	alices, err := db.CreateStatement("", "a.csv", "hash-a", "sha256", 100, "text/csv", "checking", "Checking", "", "", "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobs, err := db.CreateStatement("", "b.csv", "hash-b", "sha256", 100, "text/csv", "checking", "Checking", "", "", "bob", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TagStatement("alice", alices, "taxes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TagStatement("bob", bobs, "taxes"); err != nil {
+		t.Fatal(err)
+	}
+	// A tenant can't attach a tag it doesn't have.
+	if err := db.TagStatement("alice", alices, "receipts"); err == nil {
+		t.Error("attached another tenant's tag")
+	}
+
+	tags, err := db.ListTags("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "taxes" || tags[0].OwnerID != "alice" || tags[0].StatementCount != 1 {
+		t.Errorf("alice's tags = %+v, want taxes on one statement", tags)
+	}
+	if tag, err := db.GetTag("alice", "receipts"); err != nil || tag != nil {
+		t.Errorf("GetTag found another tenant's tag: %+v, %v", tag, err)
+	}
+	if tags, err := db.ListTags(""); err != nil || len(tags) != 0 {
+		t.Errorf("ownerless tags = %+v, %v; want none", tags, err)
+	}
+
+	statements, err := db.ListStatements(StatementFilter{Owner: "alice", Tags: []string{"taxes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range statements {
+		ids = append(ids, s.ID)
+	}
+	if !slices.Equal(ids, []string{alices}) {
+		t.Errorf("alice's statements tagged taxes = %q, want %q", ids, alices)
+	}
+}
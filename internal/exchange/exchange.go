@@ -0,0 +1,67 @@
+// Package exchange converts amounts between currencies using exchange rates.
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrNoRate is returned by a Provider that has no rate for a currency pair on
+// a date.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Provider looks up exchange rates. Rate returns how many units of to one unit
+// of from buys on date (YYYY-MM-DD), or an error wrapping ErrNoRate when it
+// doesn't know.
+type Provider interface {
+	Rate(ctx context.Context, from, to, date string) (float64, error)
+}
+
+// Chain tries each provider in order, moving on when one has no rate.
+type Chain []Provider
+
+// Rate returns the first rate found by the providers in c.
+func (c Chain) Rate(ctx context.Context, from, to, date string) (float64, error) {
+	var errs []error
+	for _, p := range c {
+		rate, err := p.Rate(ctx, from, to, date)
+		if err == nil {
+			return rate, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return 0, fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, date)
+	}
+	return 0, errors.Join(errs...)
+}
+
+// Converter converts amounts into a base currency.
+type Converter struct {
+	Base     string
+	Provider Provider
+}
+
+// NewConverter creates a Converter to base, an ISO 4217 code.
+func NewConverter(base string, provider Provider) *Converter {
+	return &Converter{Base: strings.ToUpper(base), Provider: provider}
+}
+
+// Convert returns cents of currency in the base currency at the rate on date,
+// rounded half away from zero. Amounts already in the base currency are
+// returned unchanged.
+func (c *Converter) Convert(ctx context.Context, cents int64, currency, date string) (int64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == c.Base {
+		return cents, nil
+	}
+
+	rate, err := c.Provider.Rate(ctx, currency, c.Base, date)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(float64(cents) * rate)), nil
+}
@@ -0,0 +1,83 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP fetches rates from a Frankfurter-compatible API:
+// GET {baseURL}/{date}?from=EUR&to=USD answering {"rates": {"USD": 1.08}}.
+// Rates are cached for the life of the provider, since historical rates
+// don't change.
+type HTTP struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]float64
+}
+
+// NewHTTP creates an HTTP provider for the API at baseURL. timeout bounds
+// each request; 0 means none.
+func NewHTTP(baseURL string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+		cache:      make(map[string]float64),
+	}
+}
+
+// Rate returns the rate from one currency to another on date.
+func (h *HTTP) Rate(ctx context.Context, from, to, date string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	key := from + "/" + to + "@" + date
+
+	h.mu.Lock()
+	rate, ok := h.cache[key]
+	h.mu.Unlock()
+	if ok {
+		return rate, nil
+	}
+
+	query := url.Values{"from": {from}, "to": {to}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+"/"+url.PathEscape(date)+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("exchange rate request: %w", err)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("exchange rate request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, date)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("exchange rate API returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decode exchange rate response: %w", err)
+	}
+	rate, ok = body.Rates[to]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, date)
+	}
+
+	h.mu.Lock()
+	h.cache[key] = rate
+	h.mu.Unlock()
+	return rate, nil
+}
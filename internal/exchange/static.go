@@ -0,0 +1,85 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Static serves fixed rates quoted against a base currency, optionally with
+// the date each takes effect. It is typically loaded from configuration.
+type Static struct {
+	base  string
+	rates map[string][]datedRate // by currency, sorted by date
+}
+
+// datedRate is a rate in effect from date onwards; an empty date applies
+// before the first dated rate.
+type datedRate struct {
+	date string
+	rate float64
+}
+
+// ParseStatic builds a Static provider from rates keyed by currency, or by
+// currency@YYYY-MM-DD for a rate taking effect on that date. Each value is
+// the price of one unit of the currency in base, e.g. {"eur": "1.08",
+// "eur@2024-06-01": "1.10"} with base USD.
+func ParseStatic(base string, rates map[string]string) (*Static, error) {
+	s := &Static{base: strings.ToUpper(base), rates: make(map[string][]datedRate)}
+	for key, value := range rates {
+		currency, date, _ := strings.Cut(key, "@")
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if len(currency) != 3 {
+			return nil, fmt.Errorf("rate %q: invalid currency code", key)
+		}
+		if date != "" {
+			if _, err := time.Parse(time.DateOnly, date); err != nil {
+				return nil, fmt.Errorf("rate %q: invalid date, want YYYY-MM-DD", key)
+			}
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("rate %q: must be a positive number, got %q", key, value)
+		}
+		s.rates[currency] = append(s.rates[currency], datedRate{date: date, rate: rate})
+	}
+	for _, rates := range s.rates {
+		slices.SortFunc(rates, func(a, b datedRate) int { return strings.Compare(a.date, b.date) })
+	}
+	return s, nil
+}
+
+// Rate returns the rate from one currency to another on date. Pairs not
+// involving the base currency are crossed through it.
+func (s *Static) Rate(_ context.Context, from, to, date string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fromRate, ok := s.lookup(from, date)
+	if !ok {
+		return 0, fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, date)
+	}
+	toRate, ok := s.lookup(to, date)
+	if !ok {
+		return 0, fmt.Errorf("%w for %s/%s on %s", ErrNoRate, from, to, date)
+	}
+	return fromRate / toRate, nil
+}
+
+// lookup returns the price of currency in base on date: the latest rate
+// dated on or before it.
+func (s *Static) lookup(currency, date string) (float64, bool) {
+	if currency == s.base {
+		return 1, true
+	}
+	var rate float64
+	var ok bool
+	for _, r := range s.rates[currency] {
+		if r.date > date {
+			break
+		}
+		rate, ok = r.rate, true
+	}
+	return rate, ok
+}
@@ -0,0 +1,134 @@
+// Package fetch downloads files from client-supplied URLs.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/netsafe"
+)
+
+var (
+	// ErrInvalidURL is returned for URLs that aren't absolute http(s) URLs.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrForbiddenAddress is returned when a URL resolves, directly or through
+	// a redirect, to an address that may not be fetched.
+	ErrForbiddenAddress = netsafe.ErrForbiddenAddress
+	// ErrTooLarge is returned when a download exceeds the size limit.
+	ErrTooLarge = errors.New("file too large")
+)
+
+// maxRedirects is how many redirects a download follows.
+const maxRedirects = 5
+
+// File is a downloaded file.
+type File struct {
+	// Name is taken from the Content-Disposition header or, failing that,
+	// the last segment of the final URL's path.
+	Name string
+	Data []byte
+}
+
+// Fetcher downloads files over HTTP(S).
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// New creates a Fetcher. timeout bounds each download, including redirects and
+// reading the body; downloads larger than maxBytes fail with ErrTooLarge.
+// Connections, including those for redirects, go through dialer, which fails
+// them with ErrForbiddenAddress for blocked addresses; a nil dialer connects
+// anywhere.
+func New(timeout time.Duration, maxBytes int64, dialer *netsafe.Dialer) *Fetcher {
+	dial := (&net.Dialer{Timeout: timeout}).DialContext
+	if dialer != nil {
+		dial = dialer.DialContext
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				// No proxy: it would make the connection on our behalf,
+				// bypassing the address check.
+				Proxy:               nil,
+				DialContext:         dial,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("%w: redirect to %s", ErrInvalidURL, req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch downloads the file at rawURL.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: must be an absolute http or https URL", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in URLs are not supported", ErrInvalidURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddress) || errors.Is(err, ErrInvalidURL) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: server returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds maximum %d", ErrTooLarge, resp.ContentLength, f.maxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, fmt.Errorf("%w: exceeds maximum %d bytes", ErrTooLarge, f.maxBytes)
+	}
+
+	return &File{Name: filename(resp), Data: data}, nil
+}
+
+// filename names a downloaded file.
+func filename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(params["filename"]); name != "." && name != "/" {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" {
+		return name
+	}
+	return "download"
+}
@@ -0,0 +1,239 @@
+// Package jsonschema validates JSON documents against a subset of JSON Schema
+// and reports each problem with its line and column in the document.
+//
+// Supported keywords are type, enum, required, properties,
+// additionalProperties, items, minItems, maxItems, minLength and maxLength.
+// Annotations such as $schema, title and description are ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled schema.
+type Schema struct {
+	Types                []string
+	Enum                 []any
+	Required             []string
+	Properties           map[string]*Schema
+	AdditionalProperties *bool
+	Items                *Schema
+	MinItems             *int
+	MaxItems             *int
+	MinLength            *int
+	MaxLength            *int
+}
+
+// Problem is one way a document fails its schema. Field is the path to the
+// offending value, e.g. "rules[2].category"; it is empty for the root.
+type Problem struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", p.Line, p.Column, p.Field, p.Message)
+}
+
+// Compile parses a schema document.
+func Compile(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+	return &s, nil
+}
+
+// UnmarshalJSON reads the supported keywords; type may be a string or a list.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type                 json.RawMessage    `json:"type"`
+		Enum                 []any              `json:"enum"`
+		Required             []string           `json:"required"`
+		Properties           map[string]*Schema `json:"properties"`
+		AdditionalProperties *bool              `json:"additionalProperties"`
+		Items                *Schema            `json:"items"`
+		MinItems             *int               `json:"minItems"`
+		MaxItems             *int               `json:"maxItems"`
+		MinLength            *int               `json:"minLength"`
+		MaxLength            *int               `json:"maxLength"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw.Type) > 0 {
+		var one string
+		if err := json.Unmarshal(raw.Type, &one); err == nil {
+			s.Types = []string{one}
+		} else if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			return fmt.Errorf("type must be a string or a list of strings")
+		}
+	}
+	s.Enum = raw.Enum
+	s.Required = raw.Required
+	s.Properties = raw.Properties
+	s.AdditionalProperties = raw.AdditionalProperties
+	s.Items = raw.Items
+	s.MinItems, s.MaxItems = raw.MinItems, raw.MaxItems
+	s.MinLength, s.MaxLength = raw.MinLength, raw.MaxLength
+	return nil
+}
+
+// Validate checks doc against the schema. A document that isn't valid JSON
+// yields a single problem at the syntax error.
+func (s *Schema) Validate(doc []byte) []Problem {
+	root, err := parse(doc)
+	if err != nil {
+		se := err.(*syntaxError)
+		line, col := position(doc, se.offset)
+		return []Problem{{Line: line, Column: col, Message: "invalid JSON: " + se.msg}}
+	}
+
+	v := validator{doc: doc}
+	v.check(s, root, "")
+	return v.problems
+}
+
+type validator struct {
+	doc      []byte
+	problems []Problem
+}
+
+func (v *validator) report(n *node, field, format string, args ...any) {
+	line, col := position(v.doc, n.offset)
+	v.problems = append(v.problems, Problem{Line: line, Column: col, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) check(s *Schema, n *node, field string) {
+	if len(s.Types) > 0 && !slices.ContainsFunc(s.Types, n.is) {
+		v.report(n, field, "must be %s, got %s", strings.Join(s.Types, " or "), n.kind)
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, n.equals) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			allowed[i] = string(b)
+		}
+		v.report(n, field, "must be one of %s", strings.Join(allowed, ", "))
+	}
+
+	switch n.kind {
+	case kindString:
+		length := utf8.RuneCountInString(n.str)
+		if s.MinLength != nil && length < *s.MinLength {
+			if *s.MinLength == 1 {
+				v.report(n, field, "must not be empty")
+			} else {
+				v.report(n, field, "must be at least %d characters", *s.MinLength)
+			}
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			v.report(n, field, "must be at most %d characters", *s.MaxLength)
+		}
+
+	case kindArray:
+		if s.MinItems != nil && len(n.items) < *s.MinItems {
+			v.report(n, field, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(n.items) > *s.MaxItems {
+			v.report(n, field, "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range n.items {
+				v.check(s.Items, item, fmt.Sprintf("%s[%d]", field, i))
+			}
+		}
+
+	case kindObject:
+		for _, name := range s.Required {
+			if n.member(name) == nil {
+				v.report(n, join(field, name), "is required")
+			}
+		}
+		for _, m := range n.members {
+			if prop, ok := s.Properties[m.key]; ok {
+				v.check(prop, m.value, join(field, m.key))
+				continue
+			}
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				v.report(m.keyNode, join(field, m.key), "unknown field%s", suggestion(m.key, s.Properties))
+			}
+		}
+	}
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// suggestion names the closest known property when key looks like a typo of it.
+func suggestion(key string, properties map[string]*Schema) string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := distance(strings.ToLower(key), name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// distance is the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// position converts a byte offset in doc to a 1-based line and column.
+func position(doc []byte, offset int) (line, col int) {
+	offset = min(offset, len(doc))
+	line, col = 1, 1
+	for _, b := range doc[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,177 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// JSON kinds, named as in the schema type keyword.
+const (
+	kindObject  = "object"
+	kindArray   = "array"
+	kindString  = "string"
+	kindNumber  = "number"
+	kindBoolean = "boolean"
+	kindNull    = "null"
+)
+
+// node is a parsed JSON value that remembers where it starts in the document.
+type node struct {
+	kind    string
+	offset  int
+	str     string
+	num     json.Number
+	boolean bool
+	members []member
+	items   []*node
+}
+
+type member struct {
+	key     string
+	keyNode *node
+	value   *node
+}
+
+func (n *node) member(key string) *node {
+	for _, m := range n.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// is reports whether n satisfies a schema type.
+func (n *node) is(typ string) bool {
+	if typ == "integer" {
+		_, err := n.num.Int64()
+		return n.kind == kindNumber && err == nil
+	}
+	return n.kind == typ
+}
+
+// equals compares n with an enum value decoded by encoding/json.
+func (n *node) equals(v any) bool {
+	switch v := v.(type) {
+	case string:
+		return n.kind == kindString && n.str == v
+	case float64:
+		f, err := n.num.Float64()
+		return n.kind == kindNumber && err == nil && f == v
+	case bool:
+		return n.kind == kindBoolean && n.boolean == v
+	case nil:
+		return n.kind == kindNull
+	}
+	return false
+}
+
+type parser struct {
+	doc []byte
+	dec *json.Decoder
+}
+
+// syntaxError is a document that isn't valid JSON, with the offset where
+// parsing stopped.
+type syntaxError struct {
+	offset int
+	msg    string
+}
+
+func (e *syntaxError) Error() string { return e.msg }
+
+func parse(doc []byte) (*node, error) {
+	p := parser{doc: doc, dec: json.NewDecoder(bytes.NewReader(doc))}
+	p.dec.UseNumber()
+
+	root, err := p.value()
+	if err == nil {
+		if _, err = p.dec.Token(); err == nil {
+			err = errors.New("unexpected data after the top-level value")
+		} else if err == io.EOF {
+			return root, nil
+		}
+	}
+
+	offset := int(p.dec.InputOffset())
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		offset = int(se.Offset)
+	}
+	return nil, &syntaxError{offset: offset, msg: err.Error()}
+}
+
+// start returns the offset of the next token, skipping whitespace and the
+// separators the decoder consumes silently.
+func (p *parser) start() int {
+	i := int(p.dec.InputOffset())
+	for i < len(p.doc) {
+		switch p.doc[i] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func (p *parser) value() (*node, error) {
+	offset := p.start()
+	tok, err := p.dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{offset: offset}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			n.kind = kindObject
+			for p.dec.More() {
+				keyOffset := p.start()
+				keyTok, err := p.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				value, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				n.members = append(n.members, member{
+					key:     key,
+					keyNode: &node{kind: kindString, offset: keyOffset, str: key},
+					value:   value,
+				})
+			}
+		} else {
+			n.kind = kindArray
+			for p.dec.More() {
+				item, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+		}
+		// Consume the closing delimiter.
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.kind, n.str = kindString, t
+	case json.Number:
+		n.kind, n.num = kindNumber, t
+	case bool:
+		n.kind, n.boolean = kindBoolean, t
+	case nil:
+		n.kind = kindNull
+	}
+	return n, nil
+}
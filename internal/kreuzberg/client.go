@@ -2,76 +2,385 @@ package kreuzberg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// ErrTimeout is returned when Kreuzberg doesn't respond within the configured timeout.
+var ErrTimeout = errors.New("kreuzberg request timed out")
+
+// ErrUnavailable is returned when Kreuzberg can't be reached or fails with a
+// server error, as opposed to rejecting the file; trying again later may work.
+var ErrUnavailable = errors.New("kreuzberg unavailable")
+
+// ErrResponseTooLarge is returned when an extraction response exceeds the
+// configured size cap.
+var ErrResponseTooLarge = errors.New("kreuzberg response too large")
+
+// StatusError is returned when Kreuzberg answers an extraction with a status
+// other than 200 OK. Snippet is a short, single-line excerpt of the body:
+// the JSON as sent, or the text of an HTML error page from a proxy.
+type StatusError struct {
+	StatusCode int
+	Snippet    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Snippet == "" {
+		return fmt.Sprintf("kreuzberg returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("kreuzberg returned status %d: %s", e.StatusCode, e.Snippet)
+}
+
+// errorBodyBytes is how much of an error response is read; snippetRunes is
+// the longest snippet kept from it.
+const (
+	errorBodyBytes = 8 * 1024
+	snippetRunes   = 200
+)
+
+// Pool tunes the connections the client keeps open to Kreuzberg. Every
+// request goes to the same host, so many uploads at once would otherwise
+// open and close a connection each.
+type Pool struct {
+	// MaxIdleConnsPerHost is how many idle connections are kept for reuse.
+	// MaxConnsPerHost caps all connections, idle or not; 0 means unlimited.
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	// IdleConnTimeout closes connections left idle for longer; 0 keeps them.
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes on open
+	// connections; negative disables them.
+	KeepAlive time.Duration
+}
+
+// transport builds an HTTP transport sized by the pool, with the defaults of
+// http.DefaultTransport otherwise.
+func (p Pool) transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 0
+	t.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = p.MaxConnsPerHost
+	t.IdleConnTimeout = p.IdleConnTimeout
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: p.KeepAlive}).DialContext
+	return t
+}
+
 // Client communicates with the Kreuzberg document extraction API.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL       string
+	extractPath   string
+	timeout       time.Duration
+	timeoutByType map[string]time.Duration
+	authHeader    string
+	authToken     string
+	// maxResponseBytes caps the extraction response body; 0 means unlimited.
+	maxResponseBytes int64
+	httpClient       *http.Client
 }
 
-// NewClient creates a new Kreuzberg API client.
-func NewClient(baseURL string, timeout time.Duration) *Client {
+// NewClient creates a new Kreuzberg API client. extractPath is the path of the
+// extraction endpoint, normally "/extract". timeoutByType overrides timeout for
+// extractions of specific MIME types. A non-empty authToken is sent in
+// authHeader on every request, as "Bearer <token>" when authHeader is
+// Authorization. Extraction responses larger than maxResponseBytes fail with
+// ErrResponseTooLarge; 0 means unlimited. pool sizes the connections kept
+// open to Kreuzberg.
+func NewClient(baseURL, extractPath string, timeout time.Duration, timeoutByType map[string]time.Duration, authHeader, authToken string, maxResponseBytes int64, pool Pool) *Client {
 	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+		baseURL:          baseURL,
+		extractPath:      extractPath,
+		timeout:          timeout,
+		timeoutByType:    timeoutByType,
+		authHeader:       authHeader,
+		authToken:        authToken,
+		maxResponseBytes: maxResponseBytes,
+		// Timeouts are applied per request, since they depend on the file type.
+		httpClient: &http.Client{Transport: pool.transport()},
+	}
+}
+
+// Close closes the idle connections to Kreuzberg.
+func (c *Client) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// authorize adds the configured credentials to req.
+func (c *Client) authorize(req *http.Request) {
+	if c.authToken == "" {
+		return
 	}
+	if strings.EqualFold(c.authHeader, "Authorization") {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+		return
+	}
+	req.Header.Set(c.authHeader, c.authToken)
+}
+
+// scrub removes the auth token from text echoed back by Kreuzberg or a proxy
+// in front of it, so it can't reach logs or stored error messages.
+func (c *Client) scrub(s string) string {
+	if c.authToken == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, c.authToken, "[REDACTED]")
+}
+
+// timeoutFor returns the extraction timeout for a MIME type.
+func (c *Client) timeoutFor(mimeType string) time.Duration {
+	if d, ok := c.timeoutByType[mimeType]; ok {
+		return d
+	}
+	return c.timeout
 }
 
-// Extract sends a file to the Kreuzberg /extract endpoint and returns the extraction results.
+// FileInput is a single file sent to Kreuzberg as part of a batch.
+type FileInput struct {
+	Filename string
+	Data     []byte
+	MimeType string
+}
+
+// BatchResult is the extraction outcome for one FileInput.
+type BatchResult struct {
+	Result ExtractionResult
+	Err    error
+}
+
+// Extract sends a file to the Kreuzberg extraction endpoint and returns the extraction results.
 func (c *Client) Extract(filename string, data []byte, mimeType string) ([]ExtractionResult, error) {
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
+	return c.ExtractReader(context.Background(), filename, bytes.NewReader(data), int64(len(data)), mimeType)
+}
 
-	part, err := writer.CreateFormFile("files", filename)
-	if err != nil {
-		return nil, fmt.Errorf("create form file: %w", err)
+// ExtractReader streams a file from r to the Kreuzberg extraction endpoint and returns
+// the extraction results. The multipart body is written through a pipe, so the file
+// is never buffered in full. If size is non-negative, it must match the number of
+// bytes read from r.
+func (c *Client) ExtractReader(ctx context.Context, filename string, r io.Reader, size int64, mimeType string) ([]ExtractionResult, error) {
+	return c.post(ctx, c.timeoutFor(mimeType), func(writer *multipart.Writer) error {
+		return writeFilePart(writer, filename, r, size)
+	})
+}
+
+// ExtractBatch sends several files to Kreuzberg in a single multipart request and
+// returns one result per input, in input order. If the batch request fails or the
+// response doesn't line up with the inputs, each file is retried on its own so one
+// bad file doesn't fail the rest.
+func (c *Client) ExtractBatch(ctx context.Context, files []FileInput) []BatchResult {
+	batch := make([]BatchResult, len(files))
+	if len(files) == 0 {
+		return batch
+	}
+
+	// The batch gets the longest timeout of the files it contains.
+	var timeout time.Duration
+	for _, f := range files {
+		timeout = max(timeout, c.timeoutFor(f.MimeType))
 	}
 
-	if _, err := part.Write(data); err != nil {
-		return nil, fmt.Errorf("write file data: %w", err)
+	results, err := c.post(ctx, timeout, func(writer *multipart.Writer) error {
+		for _, f := range files {
+			if err := writeFilePart(writer, f.Filename, bytes.NewReader(f.Data), int64(len(f.Data))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && len(results) != len(files) {
+		err = fmt.Errorf("kreuzberg returned %d results for %d files", len(results), len(files))
 	}
 
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("close multipart writer: %w", err)
+	if err == nil {
+		for i := range results {
+			batch[i].Result = results[i]
+		}
+		return batch
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/extract", &body)
+	if len(files) == 1 {
+		batch[0].Err = err
+		return batch
+	}
+
+	// Fall back to one request per file to isolate the failing ones.
+	for i, f := range files {
+		results, err := c.ExtractReader(ctx, f.Filename, bytes.NewReader(f.Data), int64(len(f.Data)), f.MimeType)
+		switch {
+		case err != nil:
+			batch[i].Err = err
+		case len(results) == 0:
+			batch[i].Err = fmt.Errorf("kreuzberg returned no results")
+		default:
+			batch[i].Result = results[0]
+		}
+	}
+
+	return batch
+}
+
+// post writes a multipart body through a pipe to the extraction endpoint and
+// decodes the response. timeout covers the whole exchange, including reading the
+// response body.
+func (c *Client) post(ctx context.Context, timeout time.Duration, writeParts func(*multipart.Writer) error) ([]ExtractionResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		err := writeParts(writer)
+		if err == nil {
+			if closeErr := writer.Close(); closeErr != nil {
+				err = fmt.Errorf("close multipart writer: %w", closeErr)
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+c.extractPath, pr)
 	if err != nil {
+		_ = pr.Close()
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		if isTimeout(err) {
+			return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return nil, fmt.Errorf("%w: send request: %w", ErrUnavailable, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("kreuzberg returned status %d: %s", resp.StatusCode, string(respBody))
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyBytes))
+		err := error(&StatusError{StatusCode: resp.StatusCode, Snippet: snippet(c.scrub(string(respBody)))})
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+			err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return nil, err
+	}
+
+	// Read one byte past the cap so a body of exactly the cap still decodes.
+	body := io.Reader(resp.Body)
+	var limited *io.LimitedReader
+	if c.maxResponseBytes > 0 {
+		limited = &io.LimitedReader{R: resp.Body, N: c.maxResponseBytes + 1}
+		body = limited
 	}
 
 	var results []ExtractionResult
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+	if err := json.NewDecoder(body).Decode(&results); err != nil {
+		if limited != nil && limited.N == 0 {
+			return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, c.maxResponseBytes)
+		}
+		// The timeout also covers reading the body.
+		if isTimeout(err) {
+			return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
 	return results, nil
 }
 
+// snippet shortens an error body to one line of at most snippetRunes: JSON
+// is kept as is, an HTML page is reduced to its title, or failing that its
+// text without markup, and whitespace is collapsed.
+func snippet(body string) string {
+	body = strings.ToValidUTF8(strings.TrimSpace(body), "\uFFFD")
+	// Only ASCII is lowered, so offsets into lower are offsets into body.
+	lower := strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, body)
+	if start := strings.Index(lower, "<title>"); start >= 0 {
+		if end := strings.Index(lower[start:], "</title>"); end >= 0 {
+			body = body[start+len("<title>") : start+end]
+		}
+	}
+	if !json.Valid([]byte(body)) {
+		var text strings.Builder
+		inTag := false
+		for _, r := range body {
+			switch {
+			case r == '<':
+				inTag = true
+			case r == '>' && inTag:
+				inTag = false
+				text.WriteByte(' ')
+			case !inTag:
+				text.WriteRune(r)
+			}
+		}
+		body = text.String()
+	}
+	body = strings.Join(strings.Fields(body), " ")
+	if runes := []rune(body); len(runes) > snippetRunes {
+		body = string(runes[:snippetRunes]) + "…"
+	}
+	return body
+}
+
+// isTimeout reports whether err is a deadline or network timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// writeFilePart copies r into a "files" form part.
+func writeFilePart(writer *multipart.Writer, filename string, r io.Reader, size int64) error {
+	part, err := writer.CreateFormFile("files", filename)
+	if err != nil {
+		return fmt.Errorf("create form file: %w", err)
+	}
+
+	n, err := io.Copy(part, r)
+	if err != nil {
+		return fmt.Errorf("write file data: %w", err)
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("write file data: read %d bytes, expected %d", n, size)
+	}
+
+	return nil
+}
+
 // Health checks the Kreuzberg /health endpoint.
 func (c *Client) Health() error {
-	resp, err := c.httpClient.Get(c.baseURL + "/health")
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("kreuzberg health check: %w", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("kreuzberg health check: %w", err)
 	}
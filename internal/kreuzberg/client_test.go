@@ -0,0 +1,63 @@
+package kreuzberg
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkExtract extracts files from parallel goroutines against a local
+// Kreuzberg stand-in, reporting the connections opened per extraction. The
+// pooled client, sized as configured by default, reuses its connections
+// rather than opening one per request.
+func BenchmarkExtract(b *testing.B) {
+	pools := []struct {
+		name string
+		pool Pool
+	}{
+		// A negative MaxIdleConnsPerHost keeps no idle connections, so
+		// every request opens its own.
+		{"no reuse", Pool{MaxIdleConnsPerHost: -1}},
+		{"pooled", Pool{MaxIdleConnsPerHost: 16, IdleConnTimeout: 90 * time.Second, KeepAlive: 30 * time.Second}},
+	}
+	data := []byte("Date,Description,Amount\n2024-01-02,Coffee,-3.50\n")
+
+	for _, p := range pools {
+		b.Run(p.name, func(b *testing.B) {
+			var conns atomic.Int64
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				time.Sleep(100 * time.Microsecond)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `[{"content":"Statement","mime_type":"text/csv"}]`+"\n")
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			client := NewClient(server.URL, "/extract", 10*time.Second, nil, "", "", 0, p.pool)
+			defer client.Close()
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := client.Extract("s.csv", data, "text/csv"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
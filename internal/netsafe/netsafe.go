@@ -0,0 +1,137 @@
+// Package netsafe dials outbound connections to client-supplied hosts while
+// refusing loopback, private, link-local and other internal addresses, so the
+// server can't be used to reach services behind it.
+package netsafe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a host resolves to a blocked address.
+var ErrForbiddenAddress = errors.New("address not allowed")
+
+// DefaultBlocked are the ranges refused when no others are configured: this
+// network, private, shared, loopback, link-local, IETF protocol assignments,
+// documentation, benchmarking, multicast, reserved and broadcast addresses,
+// plus the IPv6 ranges that are internal or can embed an IPv4 address.
+var DefaultBlocked = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// Dialer connects only to addresses outside its blocked ranges.
+type Dialer struct {
+	dialer   net.Dialer
+	resolver *net.Resolver
+	blocked  []netip.Prefix
+	allowed  []netip.Prefix
+}
+
+// NewDialer creates a Dialer whose connection attempts time out after timeout.
+// It refuses addresses in blocked, or DefaultBlocked if blocked is empty, except
+// those in allowed, which carve exceptions out of the blocked ranges.
+func NewDialer(timeout time.Duration, blocked, allowed []netip.Prefix) *Dialer {
+	if len(blocked) == 0 {
+		blocked = DefaultBlocked
+	}
+	return &Dialer{
+		dialer:   net.Dialer{Timeout: timeout},
+		resolver: net.DefaultResolver,
+		blocked:  blocked,
+		allowed:  allowed,
+	}
+}
+
+// Allowed reports whether addr may be connected to. IPv4-mapped IPv6
+// addresses are checked as IPv4.
+func (d *Dialer) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range d.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	for _, p := range d.blocked {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// DialContext resolves the host of address, checks every address it resolves
+// to and dials the checked addresses directly, so a DNS answer that changes
+// between the check and the connection (DNS rebinding) can't slip through. A
+// host with any blocked address is refused outright. It has the signature of
+// http.Transport.DialContext.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := d.resolver.LookupNetIP(ctx, ipNetwork(network), host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("lookup %s: no addresses", host)
+	}
+	for _, addr := range addrs {
+		if d.Allowed(addr) {
+			continue
+		}
+		if host == addr.Unmap().String() {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil, fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, addr.Unmap())
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ipNetwork maps a dial network to the matching LookupNetIP network.
+func ipNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	}
+	return "ip"
+}
@@ -0,0 +1,114 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// cardCandidate matches runs of 13-19 digits, optionally grouped by spaces or dashes,
+// the shape of a payment card number (PAN).
+var cardCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// keepDigits is the number of trailing digits left visible in a masked value.
+const keepDigits = 4
+
+// Redactor masks sensitive numbers such as card and account numbers in free text.
+// A nil *Redactor leaves text unchanged.
+type Redactor struct {
+	extra *regexp.Regexp
+}
+
+// New creates a Redactor that masks Luhn-valid card numbers and, if pattern is
+// non-empty, anything matching pattern (e.g. bank-specific account number formats).
+func New(pattern string) (*Redactor, error) {
+	r := &Redactor{}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile redaction pattern: %w", err)
+		}
+		r.extra = re
+	}
+	return r, nil
+}
+
+// Redact returns s with sensitive numbers masked, keeping the last four digits,
+// e.g. "4111 1111 1111 1111" becomes "**** **** **** 1111".
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	s = cardCandidate.ReplaceAllStringFunc(s, func(match string) string {
+		if !luhnValid(match) {
+			return match
+		}
+		return mask(match)
+	})
+
+	if r.extra != nil {
+		s = r.extra.ReplaceAllStringFunc(s, mask)
+	}
+
+	return s
+}
+
+// RedactAll redacts every string in values in place and returns it.
+func (r *Redactor) RedactAll(values []string) []string {
+	if r == nil {
+		return values
+	}
+	for i, v := range values {
+		values[i] = r.Redact(v)
+	}
+	return values
+}
+
+// mask replaces every digit except the last four with '*', preserving separators.
+func mask(s string) string {
+	digits := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	seen := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			seen++
+			if seen <= digits-keepDigits {
+				b.WriteByte('*')
+				continue
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,120 @@
+package redact
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		in      string
+		want    string
+	}{
+		{
+			name: "visa",
+			in:   "Card 4111111111111111 declined",
+			want: "Card ************1111 declined",
+		},
+		{
+			name: "mastercard with spaces",
+			in:   "Payment from 5555 5555 5555 4444",
+			want: "Payment from **** **** **** 4444",
+		},
+		{
+			name: "amex with dashes",
+			in:   "AMEX 3782-822463-10005 autopay",
+			want: "AMEX ****-******-*0005 autopay",
+		},
+		{
+			name: "13-digit card",
+			in:   "4222222222222",
+			want: "*********2222",
+		},
+		{
+			name: "several cards",
+			in:   "4111 1111 1111 1111 then 5555-5555-5555-4444",
+			want: "**** **** **** 1111 then ****-****-****-4444",
+		},
+		{
+			name: "failed Luhn check",
+			in:   "Reference 4111111111111112",
+			want: "Reference 4111111111111112",
+		},
+		{
+			name: "failed Luhn check with spaces",
+			in:   "Ref 5555 5555 5555 4445",
+			want: "Ref 5555 5555 5555 4445",
+		},
+		{
+			name: "too short",
+			in:   "Check 100234567890 cleared",
+			want: "Check 100234567890 cleared",
+		},
+		{
+			name: "part of a longer number",
+			in:   "Trace 41111111111111110000",
+			want: "Trace 41111111111111110000",
+		},
+		{
+			name: "amounts and dates",
+			in:   "2024-01-15 Grocery Store -1,234.56",
+			want: "2024-01-15 Grocery Store -1,234.56",
+		},
+		{
+			name:    "extra pattern",
+			pattern: `\bDE\d{20}\b`,
+			in:      "IBAN DE89370400440532013000 debit",
+			want:    "IBAN DE****************3000 debit",
+		},
+		{
+			name:    "extra pattern with a separator",
+			pattern: `\bAcct(?:ount)? #?\d{4}-\d{6}\b`,
+			in:      "Transfer to Acct #1234-567890",
+			want:    "Transfer to Acct #****-**7890",
+		},
+		{
+			name:    "extra pattern alongside a card",
+			pattern: `\b\d{3}-\d{7}\b`,
+			in:      "Account 021-4567890, card 4111111111111111",
+			want:    "Account ***-***7890, card ************1111",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactNil(t *testing.T) {
+	var r *Redactor
+	if got := r.Redact("4111111111111111"); got != "4111111111111111" {
+		t.Errorf("nil Redactor changed the text to %q", got)
+	}
+}
+
+func TestRedactAll(t *testing.T) {
+	r, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []string{"2024-01-15", "4111 1111 1111 1111", "-42.00"}
+	got := r.RedactAll(values)
+	want := []string{"2024-01-15", "**** **** **** 1111", "-42.00"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RedactAll()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	if _, err := New(`(`); err == nil {
+		t.Error("New accepted an invalid pattern")
+	}
+}
@@ -0,0 +1,109 @@
+// Package requestinfo tags each request with an ID and its start time, and
+// records whether its JSON responses are wrapped in an envelope carrying them
+// and the timezone their times are rendered in.
+package requestinfo
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request ID, from clients and proxies that set one and
+// back on every response.
+const Header = "X-Request-ID"
+
+// EnvelopeMediaType is the Accept media type asking for enveloped responses.
+const EnvelopeMediaType = "application/vnd.moneymanager.envelope+json"
+
+// maxIDLength is the longest request ID taken from a client.
+const maxIDLength = 128
+
+// Info describes a request.
+type Info struct {
+	ID    string
+	Start time.Time
+	// Envelope wraps JSON responses in {data, meta}.
+	Envelope bool
+	// Location is the timezone times are rendered in and date-only values
+	// are read in.
+	Location *time.Location
+}
+
+type contextKey struct{}
+
+// FromContext returns the request info stored by Middleware, if any.
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// WithInfo returns a copy of ctx carrying info.
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// Middleware stores the Info of each request in its context and returns the
+// request ID in the X-Request-ID header. The ID is taken from the request's
+// own X-Request-ID when it's a short printable token, so it can be traced
+// across proxies, and generated otherwise. Responses are enveloped when
+// envelope is set or the client accepts EnvelopeMediaType. Times are in
+// location unless the ?tz query parameter names another IANA timezone; an
+// unknown one is rejected with 400 Bad Request.
+func Middleware(envelope bool, location *time.Location) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := Info{
+				ID:       r.Header.Get(Header),
+				Start:    time.Now(),
+				Envelope: envelope || acceptsEnvelope(r),
+				Location: location,
+			}
+			if !validID(info.ID) {
+				info.ID = uuid.NewString()
+			}
+
+			w.Header().Set(Header, info.ID)
+			if tz := r.URL.Query().Get("tz"); tz != "" {
+				loc, err := time.LoadLocation(tz)
+				if err != nil {
+					http.Error(w, "Bad Request: unknown timezone "+strconv.Quote(tz), http.StatusBadRequest)
+					return
+				}
+				info.Location = loc
+			}
+			next.ServeHTTP(w, r.WithContext(WithInfo(r.Context(), info)))
+		})
+	}
+}
+
+// acceptsEnvelope reports whether r lists EnvelopeMediaType in its Accept header.
+func acceptsEnvelope(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err == nil && mediaType == EnvelopeMediaType && params["q"] != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validID reports whether id is safe to echo back and log.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
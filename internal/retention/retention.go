@@ -0,0 +1,142 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/storage"
+)
+
+// auditActor is the actor recorded in the audit log for purges.
+const auditActor = "system:retention"
+
+// Policy describes how long statements are kept and how they are purged.
+type Policy struct {
+	// Days is the retention window. Statements uploaded longer ago are purged.
+	Days int
+	// HardDelete removes statements entirely instead of soft-deleting them.
+	HardDelete bool
+	// DryRun only reports what would be purged.
+	DryRun bool
+	// Interval is the time between purge runs.
+	Interval time.Duration
+}
+
+// Result summarizes a single purge run.
+type Result struct {
+	Candidates int
+	Purged     int
+	Failed     int
+}
+
+// Purger periodically purges statements older than the retention window.
+// Statements under legal hold are never purged.
+type Purger struct {
+	db     *database.DB
+	policy Policy
+	files  storage.FileStore
+	audit  *audit.Recorder
+	logger *slog.Logger
+}
+
+// NewPurger creates a new Purger. Original files of purged statements are
+// removed from files, if set.
+func NewPurger(db *database.DB, policy Policy, files storage.FileStore, auditor *audit.Recorder, logger *slog.Logger) *Purger {
+	return &Purger{
+		db:     db,
+		policy: policy,
+		files:  files,
+		audit:  auditor,
+		logger: logger,
+	}
+}
+
+// Run purges once immediately and then on every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeOnce(time.Now()); err != nil {
+			p.logger.Error("retention purge failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce purges every statement that expired as of now.
+func (p *Purger) PurgeOnce(now time.Time) (Result, error) {
+	cutoff := now.AddDate(0, 0, -p.policy.Days)
+
+	ids, err := p.db.ListExpiredStatements(cutoff)
+	if err != nil {
+		return Result{}, fmt.Errorf("list expired statements: %w", err)
+	}
+
+	result := Result{Candidates: len(ids)}
+
+	if p.policy.DryRun {
+		p.logger.Info("retention purge dry run",
+			"cutoff", cutoff.UTC().Format(time.RFC3339),
+			"would_purge", len(ids),
+			"statement_ids", ids,
+			"hard_delete", p.policy.HardDelete,
+		)
+		return result, nil
+	}
+
+	for _, id := range ids {
+		stmt, err := p.db.GetStatement(id)
+		if err != nil || stmt == nil {
+			result.Failed++
+			p.logger.Error("failed to load statement for purge", "statement_id", id, "error", err)
+			continue
+		}
+
+		if p.policy.HardDelete {
+			err = p.db.DeleteStatement(id)
+		} else {
+			err = p.db.SoftDeleteStatement(id)
+		}
+
+		if err != nil {
+			result.Failed++
+			p.logger.Error("failed to purge statement", "statement_id", id, "error", err)
+			continue
+		}
+		result.Purged++
+
+		// Forced re-uploads share the file of the statement they duplicate.
+		if inUse, err := p.db.FileInUse(stmt.FileHash); err != nil {
+			p.logger.Error("failed to check original file use", "statement_id", id, "error", err)
+		} else if !inUse && p.files != nil {
+			if err := p.files.Delete(stmt.FileHash); err != nil {
+				p.logger.Error("failed to remove original file", "statement_id", id, "error", err)
+			}
+		}
+
+		p.audit.RecordAs(auditActor, audit.ActionDelete, audit.TargetStatement, id, map[string]any{
+			"reason":      "retention",
+			"hard_delete": p.policy.HardDelete,
+		})
+	}
+
+	p.logger.Info("retention purge complete",
+		"cutoff", cutoff.UTC().Format(time.RFC3339),
+		"candidates", result.Candidates,
+		"purged", result.Purged,
+		"failed", result.Failed,
+		"hard_delete", p.policy.HardDelete,
+	)
+
+	return result, nil
+}
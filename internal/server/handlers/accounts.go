@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// AccountsHandler serves reports across the statements of an account. Accounts
+// are identified by the account_name given at upload, matched case-insensitively.
+type AccountsHandler struct {
+	db       *database.DB
+	currency string
+	logger   *slog.Logger
+}
+
+// NewAccountsHandler creates a new AccountsHandler. Amounts are formatted in
+// currency, an ISO 4217 code.
+func NewAccountsHandler(db *database.DB, currency string, logger *slog.Logger) *AccountsHandler {
+	return &AccountsHandler{
+		db:       db,
+		currency: currency,
+		logger:   logger,
+	}
+}
+
+type categorySummary struct {
+	Category         string `json:"category"`
+	Inflow           string `json:"inflow"`
+	Outflow          string `json:"outflow"`
+	Net              string `json:"net"`
+	TransactionCount int    `json:"transaction_count"`
+}
+
+type accountSummaryResponse struct {
+	Account          string            `json:"account"`
+	Currency         string            `json:"currency"`
+	From             string            `json:"from,omitempty"`
+	To               string            `json:"to,omitempty"`
+	Inflow           string            `json:"inflow"`
+	Outflow          string            `json:"outflow"`
+	Net              string            `json:"net"`
+	TransactionCount int               `json:"transaction_count"`
+	Categories       []categorySummary `json:"categories"`
+}
+
+// Summary handles GET /accounts/{account}/summary. It totals the money coming in
+// and going out of the account by category, optionally limited to transaction
+// dates between from and to (YYYY-MM-DD, inclusive). Outflow is reported as a
+// positive amount; net is inflow minus outflow.
+func (h *AccountsHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("account")
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+
+	for _, p := range []struct{ name, value string }{{"from", from}, {"to", to}} {
+		if p.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", p.value); err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid " + p.name + ": expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "from must not be after to"})
+		return
+	}
+
+	exists, err := h.db.HasAccount(tenant(r), account)
+	if err != nil {
+		h.logger.Error("get account failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load account"})
+		return
+	}
+	if !exists {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "account not found"})
+		return
+	}
+
+	totals, err := h.db.SummarizeAccount(tenant(r), account, from, to)
+	if err != nil {
+		h.logger.Error("summarize account failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to summarize account"})
+		return
+	}
+
+	resp := accountSummaryResponse{
+		Account:    database.AccountKey(account),
+		Currency:   h.currency,
+		From:       from,
+		To:         to,
+		Categories: make([]categorySummary, len(totals)),
+	}
+
+	var inflow, outflow int64
+	for i, c := range totals {
+		inflow += c.InflowCents
+		outflow += c.OutflowCents
+		resp.TransactionCount += c.Count
+		resp.Categories[i] = categorySummary{
+			Category:         c.Category,
+			Inflow:           transaction.FormatCurrency(c.InflowCents, h.currency),
+			Outflow:          transaction.FormatCurrency(c.OutflowCents, h.currency),
+			Net:              transaction.FormatCurrency(c.InflowCents-c.OutflowCents, h.currency),
+			TransactionCount: c.Count,
+		}
+	}
+	resp.Inflow = transaction.FormatCurrency(inflow, h.currency)
+	resp.Outflow = transaction.FormatCurrency(outflow, h.currency)
+	resp.Net = transaction.FormatCurrency(inflow-outflow, h.currency)
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+type accountStatementsResponse struct {
+	Account        string              `json:"account"`
+	StatementCount int                 `json:"statement_count"`
+	From           string              `json:"from,omitempty"`
+	To             string              `json:"to,omitempty"`
+	Statements     []statementResponse `json:"statements"`
+}
+
+// Statements handles GET /accounts/{account}/statements: a page of the
+// account's statements, filtered and paged like GET /statements, with the
+// number of statements the account has and the range of transaction dates
+// they cover.
+func (h *AccountsHandler) Statements(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("account")
+
+	filter, err := statementFilter(r)
+	if err == nil {
+		err = statementPage(r, &filter)
+	}
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	filter.Account = account
+
+	count, err := h.db.CountAccountStatements(tenant(r), account)
+	if err != nil {
+		h.logger.Error("count account statements failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load account"})
+		return
+	}
+	if count == 0 {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "account not found"})
+		return
+	}
+
+	from, to, err := h.db.AccountPeriod(tenant(r), account)
+	if err != nil {
+		h.logger.Error("get account period failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load account"})
+		return
+	}
+
+	statements, err := h.db.ListStatements(filter)
+	if err != nil {
+		h.logger.Error("list statements failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statements"})
+		return
+	}
+
+	resp := accountStatementsResponse{
+		Account:        database.AccountKey(account),
+		StatementCount: count,
+		From:           from,
+		To:             to,
+		Statements:     make([]statementResponse, len(statements)),
+	}
+	for i := range statements {
+		resp.Statements[i] = newStatementResponse(r, &statements[i])
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditHandler serves the read-only audit log.
+type AuditHandler struct {
+	db     *database.DB
+	logger *slog.Logger
+}
+
+// NewAuditHandler creates a new AuditHandler.
+func NewAuditHandler(db *database.DB, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type auditEntryResponse struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	ClientIP   string          `json:"client_ip,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Details    json.RawMessage `json:"details"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// List handles GET /admin/audit. Entries are returned newest first and can be
+// filtered by actor, action, target_id and a since/until range of RFC 3339
+// times or dates in the request's timezone, until covering its whole day. With
+// tenant isolation, callers only see their own entries.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.AuditFilter{
+		Actor:    q.Get("actor"),
+		Action:   q.Get("action"),
+		TargetID: q.Get("target_id"),
+		Limit:    defaultAuditLimit,
+	}
+
+	// Tenants only see the entries recorded under their own key name.
+	if t := tenant(r); t != "" {
+		if filter.Actor != "" && filter.Actor != t {
+			writeJSON(w, r, http.StatusOK, []auditEntryResponse{})
+			return
+		}
+		filter.Actor = t
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+		end  bool
+	}{
+		{"since", &filter.Since, false},
+		{"until", &filter.Until, true},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(r, v, p.end)
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid " + p.name + ": expected RFC 3339 time or YYYY-MM-DD"})
+			return
+		}
+		*p.dst = t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := h.db.ListAuditEntries(filter)
+	if err != nil {
+		h.logger.Error("list audit entries failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load audit log"})
+		return
+	}
+
+	resp := make([]auditEntryResponse, len(entries))
+	for i, e := range entries {
+		resp[i] = auditEntryResponse{
+			ID:         e.ID,
+			Actor:      e.Actor,
+			ClientIP:   e.ClientIP,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			Details:    json.RawMessage(e.Details),
+			CreatedAt:  localTime(r, e.CreatedAt),
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
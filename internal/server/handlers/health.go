@@ -4,8 +4,10 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/billdaws/moneymanager/internal/buildinfo"
 	"github.com/billdaws/moneymanager/internal/database"
 	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/sysmem"
 )
 
 // HealthResponse represents the health check response.
@@ -14,6 +16,26 @@ type HealthResponse struct {
 	KreuzbergAvailable  bool   `json:"kreuzberg_available"`
 	GnuCashDBWritable   bool   `json:"gnucash_db_writable"`
 	MetadataDBConnected bool   `json:"metadata_db_connected"`
+
+	Memory memoryResponse  `json:"memory"`
+	Build  versionResponse `json:"build"`
+}
+
+// memoryResponse reports memory use in bytes. Available and limit are omitted
+// where they can't be read.
+type memoryResponse struct {
+	AvailableBytes *uint64 `json:"available_bytes,omitempty"`
+	LimitBytes     *uint64 `json:"limit_bytes,omitempty"`
+	ProcessBytes   uint64  `json:"process_bytes"`
+	HeapBytes      uint64  `json:"heap_bytes"`
+}
+
+func newMemoryResponse(s sysmem.Stats) memoryResponse {
+	resp := memoryResponse{ProcessBytes: s.Process, HeapBytes: s.Heap}
+	if s.Known() {
+		resp.AvailableBytes, resp.LimitBytes = &s.Available, &s.Limit
+	}
+	return resp
 }
 
 // HealthHandler handles health check requests with real dependency checks.
@@ -49,11 +71,13 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		httpStatus = http.StatusServiceUnavailable
 	}
 
-	writeJSON(w, httpStatus, HealthResponse{
+	writeJSON(w, r, httpStatus, HealthResponse{
 		Status:              status,
 		KreuzbergAvailable:  kreuzbergOK,
 		GnuCashDBWritable:   gnucashOK,
 		MetadataDBConnected: metadataOK,
+		Memory:              newMemoryResponse(sysmem.Read()),
+		Build:               newVersionResponse(buildinfo.Get()),
 	})
 }
 
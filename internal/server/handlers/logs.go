@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+)
+
+// LogsHandler serves processing logs, across all statements or for one.
+type LogsHandler struct {
+	db     *database.DB
+	logger *slog.Logger
+}
+
+// NewLogsHandler creates a new LogsHandler.
+func NewLogsHandler(db *database.DB, logger *slog.Logger) *LogsHandler {
+	return &LogsHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type logEntryResponse struct {
+	ID          int64          `json:"id"`
+	StatementID string         `json:"statement_id"`
+	Level       database.Level `json:"level"`
+	Stage       string         `json:"stage"`
+	Message     string         `json:"message"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// List handles GET /logs. Entries are returned newest first, can be filtered by
+// level, stage, a since time (RFC 3339, or a date in the request's timezone)
+// and an after cursor, and are paged with limit and offset.
+func (h *LogsHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseLogFilter(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.RecentLogs(filter)
+	if err != nil {
+		h.logger.Error("list processing logs failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load processing logs"})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, newLogEntryResponses(r, entries))
+}
+
+type statementLogsResponse struct {
+	Entries []logEntryResponse `json:"entries"`
+	// Cursor is the ID of the newest entry returned, or the after parameter
+	// when there were none. Passing it back as after fetches only later entries.
+	Cursor int64 `json:"cursor"`
+}
+
+// Statement handles GET /statements/{id}/logs. Entries are returned oldest first
+// and accept the filters of List plus offset, so a live tail can poll with the
+// cursor of its previous response.
+func (h *LogsHandler) Statement(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	filter, ok := parseLogFilter(w, r)
+	if !ok {
+		return
+	}
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	entries, err := h.db.StatementLogs(id, filter)
+	if err != nil {
+		h.logger.Error("list statement logs failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load processing logs"})
+		return
+	}
+
+	resp := statementLogsResponse{Entries: newLogEntryResponses(r, entries), Cursor: filter.After}
+	if n := len(entries); n > 0 {
+		resp.Cursor = entries[n-1].ID
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// parseLogFilter reads the level, stage, since, after, limit and offset query
+// parameters. It writes a 400 response and reports false if any is invalid.
+func parseLogFilter(w http.ResponseWriter, r *http.Request) (database.LogFilter, bool) {
+	q := r.URL.Query()
+	filter := database.LogFilter{
+		Stage: q.Get("stage"),
+		Owner: tenant(r),
+		Limit: defaultLogLimit,
+	}
+
+	if v := q.Get("level"); v != "" {
+		level, err := database.ParseLevel(v)
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "level must be info, warn or error"})
+			return filter, false
+		}
+		filter.Level = level
+	}
+
+	if v := q.Get("since"); v != "" {
+		t, err := parseTime(r, v, false)
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid since: expected RFC 3339 time or YYYY-MM-DD"})
+			return filter, false
+		}
+		filter.Since = t
+	}
+
+	if v := q.Get("after"); v != "" {
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 0 {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "after must be a non-negative cursor"})
+			return filter, false
+		}
+		filter.After = after
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLogLimit {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "limit must be between 1 and " + strconv.Itoa(maxLogLimit)})
+			return filter, false
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "offset must be a non-negative integer"})
+			return filter, false
+		}
+		filter.Offset = offset
+	}
+
+	return filter, true
+}
+
+func newLogEntryResponses(r *http.Request, entries []database.LogEntry) []logEntryResponse {
+	resp := make([]logEntryResponse, len(entries))
+	for i, e := range entries {
+		resp[i] = logEntryResponse{
+			ID:          e.ID,
+			StatementID: e.StatementID,
+			Level:       e.Level,
+			Stage:       e.Stage,
+			Message:     e.Message,
+			CreatedAt:   localTime(r, e.CreatedAt),
+		}
+	}
+	return resp
+}
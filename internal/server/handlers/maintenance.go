@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// MaintenanceHandler serves database maintenance operations.
+type MaintenanceHandler struct {
+	db     *database.DB
+	audit  *audit.Recorder
+	logger *slog.Logger
+}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler.
+func NewMaintenanceHandler(db *database.DB, auditor *audit.Recorder, logger *slog.Logger) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		db:     db,
+		audit:  auditor,
+		logger: logger,
+	}
+}
+
+type vacuumResponse struct {
+	BeforeBytes    int64 `json:"before_bytes"`
+	AfterBytes     int64 `json:"after_bytes"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	DurationMS     int64 `json:"duration_ms"`
+}
+
+// Vacuum handles POST /admin/vacuum. It runs VACUUM and ANALYZE on the metadata
+// database and reports the file size before and after. Writes wait until it
+// finishes.
+func (h *MaintenanceHandler) Vacuum(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	result, err := h.db.Vacuum()
+	if err != nil {
+		h.logger.Error("vacuum database failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to vacuum database"})
+		return
+	}
+	duration := time.Since(start)
+	reclaimed := result.BeforeBytes - result.AfterBytes
+
+	h.logger.Info("vacuumed database",
+		"duration", duration,
+		"before_bytes", result.BeforeBytes,
+		"after_bytes", result.AfterBytes,
+		"reclaimed_bytes", reclaimed,
+	)
+	h.audit.Record(r.Context(), audit.ActionVacuum, "", "", map[string]any{"reclaimed_bytes": reclaimed})
+
+	writeJSON(w, r, http.StatusOK, vacuumResponse{
+		BeforeBytes:    result.BeforeBytes,
+		AfterBytes:     result.AfterBytes,
+		ReclaimedBytes: reclaimed,
+		DurationMS:     duration.Milliseconds(),
+	})
+}
+
+type schemaResponse struct {
+	Version  int   `json:"version"`
+	Latest   int   `json:"latest"`
+	Pending  []int `json:"pending"`
+	UpToDate bool  `json:"up_to_date"`
+}
+
+func newSchemaResponse(s database.SchemaStatus) schemaResponse {
+	return schemaResponse{
+		Version:  s.Version,
+		Latest:   s.Latest,
+		Pending:  s.Pending(),
+		UpToDate: s.Version == s.Latest,
+	}
+}
+
+// Schema handles GET /admin/schema. It reports the schema version of the
+// metadata database, the latest version this build knows and the migrations
+// still pending.
+func (h *MaintenanceHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	status, err := h.db.SchemaStatus()
+	if err != nil {
+		h.logger.Error("read schema version failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to read schema version"})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newSchemaResponse(status))
+}
+
+type migrateResponse struct {
+	schemaResponse
+	Applied []int `json:"applied"`
+}
+
+// Migrate handles POST /admin/migrate. It applies any pending migrations and
+// reports those applied along with the resulting schema version; running it
+// again applies nothing. Writes wait until it finishes.
+func (h *MaintenanceHandler) Migrate(w http.ResponseWriter, r *http.Request) {
+	applied, err := h.db.Migrate()
+	if err != nil {
+		h.logger.Error("migrate database failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to migrate database"})
+		return
+	}
+	status, err := h.db.SchemaStatus()
+	if err != nil {
+		h.logger.Error("read schema version failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to read schema version"})
+		return
+	}
+
+	if len(applied) > 0 {
+		h.logger.Info("migrated database", "applied", applied, "version", status.Version)
+	}
+	h.audit.Record(r.Context(), audit.ActionMigrate, "", "", map[string]any{"applied": applied, "version": status.Version})
+
+	writeJSON(w, r, http.StatusOK, migrateResponse{schemaResponse: newSchemaResponse(status), Applied: applied})
+}
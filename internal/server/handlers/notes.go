@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// maxNoteLength caps the characters in a note body.
+const maxNoteLength = 4000
+
+// NotesHandler manages reviewer notes on statements.
+type NotesHandler struct {
+	db     *database.DB
+	audit  *audit.Recorder
+	logger *slog.Logger
+}
+
+// NewNotesHandler creates a new NotesHandler.
+func NewNotesHandler(db *database.DB, auditor *audit.Recorder, logger *slog.Logger) *NotesHandler {
+	return &NotesHandler{
+		db:     db,
+		audit:  auditor,
+		logger: logger,
+	}
+}
+
+type noteResponse struct {
+	ID          int64     `json:"id"`
+	StatementID string    `json:"statement_id"`
+	Author      string    `json:"author"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newNoteResponse(r *http.Request, n *database.Note) noteResponse {
+	return noteResponse{
+		ID:          n.ID,
+		StatementID: n.StatementID,
+		Author:      n.Author,
+		Body:        n.Body,
+		CreatedAt:   localTime(r, n.CreatedAt),
+	}
+}
+
+type createNoteRequest struct {
+	Body string `json:"body"`
+}
+
+// Create handles POST /statements/{id}/notes. The author is the name of the
+// API key that made the request.
+func (h *NotesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.statementExists(w, r, id) {
+		return
+	}
+
+	var req createNoteRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	body := strings.TrimSpace(req.Body)
+	switch {
+	case body == "":
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "body is required"})
+		return
+	case utf8.RuneCountInString(body) > maxNoteLength:
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "body must be at most " + strconv.Itoa(maxNoteLength) + " characters"})
+		return
+	}
+
+	note, err := h.db.AddNote(id, audit.Actor(r.Context()), body)
+	if err != nil || note == nil {
+		h.logger.Error("add note failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to add note"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionNoteAdd, audit.TargetStatement, id, map[string]any{"note_id": note.ID})
+
+	writeJSON(w, r, http.StatusCreated, newNoteResponse(r, note))
+}
+
+// List handles GET /statements/{id}/notes, oldest first.
+func (h *NotesHandler) List(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.statementExists(w, r, id) {
+		return
+	}
+
+	notes, err := h.db.ListNotes(id)
+	if err != nil {
+		h.logger.Error("list notes failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load notes"})
+		return
+	}
+
+	resp := make([]noteResponse, len(notes))
+	for i := range notes {
+		resp[i] = newNoteResponse(r, &notes[i])
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// Delete handles DELETE /statements/{id}/notes/{note}.
+func (h *NotesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	noteID, err := strconv.ParseInt(r.PathValue("note"), 10, 64)
+	if err != nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "note not found"})
+		return
+	}
+	if !h.statementExists(w, r, id) {
+		return
+	}
+
+	deleted, err := h.db.DeleteNote(id, noteID)
+	if err != nil {
+		h.logger.Error("delete note failed", "statement_id", id, "note_id", noteID, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to delete note"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "note not found"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionNoteDelete, audit.TargetStatement, id, map[string]any{"note_id": noteID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// statementExists writes a 404 or 500 response and reports false unless the
+// statement exists and hasn't been deleted.
+func (h *NotesHandler) statementExists(w http.ResponseWriter, r *http.Request, id string) bool {
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return false
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/billdaws/moneymanager/internal/statement"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+type previewTransaction struct {
+	RowIndex    int    `json:"row_index"`
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	AmountCents int64  `json:"amount_cents"`
+	Category    string `json:"category"`
+	Balance     string `json:"balance,omitempty"`
+	Merchant    string `json:"merchant,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+}
+
+type previewResponse struct {
+	Filename         string               `json:"filename"`
+	MimeType         string               `json:"mime_type"`
+	Mapping          headerMapping        `json:"mapping"`
+	RowCount         int                  `json:"row_count"`
+	Extractor        string               `json:"extractor"`
+	Skipped          int                  `json:"skipped"`
+	Transactions     []previewTransaction `json:"transactions"`
+	Warnings         []string             `json:"warnings"`
+	Reconciled       *bool                `json:"reconciled,omitempty"`
+	Discrepancy      string               `json:"discrepancy,omitempty"`
+	ProcessingTimeMs int64                `json:"processing_time_ms"`
+
+	DetectedAccountType   string   `json:"detected_account_type,omitempty"`
+	AccountTypeConfidence *float64 `json:"account_type_confidence,omitempty"`
+
+	Charset   string `json:"charset,omitempty"`
+	Delimiter string `json:"delimiter,omitempty"`
+}
+
+// Preview handles POST /parse/preview. It takes the same form as POST /upload and
+// returns the transactions the file would produce, without storing anything.
+// The date_header, description_header, amount_header, merchant_header,
+// reference_header and type_header fields override the account's header
+// profile for this request.
+func (h *UploadHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	if err := h.parseMultipartForm(w, r, 1); err != nil {
+		writeFormError(w, r, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "missing or invalid 'file' field"})
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	result, err := h.processor.Preview(statement.Upload{
+		Filename:    header.Filename,
+		Body:        file,
+		AccountType: r.FormValue("account_type"),
+		AccountName: r.FormValue("account_name"),
+		Charset:     r.FormValue("charset"),
+		Delimiter:   r.FormValue("delimiter"),
+		Currency:    r.FormValue("currency"),
+
+		ParseStrategy: r.FormValue("parse_strategy"),
+
+		OpeningBalance: r.FormValue("opening_balance"),
+		ClosingBalance: r.FormValue("closing_balance"),
+
+		Owner: tenant(r),
+	}, transaction.Mapping{
+		Date:        r.FormValue("date_header"),
+		Description: r.FormValue("description_header"),
+		Amount:      r.FormValue("amount_header"),
+		Merchant:    r.FormValue("merchant_header"),
+		Reference:   r.FormValue("reference_header"),
+		Type:        r.FormValue("type_header"),
+	})
+	if err != nil {
+		h.logger.Error("preview failed",
+			"filename", header.Filename,
+			"error", err,
+		)
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, statement.ErrInvalidAccountType) || errors.Is(err, statement.ErrInvalidBalance) ||
+			errors.Is(err, statement.ErrInvalidCharset) || errors.Is(err, statement.ErrInvalidDelimiter) ||
+			errors.Is(err, statement.ErrInvalidCurrency) || errors.Is(err, statement.ErrInvalidParseStrategy) {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, r, status, errorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := previewResponse{
+		Filename:         result.Filename,
+		MimeType:         result.MimeType,
+		Mapping:          newHeaderMapping(result.Mapping),
+		RowCount:         len(result.Rows),
+		Extractor:        result.Extractor,
+		Skipped:          result.Skipped,
+		Transactions:     make([]previewTransaction, len(result.Transactions)),
+		Warnings:         result.Warnings,
+		ProcessingTimeMs: result.ProcessingTimeMs,
+		Charset:          result.Charset,
+	}
+	if result.Delimiter != 0 {
+		resp.Delimiter = string(result.Delimiter)
+	}
+	if resp.Warnings == nil {
+		resp.Warnings = []string{}
+	}
+	for i, t := range result.Transactions {
+		resp.Transactions[i] = previewTransaction{
+			RowIndex:    t.RowIndex,
+			Date:        t.Date,
+			Description: t.Description,
+			Amount:      transaction.FormatAmount(t.AmountCents),
+			AmountCents: t.AmountCents,
+			Category:    t.Category,
+			Merchant:    t.Merchant,
+			Reference:   t.Reference,
+			Type:        t.Type,
+			Currency:    t.Currency,
+		}
+		if t.BalanceCents != nil {
+			resp.Transactions[i].Balance = transaction.FormatAmount(*t.BalanceCents)
+		}
+	}
+	if rec := result.Reconciliation; rec != nil {
+		resp.Reconciled = &rec.Reconciled
+		resp.Discrepancy = transaction.FormatAmount(rec.DiscrepancyCents)
+	}
+	if result.DetectedAccountType != "" {
+		resp.DetectedAccountType = result.DetectedAccountType
+		resp.AccountTypeConfidence = &result.AccountTypeConfidence
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// HeaderProfilesHandler manages the per-account header mapping profiles used
+// to locate the date, description and amount columns of a statement, and the
+// optional merchant, reference and type columns.
+type HeaderProfilesHandler struct {
+	db     *database.DB
+	audit  *audit.Recorder
+	logger *slog.Logger
+}
+
+// NewHeaderProfilesHandler creates a new HeaderProfilesHandler.
+func NewHeaderProfilesHandler(db *database.DB, auditor *audit.Recorder, logger *slog.Logger) *HeaderProfilesHandler {
+	return &HeaderProfilesHandler{
+		db:     db,
+		audit:  auditor,
+		logger: logger,
+	}
+}
+
+type headerMapping struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Merchant    string `json:"merchant,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+// newHeaderMapping returns the response form of m.
+func newHeaderMapping(m transaction.Mapping) headerMapping {
+	return headerMapping{
+		Date:        m.Date,
+		Description: m.Description,
+		Amount:      m.Amount,
+		Merchant:    m.Merchant,
+		Reference:   m.Reference,
+		Type:        m.Type,
+	}
+}
+
+type headerProfileResponse struct {
+	AccountName string        `json:"account_name"`
+	Mapping     headerMapping `json:"mapping"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+func newHeaderProfileResponse(r *http.Request, p *database.HeaderProfile) headerProfileResponse {
+	return headerProfileResponse{
+		AccountName: p.AccountName,
+		Mapping: headerMapping{
+			Date:        p.DateHeader,
+			Description: p.DescriptionHeader,
+			Amount:      p.AmountHeader,
+			Merchant:    p.MerchantHeader,
+			Reference:   p.ReferenceHeader,
+			Type:        p.TypeHeader,
+		},
+		CreatedAt: localTime(r, p.CreatedAt),
+		UpdatedAt: localTime(r, p.UpdatedAt),
+	}
+}
+
+// List handles GET /header-profiles.
+func (h *HeaderProfilesHandler) List(w http.ResponseWriter, r *http.Request) {
+	profiles, err := h.db.ListHeaderProfiles(tenant(r))
+	if err != nil {
+		h.logger.Error("list header profiles failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load header profiles"})
+		return
+	}
+
+	resp := make([]headerProfileResponse, len(profiles))
+	for i := range profiles {
+		resp[i] = newHeaderProfileResponse(r, &profiles[i])
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// Get handles GET /accounts/{account}/header-profile.
+func (h *HeaderProfilesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("account")
+
+	profile, err := h.db.GetHeaderProfile(tenant(r), account)
+	if err != nil {
+		h.logger.Error("get header profile failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load header profile"})
+		return
+	}
+	if profile == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "header profile not found"})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, newHeaderProfileResponse(r, profile))
+}
+
+// Put handles PUT /accounts/{account}/header-profile, creating or replacing the
+// account's profile. It applies to statements uploaded with that account_name.
+func (h *HeaderProfilesHandler) Put(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("account")
+	if database.ProfileKey(account) == "" {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "account name is required"})
+		return
+	}
+
+	var req headerMapping
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	req.Date = strings.TrimSpace(req.Date)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Amount = strings.TrimSpace(req.Amount)
+	req.Merchant = strings.TrimSpace(req.Merchant)
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Type = strings.TrimSpace(req.Type)
+	if req == (headerMapping{}) {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "at least one header is required"})
+		return
+	}
+
+	if err := h.db.UpsertHeaderProfile(database.HeaderProfile{
+		OwnerID:           tenant(r),
+		AccountName:       account,
+		DateHeader:        req.Date,
+		DescriptionHeader: req.Description,
+		AmountHeader:      req.Amount,
+		MerchantHeader:    req.Merchant,
+		ReferenceHeader:   req.Reference,
+		TypeHeader:        req.Type,
+	}); err != nil {
+		h.logger.Error("save header profile failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to save header profile"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionHeaderProfilePut, audit.TargetHeaderProfile, database.ProfileKey(account), map[string]any{
+		"date":        req.Date,
+		"description": req.Description,
+		"amount":      req.Amount,
+		"merchant":    req.Merchant,
+		"reference":   req.Reference,
+		"type":        req.Type,
+	})
+
+	profile, err := h.db.GetHeaderProfile(tenant(r), account)
+	if err != nil || profile == nil {
+		h.logger.Error("reload header profile failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load header profile"})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, newHeaderProfileResponse(r, profile))
+}
+
+// Delete handles DELETE /accounts/{account}/header-profile.
+func (h *HeaderProfilesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("account")
+
+	deleted, err := h.db.DeleteHeaderProfile(tenant(r), account)
+	if err != nil {
+		h.logger.Error("delete header profile failed", "account", account, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to delete header profile"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "header profile not found"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionHeaderProfileDelete, audit.TargetHeaderProfile, database.ProfileKey(account), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type headerSuggestionResponse struct {
+	StatementID string        `json:"statement_id"`
+	AccountName string        `json:"account_name"`
+	Headers     []string      `json:"headers"`
+	Suggestion  headerMapping `json:"suggestion"`
+}
+
+// Suggest handles GET /statements/{id}/header-profile/suggestion. It proposes a
+// mapping from the statement's extracted headers for the user to confirm with
+// PUT /accounts/{account}/header-profile.
+func (h *HeaderProfilesHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	tables, err := h.db.ListRawHeaders(id)
+	if err != nil {
+		h.logger.Error("list raw headers failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load headers"})
+		return
+	}
+	if len(tables) == 0 {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement has no extracted tables"})
+		return
+	}
+
+	// Propose the mapping for the table whose headers cover the most fields.
+	best, bestScore := 0, -1
+	var suggestion transaction.Mapping
+	for i, headers := range tables {
+		m := transaction.Suggest(headers)
+		score := 0
+		for _, field := range []string{m.Date, m.Description, m.Amount} {
+			if field != "" {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore, suggestion = i, score, m
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, headerSuggestionResponse{
+		StatementID: id,
+		AccountName: stmt.AccountName,
+		Headers:     tables[best],
+		Suggestion:  newHeaderMapping(suggestion),
+	})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// maxReportPeriods caps the periods of a report, so a long range at day
+// granularity can't produce an unbounded response.
+const maxReportPeriods = 1000
+
+// periodLayouts is the time layout of each granularity's period labels, as
+// the database writes them.
+var periodLayouts = map[string]string{
+	database.GranularityDay:   time.DateOnly,
+	database.GranularityMonth: "2006-01",
+	database.GranularityYear:  "2006",
+}
+
+// ReportsHandler serves reports across accounts.
+type ReportsHandler struct {
+	db       *database.DB
+	currency string
+	logger   *slog.Logger
+}
+
+// NewReportsHandler creates a new ReportsHandler. Amounts are formatted in
+// currency, an ISO 4217 code.
+func NewReportsHandler(db *database.DB, currency string, logger *slog.Logger) *ReportsHandler {
+	return &ReportsHandler{
+		db:       db,
+		currency: currency,
+		logger:   logger,
+	}
+}
+
+type periodSummary struct {
+	Period           string `json:"period"`
+	Inflow           string `json:"inflow"`
+	Outflow          string `json:"outflow"`
+	Net              string `json:"net"`
+	TransactionCount int    `json:"transaction_count"`
+}
+
+type categorySeries struct {
+	Category string          `json:"category"`
+	Periods  []periodSummary `json:"periods"`
+}
+
+type categoryReportResponse struct {
+	Currency    string           `json:"currency"`
+	Granularity string           `json:"granularity"`
+	From        string           `json:"from,omitempty"`
+	To          string           `json:"to,omitempty"`
+	Accounts    []string         `json:"accounts,omitempty"`
+	Periods     []string         `json:"periods"`
+	Categories  []categorySeries `json:"categories"`
+}
+
+// Categories handles GET /reports/categories. It totals transactions by
+// category and period (granularity day, month or year; month by default),
+// optionally limited to transaction dates between from and to (YYYY-MM-DD,
+// inclusive) and to the statements of the account parameter (repeated or
+// comma-separated). Every category has an entry for every period in the
+// range, zero when it had no transactions, so a chart has no gaps. Without
+// from and to the range spans the transactions found.
+func (h *ReportsHandler) Categories(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+
+	granularity := q.Get("granularity")
+	if granularity == "" {
+		granularity = database.GranularityMonth
+	}
+	layout, ok := periodLayouts[granularity]
+	if !ok {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "granularity must be day, month or year"})
+		return
+	}
+
+	for _, p := range []struct{ name, value string }{{"from", from}, {"to", to}} {
+		if p.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, p.value); err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid " + p.name + ": expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "from must not be after to"})
+		return
+	}
+
+	var accounts []string
+	for _, v := range q["account"] {
+		for _, account := range strings.Split(v, ",") {
+			if account = database.AccountKey(account); account != "" {
+				accounts = append(accounts, account)
+			}
+		}
+	}
+
+	totals, err := h.db.CategorySpending(tenant(r), accounts, from, to, granularity)
+	if err != nil {
+		h.logger.Error("category spending report failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to build report"})
+		return
+	}
+
+	// The range runs from the period of from, or the earliest found, to the
+	// period of to, or the latest.
+	var first, last string
+	for _, t := range totals {
+		if first == "" || t.Period < first {
+			first = t.Period
+		}
+		last = max(last, t.Period)
+	}
+	if from != "" {
+		first = periodOf(from, layout)
+	}
+	if to != "" {
+		last = periodOf(to, layout)
+	}
+
+	periods, ok := periodLabels(first, last, layout, granularity)
+	if !ok {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "range spans more than " + strconv.Itoa(maxReportPeriods) + " periods; use a coarser granularity"})
+		return
+	}
+
+	resp := categoryReportResponse{
+		Currency:    h.currency,
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		Accounts:    accounts,
+		Periods:     periods,
+		Categories:  []categorySeries{},
+	}
+
+	index := make(map[string]int, len(periods))
+	for i, p := range periods {
+		index[p] = i
+	}
+	for _, t := range totals {
+		n := len(resp.Categories)
+		if n == 0 || resp.Categories[n-1].Category != t.Category {
+			resp.Categories = append(resp.Categories, h.emptySeries(t.Category, periods))
+			n++
+		}
+		resp.Categories[n-1].Periods[index[t.Period]] = periodSummary{
+			Period:           t.Period,
+			Inflow:           transaction.FormatCurrency(t.InflowCents, h.currency),
+			Outflow:          transaction.FormatCurrency(t.OutflowCents, h.currency),
+			Net:              transaction.FormatCurrency(t.InflowCents-t.OutflowCents, h.currency),
+			TransactionCount: t.Count,
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// emptySeries returns a category's series with a zero entry for every period.
+func (h *ReportsHandler) emptySeries(category string, periods []string) categorySeries {
+	zero := transaction.FormatCurrency(0, h.currency)
+	s := categorySeries{Category: category, Periods: make([]periodSummary, len(periods))}
+	for i, p := range periods {
+		s.Periods[i] = periodSummary{Period: p, Inflow: zero, Outflow: zero, Net: zero}
+	}
+	return s
+}
+
+// periodOf returns the label of the period a YYYY-MM-DD date falls in.
+func periodOf(date, layout string) string {
+	t, _ := time.Parse(time.DateOnly, date)
+	return t.Format(layout)
+}
+
+// periodLabels lists the period labels from first to last inclusive. It
+// reports false when there are more than maxReportPeriods.
+func periodLabels(first, last, layout, granularity string) ([]string, bool) {
+	labels := []string{}
+	if first == "" || last == "" {
+		return labels, true
+	}
+	t, err := time.Parse(layout, first)
+	if err != nil {
+		return labels, true
+	}
+	for label := first; label <= last; label = t.Format(layout) {
+		if len(labels) == maxReportPeriods {
+			return nil, false
+		}
+		labels = append(labels, label)
+		switch granularity {
+		case database.GranularityDay:
+			t = t.AddDate(0, 0, 1)
+		case database.GranularityMonth:
+			t = t.AddDate(0, 1, 0)
+		default:
+			t = t.AddDate(1, 0, 0)
+		}
+	}
+	return labels, true
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/buildinfo"
+	"github.com/billdaws/moneymanager/internal/requestinfo"
+)
+
+// writeJSON encodes v as the response body. Successful responses honor the
+// ?pretty and ?fields query parameters (see encodeJSON), and all of them are
+// enveloped for requests that asked for it (see envelop).
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	var body []byte
+	var err error
+	if status < 300 {
+		body, err = encodeJSON(r, v)
+	} else {
+		body, err = json.Marshal(v)
+		body = append(body, '\n')
+	}
+	if err == nil {
+		body, err = envelop(r, body)
+	}
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// encodeJSON marshals v for the response to r:
+//   - ?pretty=true indents the output for humans; compact is the default.
+//   - ?fields=a,b keeps only the listed top-level fields of an object, or of
+//     each object in an array, to reduce payload size.
+func encodeJSON(r *http.Request, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		body, err = projectFields(body, strings.Split(fields, ","))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err != nil {
+			return nil, err
+		}
+		body = indented.Bytes()
+	}
+
+	return append(body, '\n'), nil
+}
+
+// envelope wraps the JSON responses of requests that asked for one.
+type envelope struct {
+	Data json.RawMessage `json:"data"`
+	Meta envelopeMeta    `json:"meta"`
+}
+
+type envelopeMeta struct {
+	RequestID        string `json:"request_id"`
+	ProcessingTimeMs int64  `json:"processing_time_ms"`
+	Version          string `json:"version"`
+}
+
+// envelop wraps body, a response encoded for r, in an envelope when r asked
+// for one through requestinfo.Middleware, and returns it unchanged otherwise.
+func envelop(r *http.Request, body []byte) ([]byte, error) {
+	info, ok := requestinfo.FromContext(r.Context())
+	if !ok || !info.Envelope {
+		return body, nil
+	}
+
+	wrapped, err := json.Marshal(envelope{
+		Data: body,
+		Meta: envelopeMeta{
+			RequestID:        info.ID,
+			ProcessingTimeMs: time.Since(info.Start).Milliseconds(),
+			Version:          buildinfo.Get().Version,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Marshalling compacts the data, so indent the whole envelope again.
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, wrapped, "", "  "); err != nil {
+			return nil, err
+		}
+		wrapped = indented.Bytes()
+	}
+
+	return append(wrapped, '\n'), nil
+}
+
+// projectFields keeps only the named keys of a JSON object, or of every object
+// in a JSON array. Other JSON values are returned unchanged.
+func projectFields(body []byte, fields []string) ([]byte, error) {
+	keep := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			keep[f] = true
+		}
+	}
+
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, err
+	}
+
+	project := func(v any) any {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		for k := range obj {
+			if !keep[k] {
+				delete(obj, k)
+			}
+		}
+		return obj
+	}
+
+	switch d := decoded.(type) {
+	case []any:
+		for i := range d {
+			d[i] = project(d[i])
+		}
+	default:
+		decoded = project(d)
+	}
+
+	return json.Marshal(decoded)
+}
@@ -0,0 +1,1032 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/storage"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// StatementsHandler handles requests for individual statements under /statements/{id}.
+type StatementsHandler struct {
+	db                      *database.DB
+	files                   storage.FileStore
+	reconcileToleranceCents int64
+	audit                   *audit.Recorder
+	logger                  *slog.Logger
+}
+
+// NewStatementsHandler creates a new StatementsHandler.
+func NewStatementsHandler(db *database.DB, files storage.FileStore, reconcileToleranceCents int64, auditor *audit.Recorder, logger *slog.Logger) *StatementsHandler {
+	return &StatementsHandler{
+		db:                      db,
+		files:                   files,
+		reconcileToleranceCents: reconcileToleranceCents,
+		audit:                   auditor,
+		logger:                  logger,
+	}
+}
+
+type statementResponse struct {
+	ID               string     `json:"id"`
+	Filename         string     `json:"filename"`
+	FileHash         string     `json:"file_hash"`
+	HashAlgorithm    string     `json:"hash_algorithm"`
+	DuplicateOf      string     `json:"duplicate_of,omitempty"`
+	FileSize         int64      `json:"file_size"`
+	MimeType         string     `json:"mime_type"`
+	Status           string     `json:"status"`
+	TransactionCount int        `json:"transaction_count"`
+	AccountType      string     `json:"account_type"`
+	AccountName      string     `json:"account_name"`
+	StatementDate    string     `json:"statement_date"`
+	Currency         string     `json:"currency,omitempty"`
+	ErrorMessage     string     `json:"error_message,omitempty"`
+	UploadTime       time.Time  `json:"upload_time"`
+	ProcessedTime    *time.Time `json:"processed_time,omitempty"`
+	LegalHold        bool       `json:"legal_hold"`
+	OpeningBalance   string     `json:"opening_balance,omitempty"`
+	ClosingBalance   string     `json:"closing_balance,omitempty"`
+	Reconciled       *bool      `json:"reconciled,omitempty"`
+	Discrepancy      string     `json:"discrepancy,omitempty"`
+	NeedsReview      bool       `json:"needs_review"`
+	ExpectedCount    *int       `json:"expected_count,omitempty"`
+	CountMismatch    bool       `json:"count_mismatch"`
+	Tags             []string   `json:"tags"`
+
+	// AccountTypeConfidence is set when account_type was detected from the content.
+	AccountTypeConfidence *float64 `json:"account_type_confidence,omitempty"`
+	// StatementDateInferredFrom is set when statement_date was derived rather
+	// than supplied: max, month or upload_time.
+	StatementDateInferredFrom string `json:"statement_date_inferred_from,omitempty"`
+	// RetryAttempts counts the automatic retries of a failed statement, and
+	// NextRetryAt is set while another is scheduled.
+	RetryAttempts int        `json:"retry_attempts"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"`
+	// SourceCharset is the encoding of a text statement's original file.
+	SourceCharset string `json:"source_charset,omitempty"`
+}
+
+func newStatementResponse(r *http.Request, s *database.Statement) statementResponse {
+	resp := statementResponse{
+		ID:               s.ID,
+		Filename:         s.Filename,
+		FileHash:         s.FileHash,
+		HashAlgorithm:    s.HashAlgorithm,
+		DuplicateOf:      s.DuplicateOf,
+		FileSize:         s.FileSize,
+		MimeType:         s.MimeType,
+		Status:           s.Status,
+		TransactionCount: s.TransactionCount,
+		AccountType:      s.AccountType,
+		AccountName:      s.AccountName,
+		StatementDate:    s.StatementDate,
+		Currency:         s.Currency,
+		ErrorMessage:     s.ErrorMessage,
+		UploadTime:       localTime(r, s.UploadTime),
+		LegalHold:        s.LegalHold,
+		Reconciled:       s.Reconciled,
+		NeedsReview:      s.NeedsReview,
+		ExpectedCount:    s.ExpectedCount,
+		CountMismatch:    s.CountMismatch,
+		Tags:             s.Tags,
+
+		AccountTypeConfidence:     s.AccountTypeConfidence,
+		StatementDateInferredFrom: s.StatementDateInferredFrom,
+		RetryAttempts:             s.RetryAttempts,
+		SourceCharset:             s.SourceCharset,
+	}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	if !s.ProcessedTime.IsZero() {
+		processed := localTime(r, s.ProcessedTime)
+		resp.ProcessedTime = &processed
+	}
+	if !s.NextRetryAt.IsZero() {
+		next := localTime(r, s.NextRetryAt)
+		resp.NextRetryAt = &next
+	}
+	if s.OpeningBalanceCents != nil {
+		resp.OpeningBalance = transaction.FormatAmount(*s.OpeningBalanceCents)
+	}
+	if s.ClosingBalanceCents != nil {
+		resp.ClosingBalance = transaction.FormatAmount(*s.ClosingBalanceCents)
+	}
+	if s.Reconciled != nil {
+		resp.Discrepancy = transaction.FormatAmount(s.DiscrepancyCents)
+	}
+	return resp
+}
+
+const (
+	defaultStatementLimit = 100
+	maxStatementLimit     = 1000
+)
+
+// statementFilter reads the filters shared by the statement list and export:
+// the tag parameter (repeated or comma-separated) keeps statements carrying all
+// of the tags, or any of them with match=any, and q keeps those whose stored
+// content has every word of it.
+func statementFilter(r *http.Request) (database.StatementFilter, error) {
+	q := r.URL.Query()
+	filter := database.StatementFilter{Owner: tenant(r), Search: q.Get("q")}
+
+	for _, v := range q["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+
+	switch q.Get("match") {
+	case "", "all":
+	case "any":
+		filter.AnyTag = true
+	default:
+		return filter, errors.New("match must be all or any")
+	}
+
+	return filter, nil
+}
+
+// statementPage reads the limit and offset query parameters paging a
+// statement list into filter.
+func statementPage(r *http.Request, filter *database.StatementFilter) error {
+	q := r.URL.Query()
+	filter.Limit = defaultStatementLimit
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxStatementLimit {
+			return errors.New("limit must be between 1 and " + strconv.Itoa(maxStatementLimit))
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return errors.New("offset must be a non-negative integer")
+		}
+		filter.Offset = offset
+	}
+
+	return nil
+}
+
+// List handles GET /statements, most recently uploaded first, filtered as
+// described at statementFilter and paged with limit and offset.
+func (h *StatementsHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := statementFilter(r)
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if err := statementPage(r, &filter); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	statements, err := h.db.ListStatements(filter)
+	if err != nil {
+		h.logger.Error("list statements failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statements"})
+		return
+	}
+
+	resp := make([]statementResponse, len(statements))
+	for i := range statements {
+		resp[i] = newStatementResponse(r, &statements[i])
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// exportColumns are the columns of GET /statements/export.csv.
+var exportColumns = []string{
+	"id", "filename", "status", "account_type", "account_name", "statement_date",
+	"upload_time", "processed_time", "transaction_count", "file_size",
+}
+
+// Export handles GET /statements/export.csv, writing every statement matching
+// the filters of List as CSV, most recently uploaded first. Rows are written as
+// they are read, so the export needs no more memory for many statements than
+// for a few. Text cells starting with a formula character are prefixed with a
+// quote so spreadsheets don't evaluate them.
+func (h *StatementsHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := statementFilter(r)
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "statements.csv"}))
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(exportColumns)
+	err = h.db.EachStatement(filter, func(s *database.Statement) error {
+		processed := ""
+		if !s.ProcessedTime.IsZero() {
+			processed = localTime(r, s.ProcessedTime).Format(time.RFC3339)
+		}
+		return cw.Write([]string{
+			s.ID, spreadsheetSafe(s.Filename), s.Status, s.AccountType, spreadsheetSafe(s.AccountName), s.StatementDate,
+			localTime(r, s.UploadTime).Format(time.RFC3339), processed, strconv.Itoa(s.TransactionCount), strconv.FormatInt(s.FileSize, 10),
+		})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		// The status is already sent; a truncated file is all the client sees.
+		h.logger.Error("export statements failed", "error", err)
+	}
+}
+
+// spreadsheetSafe prefixes values starting with =, +, - or @ with a quote, so
+// a spreadsheet opening the export shows them rather than evaluating them.
+func spreadsheetSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Get handles GET and HEAD /statements/{id}. Both report the processing status in
+// the X-Statement-Status header and share an ETag derived from the response body,
+// so HEAD is a cheap way to poll for changes. The ETag is taken before the body
+// is enveloped, whose metadata differs on every request.
+func (h *StatementsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	body, err := encodeJSON(r, newStatementResponse(r, stmt))
+	if err != nil {
+		h.logger.Error("marshal statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to encode statement"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Statement-Status", stmt.Status)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if body, err = envelop(r, body); err != nil {
+		h.logger.Error("marshal statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to encode statement"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// Download handles GET /statements/{id}/download, serving the original file.
+// http.ServeContent handles Range requests for resumable downloads, and the
+// file hash is a strong ETag since the content never changes.
+func (h *StatementsHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	if h.files == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "original file not stored"})
+		return
+	}
+	f, err := h.files.Get(stmt.FileHash)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "original file not stored"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("open original file failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to open file"})
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	w.Header().Set("Content-Type", stmt.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stmt.Filename}))
+	w.Header().Set("ETag", `"`+stmt.FileHash+`"`)
+	http.ServeContent(w, r, stmt.Filename, f.ModTime(), f)
+}
+
+// Raw handles GET /statements/{id}/raw, returning Kreuzberg's full extraction
+// response as it was received during processing.
+func (h *StatementsHandler) Raw(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	results, err := h.db.GetExtractionResults(id)
+	if err != nil {
+		h.logger.Error("get extraction results failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load extraction results"})
+		return
+	}
+	if results == "" {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "no extraction results stored for statement"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(results))
+}
+
+// Content handles GET /statements/{id}/content, returning the text extracted
+// from a statement as plain text when content storage was on.
+func (h *StatementsHandler) Content(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	content, err := h.db.GetContent(id)
+	if err != nil {
+		h.logger.Error("get statement content failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load content"})
+		return
+	}
+	if content == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "no content stored for statement"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(content.Content))
+}
+
+type imageResponse struct {
+	ID        string    `json:"id"`
+	SourceID  string    `json:"source_id"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Images handles GET /statements/{id}/images, listing the images extracted from a statement.
+func (h *StatementsHandler) Images(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	images, err := h.db.ListImages(id)
+	if err != nil {
+		h.logger.Error("list images failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to list images"})
+		return
+	}
+
+	resp := make([]imageResponse, 0, len(images))
+	for _, img := range images {
+		resp = append(resp, imageResponse{
+			ID:        img.ID,
+			SourceID:  img.SourceID,
+			MimeType:  img.MimeType,
+			Size:      img.Size,
+			CreatedAt: localTime(r, img.CreatedAt),
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// inlineImageTypes are the raster image types Image serves inline. Anything
+// else Kreuzberg reports, such as SVG or HTML, could run script in the API's
+// origin, so it is sent as a download instead.
+var inlineImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+	"image/tiff": true,
+}
+
+// Image handles GET /statements/{id}/images/{imageID}, serving the image bytes.
+func (h *StatementsHandler) Image(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	imageID := r.PathValue("imageID")
+
+	ok, err := statementVisible(h.db, r, id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+
+	var img *database.Image
+	if ok {
+		img, err = h.db.GetImage(id, imageID)
+		if err != nil {
+			h.logger.Error("get image failed", "statement_id", id, "image_id", imageID, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load image"})
+			return
+		}
+	}
+	if img == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "image not found"})
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(img.MimeType)
+	if err != nil {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(img.Content))
+	}
+	if !inlineImageTypes[contentType] {
+		contentType = "application/octet-stream"
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "image-" + imageID}))
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(img.Content)
+}
+
+type tableResponse struct {
+	Index     int       `json:"index"`
+	Columns   int       `json:"columns"`
+	Rows      int       `json:"rows"`
+	Size      int64     `json:"size"`
+	Largest   bool      `json:"largest"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Tables handles GET /statements/{id}/tables, listing the tables exported from
+// a statement as CSV. The largest is served by default at table.csv.
+func (h *StatementsHandler) Tables(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	tables, err := h.db.ListTableExports(id)
+	if err != nil {
+		h.logger.Error("list tables failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to list tables"})
+		return
+	}
+
+	largest := largestTable(tables)
+	resp := make([]tableResponse, 0, len(tables))
+	for i, t := range tables {
+		resp = append(resp, tableResponse{
+			Index:     t.Index,
+			Columns:   t.Columns,
+			Rows:      t.Rows,
+			Size:      t.Size,
+			Largest:   i == largest,
+			CreatedAt: localTime(r, t.CreatedAt),
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// TableCSV handles GET /statements/{id}/table.csv, serving a table exported
+// from a statement: the one numbered by ?index, or else the largest.
+func (h *StatementsHandler) TableCSV(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	index := -1
+	if v := r.URL.Query().Get("index"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid index: " + strconv.Quote(v)})
+			return
+		}
+		index = n
+	}
+
+	ok, err := statementVisible(h.db, r, id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+
+	var table *database.TableExport
+	if ok && index < 0 {
+		tables, err := h.db.ListTableExports(id)
+		if err != nil {
+			h.logger.Error("list tables failed", "statement_id", id, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to list tables"})
+			return
+		}
+		if i := largestTable(tables); i >= 0 {
+			index = tables[i].Index
+		}
+	}
+	if ok && index >= 0 {
+		table, err = h.db.GetTableExport(id, index)
+		if err != nil {
+			h.logger.Error("get table failed", "statement_id", id, "index", index, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load table"})
+			return
+		}
+	}
+	if table == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "table not found"})
+		return
+	}
+
+	filename := "table-" + strconv.Itoa(table.Index) + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(table.Content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(table.Content)
+}
+
+// largestTable returns the position of the table with the most rows, the
+// first of those tied, or -1 when there are none.
+func largestTable(tables []database.TableExport) int {
+	largest := -1
+	for i, t := range tables {
+		if largest < 0 || t.Rows > tables[largest].Rows {
+			largest = i
+		}
+	}
+	return largest
+}
+
+type legalHoldResponse struct {
+	StatementID string `json:"statement_id"`
+	LegalHold   bool   `json:"legal_hold"`
+}
+
+// SetLegalHold handles PUT /statements/{id}/legal-hold, exempting a statement from retention purges.
+func (h *StatementsHandler) SetLegalHold(w http.ResponseWriter, r *http.Request) {
+	h.setLegalHold(w, r, true)
+}
+
+// ClearLegalHold handles DELETE /statements/{id}/legal-hold.
+func (h *StatementsHandler) ClearLegalHold(w http.ResponseWriter, r *http.Request) {
+	h.setLegalHold(w, r, false)
+}
+
+func (h *StatementsHandler) setLegalHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	if err := h.db.SetLegalHold(id, hold); err != nil {
+		h.logger.Error("set legal hold failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to update legal hold"})
+		return
+	}
+
+	action := audit.ActionLegalHoldSet
+	if !hold {
+		action = audit.ActionLegalHoldClear
+	}
+	h.audit.Record(r.Context(), action, audit.TargetStatement, id, nil)
+
+	writeJSON(w, r, http.StatusOK, legalHoldResponse{StatementID: id, LegalHold: hold})
+}
+
+type mergeRequest struct {
+	PrimaryID   string `json:"primary_id"`
+	SecondaryID string `json:"secondary_id"`
+}
+
+// Merge handles POST /statements/merge, folding the secondary statement into
+// the primary one. Both must be processed and belong to the same account and
+// currency. The secondary's transactions keep the ID of the statement they
+// came from, the secondary is soft-deleted, and re-uploads of its file are
+// reported as duplicates of the primary. A primary with balances is
+// reconciled again.
+func (h *StatementsHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	var req mergeRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	if req.PrimaryID == "" || req.SecondaryID == "" {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "primary_id and secondary_id are required"})
+		return
+	}
+	if req.PrimaryID == req.SecondaryID {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "cannot merge a statement into itself"})
+		return
+	}
+
+	var stmts [2]*database.Statement
+	for i, id := range []string{req.PrimaryID, req.SecondaryID} {
+		stmt, err := h.db.GetStatement(id)
+		if err != nil {
+			h.logger.Error("get statement failed", "statement_id", id, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+			return
+		}
+		if stmt == nil || !visible(r, stmt) {
+			writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found: " + id})
+			return
+		}
+		stmts[i] = stmt
+	}
+	primary, secondary := stmts[0], stmts[1]
+
+	if msg := mergeConflict(primary, secondary); msg != "" {
+		writeJSON(w, r, http.StatusConflict, errorResponse{Error: msg})
+		return
+	}
+
+	if err := h.db.MergeStatements(primary.ID, secondary.ID); err != nil {
+		h.logger.Error("merge statements failed", "statement_id", primary.ID, "secondary_id", secondary.ID, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to merge statements"})
+		return
+	}
+
+	if primary.OpeningBalanceCents != nil && primary.ClosingBalanceCents != nil {
+		total, err := h.db.SumTransactions(primary.ID)
+		if err == nil {
+			rec := transaction.Reconcile(*primary.OpeningBalanceCents, *primary.ClosingBalanceCents, total, h.reconcileToleranceCents)
+			err = h.db.SetReconciliation(primary.ID, rec.Reconciled, rec.DiscrepancyCents)
+		}
+		if err != nil {
+			h.logger.Error("reconcile merged statement failed", "statement_id", primary.ID, "error", err)
+		}
+	}
+
+	h.audit.Record(r.Context(), audit.ActionMerge, audit.TargetStatement, primary.ID, map[string]any{
+		"secondary_id":      secondary.ID,
+		"transaction_count": secondary.TransactionCount,
+	})
+
+	merged, err := h.db.GetStatement(primary.ID)
+	if err != nil || merged == nil {
+		h.logger.Error("get statement failed", "statement_id", primary.ID, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newStatementResponse(r, merged))
+}
+
+// mergeConflict explains why secondary can't be merged into primary, or
+// returns "" when it can.
+func mergeConflict(primary, secondary *database.Statement) string {
+	for _, s := range []*database.Statement{primary, secondary} {
+		if s.Status != "processed" && s.Status != "processed_empty" {
+			return "statement " + s.ID + " is " + s.Status + ", only processed statements can be merged"
+		}
+	}
+	if database.AccountKey(primary.AccountName) != database.AccountKey(secondary.AccountName) {
+		return "statements belong to different accounts"
+	}
+	if primary.Currency != "" && secondary.Currency != "" && primary.Currency != secondary.Currency {
+		return "statements are in different currencies"
+	}
+	if secondary.LegalHold {
+		return "statement " + secondary.ID + " is under legal hold"
+	}
+	return ""
+}
+
+// Commit handles POST /statements/{id}/commit, promoting the transactions of
+// a staged statement so reports include them. Statements that aren't staged
+// are answered with 409 Conflict.
+func (h *StatementsHandler) Commit(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	committed, err := h.db.CommitStatement(id)
+	if err != nil {
+		h.logger.Error("commit statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to commit statement"})
+		return
+	}
+	if !committed {
+		writeJSON(w, r, http.StatusConflict, errorResponse{Error: "statement is " + stmt.Status + ", only staged statements can be committed"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionCommit, audit.TargetStatement, id, map[string]any{
+		"transaction_count": stmt.TransactionCount,
+	})
+
+	stmt, err = h.db.GetStatement(id)
+	if err != nil || stmt == nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newStatementResponse(r, stmt))
+}
+
+type reconcileRequest struct {
+	OpeningBalance *json.Number `json:"opening_balance"`
+	ClosingBalance *json.Number `json:"closing_balance"`
+}
+
+type reconciliationResponse struct {
+	StatementID       string `json:"statement_id"`
+	OpeningBalance    string `json:"opening_balance"`
+	ClosingBalance    string `json:"closing_balance"`
+	TransactionsTotal string `json:"transactions_total"`
+	Discrepancy       string `json:"discrepancy"`
+	Reconciled        bool   `json:"reconciled"`
+}
+
+// Reconcile handles POST /statements/{id}/reconcile. It checks the statement's
+// current transactions, including manual corrections, against its opening and
+// closing balances. Balances in the optional body replace the stored ones.
+func (h *StatementsHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req reconcileRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	opening, closing := stmt.OpeningBalanceCents, stmt.ClosingBalanceCents
+	for _, b := range []struct {
+		name  string
+		value *json.Number
+		dst   **int64
+	}{
+		{"opening_balance", req.OpeningBalance, &opening},
+		{"closing_balance", req.ClosingBalance, &closing},
+	} {
+		if b.value == nil {
+			continue
+		}
+		cents, err := transaction.ParseAmount(b.value.String())
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid " + b.name + ": " + err.Error()})
+			return
+		}
+		*b.dst = &cents
+	}
+	if opening == nil || closing == nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "statement has no opening and closing balance"})
+		return
+	}
+
+	if req.OpeningBalance != nil || req.ClosingBalance != nil {
+		if err := h.db.SetBalances(id, *opening, *closing); err != nil {
+			h.logger.Error("set balances failed", "statement_id", id, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to save balances"})
+			return
+		}
+	}
+
+	total, err := h.db.SumTransactions(id)
+	if err != nil {
+		h.logger.Error("sum transactions failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load transactions"})
+		return
+	}
+
+	rec := transaction.Reconcile(*opening, *closing, total, h.reconcileToleranceCents)
+	if err := h.db.SetReconciliation(id, rec.Reconciled, rec.DiscrepancyCents); err != nil {
+		h.logger.Error("save reconciliation failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to save reconciliation"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionReconcile, audit.TargetStatement, id, map[string]any{
+		"opening_balance_cents": rec.OpeningCents,
+		"closing_balance_cents": rec.ClosingCents,
+		"reconciled":            rec.Reconciled,
+	})
+
+	writeJSON(w, r, http.StatusOK, reconciliationResponse{
+		StatementID:       id,
+		OpeningBalance:    transaction.FormatAmount(rec.OpeningCents),
+		ClosingBalance:    transaction.FormatAmount(rec.ClosingCents),
+		TransactionsTotal: transaction.FormatAmount(rec.TotalCents),
+		Discrepancy:       transaction.FormatAmount(rec.DiscrepancyCents),
+		Reconciled:        rec.Reconciled,
+	})
+}
+
+// statementStatuses are the processing statuses a statement can have.
+var statementStatuses = []string{"pending", "processing", "processed", "processed_empty", "failed", "timed_out", "staged"}
+
+// maxDeleteIDs bounds the explicit ID list of a bulk delete.
+const maxDeleteIDs = 1000
+
+type deleteStatementsRequest struct {
+	Confirm bool     `json:"confirm"`
+	IDs     []string `json:"ids"`
+	Status  string   `json:"status"`
+	Account string   `json:"account"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+}
+
+type deleteStatementsResponse struct {
+	Deleted      int      `json:"deleted"`
+	Held         int      `json:"held"`
+	StatementIDs []string `json:"statement_ids"`
+}
+
+// DeleteMany handles POST /statements/delete, soft-deleting every statement
+// matching a filter in one database transaction: an explicit list of ids, a
+// status, an account, and an upload time range from/to (RFC 3339 times or
+// YYYY-MM-DD dates, to exclusive). Criteria combine, and at least one is
+// required. The request must set confirm to true. Statements under legal hold
+// are kept and counted as held.
+func (h *StatementsHandler) DeleteMany(w http.ResponseWriter, r *http.Request) {
+	var req deleteStatementsRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	if !req.Confirm {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "confirm must be true to delete statements"})
+		return
+	}
+
+	filter := database.DeleteFilter{Owner: tenant(r), Account: strings.TrimSpace(req.Account)}
+	for _, id := range req.IDs {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+	if len(filter.IDs) > maxDeleteIDs {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "at most " + strconv.Itoa(maxDeleteIDs) + " ids can be deleted at once"})
+		return
+	}
+	if req.Status != "" {
+		if !slices.Contains(statementStatuses, req.Status) {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "status must be one of " + strings.Join(statementStatuses, ", ")})
+			return
+		}
+		filter.Status = req.Status
+	}
+	var err error
+	if req.From != "" {
+		if filter.From, err = parseTime(r, req.From, false); err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "from must be an RFC 3339 time or YYYY-MM-DD date"})
+			return
+		}
+	}
+	if req.To != "" {
+		if filter.To, err = parseTime(r, req.To, true); err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "to must be an RFC 3339 time or YYYY-MM-DD date"})
+			return
+		}
+	}
+	if filter.Empty() {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "at least one of ids, status, account, from or to is required"})
+		return
+	}
+
+	deleted, held, err := h.db.SoftDeleteStatements(filter)
+	if err != nil {
+		h.logger.Error("delete statements failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to delete statements"})
+		return
+	}
+
+	resp := deleteStatementsResponse{Deleted: len(deleted), Held: held, StatementIDs: make([]string, 0, len(deleted))}
+	for _, s := range deleted {
+		resp.StatementIDs = append(resp.StatementIDs, s.ID)
+
+		// Forced re-uploads share the file of the statement they duplicate.
+		if inUse, err := h.db.FileInUse(s.FileHash); err != nil {
+			h.logger.Error("failed to check original file use", "statement_id", s.ID, "error", err)
+		} else if !inUse && h.files != nil {
+			if err := h.files.Delete(s.FileHash); err != nil {
+				h.logger.Error("failed to remove original file", "statement_id", s.ID, "error", err)
+			}
+		}
+
+		h.audit.Record(r.Context(), audit.ActionDelete, audit.TargetStatement, s.ID, map[string]any{
+			"reason": "bulk_delete",
+		})
+	}
+
+	h.logger.Info("deleted statements", "deleted", len(deleted), "held", held)
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// TagsHandler manages tags and their attachment to statements.
+type TagsHandler struct {
+	db     *database.DB
+	audit  *audit.Recorder
+	logger *slog.Logger
+}
+
+// NewTagsHandler creates a new TagsHandler.
+func NewTagsHandler(db *database.DB, auditor *audit.Recorder, logger *slog.Logger) *TagsHandler {
+	return &TagsHandler{
+		db:     db,
+		audit:  auditor,
+		logger: logger,
+	}
+}
+
+type tagResponse struct {
+	Name           string    `json:"name"`
+	StatementCount int       `json:"statement_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func newTagResponse(r *http.Request, t *database.Tag) tagResponse {
+	return tagResponse{
+		Name:           t.Name,
+		StatementCount: t.StatementCount,
+		CreatedAt:      localTime(r, t.CreatedAt),
+	}
+}
+
+type createTagRequest struct {
+	Name string `json:"name"`
+}
+
+// Create handles POST /tags.
+func (h *TagsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createTagRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	name := database.NormalizeTagName(req.Name)
+	if !database.ValidTagName(name) {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "tag name must be 1-64 letters, digits, '.', '_', ':' or '-', starting with a letter or digit"})
+		return
+	}
+
+	created, err := h.db.CreateTag(tenant(r), name)
+	if err != nil {
+		h.logger.Error("create tag failed", "tag", name, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to create tag"})
+		return
+	}
+	if !created {
+		writeJSON(w, r, http.StatusConflict, errorResponse{Error: "tag already exists"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionTagCreate, audit.TargetTag, name, nil)
+
+	tag, err := h.db.GetTag(tenant(r), name)
+	if err != nil || tag == nil {
+		h.logger.Error("reload tag failed", "tag", name, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load tag"})
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, newTagResponse(r, tag))
+}
+
+// List handles GET /tags.
+func (h *TagsHandler) List(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.db.ListTags(tenant(r))
+	if err != nil {
+		h.logger.Error("list tags failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load tags"})
+		return
+	}
+
+	resp := make([]tagResponse, len(tags))
+	for i := range tags {
+		resp[i] = newTagResponse(r, &tags[i])
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+type statementTagsResponse struct {
+	StatementID string   `json:"statement_id"`
+	Tags        []string `json:"tags"`
+}
+
+// Attach handles PUT /statements/{id}/tags/{tag}. The tag must have been
+// created with POST /tags; attaching it again is a no-op.
+func (h *TagsHandler) Attach(w http.ResponseWriter, r *http.Request) {
+	h.setTag(w, r, true)
+}
+
+// Detach handles DELETE /statements/{id}/tags/{tag}.
+func (h *TagsHandler) Detach(w http.ResponseWriter, r *http.Request) {
+	h.setTag(w, r, false)
+}
+
+func (h *TagsHandler) setTag(w http.ResponseWriter, r *http.Request, attach bool) {
+	id := r.PathValue("id")
+	name := database.NormalizeTagName(r.PathValue("tag"))
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+
+	tag, err := h.db.GetTag(tenant(r), name)
+	if err != nil {
+		h.logger.Error("get tag failed", "tag", name, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load tag"})
+		return
+	}
+	if tag == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "tag not found"})
+		return
+	}
+
+	action := audit.ActionTagAttach
+	if attach {
+		err = h.db.TagStatement(tenant(r), id, name)
+	} else {
+		action = audit.ActionTagDetach
+		var removed bool
+		removed, err = h.db.UntagStatement(id, name)
+		if err == nil && !removed {
+			writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement does not have this tag"})
+			return
+		}
+	}
+	if err != nil {
+		h.logger.Error("update statement tags failed", "statement_id", id, "tag", name, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to update tags"})
+		return
+	}
+
+	h.audit.Record(r.Context(), action, audit.TargetStatement, id, map[string]any{"tag": name})
+
+	stmt, err = h.db.GetStatement(id)
+	if err != nil || stmt == nil {
+		h.logger.Error("reload statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+
+	resp := statementTagsResponse{StatementID: id, Tags: stmt.Tags}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
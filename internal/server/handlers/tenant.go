@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/billdaws/moneymanager/internal/auth"
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// tenant returns the tenant a request is scoped to, or "" when tenant isolation
+// is off. The database treats an empty owner as no filter.
+func tenant(r *http.Request) string {
+	t, _ := auth.Tenant(r.Context())
+	return t
+}
+
+// internal reports whether a request comes with an API key granted the internal
+// scope.
+func internal(r *http.Request) bool {
+	p, ok := auth.FromContext(r.Context())
+	return ok && p.Internal
+}
+
+// visible reports whether a request may see a statement: any statement with
+// tenant isolation off, otherwise only the tenant's own. Statements of other
+// tenants are reported as not found so their IDs can't be probed.
+func visible(r *http.Request, stmt *database.Statement) bool {
+	t, ok := auth.Tenant(r.Context())
+	return !ok || stmt.OwnerID == t
+}
+
+// statementVisible looks up a statement by ID and reports whether it is
+// visible to the request. It skips the lookup with tenant isolation off.
+func statementVisible(db *database.DB, r *http.Request, id string) (bool, error) {
+	if _, ok := auth.Tenant(r.Context()); !ok {
+		return true, nil
+	}
+	stmt, err := db.GetStatement(id)
+	if err != nil || stmt == nil {
+		return false, err
+	}
+	return visible(r, stmt), nil
+}
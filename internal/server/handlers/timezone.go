@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/requestinfo"
+)
+
+// location returns the timezone of a request: the ?tz override or the
+// configured default, as stored by requestinfo.Middleware. UTC otherwise.
+func location(r *http.Request) *time.Location {
+	if info, ok := requestinfo.FromContext(r.Context()); ok && info.Location != nil {
+		return info.Location
+	}
+	return time.UTC
+}
+
+// localTime renders t, stored in UTC, in the timezone of a request.
+func localTime(r *http.Request, t time.Time) time.Time {
+	return t.In(location(r))
+}
+
+// parseTime reads a time query parameter: an RFC 3339 time, or a YYYY-MM-DD
+// date taken in the timezone of the request. A date starts at its midnight,
+// or with end set ends at the next one, so an exclusive upper bound of
+// 2024-01-31 still covers that whole day.
+func parseTime(r *http.Request, value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, location(r))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
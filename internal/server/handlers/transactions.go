@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/exchange"
+	"github.com/billdaws/moneymanager/internal/jsonschema"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// TransactionsHandler handles requests for parsed transactions.
+type TransactionsHandler struct {
+	db              *database.DB
+	converter       *exchange.Converter
+	pendingAccepted bool
+	audit           *audit.Recorder
+	logger          *slog.Logger
+}
+
+// NewTransactionsHandler creates a new TransactionsHandler. A non-nil converter
+// recomputes the base currency amount of corrected transactions. With
+// pendingAccepted set, listing the transactions of a statement that hasn't
+// finished processing is answered with 202 Accepted.
+func NewTransactionsHandler(db *database.DB, converter *exchange.Converter, pendingAccepted bool, auditor *audit.Recorder, logger *slog.Logger) *TransactionsHandler {
+	return &TransactionsHandler{
+		db:              db,
+		converter:       converter,
+		pendingAccepted: pendingAccepted,
+		audit:           auditor,
+		logger:          logger,
+	}
+}
+
+type transactionResponse struct {
+	ID          string     `json:"id"`
+	StatementID string     `json:"statement_id"`
+	RowIndex    int        `json:"row_index"`
+	Date        string     `json:"date"`
+	Description string     `json:"description"`
+	Amount      string     `json:"amount"`
+	AmountCents int64      `json:"amount_cents"`
+	Category    string     `json:"category"`
+	Merchant    string     `json:"merchant,omitempty"`
+	Reference   string     `json:"reference,omitempty"`
+	Type        string     `json:"type,omitempty"`
+	Edited      bool       `json:"edited"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+
+	// Balance is the running balance after the transaction. BalanceDiscrepancy
+	// is set when a printed balance differs from the computed one.
+	Balance            string `json:"balance,omitempty"`
+	BalanceCents       *int64 `json:"balance_cents,omitempty"`
+	BalanceDiscrepancy string `json:"balance_discrepancy,omitempty"`
+
+	// BaseAmount is the amount in the base currency. RateMissing is set when
+	// it couldn't be converted for lack of an exchange rate.
+	BaseAmount      string `json:"base_amount,omitempty"`
+	BaseAmountCents *int64 `json:"base_amount_cents,omitempty"`
+	RateMissing     bool   `json:"rate_missing,omitempty"`
+	// Currency is set when the amount was printed with a currency of its own.
+	Currency string `json:"currency,omitempty"`
+
+	// AccountName and AccountType are set for transactions of a combined
+	// statement, naming the account section they were found under.
+	AccountName string `json:"account_name,omitempty"`
+	AccountType string `json:"account_type,omitempty"`
+
+	// SourceStatementID is set for transactions moved in by a merge, naming
+	// the statement they were extracted from.
+	SourceStatementID string `json:"source_statement_id,omitempty"`
+}
+
+func newTransactionResponse(r *http.Request, t *database.Transaction) transactionResponse {
+	resp := transactionResponse{
+		ID:          t.ID,
+		StatementID: t.StatementID,
+		RowIndex:    t.RowIndex,
+		Date:        t.Date,
+		Description: t.Description,
+		Amount:      transaction.FormatAmount(t.AmountCents),
+		AmountCents: t.AmountCents,
+		Category:    t.Category,
+		Merchant:    t.Merchant,
+		Reference:   t.Reference,
+		Type:        t.Type,
+		Edited:      t.Edited,
+		AccountName: t.AccountName,
+		AccountType: t.AccountType,
+
+		SourceStatementID: t.SourceStatementID,
+	}
+	if t.BalanceCents != nil {
+		resp.Balance = transaction.FormatAmount(*t.BalanceCents)
+		resp.BalanceCents = t.BalanceCents
+	}
+	if t.BalanceDiscrepancyCents != 0 {
+		resp.BalanceDiscrepancy = transaction.FormatAmount(t.BalanceDiscrepancyCents)
+	}
+	if t.BaseAmountCents != nil {
+		resp.BaseAmount = transaction.FormatAmount(*t.BaseAmountCents)
+		resp.BaseAmountCents = t.BaseAmountCents
+	}
+	resp.RateMissing = t.RateMissing
+	resp.Currency = t.Currency
+	if !t.EditedAt.IsZero() {
+		editedAt := localTime(r, t.EditedAt)
+		resp.EditedAt = &editedAt
+	}
+	return resp
+}
+
+// processingResponse answers for a statement whose transactions aren't parsed yet.
+type processingResponse struct {
+	StatementID string `json:"statement_id"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+}
+
+// List handles GET /statements/{id}/transactions. A statement still pending
+// or processing has none yet; with pendingAccepted set that's answered with
+// 202 Accepted, so it isn't mistaken for one that parsed no transactions.
+func (h *TransactionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found"})
+		return
+	}
+	if h.pendingAccepted && (stmt.Status == "pending" || stmt.Status == "processing") {
+		writeJSON(w, r, http.StatusAccepted, processingResponse{
+			StatementID: id,
+			Status:      stmt.Status,
+			Message:     "statement is still processing; its transactions aren't available yet",
+		})
+		return
+	}
+
+	txns, err := h.db.ListTransactions(id)
+	if err != nil {
+		h.logger.Error("list transactions failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to list transactions"})
+		return
+	}
+
+	resp := make([]transactionResponse, 0, len(txns))
+	for i := range txns {
+		resp = append(resp, newTransactionResponse(r, &txns[i]))
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// transactionExportColumns are the columns of GET /statements/{id}/transactions.csv.
+var transactionExportColumns = []string{
+	"row_index", "date", "description", "merchant", "reference", "type", "amount", "category", "balance",
+	"account_name",
+}
+
+// Export handles GET /statements/{id}/transactions.csv, writing a statement's
+// transactions as CSV in row order. Text cells are made spreadsheet-safe as in
+// the statement export.
+func (h *TransactionsHandler) Export(w http.ResponseWriter, r *http.Request) {
+	txns, ok := h.statementTransactions(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "transactions.csv"}))
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write(transactionExportColumns)
+	for _, t := range txns {
+		balance := ""
+		if t.BalanceCents != nil {
+			balance = transaction.FormatAmount(*t.BalanceCents)
+		}
+		_ = cw.Write([]string{
+			strconv.Itoa(t.RowIndex), t.Date, spreadsheetSafe(t.Description), spreadsheetSafe(t.Merchant),
+			spreadsheetSafe(t.Reference), spreadsheetSafe(t.Type), transaction.FormatAmount(t.AmountCents),
+			spreadsheetSafe(t.Category), balance, spreadsheetSafe(t.AccountName),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		h.logger.Error("export transactions failed", "statement_id", r.PathValue("id"), "error", err)
+	}
+}
+
+type transactionChangeResponse struct {
+	Before transactionResponse `json:"before"`
+	After  transactionResponse `json:"after"`
+	Fields []string            `json:"fields"`
+}
+
+type statementDiffResponse struct {
+	StatementID string                      `json:"statement_id"`
+	Against     string                      `json:"against"`
+	Added       []transactionResponse       `json:"added"`
+	Removed     []transactionResponse       `json:"removed"`
+	Changed     []transactionChangeResponse `json:"changed"`
+	Unchanged   int                         `json:"unchanged"`
+}
+
+// Diff handles GET /statements/{id}/diff?against={otherId}, comparing the
+// transactions of a statement with those of an earlier version. Rows are
+// matched by date, amount and description: added rows are only in the
+// statement, removed rows only in the other one, and changed rows agree on
+// two of the three.
+func (h *TransactionsHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	against := r.URL.Query().Get("against")
+	if against == "" {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "against is required"})
+		return
+	}
+
+	after, ok := h.statementTransactions(w, r, id)
+	if !ok {
+		return
+	}
+	before, ok := h.statementTransactions(w, r, against)
+	if !ok {
+		return
+	}
+
+	diff := transaction.Compare(toParsed(before), toParsed(after))
+
+	resp := statementDiffResponse{
+		StatementID: id,
+		Against:     against,
+		Added:       make([]transactionResponse, 0, len(diff.Added)),
+		Removed:     make([]transactionResponse, 0, len(diff.Removed)),
+		Changed:     make([]transactionChangeResponse, 0, len(diff.Changed)),
+		Unchanged:   diff.Unchanged,
+	}
+	for _, i := range diff.Added {
+		resp.Added = append(resp.Added, newTransactionResponse(r, &after[i]))
+	}
+	for _, i := range diff.Removed {
+		resp.Removed = append(resp.Removed, newTransactionResponse(r, &before[i]))
+	}
+	for _, c := range diff.Changed {
+		resp.Changed = append(resp.Changed, transactionChangeResponse{
+			Before: newTransactionResponse(r, &before[c.Before]),
+			After:  newTransactionResponse(r, &after[c.After]),
+			Fields: c.Fields,
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// statementTransactions loads the transactions of a statement visible to the
+// request. It writes the error response and returns false on failure.
+func (h *TransactionsHandler) statementTransactions(w http.ResponseWriter, r *http.Request, id string) ([]database.Transaction, bool) {
+	stmt, err := h.db.GetStatement(id)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load statement"})
+		return nil, false
+	}
+	if stmt == nil || !visible(r, stmt) {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "statement not found: " + id})
+		return nil, false
+	}
+
+	txns, err := h.db.ListTransactions(id)
+	if err != nil {
+		h.logger.Error("list transactions failed", "statement_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to list transactions"})
+		return nil, false
+	}
+	return txns, true
+}
+
+// toParsed converts stored transactions to the form transaction.Compare takes.
+func toParsed(txns []database.Transaction) []transaction.Transaction {
+	parsed := make([]transaction.Transaction, len(txns))
+	for i, t := range txns {
+		parsed[i] = transaction.Transaction{
+			RowIndex:    t.RowIndex,
+			Date:        t.Date,
+			Description: t.Description,
+			AmountCents: t.AmountCents,
+			Category:    t.Category,
+		}
+	}
+	return parsed
+}
+
+// convert recomputes the base currency amount of a corrected transaction at
+// the rate on its date, flagging it when there is no rate.
+func (h *TransactionsHandler) convert(r *http.Request, t *database.Transaction) error {
+	stmt, err := h.db.GetStatement(t.StatementID)
+	if err != nil {
+		return err
+	}
+	currency := t.Currency
+	if currency == "" && stmt != nil {
+		currency = stmt.Currency
+	}
+
+	cents, err := h.converter.Convert(r.Context(), t.AmountCents, currency, t.Date)
+	if err != nil {
+		h.logger.Warn("convert transaction failed", "transaction_id", t.ID, "error", err)
+		t.BaseAmountCents, t.RateMissing = nil, true
+		return nil
+	}
+	t.BaseAmountCents, t.RateMissing = &cents, false
+	return nil
+}
+
+// updateTransactionRequest holds the fields of a manual correction; omitted fields are unchanged.
+type updateTransactionRequest struct {
+	Date        *string      `json:"date"`
+	Description *string      `json:"description"`
+	Amount      *json.Number `json:"amount"`
+	Category    *string      `json:"category"`
+}
+
+// Update handles PUT /transactions/{id}, applying a manual correction. Edited
+// transactions are flagged so reprocessing the statement doesn't overwrite them.
+func (h *TransactionsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req updateTransactionRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	t, err := h.db.GetTransaction(id)
+	if err != nil {
+		h.logger.Error("get transaction failed", "transaction_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load transaction"})
+		return
+	}
+	if t == nil {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "transaction not found"})
+		return
+	}
+	ok, err := statementVisible(h.db, r, t.StatementID)
+	if err != nil {
+		h.logger.Error("get statement failed", "statement_id", t.StatementID, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load transaction"})
+		return
+	}
+	if !ok {
+		writeJSON(w, r, http.StatusNotFound, errorResponse{Error: "transaction not found"})
+		return
+	}
+
+	if req.Date != nil {
+		date, err := transaction.ParseDate(*req.Date)
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid date: " + err.Error()})
+			return
+		}
+		t.Date = date
+	}
+
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if description == "" {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "description must not be empty"})
+			return
+		}
+		t.Description = description
+	}
+
+	if req.Amount != nil {
+		cents, err := transaction.ParseAmount(req.Amount.String())
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid amount: " + err.Error()})
+			return
+		}
+		t.AmountCents = cents
+	}
+
+	if req.Category != nil {
+		t.Category = strings.TrimSpace(*req.Category)
+	}
+
+	if h.converter != nil && (req.Date != nil || req.Amount != nil) {
+		if err := h.convert(r, t); err != nil {
+			h.logger.Error("get statement failed", "statement_id", t.StatementID, "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load transaction"})
+			return
+		}
+	}
+
+	if err := h.db.UpdateTransaction(t); err != nil {
+		h.logger.Error("update transaction failed", "transaction_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to update transaction"})
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.ActionTransactionEdit, audit.TargetTransaction, id, map[string]any{
+		"statement_id": t.StatementID,
+		"date":         t.Date,
+		"description":  t.Description,
+		"amount_cents": t.AmountCents,
+		"category":     t.Category,
+	})
+
+	updated, err := h.db.GetTransaction(id)
+	if err != nil || updated == nil {
+		h.logger.Error("reload transaction failed", "transaction_id", id, "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to load transaction"})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, newTransactionResponse(r, updated))
+}
+
+type categorizeRequest struct {
+	IDs      []string `json:"ids"`
+	Pattern  string   `json:"pattern"`
+	Category string   `json:"category"`
+	// CreateRule also saves pattern as a rule applied to future uploads.
+	CreateRule bool `json:"create_rule"`
+}
+
+type categorizeResponse struct {
+	Updated int64  `json:"updated"`
+	RuleID  string `json:"rule_id,omitempty"`
+}
+
+// Categorize handles POST /transactions/categorize, setting the category of the
+// listed transactions and/or every transaction whose description contains pattern.
+func (h *TransactionsHandler) Categorize(w http.ResponseWriter, r *http.Request) {
+	var req categorizeRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	req.Category = strings.TrimSpace(req.Category)
+	req.Pattern = strings.TrimSpace(req.Pattern)
+
+	switch {
+	case req.Category == "":
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "category is required"})
+		return
+	case len(req.IDs) == 0 && req.Pattern == "":
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "ids or pattern is required"})
+		return
+	case req.CreateRule && req.Pattern == "":
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "create_rule requires a pattern"})
+		return
+	}
+
+	updated, err := h.db.CategorizeTransactions(tenant(r), req.IDs, req.Pattern, req.Category)
+	if err != nil {
+		h.logger.Error("categorize transactions failed", "error", err)
+		writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "failed to categorize transactions"})
+		return
+	}
+
+	details := map[string]any{"category": req.Category, "updated": updated}
+	if len(req.IDs) > 0 {
+		details["ids"] = req.IDs
+	}
+	if req.Pattern != "" {
+		details["pattern"] = req.Pattern
+	}
+	h.audit.Record(r.Context(), audit.ActionCategorize, audit.TargetTransaction, "", details)
+
+	resp := categorizeResponse{Updated: updated}
+
+	if req.CreateRule {
+		resp.RuleID, err = h.db.InsertCategoryRule(tenant(r), req.Pattern, req.Category)
+		if err != nil {
+			h.logger.Error("create category rule failed", "error", err)
+			writeJSON(w, r, http.StatusInternalServerError, errorResponse{Error: "transactions categorized but failed to create rule"})
+			return
+		}
+
+		h.audit.Record(r.Context(), audit.ActionRuleCreate, audit.TargetCategoryRule, resp.RuleID, map[string]any{
+			"pattern":  req.Pattern,
+			"category": req.Category,
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+type validateRulesResponse struct {
+	Valid  bool                 `json:"valid"`
+	Rules  int                  `json:"rules"`
+	Errors []jsonschema.Problem `json:"errors,omitempty"`
+}
+
+// ValidateRules handles POST /categorize/validate, checking a category rules
+// document against the rules file schema without applying it. An invalid
+// document is answered with 422 and every problem found.
+func (h *TransactionsHandler) ValidateRules(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	rules, err := transaction.ParseRules(data)
+	var rulesErr *transaction.RulesError
+	switch {
+	case errors.As(err, &rulesErr):
+		writeJSON(w, r, http.StatusUnprocessableEntity, validateRulesResponse{Errors: rulesErr.Problems})
+		return
+	case err != nil:
+		writeJSON(w, r, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, validateRulesResponse{Valid: true, Rules: len(rules)})
+}
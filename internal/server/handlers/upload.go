@@ -1,30 +1,224 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/fetch"
 	"github.com/billdaws/moneymanager/internal/statement"
+	"github.com/billdaws/moneymanager/internal/transaction"
 )
 
-// UploadHandler handles POST /upload requests.
+// UploadHandler handles POST /upload, POST /upload/batch and POST /upload/url
+// requests.
 type UploadHandler struct {
-	processor  *statement.Processor
-	maxSizeMB int
-	logger     *slog.Logger
+	processor         *statement.Processor
+	fetcher           *fetch.Fetcher
+	maxSizeMB         int
+	maxBatchFiles     int
+	multipartMemoryMB int
+	maxFormBytes      int64
+	duplicateConflict bool
+	audit             *audit.Recorder
+	logger            *slog.Logger
 }
 
-// NewUploadHandler creates a new UploadHandler.
-func NewUploadHandler(processor *statement.Processor, maxSizeMB int, logger *slog.Logger) *UploadHandler {
+// NewUploadHandler creates a new UploadHandler. Each file of a multipart
+// request may be up to maxSizeMB, and its other fields and multipart framing
+// together up to maxFormKB. POST /upload streams its file to the processor;
+// batch and preview requests hold up to multipartMemoryMB in memory, writing
+// file parts beyond that to temporary files. With duplicateConflict set, a duplicate upload is answered
+// with 409 Conflict rather than 200 OK. fetcher downloads the files of URL
+// uploads; nil disables them.
+func NewUploadHandler(processor *statement.Processor, fetcher *fetch.Fetcher, maxSizeMB, maxBatchFiles, multipartMemoryMB, maxFormKB int, duplicateConflict bool, auditor *audit.Recorder, logger *slog.Logger) *UploadHandler {
 	return &UploadHandler{
-		processor: processor,
-		maxSizeMB: maxSizeMB,
-		logger:    logger,
+		processor:         processor,
+		fetcher:           fetcher,
+		maxSizeMB:         maxSizeMB,
+		maxBatchFiles:     maxBatchFiles,
+		multipartMemoryMB: multipartMemoryMB,
+		maxFormBytes:      int64(maxFormKB) * 1024,
+		duplicateConflict: duplicateConflict,
+		audit:             auditor,
+		logger:            logger,
 	}
 }
 
+// errFormTooLarge is returned when a multipart body, one of its files or its
+// other fields exceed their size limit.
+var errFormTooLarge = errors.New("request too large")
+
+// parseMultipartForm parses a multipart body of up to files files, keeping up
+// to multipartMemoryMB in memory. The body may hold files times maxSizeMB plus
+// maxFormBytes for the other fields and the multipart framing; within that,
+// each file is checked against maxSizeMB and the fields against maxFormBytes.
+// The temporary files are removed when the request finishes.
+func (h *UploadHandler) parseMultipartForm(w http.ResponseWriter, r *http.Request, files int) error {
+	maxFileBytes := int64(h.maxSizeMB) * 1024 * 1024
+	r.Body = http.MaxBytesReader(w, r.Body, int64(files)*maxFileBytes+h.maxFormBytes)
+	if err := r.ParseMultipartForm(int64(h.multipartMemoryMB) * 1024 * 1024); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w: body exceeds maximum %d bytes", errFormTooLarge, tooLarge.Limit)
+		}
+		return err
+	}
+
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			if header.Size > maxFileBytes {
+				return fmt.Errorf("%w: file %q of %d bytes exceeds maximum %d MB", errFormTooLarge, header.Filename, header.Size, h.maxSizeMB)
+			}
+		}
+	}
+	var fieldBytes int64
+	for name, values := range r.MultipartForm.Value {
+		for _, value := range values {
+			fieldBytes += int64(len(name) + len(value))
+		}
+	}
+	if fieldBytes > h.maxFormBytes {
+		return fmt.Errorf("%w: form fields of %d bytes exceed maximum %d bytes", errFormTooLarge, fieldBytes, h.maxFormBytes)
+	}
+	return nil
+}
+
+// errInvalidForm is returned when a streamed multipart body is malformed or
+// one of its fields is invalid.
+var errInvalidForm = errors.New("invalid form")
+
+// streamForm reads a multipart upload one part at a time, so its file can be
+// handed to the processor without buffering it first. Fields before the file
+// are read by nextFile, the rest by rest once the file has been consumed.
+type streamForm struct {
+	reader     *multipart.Reader
+	values     url.Values
+	fieldBytes int64
+	maxBytes   int64
+}
+
+// streamMultipartForm starts reading a multipart body holding one file of up
+// to maxSizeMB and other fields of up to maxFormBytes.
+func (h *UploadHandler) streamMultipartForm(w http.ResponseWriter, r *http.Request) (*streamForm, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.maxSizeMB)*1024*1024+h.maxFormBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return &streamForm{reader: reader, values: url.Values{}, maxBytes: h.maxFormBytes}, nil
+}
+
+// nextFile reads fields up to the "file" part and returns it unread. It
+// returns nil when the body has no file.
+func (f *streamForm) nextFile() (*multipart.Part, error) {
+	for {
+		part, err := f.reader.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, formReadError(err)
+		}
+		if part.FileName() != "" {
+			if part.FormName() == "file" {
+				return part, nil
+			}
+			continue
+		}
+		if err := f.readField(part); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rest reads the fields after the file. Further files are skipped.
+func (f *streamForm) rest() error {
+	for {
+		part, err := f.reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return formReadError(err)
+		}
+		if part.FileName() != "" {
+			continue
+		}
+		if err := f.readField(part); err != nil {
+			return err
+		}
+	}
+}
+
+// readField adds a field part to the form values, within the field budget.
+func (f *streamForm) readField(part *multipart.Part) error {
+	name := part.FormName()
+	value, err := io.ReadAll(io.LimitReader(part, f.maxBytes-f.fieldBytes+1))
+	if err != nil {
+		return formReadError(err)
+	}
+	f.fieldBytes += int64(len(name) + len(value))
+	if f.fieldBytes > f.maxBytes {
+		return fmt.Errorf("%w: form fields exceed maximum %d bytes", errFormTooLarge, f.maxBytes)
+	}
+	f.values.Add(name, string(value))
+	return nil
+}
+
+// formReadError classifies an error reading a streamed multipart body.
+func formReadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: body exceeds maximum %d bytes", errFormTooLarge, tooLarge.Limit)
+	}
+	return fmt.Errorf("%w: %w", errInvalidForm, err)
+}
+
+// writeFormError answers a request whose multipart body was rejected by
+// parseMultipartForm: 413 Request Entity Too Large when it exceeded a size
+// limit, 400 Bad Request otherwise.
+func writeFormError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errFormTooLarge) {
+		writeJSON(w, r, http.StatusRequestEntityTooLarge, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "failed to parse multipart form: " + err.Error()})
+}
+
+// recordUpload audits the creation of a statement, and any file accepted through
+// the internal allow-list. Duplicates create nothing.
+func (h *UploadHandler) recordUpload(r *http.Request, result *statement.ProcessResult) {
+	if result.InternalType != "" {
+		h.audit.Record(r.Context(), audit.ActionInternalType, audit.TargetStatement, result.StatementID, map[string]any{
+			"filename":  result.Filename,
+			"mime_type": result.InternalType,
+			"duplicate": result.Duplicate,
+		})
+	}
+	if result.Duplicate {
+		return
+	}
+	details := map[string]any{
+		"filename": result.Filename,
+		"status":   result.Status,
+	}
+	if result.DuplicateOf != "" {
+		details["force"] = true
+		details["duplicate_of"] = result.DuplicateOf
+	}
+	h.audit.Record(r.Context(), audit.ActionUpload, audit.TargetStatement, result.StatementID, details)
+}
+
 type uploadResponse struct {
 	StatementID           string `json:"statement_id"`
 	Filename              string `json:"filename"`
@@ -32,6 +226,62 @@ type uploadResponse struct {
 	TransactionsExtracted int    `json:"transactions_extracted"`
 	ProcessingTimeMs      int64  `json:"processing_time_ms"`
 	Duplicate             bool   `json:"duplicate"`
+	DuplicateOf           string `json:"duplicate_of,omitempty"`
+	RetryScheduled        bool   `json:"retry_scheduled,omitempty"`
+	Reconciled            *bool  `json:"reconciled,omitempty"`
+	Discrepancy           string `json:"discrepancy,omitempty"`
+	ExpectedCount         *int   `json:"expected_count,omitempty"`
+	CountMismatch         bool   `json:"count_mismatch,omitempty"`
+	Extractor             string `json:"extractor,omitempty"`
+	TablesExported        int    `json:"tables_exported,omitempty"`
+
+	// Accounts lists the accounts a combined statement was split into.
+	Accounts []accountSectionResponse `json:"accounts,omitempty"`
+	// Overlaps lists the statements of the same account covering some of
+	// the same dates.
+	Overlaps []overlapResponse `json:"overlaps,omitempty"`
+}
+
+// overlapResponse is a statement whose transaction dates overlap an upload's.
+type overlapResponse struct {
+	StatementID string `json:"statement_id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// accountSectionResponse is one account of a combined statement.
+type accountSectionResponse struct {
+	Name         string `json:"account_name"`
+	Type         string `json:"account_type"`
+	Transactions int    `json:"transactions"`
+}
+
+func newUploadResponse(result *statement.ProcessResult) uploadResponse {
+	resp := uploadResponse{
+		StatementID:           result.StatementID,
+		Filename:              result.Filename,
+		Status:                result.Status,
+		TransactionsExtracted: result.TransactionsExtracted,
+		ProcessingTimeMs:      result.ProcessingTimeMs,
+		Duplicate:             result.Duplicate,
+		DuplicateOf:           result.DuplicateOf,
+		RetryScheduled:        result.RetryScheduled,
+		ExpectedCount:         result.ExpectedCount,
+		CountMismatch:         result.CountMismatch,
+		Extractor:             result.Extractor,
+		TablesExported:        result.TablesExported,
+	}
+	if rec := result.Reconciliation; rec != nil {
+		resp.Reconciled = &rec.Reconciled
+		resp.Discrepancy = transaction.FormatAmount(rec.DiscrepancyCents)
+	}
+	for _, a := range result.Accounts {
+		resp.Accounts = append(resp.Accounts, accountSectionResponse{Name: a.Name, Type: a.Type, Transactions: a.Transactions})
+	}
+	for _, o := range result.Overlaps {
+		resp.Overlaps = append(resp.Overlaps, overlapResponse{StatementID: o.StatementID, From: o.From, To: o.To})
+	}
+	return resp
 }
 
 type errorResponse struct {
@@ -44,59 +294,274 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Limit the request body to maxSizeMB + 1MB overhead for form fields.
-	maxBytes := int64(h.maxSizeMB+1) * 1024 * 1024
-	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
-
-	if err := r.ParseMultipartForm(maxBytes); err != nil {
-		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "failed to parse multipart form: " + err.Error()})
+	form, err := h.streamMultipartForm(w, r)
+	if err != nil {
+		writeFormError(w, r, err)
 		return
 	}
-
-	file, header, err := r.FormFile("file")
+	file, err := form.nextFile()
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "missing or invalid 'file' field"})
+		writeFormError(w, r, err)
 		return
 	}
-	defer func() { _ = file.Close() }()
-
-	data, err := io.ReadAll(file)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "failed to read file: " + err.Error()})
+	if file == nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "missing or invalid 'file' field"})
 		return
 	}
 
-	accountType := r.FormValue("account_type")
-	accountName := r.FormValue("account_name")
-	statementDate := r.FormValue("statement_date")
+	// The file part is read by the processor, which rejects an unsupported
+	// type from its first bytes; fields sent after it are read afterwards.
+	result, err := h.processor.Process(statement.Upload{
+		Filename: file.FileName(),
+		Body:     file,
+		Owner:    tenant(r),
+		Internal: internal(r),
+		Trailer: func(u *statement.Upload) error {
+			if err := form.rest(); err != nil {
+				return err
+			}
+			var err error
+			if u.Force, err = parseBool("force", form.values.Get("force")); err != nil {
+				return fmt.Errorf("%w: %w", errInvalidForm, err)
+			}
+			if u.Stage, err = parseBool("stage", form.values.Get("stage")); err != nil {
+				return fmt.Errorf("%w: %w", errInvalidForm, err)
+			}
+			u.AccountType = form.values.Get("account_type")
+			u.AccountName = form.values.Get("account_name")
+			u.StatementDate = form.values.Get("statement_date")
+			u.Currency = form.values.Get("currency")
+			u.Priority = form.values.Get("priority")
+			u.Charset = form.values.Get("charset")
+			u.ParseStrategy = form.values.Get("parse_strategy")
+			u.OpeningBalance = form.values.Get("opening_balance")
+			u.ClosingBalance = form.values.Get("closing_balance")
+			u.ExpectedCount = form.values.Get("expected_count")
+			return nil
+		},
+	})
+	h.respond(w, r, file.FileName(), result, err)
+}
 
-	result, err := h.processor.Process(header.Filename, data, accountType, accountName, statementDate)
+// respond writes the outcome of processing a single upload.
+func (h *UploadHandler) respond(w http.ResponseWriter, r *http.Request, filename string, result *statement.ProcessResult, err error) {
 	if err != nil {
 		h.logger.Error("processing failed",
-			"filename", header.Filename,
+			"filename", filename,
 			"error", err,
 		)
-		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		var tooLarge *http.MaxBytesError
+		status := http.StatusUnprocessableEntity
+		switch {
+		case errors.Is(err, errFormTooLarge), errors.As(err, &tooLarge), errors.Is(err, statement.ErrFileTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, errInvalidForm):
+			status = http.StatusBadRequest
+		case errors.Is(err, statement.ErrInvalidAccountType), errors.Is(err, statement.ErrInvalidBalance),
+			errors.Is(err, statement.ErrInvalidCurrency), errors.Is(err, statement.ErrInvalidPriority),
+			errors.Is(err, statement.ErrInvalidCharset), errors.Is(err, statement.ErrInvalidExpectedCount),
+			errors.Is(err, statement.ErrInvalidParseStrategy):
+			status = http.StatusBadRequest
+		case errors.Is(err, statement.ErrStatementLimit):
+			status = http.StatusForbidden
+		}
+		writeJSON(w, r, status, errorResponse{Error: err.Error()})
 		return
 	}
 
+	h.recordUpload(r, result)
+
 	status := http.StatusOK
-	if result.Duplicate {
-		status = http.StatusOK
+	switch {
+	case result.RetryScheduled:
+		// Extraction timed out and continues in the background.
+		status = http.StatusAccepted
+	case result.Duplicate && h.duplicateConflict:
+		// The body still describes the existing statement.
+		status = http.StatusConflict
 	}
 
-	writeJSON(w, status, uploadResponse{
-		StatementID:           result.StatementID,
-		Filename:              result.Filename,
-		Status:                result.Status,
-		TransactionsExtracted: result.TransactionsExtracted,
-		ProcessingTimeMs:      result.ProcessingTimeMs,
-		Duplicate:             result.Duplicate,
+	writeJSON(w, r, status, newUploadResponse(result))
+}
+
+type batchItemResponse struct {
+	uploadResponse
+	Error string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchItemResponse `json:"results"`
+}
+
+// Batch handles POST /upload/batch. Every "file" part is processed and sent to
+// Kreuzberg in a single request; the account metadata fields apply to all files.
+// Results are returned in the order the files were sent.
+func (h *UploadHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	if err := h.parseMultipartForm(w, r, h.maxBatchFiles); err != nil {
+		writeFormError(w, r, err)
+		return
+	}
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "missing 'file' fields"})
+		return
+	}
+	if len(headers) > h.maxBatchFiles {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("too many files: %d exceeds maximum %d", len(headers), h.maxBatchFiles)})
+		return
+	}
+
+	force, err := formBool(r, "force")
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	stage, err := formBool(r, "stage")
+	if err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	uploads := make([]statement.Upload, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid file %q", header.Filename)})
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		uploads = append(uploads, statement.Upload{
+			Filename:      header.Filename,
+			Body:          file,
+			AccountType:   r.FormValue("account_type"),
+			AccountName:   r.FormValue("account_name"),
+			StatementDate: r.FormValue("statement_date"),
+			Currency:      r.FormValue("currency"),
+			Priority:      r.FormValue("priority"),
+			Charset:       r.FormValue("charset"),
+			ParseStrategy: r.FormValue("parse_strategy"),
+			Force:         force,
+			Stage:         stage,
+			Owner:         tenant(r),
+			Internal:      internal(r),
+		})
+	}
+
+	items := h.processor.ProcessBatch(uploads)
+
+	resp := batchResponse{Results: make([]batchItemResponse, len(items))}
+	for i, item := range items {
+		if item.Err != nil {
+			h.logger.Error("processing failed",
+				"filename", headers[i].Filename,
+				"error", item.Err,
+			)
+			resp.Results[i] = batchItemResponse{
+				uploadResponse: uploadResponse{Filename: headers[i].Filename, Status: "rejected"},
+				Error:          item.Err.Error(),
+			}
+			continue
+		}
+
+		h.recordUpload(r, item.Result)
+		resp.Results[i] = batchItemResponse{uploadResponse: newUploadResponse(item.Result)}
+	}
+
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// uploadURLRequest is the body of POST /upload/url. The metadata fields match
+// the form fields of POST /upload.
+type uploadURLRequest struct {
+	URL            string `json:"url"`
+	Filename       string `json:"filename"`
+	AccountType    string `json:"account_type"`
+	AccountName    string `json:"account_name"`
+	StatementDate  string `json:"statement_date"`
+	Currency       string `json:"currency"`
+	Priority       string `json:"priority"`
+	Charset        string `json:"charset"`
+	ParseStrategy  string `json:"parse_strategy"`
+	OpeningBalance string `json:"opening_balance"`
+	ClosingBalance string `json:"closing_balance"`
+	ExpectedCount  string `json:"expected_count"`
+	Force          bool   `json:"force"`
+	Stage          bool   `json:"stage"`
+}
+
+// URL handles POST /upload/url. The server downloads the file at url and runs
+// it through the same pipeline as POST /upload. filename overrides the name
+// taken from the download.
+func (h *UploadHandler) URL(w http.ResponseWriter, r *http.Request) {
+	var req uploadURLRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		writeJSON(w, r, http.StatusBadRequest, errorResponse{Error: "url is required"})
+		return
+	}
+
+	file, err := h.fetcher.Fetch(r.Context(), strings.TrimSpace(req.URL))
+	if err != nil {
+		h.logger.Warn("fetch upload failed", "url", req.URL, "error", err)
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, fetch.ErrInvalidURL), errors.Is(err, fetch.ErrForbiddenAddress):
+			status = http.StatusBadRequest
+		case errors.Is(err, fetch.ErrTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, r, status, errorResponse{Error: err.Error()})
+		return
+	}
+
+	filename := file.Name
+	if req.Filename != "" {
+		filename = req.Filename
+	}
+
+	result, err := h.processor.Process(statement.Upload{
+		Filename:      filename,
+		Body:          bytes.NewReader(file.Data),
+		AccountType:   req.AccountType,
+		AccountName:   req.AccountName,
+		StatementDate: req.StatementDate,
+		Currency:      req.Currency,
+		Priority:      req.Priority,
+		Charset:       req.Charset,
+		ParseStrategy: req.ParseStrategy,
+
+		OpeningBalance: req.OpeningBalance,
+		ClosingBalance: req.ClosingBalance,
+		ExpectedCount:  req.ExpectedCount,
+
+		Force:    req.Force,
+		Stage:    req.Stage,
+		Owner:    tenant(r),
+		Internal: internal(r),
 	})
+	h.respond(w, r, filename, result, err)
+}
+
+// formBool parses an optional boolean form field; a missing field is false.
+func formBool(r *http.Request, name string) (bool, error) {
+	return parseBool(name, r.FormValue(name))
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(v)
+// parseBool parses the value v of an optional boolean field; empty is false.
+func parseBool(name, v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: must be true or false", name)
+	}
+	return b, nil
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/billdaws/moneymanager/internal/buildinfo"
+)
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+}
+
+func newVersionResponse(info buildinfo.Info) versionResponse {
+	return versionResponse{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		Modified:  info.Modified,
+		GoVersion: info.GoVersion,
+	}
+}
+
+// Version handles GET /version, reporting which build is running.
+func Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, newVersionResponse(buildinfo.Get()))
+}
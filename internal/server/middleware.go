@@ -1,9 +1,20 @@
 package server
 
 import (
+	"compress/gzip"
 	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/billdaws/moneymanager/internal/clientip"
+	"github.com/billdaws/moneymanager/internal/config"
+	"github.com/billdaws/moneymanager/internal/requestinfo"
+	"github.com/billdaws/moneymanager/internal/sysmem"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code
@@ -24,8 +35,10 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// LoggingMiddleware logs HTTP requests
-func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+// LoggingMiddleware logs HTTP requests. Requests to cfg.ExcludePaths aren't
+// logged and those to a path in cfg.SampleRates only sometimes, unless they
+// fail with a server error. Paths are matched below basePath.
+func LoggingMiddleware(logger *slog.Logger, cfg config.LoggingConfig, basePath string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -39,6 +52,10 @@ func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 			// Process request
 			next.ServeHTTP(rw, r)
 
+			if rw.statusCode < http.StatusInternalServerError && !sampled(cfg, strings.TrimPrefix(r.URL.Path, basePath)) {
+				return
+			}
+
 			// Log request
 			duration := time.Since(start)
 			logger.Info("http request",
@@ -48,11 +65,30 @@ func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 				"duration_ms", duration.Milliseconds(),
 				"bytes", rw.written,
 				"remote_addr", r.RemoteAddr,
+				"client_ip", clientip.ClientIP(r),
+				"request_id", requestID(r),
 			)
 		})
 	}
 }
 
+// requestID returns the ID requestinfo.Middleware gave r, if it passed through it.
+func requestID(r *http.Request) string {
+	info, _ := requestinfo.FromContext(r.Context())
+	return info.ID
+}
+
+// sampled reports whether a request to path should be logged.
+func sampled(cfg config.LoggingConfig, path string) bool {
+	if slices.Contains(cfg.ExcludePaths, path) {
+		return false
+	}
+	if rate, ok := cfg.SampleRates[strings.ToLower(path)]; ok {
+		return rand.Float64() < rate
+	}
+	return true
+}
+
 // RecoveryMiddleware recovers from panics and returns a 500 error
 func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -72,18 +108,208 @@ func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-// CORSMiddleware adds CORS headers
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// MemoryGuard refuses requests with 503 while less than minFree bytes of memory
+// are available, telling clients to come back after retryAfter, so a stressed
+// host sheds new uploads instead of running out of memory. Requests are let
+// through when the available memory can't be read.
+func MemoryGuard(minFree uint64, retryAfter time.Duration, logger *slog.Logger) func(http.Handler) http.Handler {
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mem := sysmem.Read(); mem.Known() && mem.Available < minFree {
+				logger.Warn("rejected request: low memory",
+					"path", r.URL.Path,
+					"available_bytes", mem.Available,
+					"min_free_bytes", minFree,
+				)
+				w.Header().Set("Retry-After", seconds)
+				http.Error(w, "Service Unavailable: low memory", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const (
+	corsAllowMethods  = "GET, HEAD, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders  = "Content-Type, Authorization, X-API-Key, If-None-Match, Range, If-Range"
+	corsExposeHeaders = "ETag, X-Statement-Status, X-Request-ID, Accept-Ranges, Content-Range, Content-Disposition"
+)
+
+// CORSMiddleware adds CORS headers for requests from allowed origins and answers
+// preflight requests itself with 204, so they never reach the routes. Requests
+// from other origins get no CORS headers, and their preflights are refused.
+func CORSMiddleware(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if !anyOrigin {
+				// The response depends on the origin, so caches must key on it.
+				w.Header().Add("Vary", "Origin")
+			}
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := anyOrigin || slices.ContainsFunc(cfg.AllowedOrigins, func(o string) bool {
+				return strings.EqualFold(o, origin)
+			})
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if !allowed {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+// CompressionMiddleware gzips JSON and text responses for clients that accept
+// gzip. Bodies shorter than minBytes are sent as-is, as are other content
+// types and responses that support ranges, so file downloads keep their
+// length and resumability.
+func CompressionMiddleware(minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minBytes: minBytes, statusCode: http.StatusOK}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// to compress it: the content type must be compressible and the body at least
+// minBytes long.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes   int
+	statusCode int
+	buf        []byte
+	decided    bool
+	gz         *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(statusCode int) {
+	gw.statusCode = statusCode
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	if !gw.compressible() {
+		gw.start(false)
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.minBytes {
+		if err := gw.flushBuffer(true); err != nil {
+			return 0, err
 		}
+	}
+	return len(b), nil
+}
+
+// compressible reports whether the response can be gzipped, judging by the
+// headers set so far.
+func (gw *gzipResponseWriter) compressible() bool {
+	h := gw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Accept-Ranges") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if gw.statusCode < http.StatusOK || gw.statusCode == http.StatusNoContent || gw.statusCode == http.StatusNotModified {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/")
+}
 
-		next.ServeHTTP(w, r)
-	})
+// start sends the status line and headers, switching to gzip if compress is set.
+func (gw *gzipResponseWriter) start(compress bool) {
+	gw.decided = true
+	if compress {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.statusCode)
+}
+
+func (gw *gzipResponseWriter) flushBuffer(compress bool) error {
+	gw.start(compress)
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if gw.gz != nil {
+		_, err := gw.gz.Write(buf)
+		return err
+	}
+	_, err := gw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close sends a response that stayed below minBytes uncompressed and
+// finishes the gzip stream otherwise.
+func (gw *gzipResponseWriter) close() {
+	if !gw.decided {
+		_ = gw.flushBuffer(false)
+	}
+	if gw.gz != nil {
+		_ = gw.gz.Close()
+	}
 }
@@ -5,48 +5,376 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
 
+	"github.com/billdaws/moneymanager/internal/audit"
+	"github.com/billdaws/moneymanager/internal/auth"
+	"github.com/billdaws/moneymanager/internal/clientip"
 	"github.com/billdaws/moneymanager/internal/config"
 	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/exchange"
+	"github.com/billdaws/moneymanager/internal/fetch"
 	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/netsafe"
+	"github.com/billdaws/moneymanager/internal/redact"
+	"github.com/billdaws/moneymanager/internal/requestinfo"
+	"github.com/billdaws/moneymanager/internal/retention"
 	"github.com/billdaws/moneymanager/internal/server/handlers"
 	"github.com/billdaws/moneymanager/internal/statement"
+	"github.com/billdaws/moneymanager/internal/storage"
+	"github.com/billdaws/moneymanager/internal/transaction"
 )
 
 // Server wraps the HTTP server and its dependencies.
 type Server struct {
 	httpServer *http.Server
 	db         *database.DB
+	processor  *statement.Processor
+	kreuzberg  *kreuzberg.Client
+	purger     *retention.Purger
 	logger     *slog.Logger
+
+	// retryFailed runs the automatic retries of failed statements.
+	retryFailed bool
+
+	checkpointInterval time.Duration
+
+	// stopBackground cancels background jobs; background tracks them so the
+	// database isn't closed while one is still running.
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+}
+
+// Option customizes a Server beyond what its configuration covers.
+type Option func(*options)
+
+type options struct {
+	hooks []statement.PipelineHook
+}
+
+// WithHooks registers pipeline hooks, invoked in order after extraction and
+// after parsing of every statement. PIPELINE_FAIL_ON_HOOK_ERROR decides
+// whether a hook error fails the statement.
+func WithHooks(hooks ...statement.PipelineHook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hooks...) }
 }
 
 // New creates a new HTTP server with all dependencies initialized.
-func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
+func New(cfg *config.Config, logger *slog.Logger, opts ...Option) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Spill large multipart uploads to the configured temp dir.
+	if err := useTempDir(cfg.Upload.TempDir, logger); err != nil {
+		return nil, err
+	}
+
 	// Open metadata database (creates file and runs migrations).
-	db, err := database.Open(cfg.Database.MetadataPath)
+	pool := database.Pool{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	}
+	db, err := database.Open(cfg.Database.MetadataPath, pool)
 	if err != nil {
 		return nil, fmt.Errorf("open metadata database: %w", err)
 	}
+	logger.Info("metadata database connection pool",
+		"max_open_conns", pool.MaxOpenConns,
+		"max_idle_conns", pool.MaxIdleConns,
+		"conn_max_lifetime", pool.ConnMaxLifetime.String(),
+		"read_connection", cfg.Database.ReadConnection,
+	)
+	if cfg.Database.ReadConnection {
+		if err := db.OpenReadConnection(cfg.Database.MetadataPath); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("open metadata database: %w", err)
+		}
+	}
 
 	// Create Kreuzberg client.
-	kreuzbergClient := kreuzberg.NewClient(cfg.Kreuzberg.URL, cfg.Kreuzberg.Timeout)
+	kreuzbergClient := kreuzberg.NewClient(cfg.Kreuzberg.URL, cfg.Kreuzberg.ExtractPath, cfg.Kreuzberg.Timeout, cfg.Kreuzberg.TimeoutByType,
+		cfg.Kreuzberg.AuthHeader, cfg.Kreuzberg.AuthToken, int64(cfg.Kreuzberg.MaxResponseMB)<<20, kreuzberg.Pool{
+			MaxIdleConnsPerHost: cfg.Kreuzberg.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     cfg.Kreuzberg.MaxConnsPerHost,
+			IdleConnTimeout:     cfg.Kreuzberg.IdleConnTimeout,
+			KeepAlive:           cfg.Kreuzberg.KeepAlive,
+		})
+
+	// Create redactor for logs and, optionally, stored extraction data.
+	var redactor *redact.Redactor
+	if cfg.Redaction.Enabled {
+		redactor, err = redact.New(cfg.Redaction.Pattern)
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("create redactor: %w", err)
+		}
+	}
+
+	// Keep original uploads for download.
+	var files storage.FileStore
+	if cfg.Upload.KeepOriginals {
+		files, err = fileStore(cfg.Upload)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	tableFilter, tableFiltersByAccount, err := tableFilters(cfg.Pipeline)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	accountNames, err := statement.ParseAccountNameRules(cfg.Upload.AccountNameMatching)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	fallbacks, err := fallbackExtractors(cfg.Pipeline)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	hasher, err := statement.NewHasher(cfg.Upload.HashAlgorithm, cfg.Upload.HashSalt)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	var categoryRules []transaction.Rule
+	if cfg.Pipeline.CategoryRulesFile != "" {
+		categoryRules, err = transaction.LoadRules(cfg.Pipeline.CategoryRulesFile)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		logger.Info("loaded category rules", "path", cfg.Pipeline.CategoryRulesFile, "rules", len(categoryRules))
+	}
+
+	converter, err := currencyConverter(cfg.Currency)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
 	// Create statement processing pipeline.
-	store := statement.NewStore(db)
-	processor := statement.NewProcessor(store, kreuzbergClient, cfg.Upload.MaxSizeMB, cfg.Upload.AllowedTypes, logger)
+	store := statement.NewStore(db, redactor, cfg.Redaction.RawData)
+	processor := statement.NewProcessor(store, kreuzbergClient, statement.ProcessorOptions{
+		MaxSizeMB:       cfg.Upload.MaxSizeMB,
+		MaxSizeMBByType: cfg.Upload.MaxSizeMBByType,
+		Files:           files,
+		Hasher:          hasher,
+		AllowedTypes:    cfg.Upload.AllowedTypes,
+		ExtensionTypes:  extensionTypes(cfg.Upload),
+		AccountTypes:    accountTypes(cfg.Upload),
+
+		InternalAllowedTypes: cfg.Upload.InternalAllowedTypes,
+
+		DetectCharset: cfg.Upload.DetectCharset,
+		PeriodOverlap: cfg.Upload.PeriodOverlap,
+
+		StatementLimits: statement.StatementLimits{
+			PerAccount: cfg.Upload.MaxStatementsPerAccount,
+			ByAccount:  cfg.Upload.MaxStatementsByAccount,
+		},
+
+		StoreImages:     cfg.Pipeline.StoreImages,
+		StoreContent:    cfg.Pipeline.StoreContent,
+		TableExport:     cfg.Pipeline.TableExport,
+		MergeTables:     cfg.Pipeline.MergeTables,
+		Hooks:           o.hooks,
+		FailOnHookError: cfg.Pipeline.FailOnHookError,
+		FailOnEmpty:     cfg.Pipeline.FailOnEmpty,
+		TimeoutRetries:  cfg.Kreuzberg.TimeoutRetries,
+		RetryDelay:      cfg.Kreuzberg.RetryDelay,
+
+		ProcessingTimeout:      cfg.Pipeline.ProcessingTimeout,
+		RetryProcessingTimeout: cfg.Pipeline.RetryProcessingTimeout,
+
+		FailedRetry: statement.FailedRetryPolicy{
+			MaxAttempts: cfg.Pipeline.FailedRetries,
+			Delay:       cfg.Pipeline.FailedRetryDelay,
+			MaxDelay:    cfg.Pipeline.FailedRetryMaxDelay,
+			Interval:    cfg.Pipeline.FailedRetryInterval,
+		},
+
+		MaxConcurrent:           cfg.Upload.MaxConcurrent,
+		MaxConcurrentPerAccount: cfg.Upload.MaxConcurrentPerAccount,
+		Prioritize:              cfg.Upload.PriorityScheduling,
+		CostWeights:             cfg.Upload.CostWeights,
+		PriorityMaxWait:         cfg.Upload.PriorityMaxWait,
+		StageUploads:            cfg.Upload.Stage,
+		DeterministicIDs:        cfg.Upload.DeterministicIDs,
+
+		ReconcileToleranceCents: cfg.Pipeline.ReconcileToleranceCents,
+		ExpectedCountTolerance:  cfg.Pipeline.ExpectedCountTolerance,
+
+		TableFilter:           tableFilter,
+		TableFiltersByAccount: tableFiltersByAccount,
+		InvertDebitCredit:     cfg.Pipeline.InvertDebitCredit,
+		HeaderNormalization: statement.HeaderNormalization{
+			Enabled:   cfg.Pipeline.NormalizeHeaders,
+			Lowercase: cfg.Pipeline.LowercaseHeaders,
+		},
+		HeaderRows:         cfg.Pipeline.HeaderRows,
+		FallbackExtractors: fallbacks,
+		ExtractionRoutes:   cfg.Pipeline.ExtractionRoutes,
+		StatementDate:      cfg.Pipeline.StatementDate,
+		Timezone:           cfg.Server.Timezone,
+
+		CategoryRules: categoryRules,
+
+		AccountTypeDetector: accountTypeDetector(cfg.Pipeline),
+		AccountSplitter:     accountSplitter(cfg.Pipeline),
+		AccountNames:        accountNames,
+
+		MaxImages: cfg.Pipeline.MaxImages,
+		MaxChunks: cfg.Pipeline.MaxChunks,
+
+		MaxTableColumns: cfg.Pipeline.MaxTableColumns,
+		MaxHeaderLength: cfg.Pipeline.MaxHeaderLength,
+
+		DefaultCurrency: cfg.Currency.Base,
+		Converter:       converter,
+		SplitCurrency:   cfg.Currency.SplitAmounts,
+	}, logger)
+
+	// Record mutations in the audit log; a nil recorder disables auditing.
+	var auditor *audit.Recorder
+	if cfg.Audit.Enabled {
+		auditor = audit.NewRecorder(db, logger)
+	}
 
 	// Create handlers.
 	healthHandler := handlers.NewHealthHandler(kreuzbergClient, db, cfg.Database.GnuCashPath)
-	uploadHandler := handlers.NewUploadHandler(processor, cfg.Upload.MaxSizeMB, logger)
+	// Bound upload bodies by the largest per-type limit; the processor applies
+	// the limit for the detected type.
+	sizeLimits := statement.SizeLimits{MaxSizeMB: cfg.Upload.MaxSizeMB, ByType: cfg.Upload.MaxSizeMBByType}
+	var fetcher *fetch.Fetcher
+	if cfg.Upload.URLEnabled {
+		var dialer *netsafe.Dialer
+		if !cfg.Upload.URLAllowPrivate {
+			dialer = netsafe.NewDialer(cfg.Upload.URLTimeout, cfg.Server.OutboundBlocked, cfg.Server.OutboundAllowed)
+		}
+		fetcher = fetch.New(cfg.Upload.URLTimeout, int64(sizeLimits.Largest())<<20, dialer)
+	}
+	uploadHandler := handlers.NewUploadHandler(processor, fetcher, sizeLimits.Largest(), cfg.Upload.MaxBatchFiles, cfg.Upload.MultipartMemoryMB, cfg.Upload.MaxFormKB, cfg.Upload.DuplicateConflict, auditor, logger)
+	statementsHandler := handlers.NewStatementsHandler(db, files, cfg.Pipeline.ReconcileToleranceCents, auditor, logger)
+	transactionsHandler := handlers.NewTransactionsHandler(db, converter, cfg.Server.PendingAccepted, auditor, logger)
+	auditHandler := handlers.NewAuditHandler(db, logger)
+	maintenanceHandler := handlers.NewMaintenanceHandler(db, auditor, logger)
+	logsHandler := handlers.NewLogsHandler(db, logger)
+	profilesHandler := handlers.NewHeaderProfilesHandler(db, auditor, logger)
+	tagsHandler := handlers.NewTagsHandler(db, auditor, logger)
+	notesHandler := handlers.NewNotesHandler(db, auditor, logger)
+	accountsHandler := handlers.NewAccountsHandler(db, cfg.GnuCash.DefaultCurrency, logger)
+	reportsHandler := handlers.NewReportsHandler(db, cfg.GnuCash.DefaultCurrency, logger)
+
+	requireAPIKey := auth.Middleware(cfg.Auth.APIKeys, cfg.Auth.InternalKeys)
+	// Uploads and statement lookups are open unless tenant isolation needs the
+	// caller's key to scope them. Internal keys are still recognized on them.
+	open := func(h http.Handler) http.Handler { return h }
+	if len(cfg.Auth.InternalKeys) > 0 {
+		open = auth.Identify(cfg.Auth.APIKeys, cfg.Auth.InternalKeys)
+	}
+	if cfg.Auth.TenantIsolation {
+		authenticate := requireAPIKey
+		requireAPIKey = func(h http.Handler) http.Handler { return authenticate(auth.Isolate(h)) }
+		open = requireAPIKey
+	}
+
+	// Uploads are refused while memory runs low, before their bodies are read.
+	accept := func(h http.Handler) http.Handler { return open(h) }
+	if cfg.Upload.MinFreeMemoryMB > 0 {
+		guard := MemoryGuard(uint64(cfg.Upload.MinFreeMemoryMB)<<20, cfg.Upload.MemoryRetryAfter, logger)
+		accept = func(h http.Handler) http.Handler { return open(guard(h)) }
+	}
 
 	// Register routes.
 	mux := http.NewServeMux()
 	mux.Handle("/health", healthHandler)
-	mux.Handle("/upload", uploadHandler)
+	mux.HandleFunc("GET /version", handlers.Version)
+	mux.Handle("/upload", accept(uploadHandler))
+	mux.Handle("POST /upload/batch", accept(http.HandlerFunc(uploadHandler.Batch)))
+	if fetcher != nil {
+		mux.Handle("POST /upload/url", accept(http.HandlerFunc(uploadHandler.URL)))
+	}
+	mux.Handle("POST /parse/preview", accept(http.HandlerFunc(uploadHandler.Preview)))
+	mux.Handle("GET /statements", requireAPIKey(http.HandlerFunc(statementsHandler.List)))
+	mux.Handle("POST /statements/merge", requireAPIKey(http.HandlerFunc(statementsHandler.Merge)))
+	mux.Handle("POST /statements/delete", requireAPIKey(http.HandlerFunc(statementsHandler.DeleteMany)))
+	mux.Handle("GET /statements/export.csv", requireAPIKey(http.HandlerFunc(statementsHandler.Export)))
+	mux.Handle("GET /statements/{id}", open(http.HandlerFunc(statementsHandler.Get)))
+	mux.Handle("GET /statements/{id}/download", requireAPIKey(http.HandlerFunc(statementsHandler.Download)))
+	mux.Handle("GET /statements/{id}/raw", requireAPIKey(http.HandlerFunc(statementsHandler.Raw)))
+	mux.Handle("GET /statements/{id}/content", requireAPIKey(http.HandlerFunc(statementsHandler.Content)))
+	mux.Handle("GET /statements/{id}/images", requireAPIKey(http.HandlerFunc(statementsHandler.Images)))
+	mux.Handle("GET /statements/{id}/images/{imageID}", requireAPIKey(http.HandlerFunc(statementsHandler.Image)))
+	mux.Handle("GET /statements/{id}/tables", requireAPIKey(http.HandlerFunc(statementsHandler.Tables)))
+	mux.Handle("GET /statements/{id}/table.csv", requireAPIKey(http.HandlerFunc(statementsHandler.TableCSV)))
+	mux.Handle("GET /statements/{id}/transactions", requireAPIKey(http.HandlerFunc(transactionsHandler.List)))
+	mux.Handle("GET /statements/{id}/transactions.csv", requireAPIKey(http.HandlerFunc(transactionsHandler.Export)))
+	mux.Handle("GET /statements/{id}/diff", requireAPIKey(http.HandlerFunc(transactionsHandler.Diff)))
+	mux.Handle("PUT /transactions/{id}", requireAPIKey(http.HandlerFunc(transactionsHandler.Update)))
+	mux.Handle("POST /transactions/categorize", requireAPIKey(http.HandlerFunc(transactionsHandler.Categorize)))
+	mux.Handle("POST /categorize/validate", requireAPIKey(http.HandlerFunc(transactionsHandler.ValidateRules)))
+	mux.Handle("POST /statements/{id}/commit", requireAPIKey(http.HandlerFunc(statementsHandler.Commit)))
+	mux.Handle("POST /statements/{id}/reconcile", requireAPIKey(http.HandlerFunc(statementsHandler.Reconcile)))
+	mux.Handle("PUT /statements/{id}/legal-hold", requireAPIKey(http.HandlerFunc(statementsHandler.SetLegalHold)))
+	mux.Handle("DELETE /statements/{id}/legal-hold", requireAPIKey(http.HandlerFunc(statementsHandler.ClearLegalHold)))
+	mux.Handle("GET /tags", requireAPIKey(http.HandlerFunc(tagsHandler.List)))
+	mux.Handle("POST /tags", requireAPIKey(http.HandlerFunc(tagsHandler.Create)))
+	mux.Handle("PUT /statements/{id}/tags/{tag}", requireAPIKey(http.HandlerFunc(tagsHandler.Attach)))
+	mux.Handle("DELETE /statements/{id}/tags/{tag}", requireAPIKey(http.HandlerFunc(tagsHandler.Detach)))
+	mux.Handle("GET /statements/{id}/notes", requireAPIKey(http.HandlerFunc(notesHandler.List)))
+	mux.Handle("POST /statements/{id}/notes", requireAPIKey(http.HandlerFunc(notesHandler.Create)))
+	mux.Handle("DELETE /statements/{id}/notes/{note}", requireAPIKey(http.HandlerFunc(notesHandler.Delete)))
+	mux.Handle("GET /header-profiles", requireAPIKey(http.HandlerFunc(profilesHandler.List)))
+	mux.Handle("GET /accounts/{account}/header-profile", requireAPIKey(http.HandlerFunc(profilesHandler.Get)))
+	mux.Handle("PUT /accounts/{account}/header-profile", requireAPIKey(http.HandlerFunc(profilesHandler.Put)))
+	mux.Handle("DELETE /accounts/{account}/header-profile", requireAPIKey(http.HandlerFunc(profilesHandler.Delete)))
+	mux.Handle("GET /accounts/{account}/summary", requireAPIKey(http.HandlerFunc(accountsHandler.Summary)))
+	mux.Handle("GET /accounts/{account}/statements", requireAPIKey(http.HandlerFunc(accountsHandler.Statements)))
+	mux.Handle("GET /reports/categories", requireAPIKey(http.HandlerFunc(reportsHandler.Categories)))
+	mux.Handle("GET /statements/{id}/header-profile/suggestion", requireAPIKey(http.HandlerFunc(profilesHandler.Suggest)))
+	mux.Handle("GET /statements/{id}/logs", requireAPIKey(http.HandlerFunc(logsHandler.Statement)))
+	mux.Handle("GET /logs", requireAPIKey(http.HandlerFunc(logsHandler.List)))
+	mux.Handle("GET /admin/audit", requireAPIKey(http.HandlerFunc(auditHandler.List)))
+	mux.Handle("POST /admin/vacuum", requireAPIKey(http.HandlerFunc(maintenanceHandler.Vacuum)))
+	mux.Handle("GET /admin/schema", requireAPIKey(http.HandlerFunc(maintenanceHandler.Schema)))
+	mux.Handle("POST /admin/migrate", requireAPIKey(http.HandlerFunc(maintenanceHandler.Migrate)))
+	if cfg.Server.Pprof {
+		logger.Warn("profiling endpoints enabled under /debug/pprof")
+		mux.Handle("GET /debug/pprof/", requireAPIKey(http.HandlerFunc(pprof.Index)))
+		mux.Handle("GET /debug/pprof/cmdline", requireAPIKey(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("GET /debug/pprof/profile", requireAPIKey(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("GET /debug/pprof/symbol", requireAPIKey(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("POST /debug/pprof/symbol", requireAPIKey(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("GET /debug/pprof/trace", requireAPIKey(http.HandlerFunc(pprof.Trace)))
+	}
+
+	// Mount all routes under the configured base path, if any.
+	var handler http.Handler = mux
+	if cfg.Server.BasePath != "" {
+		handler = http.StripPrefix(cfg.Server.BasePath, mux)
+	}
 
 	// Apply middleware.
-	handler := CORSMiddleware(mux)
-	handler = LoggingMiddleware(logger)(handler)
+	handler = CORSMiddleware(cfg.CORS)(handler)
+	if cfg.Server.Compression {
+		handler = CompressionMiddleware(cfg.Server.CompressionMinBytes)(handler)
+	}
+	handler = LoggingMiddleware(logger, cfg.Logging, cfg.Server.BasePath)(handler)
+	handler = requestinfo.Middleware(cfg.Server.ResponseEnvelope, cfg.Server.Timezone)(handler)
+	handler = clientip.Middleware(cfg.Server.TrustedProxies, cfg.Server.ProxyHeaders)(handler)
 	handler = RecoveryMiddleware(logger)(handler)
 
 	httpServer := &http.Server{
@@ -54,29 +382,201 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 		Handler:      handler,
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
+
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 
-	return &Server{
-		httpServer: httpServer,
-		db:         db,
-		logger:     logger,
-	}, nil
+	srv := &Server{
+		httpServer:     httpServer,
+		db:             db,
+		processor:      processor,
+		kreuzberg:      kreuzbergClient,
+		logger:         logger,
+		stopBackground: func() {},
+
+		checkpointInterval: cfg.Database.CheckpointInterval,
+		retryFailed:        cfg.Pipeline.FailedRetries > 0,
+	}
+
+	if cfg.Retention.Days > 0 {
+		srv.purger = retention.NewPurger(db, retention.Policy{
+			Days:       cfg.Retention.Days,
+			HardDelete: cfg.Retention.HardDelete,
+			DryRun:     cfg.Retention.DryRun,
+			Interval:   cfg.Retention.Interval,
+		}, files, auditor, logger)
+	}
+
+	return srv, nil
 }
 
-// Start starts the HTTP server.
+// tableFilters parses the default and per-account table filters.
+func tableFilters(cfg config.PipelineConfig) (statement.TableFilter, map[string]statement.TableFilter, error) {
+	filter, err := statement.ParseTableFilter(cfg.TableFilter)
+	if err != nil {
+		return statement.TableFilter{}, nil, fmt.Errorf("invalid table filter: %w", err)
+	}
+
+	byAccount := make(map[string]statement.TableFilter, len(cfg.TableFiltersByAccount))
+	for account, spec := range cfg.TableFiltersByAccount {
+		f, err := statement.ParseTableFilter(spec)
+		if err != nil {
+			return statement.TableFilter{}, nil, fmt.Errorf("invalid table filter for account %q: %w", account, err)
+		}
+		byAccount[account] = f
+	}
+
+	return filter, byAccount, nil
+}
+
+// fileStore returns the configured store for original uploads.
+func fileStore(cfg config.UploadConfig) (storage.FileStore, error) {
+	if cfg.StorageBackend == "s3" {
+		return storage.NewS3(storage.S3Config(cfg.S3))
+	}
+	return storage.NewLocal(cfg.StorageDir)
+}
+
+// extensionTypes returns the extension to MIME type map checked in strict MIME
+// mode, or nil when uploads are only validated by content.
+func extensionTypes(cfg config.UploadConfig) map[string]string {
+	if !cfg.StrictMIME {
+		return nil
+	}
+	return cfg.ExtensionTypes
+}
+
+// currencyConverter returns the converter to the base currency, or nil when
+// conversion is disabled. Static rates take precedence over the rates API.
+func currencyConverter(cfg config.CurrencyConfig) (*exchange.Converter, error) {
+	if !cfg.Conversion {
+		return nil, nil
+	}
+
+	static, err := exchange.ParseStatic(cfg.Base, cfg.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("currency rates: %w", err)
+	}
+	providers := exchange.Chain{static}
+	if cfg.RatesURL != "" {
+		providers = append(providers, exchange.NewHTTP(cfg.RatesURL, cfg.RatesTimeout))
+	}
+	return exchange.NewConverter(cfg.Base, providers), nil
+}
+
+// fallbackExtractors builds the fallback extractor chain from configuration.
+func fallbackExtractors(cfg config.PipelineConfig) ([]statement.FallbackExtractor, error) {
+	var extractors []statement.FallbackExtractor
+	for _, name := range cfg.FallbackExtractors {
+		f, err := statement.ParseFallbackExtractor(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback extractors: %w", err)
+		}
+		extractors = append(extractors, f)
+	}
+	return extractors, nil
+}
+
+// accountTypeDetector returns the detector for uploads without an account type,
+// or nil when detection is disabled.
+func accountTypeDetector(cfg config.PipelineConfig) *statement.AccountTypeDetector {
+	if !cfg.DetectAccountType {
+		return nil
+	}
+	return &statement.AccountTypeDetector{Keywords: cfg.AccountTypeKeywords}
+}
+
+// accountSplitter returns the splitter for combined statements, or nil when
+// splitting is disabled.
+func accountSplitter(cfg config.PipelineConfig) *statement.AccountSplitter {
+	if !cfg.SplitAccounts {
+		return nil
+	}
+	return &statement.AccountSplitter{Sections: cfg.AccountSections}
+}
+
+// accountTypes builds the account type allow-list from configuration.
+// A "*" entry disables the allow-list, keeping only synonym resolution.
+func accountTypes(cfg config.UploadConfig) statement.AccountTypes {
+	allowed := make([]string, 0, len(cfg.AccountTypes))
+	for _, t := range cfg.AccountTypes {
+		if t == "*" {
+			allowed = nil
+			break
+		}
+		allowed = append(allowed, t)
+	}
+
+	return statement.AccountTypes{
+		Allowed:  allowed,
+		Synonyms: cfg.AccountTypeSynonyms,
+	}
+}
+
+// Start starts background jobs and the HTTP server.
 func (s *Server) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopBackground = cancel
+
+	if s.purger != nil {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.purger.Run(ctx)
+		}()
+	}
+
+	if s.retryFailed {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.processor.RunFailedRetries(ctx)
+		}()
+	}
+
+	if s.checkpointInterval > 0 {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.runCheckpoints(ctx)
+		}()
+	}
+
 	s.logger.Info("starting http server",
 		"addr", s.httpServer.Addr,
 	)
 	return s.httpServer.ListenAndServe()
 }
 
+// runCheckpoints periodically checkpoints the metadata database WAL until ctx is cancelled.
+func (s *Server) runCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(s.checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.db.Checkpoint(); err != nil {
+				s.logger.Warn("metadata database checkpoint failed", "error", err)
+			}
+		}
+	}
+}
+
 // Shutdown gracefully shuts down the server and closes the database.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down http server")
 
 	err := s.httpServer.Shutdown(ctx)
 
+	s.stopBackground()
+	s.background.Wait()
+	s.processor.Close()
+	s.kreuzberg.Close()
+
 	if dbErr := s.db.Close(); dbErr != nil {
 		s.logger.Error("failed to close database", "error", dbErr)
 	}
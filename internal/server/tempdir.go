@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// useTempDir makes dir the process temp directory, so file parts that
+// ParseMultipartForm spills to disk land there rather than in the system default.
+// Spill files left behind by a crash are removed; the stdlib removes the rest
+// when each request finishes.
+func useTempDir(dir string, logger *slog.Logger) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("resolve upload temp dir: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0o700); err != nil {
+		return fmt.Errorf("create upload temp dir: %w", err)
+	}
+
+	stale, err := filepath.Glob(filepath.Join(abs, "multipart-*"))
+	if err != nil {
+		return fmt.Errorf("list upload temp files: %w", err)
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			logger.Warn("failed to remove stale upload temp file", "path", path, "error", err)
+		}
+	}
+	if len(stale) > 0 {
+		logger.Info("removed stale upload temp files", "count", len(stale))
+	}
+
+	// os.TempDir reads TMPDIR on Unix systems.
+	return os.Setenv("TMPDIR", abs)
+}
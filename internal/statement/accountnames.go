@@ -0,0 +1,96 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Rules for matching the account name of an upload to an existing account.
+const (
+	// AccountMatchCase ignores letter case: "CHASE" matches "Chase".
+	AccountMatchCase = "case"
+	// AccountMatchSpace ignores leading and trailing whitespace and treats
+	// runs of whitespace as one space.
+	AccountMatchSpace = "space"
+	// AccountMatchPunctuation ignores punctuation: "Chase Checking." matches
+	// "Chase-Checking" when spaces are collapsed too.
+	AccountMatchPunctuation = "punctuation"
+)
+
+// AccountNames resolves the account name of an upload to the name an
+// existing account was first uploaded under, when the two match under its
+// rules, so inconsistent spellings don't split an account in several. The
+// zero value resolves nothing.
+type AccountNames struct {
+	IgnoreCase        bool
+	CollapseSpace     bool
+	IgnorePunctuation bool
+}
+
+// ParseAccountNameRules builds AccountNames from a list of rules: case, space
+// and punctuation. An empty list, or off, disables resolution.
+func ParseAccountNameRules(rules []string) (AccountNames, error) {
+	var a AccountNames
+	for _, rule := range rules {
+		switch strings.ToLower(strings.TrimSpace(rule)) {
+		case AccountMatchCase:
+			a.IgnoreCase = true
+		case AccountMatchSpace:
+			a.CollapseSpace = true
+		case AccountMatchPunctuation:
+			a.IgnorePunctuation = true
+		case "off":
+		default:
+			return AccountNames{}, fmt.Errorf("unknown account name rule %q (must be case, space, punctuation or off)", rule)
+		}
+	}
+	return a, nil
+}
+
+// Enabled reports whether any rule is set.
+func (a AccountNames) Enabled() bool {
+	return a.IgnoreCase || a.CollapseSpace || a.IgnorePunctuation
+}
+
+// Key returns the form of an account name compared by the rules.
+func (a AccountNames) Key(name string) string {
+	if a.IgnorePunctuation {
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return ' '
+			}
+			return r
+		}, name)
+	}
+	if a.CollapseSpace {
+		name = strings.Join(strings.Fields(name), " ")
+	}
+	if a.IgnoreCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// resolveAccountName returns the name of the owner's existing account that
+// name matches, the first seen if several do, or name itself when none does.
+// Failing to look the accounts up leaves name as it is.
+func (p *Processor) resolveAccountName(owner, name string) string {
+	if !p.accountNames.Enabled() || strings.TrimSpace(name) == "" {
+		return name
+	}
+
+	names, err := p.store.AccountNames(owner)
+	if err != nil {
+		p.logger.Warn("failed to resolve account name", "account_name", name, "error", err)
+		return name
+	}
+
+	key := p.accountNames.Key(name)
+	for _, existing := range names {
+		if p.accountNames.Key(existing) == key {
+			return existing
+		}
+	}
+	return name
+}
@@ -0,0 +1,203 @@
+package statement
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// maxSectionHeadingLength is the longest line of content taken for a section
+// heading; longer lines are prose that merely mentions an account.
+const maxSectionHeadingLength = 80
+
+// DetectedAccount is one account of a combined statement.
+type DetectedAccount struct {
+	// Name is the section heading that introduced the account, e.g.
+	// "Savings Account ...5678".
+	Name string
+	// Type is the account type whose phrase the heading matched.
+	Type string
+	// Transactions counts the transactions parsed for the account.
+	Transactions int
+}
+
+// AccountSplitter splits combined statements, such as a checking and a savings
+// account on one PDF, into their accounts by section headings. Sections maps
+// each account type to lowercase phrases that open a section for it, such as
+// "savings account".
+type AccountSplitter struct {
+	Sections map[string][]string
+}
+
+// Split sets the Account of rows, as returned by ParseTables for results, to
+// the section they fall under and returns the sections in order of appearance.
+//
+// A row with a single non-blank cell matching a phrase, or a table whose only
+// header does, opens a section that runs until the next one, across tables.
+// Failing that, short lines of content matching a phrase are taken as
+// headings, one per table in order, when there are exactly as many as tables.
+// Statements with fewer than two sections aren't split: rows are left
+// unassigned and Split returns nil.
+func (s AccountSplitter) Split(results []kreuzberg.ExtractionResult, rows []RawRow) []DetectedAccount {
+	if len(s.Sections) == 0 {
+		return nil
+	}
+
+	if accounts := s.splitByRows(results, rows); len(accounts) > 1 {
+		return accounts
+	}
+	if accounts := s.splitByContent(results, rows); len(accounts) > 1 {
+		return accounts
+	}
+
+	for i := range rows {
+		rows[i].Account, rows[i].AccountType = "", ""
+	}
+	return nil
+}
+
+// splitByRows assigns rows to the sections opened by heading rows and headers.
+func (s AccountSplitter) splitByRows(results []kreuzberg.ExtractionResult, rows []RawRow) []DetectedAccount {
+	var accounts []DetectedAccount
+	var current DetectedAccount
+	open := func(text string) {
+		if name, accountType, ok := s.heading(text); ok {
+			current = DetectedAccount{Name: name, Type: accountType}
+			accounts = addAccount(accounts, current)
+		}
+	}
+
+	i := 0
+	for _, result := range results {
+		for _, table := range result.Tables {
+			if cell, ok := soleCell(table.Headers); ok {
+				open(cell)
+			}
+			for _, row := range table.Rows {
+				if cell, ok := soleCell(row); ok {
+					open(cell)
+				}
+				if i < len(rows) {
+					rows[i].Account, rows[i].AccountType = current.Name, current.Type
+				}
+				i++
+			}
+		}
+	}
+	return accounts
+}
+
+// splitByContent assigns each table with rows to the heading at the same
+// position among the headings found in the content.
+func (s AccountSplitter) splitByContent(results []kreuzberg.ExtractionResult, rows []RawRow) []DetectedAccount {
+	var headings []DetectedAccount
+	tables := 0
+	for _, result := range results {
+		for _, line := range strings.Split(result.Content, "\n") {
+			if name, accountType, ok := s.heading(line); ok {
+				headings = append(headings, DetectedAccount{Name: name, Type: accountType})
+			}
+		}
+		for _, table := range result.Tables {
+			if len(table.Rows) > 0 {
+				tables++
+			}
+		}
+	}
+	if len(headings) != tables {
+		return nil
+	}
+
+	var accounts []DetectedAccount
+	i, t := 0, 0
+	for _, result := range results {
+		for _, table := range result.Tables {
+			if len(table.Rows) == 0 {
+				continue
+			}
+			accounts = addAccount(accounts, headings[t])
+			for range table.Rows {
+				if i < len(rows) {
+					rows[i].Account, rows[i].AccountType = headings[t].Name, headings[t].Type
+				}
+				i++
+			}
+			t++
+		}
+	}
+	return accounts
+}
+
+// heading reports whether text is a section heading, returning it with
+// whitespace collapsed and the account type it opens. When phrases of several
+// types match, the first type in alphabetical order wins.
+func (s AccountSplitter) heading(text string) (name, accountType string, ok bool) {
+	name = strings.Join(strings.Fields(text), " ")
+	if name == "" || utf8.RuneCountInString(name) > maxSectionHeadingLength {
+		return "", "", false
+	}
+	lower := strings.ToLower(name)
+
+	types := make([]string, 0, len(s.Sections))
+	for t := range s.Sections {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	for _, t := range types {
+		for _, phrase := range s.Sections[t] {
+			if strings.Contains(lower, phrase) {
+				return name, t, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// soleCell returns the only non-blank value of cells, if there is exactly one.
+func soleCell(cells []string) (string, bool) {
+	var found string
+	n := 0
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			found = c
+			n++
+		}
+	}
+	return found, n == 1
+}
+
+// addAccount appends a to accounts unless an account of that name is already
+// listed, as when a section continues on the next page under the same heading.
+func addAccount(accounts []DetectedAccount, a DetectedAccount) []DetectedAccount {
+	if slices.ContainsFunc(accounts, func(b DetectedAccount) bool { return b.Name == a.Name }) {
+		return accounts
+	}
+	return append(accounts, a)
+}
+
+// countAccountTransactions sets the Transactions of each account from the
+// parsed transactions.
+func countAccountTransactions(accounts []DetectedAccount, txns []transaction.Transaction) {
+	for _, t := range txns {
+		for a := range accounts {
+			if accounts[a].Name == t.Account {
+				accounts[a].Transactions++
+			}
+		}
+	}
+}
+
+// logAccounts records the accounts a combined statement was split into.
+func (p *Processor) logAccounts(statementID string, accounts []DetectedAccount) {
+	parts := make([]string, len(accounts))
+	for i, a := range accounts {
+		parts[i] = fmt.Sprintf("%s (%s, %d transactions)", a.Name, a.Type, a.Transactions)
+	}
+	p.store.Log(statementID, database.LevelInfo, "parse", fmt.Sprintf("Split into %d accounts: %s", len(accounts), strings.Join(parts, "; ")))
+}
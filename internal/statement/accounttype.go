@@ -0,0 +1,93 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// ErrInvalidAccountType is returned when an upload's account_type is not allowed.
+var ErrInvalidAccountType = errors.New("invalid account type")
+
+// AccountTypes validates and normalizes the account_type supplied with uploads.
+type AccountTypes struct {
+	// Allowed lists the canonical account types. Empty allows any value.
+	Allowed []string
+	// Synonyms maps alternative spellings to a canonical type, e.g. "cc" → "credit".
+	Synonyms map[string]string
+}
+
+// Normalize lower-cases value, resolves synonyms and checks the result against
+// the allow-list. An empty value is accepted as "not specified".
+func (a AccountTypes) Normalize(value string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	if normalized == "" {
+		return "", nil
+	}
+
+	if canonical, ok := a.Synonyms[normalized]; ok {
+		normalized = canonical
+	}
+
+	if len(a.Allowed) == 0 || slices.Contains(a.Allowed, normalized) {
+		return normalized, nil
+	}
+
+	return "", fmt.Errorf("%w %q: must be one of %s", ErrInvalidAccountType, value, strings.Join(a.Allowed, ", "))
+}
+
+// AccountTypeDetector infers the account type of a statement uploaded without
+// one. Keywords maps each account type to lowercase phrases that suggest it,
+// such as "credit limit" or "minimum payment" for credit cards.
+type AccountTypeDetector struct {
+	Keywords map[string][]string
+}
+
+// Detect scores each account type by how many of its keywords appear in the
+// extracted content and table headers. It returns the best-scoring type and
+// its share of all matched keywords as confidence, from 0 to 1. ok is false
+// when no keyword matched or the best types tie.
+func (d AccountTypeDetector) Detect(results []kreuzberg.ExtractionResult) (accountType string, confidence float64, ok bool) {
+	var text strings.Builder
+	for _, r := range results {
+		text.WriteString(r.Content)
+		text.WriteByte('\n')
+		for _, t := range r.Tables {
+			text.WriteString(strings.Join(t.Headers, " "))
+			text.WriteByte('\n')
+		}
+	}
+	haystack := strings.Join(strings.Fields(strings.ToLower(text.String())), " ")
+
+	types := make([]string, 0, len(d.Keywords))
+	for t := range d.Keywords {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	var best, total int
+	tie := false
+	for _, t := range types {
+		score := 0
+		for _, kw := range d.Keywords[t] {
+			if strings.Contains(haystack, kw) {
+				score++
+			}
+		}
+		total += score
+		switch {
+		case score > best:
+			accountType, best, tie = t, score, false
+		case score == best && score > 0:
+			tie = true
+		}
+	}
+	if best == 0 || tie {
+		return "", 0, false
+	}
+
+	return accountType, float64(best) / float64(total), true
+}
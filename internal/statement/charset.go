@@ -0,0 +1,170 @@
+package statement
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Names of the charsets DetectCharset recognizes, as recorded on statements.
+// Charsets named in uploads are recorded by their MIME or IANA name, in
+// lower case.
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF16       = "utf-16"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetLatin1      = "iso-8859-1"
+	CharsetWindows1252 = "windows-1252"
+)
+
+var (
+	utf16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16BE = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	// utf16BOM takes the byte order from the BOM, or little-endian as Windows
+	// writes it without one.
+	utf16BOM = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+)
+
+// charsetAliases are the names accepted besides IANA's and WHATWG's, and
+// UTF-16, which IANA reads as big-endian without a BOM.
+var charsetAliases = map[string]encoding.Encoding{
+	"utf-16": utf16BOM, "utf16": utf16BOM,
+	"utf16le": utf16LE,
+	"utf16be": utf16BE,
+	"latin-1": charmap.ISO8859_1, "iso8859-1": charmap.ISO8859_1,
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// ErrInvalidCharset is returned when an upload names a charset that isn't supported.
+var ErrInvalidCharset = errors.New("invalid charset")
+
+// ParseCharset returns the encoding of a charset given in an upload: an IANA
+// name or alias such as "latin1" or "shift_jis", or a WHATWG label such as
+// "cp1252". Empty means detect it, and returns nil.
+func ParseCharset(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, nil
+	}
+	if enc, ok := charsetAliases[name]; ok {
+		return enc, nil
+	}
+
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		enc, err = htmlindex.Get(name)
+	}
+	if err != nil || enc == nil || CharsetName(enc) == "" {
+		return nil, fmt.Errorf("%w %q: must be an IANA charset name such as utf-8, iso-8859-1 or windows-1252", ErrInvalidCharset, name)
+	}
+	return enc, nil
+}
+
+// CharsetName returns the lower-cased MIME name of an encoding, else its IANA
+// name, or empty for an encoding with neither.
+func CharsetName(enc encoding.Encoding) string {
+	name, err := ianaindex.MIME.Name(enc)
+	if err != nil || name == "" {
+		name, err = ianaindex.IANA.Name(enc)
+	}
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(name)
+}
+
+// DetectCharset guesses the charset of text: from its byte order mark, from
+// the zero bytes of mostly-ASCII UTF-16, then UTF-8 if it's valid. Anything
+// else is taken for Latin-1, or Windows-1252 when it uses the bytes only
+// Windows-1252 assigns printable characters to.
+func DetectCharset(data []byte) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return unicode.UTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return utf16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return utf16BE
+	}
+
+	if enc := detectUTF16(data[:min(len(data), sniffLen)]); enc != nil {
+		return enc
+	}
+	if utf8.Valid(data) {
+		return unicode.UTF8
+	}
+	if slices.ContainsFunc(data, func(b byte) bool { return b >= 0x80 && b <= 0x9F }) {
+		return charmap.Windows1252
+	}
+	return charmap.ISO8859_1
+}
+
+// detectUTF16 recognizes UTF-16 without a byte order mark by the zero high
+// bytes of its ASCII characters: in most odd positions for little-endian, in
+// most even ones for big-endian. It returns nil for anything else.
+func detectUTF16(head []byte) encoding.Encoding {
+	if len(head) < 4 {
+		return nil
+	}
+	var even, odd int
+	for i, b := range head[:len(head)&^1] {
+		if b == 0 && i%2 == 0 {
+			even++
+		} else if b == 0 {
+			odd++
+		}
+	}
+	pairs := len(head) / 2
+	switch {
+	case odd > pairs/2 && even == 0:
+		return utf16LE
+	case even > pairs/2 && odd == 0:
+		return utf16BE
+	}
+	return nil
+}
+
+// ToUTF8 transcodes data from enc to UTF-8. A byte order mark is dropped and
+// takes precedence over enc. Bytes that don't decode become U+FFFD.
+func ToUTF8(data []byte, enc encoding.Encoding) []byte {
+	out, _, err := transform.Bytes(unicode.BOMOverride(enc.NewDecoder()), data)
+	if err != nil {
+		// Decoders replace what they can't decode rather than failing, so
+		// this is only reached for a transformer bug; keep the input.
+		return data
+	}
+	return out
+}
+
+// decodeText returns the text of a text upload as UTF-8 for extraction, with
+// the name of the charset it was decoded from: enc if given, else the
+// detected one when detection is on. Other uploads, and text with neither,
+// are returned unchanged with no charset.
+func (p *Processor) decodeText(mimeType string, data []byte, enc encoding.Encoding) ([]byte, string) {
+	if !strings.HasPrefix(mimeType, "text/") {
+		return data, ""
+	}
+	if enc == nil {
+		if !p.detectCharset {
+			return data, ""
+		}
+		enc = DetectCharset(data)
+	}
+	return ToUTF8(data, enc), CharsetName(enc)
+}
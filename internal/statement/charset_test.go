@@ -0,0 +1,180 @@
+package statement
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// readFixture returns the contents of a file in testdata.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// encodeUTF16LE encodes s as UTF-16, little-endian, without a byte order mark.
+func encodeUTF16LE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"latin-1 fixture", readFixture(t, "latin1.csv"), CharsetLatin1},
+		{"windows-1252 fixture", readFixture(t, "windows1252.csv"), CharsetWindows1252},
+		{"utf-8", []byte("Date,Description\n2024-01-02,Café Müller\n"), CharsetUTF8},
+		{"ascii", []byte("Date,Description\n2024-01-02,Coffee\n"), CharsetUTF8},
+		{"utf-8 bom", append(slices.Clone(bomUTF8), "Date,Description\n"...), CharsetUTF8},
+		{"utf-16le bom", append(slices.Clone(bomUTF16LE), encodeUTF16LE("Date,Description\n")...), CharsetUTF16LE},
+		{"utf-16le without bom", encodeUTF16LE("Date,Description\n2024-01-02,Café\n"), CharsetUTF16LE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CharsetName(DetectCharset(tt.data)); got != tt.want {
+				t.Errorf("DetectCharset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToUTF8Fixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		charset string
+		want    []string
+	}{
+		{"latin1.csv", CharsetLatin1, []string{"Café Müller", "Bäckerei Schäfer", "Crédit Agricole Société Générale", "Peña Ñandú"}},
+		{"windows1252.csv", CharsetWindows1252, []string{"“Le Café” – Zürich", "Subscription €9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			enc, err := ParseCharset(tt.charset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ToUTF8(readFixture(t, tt.fixture), enc)
+			for _, want := range tt.want {
+				if !bytes.Contains(got, []byte(want)) {
+					t.Errorf("decoded text doesn't contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"utf-8", CharsetUTF8},
+		{"UTF8", CharsetUTF8},
+		{"latin1", CharsetLatin1},
+		{"latin-1", CharsetLatin1},
+		{"ISO_8859-1", CharsetLatin1},
+		{"cp1252", CharsetWindows1252},
+		{"utf-16", CharsetUTF16},
+		{"utf16le", CharsetUTF16LE},
+		{"UTF-16BE", CharsetUTF16BE},
+		{"shift_jis", "shift_jis"},
+		{"koi8-r", "koi8-r"},
+		{"ibm850", "ibm850"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := ParseCharset(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := CharsetName(enc); got != tt.want {
+				t.Errorf("CharsetName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if enc, err := ParseCharset(""); enc != nil || err != nil {
+		t.Errorf("ParseCharset(\"\") = %v, %v, want nil, nil", enc, err)
+	}
+	if _, err := ParseCharset("klingon"); !errors.Is(err, ErrInvalidCharset) {
+		t.Errorf("ParseCharset(klingon) error = %v, want ErrInvalidCharset", err)
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		data    []byte
+		want    string
+	}{
+		{"koi8-r", "koi8-r", []byte{0xeb, 0xc1, 0xc6, 0xc5}, "Кафе"},
+		{"utf-16 takes byte order from bom", "utf-16", append(slices.Clone(bomUTF16LE), encodeUTF16LE("Café")...), "Café"},
+		{"utf-16 without bom is little-endian", "utf-16", encodeUTF16LE("Café"), "Café"},
+		{"bom overrides charset", "latin1", append(slices.Clone(bomUTF8), "Café"...), "Café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := ParseCharset(tt.charset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(ToUTF8(tt.data, enc)); got != tt.want {
+				t.Errorf("ToUTF8() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewLatin1(t *testing.T) {
+	want := []string{"Café Müller", "Bäckerei Schäfer", "Crédit Agricole Société Générale", "Peña Ñandú"}
+
+	tests := []struct {
+		name    string
+		detect  bool
+		charset string
+	}{
+		{name: "detected", detect: true},
+		{name: "named in the upload", charset: "latin1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProcessor(t, ProcessorOptions{DetectCharset: tt.detect})
+			result, err := p.Preview(Upload{
+				Filename: "latin1.csv",
+				Body:     bytes.NewReader(readFixture(t, "latin1.csv")),
+				Charset:  tt.charset,
+			}, transaction.Mapping{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Charset != CharsetLatin1 {
+				t.Errorf("Charset = %q, want %q", result.Charset, CharsetLatin1)
+			}
+			var got []string
+			for _, txn := range result.Transactions {
+				got = append(got, txn.Description)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("descriptions = %q, want %q", got, want)
+			}
+		})
+	}
+}
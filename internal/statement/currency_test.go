@@ -0,0 +1,77 @@
+package statement
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/billdaws/moneymanager/internal/exchange"
+)
+
+func TestProcessMixedCurrencies(t *testing.T) {
+	rates, err := exchange.ParseStatic("USD", map[string]string{"EUR": "1.10", "GBP": "1.25", "CAD": "0.75"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		DefaultCurrency:  "CAD",
+		Converter:        exchange.NewConverter("USD", rates),
+		SplitCurrency:    true,
+	})
+
+	csv := "Date,Description,Amount\n" +
+		"2024-01-02,Coffee,-$4.00\n" +
+		"2024-01-03,Hotel,-€120.00\n" +
+		"2024-01-04,Train,GBP -40.00\n" +
+		"2024-01-05,Refund,\"1,000.00 USD\"\n" +
+		"2024-01-06,Ramen,JPY -1200\n" +
+		"2024-01-07,Fee,-2.00\n"
+	result, err := p.Process(Upload{Filename: "mixed.csv", Body: strings.NewReader(csv)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txns, err := db.ListTransactions(result.StatementID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		currency string
+		cents    int64
+		base     int64
+		missing  bool
+	}{
+		{"CAD", -400, -300, false},
+		{"EUR", -12000, -13200, false},
+		{"GBP", -4000, -5000, false},
+		{"USD", 100000, 100000, false},
+		{"JPY", -120000, 0, true},
+		{"", -200, -150, false},
+	}
+	if len(txns) != len(want) {
+		t.Fatalf("stored %d transactions, want %d", len(txns), len(want))
+	}
+	for i, w := range want {
+		txn := txns[i]
+		if txn.Currency != w.currency || txn.AmountCents != w.cents {
+			t.Errorf("%s = %d %q, want %d %q", txn.Description, txn.AmountCents, txn.Currency, w.cents, w.currency)
+		}
+		switch {
+		case w.missing:
+			if !txn.RateMissing || txn.BaseAmountCents != nil {
+				t.Errorf("%s converted without a rate", txn.Description)
+			}
+		case txn.BaseAmountCents == nil || *txn.BaseAmountCents != w.base:
+			t.Errorf("%s base amount = %v, want %d", txn.Description, txn.BaseAmountCents, w.base)
+		}
+	}
+
+	// The warning names the currency missing a rate, not the statement's.
+	var warned bool
+	for _, msg := range logMessages(t, db, result.StatementID) {
+		warned = warned || strings.HasPrefix(msg, "No JPY to USD exchange rate for 1 transactions")
+	}
+	if !warned {
+		t.Errorf("no missing JPY rate warning in %q", logMessages(t, db, result.StatementID))
+	}
+}
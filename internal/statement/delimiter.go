@@ -0,0 +1,100 @@
+package statement
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidDelimiter is returned when an upload names a CSV delimiter that
+// isn't supported.
+var ErrInvalidDelimiter = errors.New("invalid delimiter")
+
+// csvDelimiters are the delimiters DetectDelimiter chooses from, in order of
+// preference when they fit equally well.
+var csvDelimiters = []rune{',', ';', '\t'}
+
+// delimiterSampleLines is how many non-blank lines DetectDelimiter looks at.
+const delimiterSampleLines = 5
+
+// ParseDelimiter returns the CSV delimiter named in an upload: ",", ";" or a
+// tab, also spelled comma, semicolon and tab. Empty means detect it and
+// returns zero.
+func ParseDelimiter(name string) (rune, error) {
+	if name == "\t" {
+		return '\t', nil
+	}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return 0, nil
+	case ",", "comma":
+		return ',', nil
+	case ";", "semicolon":
+		return ';', nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	return 0, fmt.Errorf("%w %q: must be comma, semicolon or tab", ErrInvalidDelimiter, name)
+}
+
+// DetectDelimiter picks the delimiter of a CSV file from its first lines,
+// ignoring delimiters inside quoted fields. Of the candidates found the same,
+// non-zero number of times on every line, the most frequent wins, so "1,50"
+// amounts in a semicolon-separated file don't make it comma-separated. When
+// none is consistent, the one most frequent in the header wins; failing
+// that, a comma.
+func DetectDelimiter(data []byte) rune {
+	var lines [][]byte
+	for line := range bytes.Lines(data) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if lines = append(lines, line); len(lines) == delimiterSampleLines {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return ','
+	}
+
+	best, bestCount := rune(0), 0
+	for _, d := range csvDelimiters {
+		count := countDelimiter(lines[0], d)
+		for _, line := range lines[1:] {
+			if countDelimiter(line, d) != count {
+				count = 0
+				break
+			}
+		}
+		if count > bestCount {
+			best, bestCount = d, count
+		}
+	}
+	if best != 0 {
+		return best
+	}
+
+	best, bestCount = ',', 0
+	for _, d := range csvDelimiters {
+		if count := countDelimiter(lines[0], d); count > bestCount {
+			best, bestCount = d, count
+		}
+	}
+	return best
+}
+
+// countDelimiter counts d in line outside double-quoted fields.
+func countDelimiter(line []byte, d rune) int {
+	n := 0
+	quoted := false
+	for _, c := range string(line) {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package statement
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want rune
+	}{
+		{"excel bom fixture", readFixture(t, "excel-bom.csv"), ','},
+		{"excel bom semicolon fixture", readFixture(t, "excel-bom-semicolon.csv"), ';'},
+		{"tab fixture", readFixture(t, "tab.csv"), '\t'},
+		{"comma decimals", []byte("Datum;Betrag\n02.01.2024;-4,80\n03.01.2024;12,00\n"), ';'},
+		{"quoted delimiters", []byte("Date,Description,Amount\n2024-01-02,\"Rent; January\",-850.00\n"), ','},
+		{"blank lines", []byte("\n\nDate;Amount\n\n2024-01-02;1.00\n"), ';'},
+		{"inconsistent lines", []byte("Date;Description;Amount\n2024-01-02;Coffee, large\n"), ';'},
+		{"single column", []byte("Description\nCoffee\n"), ','},
+		{"empty", nil, ','},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectDelimiter(tt.data); got != tt.want {
+				t.Errorf("DetectDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    rune
+		wantErr bool
+	}{
+		{"", 0, false},
+		{",", ',', false},
+		{"comma", ',', false},
+		{";", ';', false},
+		{"Semicolon", ';', false},
+		{"\t", '\t', false},
+		{`\t`, '\t', false},
+		{"tab", '\t', false},
+		{"|", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDelimiter(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPreviewCSVFixtures(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		delimiter string
+		wantDelim rune
+		headers   []string
+		rows      [][]string
+	}{
+		{
+			fixture:   "excel-bom.csv",
+			wantDelim: ',',
+			headers:   []string{"Date", "Description", "Amount"},
+			rows:      [][]string{{"2024-01-02", "Coffee", "-3.50"}, {"2024-01-05", "Salary", "1000.00"}},
+		},
+		{
+			fixture:   "excel-bom-semicolon.csv",
+			wantDelim: ';',
+			headers:   []string{"Date", "Description", "Amount"},
+			rows: [][]string{
+				{"02.01.2024", "Café Müller", "-4,80"},
+				{"03.01.2024", "Miete; Januar", "-850,00"},
+				{"05.01.2024", "Gehalt", "2.500,00"},
+			},
+		},
+		{
+			fixture:   "tab.csv",
+			wantDelim: '\t',
+			headers:   []string{"Date", "Description", "Amount"},
+			rows:      [][]string{{"2024-01-02", "Coffee, large", "-3.50"}, {"2024-01-05", "Salary", "1000.00"}},
+		},
+		{
+			// An explicit delimiter overrides detection.
+			fixture:   "excel-bom.csv",
+			delimiter: "semicolon",
+			wantDelim: ';',
+			headers:   []string{"Date,Description,Amount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture+" "+tt.delimiter, func(t *testing.T) {
+			p, _ := newTestProcessor(t, ProcessorOptions{DetectCharset: true})
+			result, err := p.Preview(Upload{
+				Filename:  tt.fixture,
+				Body:      bytes.NewReader(readFixture(t, tt.fixture)),
+				Delimiter: tt.delimiter,
+			}, transaction.Mapping{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Delimiter != tt.wantDelim {
+				t.Errorf("Delimiter = %q, want %q", result.Delimiter, tt.wantDelim)
+			}
+			if len(result.Rows) == 0 {
+				t.Fatal("no rows parsed")
+			}
+			// The BOM is stripped rather than left on the first header.
+			if got := result.Rows[0].Headers; !slices.Equal(got, tt.headers) {
+				t.Errorf("headers = %q, want %q", got, tt.headers)
+			}
+			if tt.rows == nil {
+				return
+			}
+			if len(result.Rows) != len(tt.rows) {
+				t.Fatalf("parsed %d rows, want %d", len(result.Rows), len(tt.rows))
+			}
+			for i, row := range result.Rows {
+				if !slices.Equal(row.Values, tt.rows[i]) {
+					t.Errorf("row %d = %q, want %q", i, row.Values, tt.rows[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewExcelBOMTransactions(t *testing.T) {
+	p, _ := newTestProcessor(t, ProcessorOptions{})
+	result, err := p.Preview(Upload{
+		Filename: "excel-bom.csv",
+		Body:     bytes.NewReader(readFixture(t, "excel-bom.csv")),
+	}, transaction.Mapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the BOM stripped, the Date column wouldn't be found and
+	// every row would be skipped.
+	if result.Skipped != 0 || len(result.Transactions) != 2 {
+		t.Fatalf("parsed %d transactions and skipped %d, want 2 and 0", len(result.Transactions), result.Skipped)
+	}
+	if got := result.Transactions[1].AmountCents; got != 100000 {
+		t.Errorf("second amount = %d cents, want 100000", got)
+	}
+}
@@ -0,0 +1,57 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// ErrInvalidExpectedCount is returned when an upload's expected_count isn't a
+// non-negative whole number.
+var ErrInvalidExpectedCount = errors.New("invalid expected count")
+
+// parseExpectedCount parses the expected transaction count of an upload. It
+// returns nil when none is given.
+func parseExpectedCount(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%w %q: must be a non-negative whole number", ErrInvalidExpectedCount, value)
+	}
+	return &n, nil
+}
+
+// checkCount compares the number of transactions parsed from a statement with
+// the count its upload expected, if any, and reports whether they differ by
+// more than the tolerance. A mismatch usually means tables were missed during
+// extraction; the statement is flagged for review but still processed.
+func (p *Processor) checkCount(j *job, parsed int) bool {
+	if j.expectedCount == nil {
+		return false
+	}
+	expected := *j.expectedCount
+	diff := parsed - expected
+	mismatch := max(diff, -diff) > p.countTolerance
+
+	if err := p.store.SetCountMismatch(j.statementID, mismatch); err != nil {
+		p.store.Log(j.statementID, database.LevelWarn, "parse", "failed to record transaction count check: "+err.Error())
+	}
+	if !mismatch {
+		p.store.Log(j.statementID, database.LevelInfo, "parse", fmt.Sprintf("Parsed %d transactions, as expected", parsed))
+		return false
+	}
+
+	p.store.Log(j.statementID, database.LevelWarn, "parse", fmt.Sprintf("count_mismatch: parsed %d transactions, %d were expected; flagged for review", parsed, expected))
+	p.logger.Warn("statement transaction count mismatch",
+		"statement_id", j.statementID,
+		"expected", expected,
+		"parsed", parsed,
+	)
+	return true
+}
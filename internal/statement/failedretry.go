@@ -0,0 +1,161 @@
+package statement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// FailedRetryPolicy configures the automatic retries of statements whose
+// extraction failed for a transient reason, such as Kreuzberg being down.
+type FailedRetryPolicy struct {
+	// MaxAttempts is how many times a statement is retried. Zero disables
+	// automatic retries.
+	MaxAttempts int
+	// Delay is the wait before the first retry; it doubles for each later
+	// one, up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Interval is how often statements due for a retry are looked for.
+	Interval time.Duration
+}
+
+// delay returns the wait before the given retry, counted from 1.
+func (r FailedRetryPolicy) delay(retry int) time.Duration {
+	d := r.Delay
+	for i := 1; i < retry && d < r.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, r.MaxDelay)
+}
+
+// retryable reports whether a failed extraction may succeed when tried again
+// later. Files Kreuzberg rejected, e.g. for an unsupported type, fail again.
+func retryable(err error) bool {
+	return errors.Is(err, kreuzberg.ErrUnavailable)
+}
+
+// scheduleFailedRetry schedules the next automatic retry of a job whose
+// extraction failed with extractErr, while attempts remain. Retries need the
+// original file, so none are scheduled when originals aren't kept.
+func (p *Processor) scheduleFailedRetry(j *job, extractErr error) {
+	if p.failedRetry.MaxAttempts <= 0 || p.files == nil {
+		return
+	}
+	if !retryable(extractErr) {
+		p.store.Log(j.statementID, database.LevelInfo, "extraction", "Not retried automatically: the failure isn't transient")
+		return
+	}
+	if j.retryAttempts >= p.failedRetry.MaxAttempts {
+		p.store.Log(j.statementID, database.LevelWarn, "extraction", fmt.Sprintf("Giving up after %d automatic retries", j.retryAttempts))
+		return
+	}
+
+	at := time.Now().Add(p.failedRetry.delay(j.retryAttempts + 1))
+	if err := p.store.ScheduleRetry(j.statementID, at); err != nil {
+		p.store.Log(j.statementID, database.LevelWarn, "extraction", "failed to schedule retry: "+err.Error())
+		return
+	}
+	p.store.Log(j.statementID, database.LevelInfo, "extraction", fmt.Sprintf("Retrying automatically at %s (retry %d of %d)",
+		at.UTC().Format(time.RFC3339), j.retryAttempts+1, p.failedRetry.MaxAttempts))
+}
+
+// RunFailedRetries retries the failed statements that are due now and then on
+// every interval of the retry policy until ctx is cancelled.
+func (p *Processor) RunFailedRetries(ctx context.Context) {
+	ticker := time.NewTicker(p.failedRetry.Interval)
+	defer ticker.Stop()
+
+	for {
+		ids, err := p.store.DueRetries(time.Now())
+		if err != nil {
+			p.logger.Error("list due retries failed", "error", err)
+		}
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := p.retryFailed(id); err != nil {
+				p.logger.Error("retry failed", "statement_id", id, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryFailed reprocesses a failed statement from its stored original file.
+func (p *Processor) retryFailed(id string) error {
+	ok, err := p.store.StartRetry(id)
+	if err != nil || !ok {
+		return err
+	}
+
+	stmt, err := p.store.Statement(id)
+	if err != nil || stmt == nil {
+		return fmt.Errorf("load statement: %w", err)
+	}
+
+	data, err := p.original(stmt.FileHash)
+	if err != nil {
+		msg := "original file unavailable for retry: " + err.Error()
+		p.store.Log(id, database.LevelError, "extraction", msg)
+		_ = p.store.MarkFailed(id, msg)
+		return nil
+	}
+	if enc, err := ParseCharset(stmt.SourceCharset); err == nil && enc != nil {
+		data = ToUTF8(data, enc)
+	}
+
+	j := &job{
+		statementID:   id,
+		statementDate: stmt.StatementDate,
+		filename:      stmt.Filename,
+		account:       stmt.AccountName,
+		accountType:   stmt.AccountType,
+		owner:         stmt.OwnerID,
+		currency:      stmt.Currency,
+		priority:      PriorityNormal,
+		mimeType:      stmt.MimeType,
+		data:          data,
+		start:         time.Now(),
+		expectedCount: stmt.ExpectedCount,
+		stage:         stmt.Stage,
+		parseStrategy: stmt.ParseStrategy,
+		duplicateOf:   stmt.DuplicateOf,
+		retryAttempts: stmt.RetryAttempts,
+	}
+	if stmt.OpeningBalanceCents != nil && stmt.ClosingBalanceCents != nil {
+		j.balances = &balances{opening: *stmt.OpeningBalanceCents, closing: *stmt.ClosingBalanceCents}
+	}
+
+	p.store.Log(id, database.LevelInfo, "extraction", fmt.Sprintf("Retrying failed statement (retry %d of %d)", j.retryAttempts, p.failedRetry.MaxAttempts))
+	p.logger.Info("retrying failed statement", "statement_id", id, "retry", j.retryAttempts)
+
+	results, err := p.extract(j)
+	_, err = p.finish(j, results, err)
+	return err
+}
+
+// original reads the stored original file with the given hash.
+func (p *Processor) original(hash string) ([]byte, error) {
+	if p.files == nil {
+		return nil, fs.ErrNotExist
+	}
+	f, err := p.files.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,71 @@
+package statement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// ExtractorKreuzberg names the tables extracted by Kreuzberg, the extractor
+// tried before any FallbackExtractor.
+const ExtractorKreuzberg = "kreuzberg"
+
+// FallbackExtractor recovers rows from extraction results whose tables held no
+// data rows, e.g. a PDF Kreuzberg could read but not split into tables.
+type FallbackExtractor interface {
+	// Name identifies the extractor in processing logs and responses.
+	Name() string
+
+	// Extract returns the rows found in results; none when it finds nothing.
+	Extract(results []kreuzberg.ExtractionResult) []RawRow
+}
+
+// ParseFallbackExtractor returns the fallback extractor with the given name:
+// "text" for TextExtractor.
+func ParseFallbackExtractor(name string) (FallbackExtractor, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text":
+		return TextExtractor{}, nil
+	}
+	return nil, fmt.Errorf("unknown fallback extractor %q: must be text", name)
+}
+
+// TextExtractor finds transactions in the extracted text, one per line: a
+// date, a description and an amount, optionally followed by a running balance.
+type TextExtractor struct{}
+
+// textHeaders are the headers of the rows a TextExtractor returns.
+var textHeaders = []string{"Date", "Description", "Amount", "Balance"}
+
+// textLine matches a transaction line. Dates are numeric (2024-01-02,
+// 01/02/2024) or spelled out (2 Jan 2024, Jan 2, 2024); amounts need two
+// decimal places so reference numbers in the description aren't taken for them.
+var textLine = regexp.MustCompile(`^(\d{1,4}[/-]\d{1,2}[/-]\d{2,4}|\d{1,2}[ -][A-Za-z]{3}[ -]\d{4}|[A-Za-z]{3,9} \d{1,2}, \d{4})\s+(.+?)\s+(\(?[-+]?[$€£]?[\d,]*\d\.\d{2}\)?-?)(?:\s+(\(?[-+]?[$€£]?[\d,]*\d\.\d{2}\)?-?))?$`)
+
+// Name implements FallbackExtractor.
+func (TextExtractor) Name() string { return "text" }
+
+// Extract implements FallbackExtractor. Lines whose date or amount doesn't
+// parse are skipped.
+func (TextExtractor) Extract(results []kreuzberg.ExtractionResult) []RawRow {
+	var rows []RawRow
+	for _, result := range results {
+		for _, line := range strings.Split(result.Content, "\n") {
+			m := textLine.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				continue
+			}
+			if _, err := transaction.ParseDate(m[1]); err != nil {
+				continue
+			}
+			if _, err := transaction.ParseAmount(m[3]); err != nil {
+				continue
+			}
+			rows = append(rows, RawRow{Headers: textHeaders, RawHeaders: textHeaders, Values: m[1:5]})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,174 @@
+package statement
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+)
+
+// Hash algorithm names, stored with each statement's file hash.
+const (
+	HashSHA256     = "sha256"
+	HashNormalized = "normalized"
+)
+
+// Hasher computes the file hash used to detect duplicate uploads.
+type Hasher interface {
+	// Name identifies the algorithm. Hashes are only compared with hashes of
+	// the same name.
+	Name() string
+	// HashFile returns the hex-encoded hash of a file of the given MIME type.
+	HashFile(data []byte, mimeType string) string
+	// NewWriter returns a hash the file can be written to as it's read, whose
+	// hex-encoded sum is the file's hash, or nil if the hash needs the whole
+	// file and HashFile must be used.
+	NewWriter() hash.Hash
+}
+
+// NewHasher returns the Hasher for an algorithm name. A non-empty salt is
+// prepended to the hashed content.
+func NewHasher(algorithm, salt string) (Hasher, error) {
+	switch algorithm {
+	case HashSHA256, "":
+		return SHA256Hasher{Salt: salt}, nil
+	case HashNormalized:
+		return NormalizedHasher{Salt: salt}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+}
+
+// SHA256Hasher hashes the raw file bytes. It is the default.
+type SHA256Hasher struct {
+	Salt string
+}
+
+// Name implements Hasher.
+func (h SHA256Hasher) Name() string { return HashSHA256 }
+
+// HashFile implements Hasher.
+func (h SHA256Hasher) HashFile(data []byte, _ string) string {
+	return saltedSHA256(h.Salt, data)
+}
+
+// NewWriter implements Hasher.
+func (h SHA256Hasher) NewWriter() hash.Hash {
+	w := sha256.New()
+	w.Write([]byte(h.Salt))
+	return w
+}
+
+// NormalizedHasher hashes the file content with metadata and formatting noise
+// removed, so re-downloads of the same statement are recognized as duplicates.
+// For PDFs the document info entries, trailer ID, XMP packet and cross-reference
+// offsets are dropped; for CSV and text the byte order mark, line endings and
+// trailing whitespace are normalized. Other types are hashed as-is.
+type NormalizedHasher struct {
+	Salt string
+}
+
+// Name implements Hasher.
+func (h NormalizedHasher) Name() string { return HashNormalized }
+
+// HashFile implements Hasher.
+func (h NormalizedHasher) HashFile(data []byte, mimeType string) string {
+	switch mimeType {
+	case "application/pdf":
+		data = normalizePDF(data)
+	case "text/csv", "text/plain":
+		data = normalizeText(data)
+	}
+	return saltedSHA256(h.Salt, data)
+}
+
+// NewWriter implements Hasher. Normalization needs the whole file, so it
+// returns nil.
+func (h NormalizedHasher) NewWriter() hash.Hash { return nil }
+
+// pdfMetadata matches the parts of a PDF that change when the same document is
+// generated or saved again.
+var pdfMetadata = []*regexp.Regexp{
+	regexp.MustCompile(`/(CreationDate|ModDate|Producer|Creator)\s*(\((\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`),
+	regexp.MustCompile(`/ID\s*\[[^\]]*\]`),
+	regexp.MustCompile(`(?s)<\?xpacket begin.*?<\?xpacket end[^>]*>`),
+	regexp.MustCompile(`(?s)\bxref\s.*?\btrailer\b`),
+	regexp.MustCompile(`startxref\s+\d+`),
+}
+
+func normalizePDF(data []byte) []byte {
+	for _, re := range pdfMetadata {
+		data = re.ReplaceAll(data, nil)
+	}
+	return data
+}
+
+func normalizeText(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t\r")
+	}
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func saltedSHA256(salt string, data []byte) string {
+	h := SHA256Hasher{Salt: salt}.NewWriter()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// uploadHash hashes an upload while it is read, with the configured hasher
+// and, when that isn't the unsalted SHA256 hash, with the legacy one too, so
+// statements hashed before the algorithm or salt changed are still found.
+type uploadHash struct {
+	hasher Hasher
+	w      hash.Hash // nil when hasher needs the whole file
+	legacy hash.Hash // nil when hasher is the legacy hash
+}
+
+func newUploadHash(hasher Hasher) *uploadHash {
+	u := &uploadHash{hasher: hasher, w: hasher.NewWriter()}
+	if hasher != Hasher(SHA256Hasher{}) {
+		u.legacy = sha256.New()
+	}
+	return u
+}
+
+// Writer returns the writer the upload is copied to as it's read, or nil if
+// nothing is hashed while reading.
+func (u *uploadHash) Writer() io.Writer {
+	switch {
+	case u.w != nil && u.legacy != nil:
+		return io.MultiWriter(u.w, u.legacy)
+	case u.w != nil:
+		return u.w
+	case u.legacy != nil:
+		return u.legacy
+	}
+	return nil
+}
+
+// Sums returns the hashes of the upload once it has been read: its file hash,
+// computed from data by hashers that need the whole file, and its legacy hash,
+// empty when the file hash is the legacy hash.
+func (u *uploadHash) Sums(data []byte, mimeType string) (fileHash, legacyHash string) {
+	if u.w != nil {
+		fileHash = hex.EncodeToString(u.w.Sum(nil))
+	} else {
+		fileHash = u.hasher.HashFile(data, mimeType)
+	}
+	if u.legacy != nil {
+		legacyHash = hex.EncodeToString(u.legacy.Sum(nil))
+	}
+	return fileHash, legacyHash
+}
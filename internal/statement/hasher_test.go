@@ -0,0 +1,83 @@
+package statement
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUploadHash(t *testing.T) {
+	data := []byte("\xef\xbb\xbfDate,Description,Amount\r\n2024-01-02,Coffee,-3.50  \r\n")
+	legacy := SHA256Hasher{}.HashFile(data, "text/csv")
+
+	tests := []struct {
+		name       string
+		hasher     Hasher
+		streamed   bool
+		wantLegacy string
+	}{
+		{"sha256", SHA256Hasher{}, true, ""},
+		{"salted sha256", SHA256Hasher{Salt: "pepper"}, true, legacy},
+		{"normalized", NormalizedHasher{}, false, legacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadHash(tt.hasher)
+			if streamed := u.w != nil; streamed != tt.streamed {
+				t.Errorf("streamed = %v, want %v", streamed, tt.streamed)
+			}
+			if w := u.Writer(); w != nil {
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fileHash, legacyHash := u.Sums(data, "text/csv")
+			if want := tt.hasher.HashFile(data, "text/csv"); fileHash != want {
+				t.Errorf("file hash = %s, want HashFile's %s", fileHash, want)
+			}
+			if legacyHash != tt.wantLegacy {
+				t.Errorf("legacy hash = %q, want %q", legacyHash, tt.wantLegacy)
+			}
+		})
+	}
+}
+
+func TestProcessHashesWhileReading(t *testing.T) {
+	csv := "Date,Description,Amount\n2024-01-02,Coffee,-3.50\n"
+
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		Hasher:           SHA256Hasher{Salt: "pepper"},
+	})
+	result, err := p.Process(Upload{Filename: "statement.csv", Body: strings.NewReader(csv)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := db.GetStatement(result.StatementID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SHA256Hasher{Salt: "pepper"}).HashFile([]byte(csv), "text/csv"); stmt.FileHash != want {
+		t.Errorf("stored hash = %s, want %s", stmt.FileHash, want)
+	}
+}
+
+func TestProcessFindsLegacyHash(t *testing.T) {
+	csv := []byte("Date,Description,Amount\n2024-01-02,Coffee,-3.50\n")
+
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		Hasher:           NormalizedHasher{Salt: "pepper"},
+	})
+	// A statement uploaded while the default hash was configured.
+	id := createTestStatement(t, db, "", "Checking", SHA256Hasher{}.HashFile(csv, "text/csv"))
+
+	result, err := p.Process(Upload{Filename: "statement.csv", Body: bytes.NewReader(csv)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Duplicate || result.StatementID != id {
+		t.Errorf("result = duplicate %v of %s, want a duplicate of %s", result.Duplicate, result.StatementID, id)
+	}
+}
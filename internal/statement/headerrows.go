@@ -0,0 +1,41 @@
+package statement
+
+import "github.com/billdaws/moneymanager/internal/kreuzberg"
+
+// How rows repeating their table's header are found and skipped.
+const (
+	HeaderRowsOff   = "off"
+	HeaderRowsFirst = "first" // only the first row of each table
+	HeaderRowsAny   = "any"   // wherever they occur, as on each page of a statement
+)
+
+// SkipHeaderRows returns a copy of results without the table rows that
+// repeat their table's header, ignoring case and extra whitespace, in mode
+// HeaderRowsFirst or HeaderRowsAny, and how many were skipped. The input is
+// left untouched.
+func SkipHeaderRows(results []kreuzberg.ExtractionResult, mode string) ([]kreuzberg.ExtractionResult, int) {
+	if mode != HeaderRowsFirst && mode != HeaderRowsAny {
+		return results, 0
+	}
+
+	var skipped int
+	kept := make([]kreuzberg.ExtractionResult, len(results))
+	for i, result := range results {
+		tables := make([]kreuzberg.Table, len(result.Tables))
+		for j, table := range result.Tables {
+			rows := make([][]string, 0, len(table.Rows))
+			for k, row := range table.Rows {
+				if (k == 0 || mode == HeaderRowsAny) && len(table.Headers) > 0 && sameHeaders(table.Headers, row) {
+					skipped++
+					continue
+				}
+				rows = append(rows, row)
+			}
+			table.Rows = rows
+			tables[j] = table
+		}
+		result.Tables = tables
+		kept[i] = result
+	}
+	return kept, skipped
+}
@@ -0,0 +1,14 @@
+package statement
+
+import "github.com/billdaws/moneymanager/internal/kreuzberg"
+
+// PipelineHook lets callers run custom logic (enrichment, external lookups)
+// between processing stages without modifying the Processor.
+type PipelineHook interface {
+	// AfterExtraction runs once Kreuzberg has returned results, before they are parsed.
+	AfterExtraction(statementID string, results []kreuzberg.ExtractionResult) error
+
+	// AfterParse runs once the extracted tables have been flattened into rows,
+	// before the rows are stored.
+	AfterParse(statementID string, rows []RawRow) error
+}
@@ -0,0 +1,199 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidPriority is returned when an upload's priority is not one of
+// low, normal or high.
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// Priority moves an upload ahead of or behind others waiting for an
+// extraction slot.
+type Priority int
+
+// Upload priorities. The zero value is PriorityNormal.
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+// ParsePriority parses an upload's priority; empty means normal.
+func ParsePriority(value string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("%w %q: must be low, normal or high", ErrInvalidPriority, value)
+}
+
+// limiter caps concurrent extractions globally and per account. An upload waits
+// for its account's slot before taking a global one, so one account's bulk
+// import queues behind itself instead of holding every global slot.
+type limiter struct {
+	global     *slotQueue
+	perAccount int
+
+	mu       sync.Mutex
+	accounts map[string]*accountSlots
+}
+
+// accountSlots is the semaphore for one account, shared by its in-flight uploads.
+type accountSlots struct {
+	sem   chan struct{}
+	users int
+}
+
+// newLimiter creates a limiter. A limit of zero or less means unlimited.
+// Global slots go to waiters in arrival order unless prioritize is set, see
+// slotQueue.
+func newLimiter(global, perAccount int, prioritize bool, maxWait time.Duration) *limiter {
+	l := &limiter{
+		perAccount: perAccount,
+		accounts:   make(map[string]*accountSlots),
+	}
+	if global > 0 {
+		l.global = &slotQueue{free: global, prioritize: prioritize, maxWait: maxWait}
+	}
+	return l
+}
+
+// acquire blocks until an owner's account may start an extraction and returns
+// the function that releases its slots. Each owner's accounts have their own
+// slots. Account names are compared case-insensitively; an owner's uploads
+// without an account name share one slot pool. cost and priority order the
+// wait for a global slot.
+func (l *limiter) acquire(owner, account string, cost float64, priority Priority) (release func()) {
+	key := limiterKey(owner, account)
+
+	var slots *accountSlots
+	if l.perAccount > 0 {
+		l.mu.Lock()
+		slots = l.accounts[key]
+		if slots == nil {
+			slots = &accountSlots{sem: make(chan struct{}, l.perAccount)}
+			l.accounts[key] = slots
+		}
+		slots.users++
+		l.mu.Unlock()
+
+		slots.sem <- struct{}{}
+	}
+
+	if l.global != nil {
+		l.global.acquire(cost, priority)
+	}
+
+	return func() {
+		if l.global != nil {
+			l.global.release()
+		}
+		if slots != nil {
+			<-slots.sem
+
+			l.mu.Lock()
+			slots.users--
+			if slots.users == 0 {
+				delete(l.accounts, key)
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// limiterKey is the name an owner's account's slots are kept under.
+func limiterKey(owner, account string) string {
+	return owner + "\x00" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// slotQueue hands out a fixed number of slots. With prioritize set, a freed
+// slot goes to the waiter with the highest priority and then the lowest
+// estimated cost, so quick jobs jump ahead of large ones; a waiter queued for
+// maxWait or longer goes first regardless, so large jobs still run. Otherwise
+// slots go in arrival order.
+type slotQueue struct {
+	prioritize bool
+	maxWait    time.Duration
+
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiting []*slotWaiter
+}
+
+// slotWaiter is an extraction waiting for a slot.
+type slotWaiter struct {
+	cost     float64
+	priority Priority
+	seq      uint64
+	queued   time.Time
+	ready    chan struct{}
+}
+
+// acquire blocks until a slot is handed to the caller.
+func (q *slotQueue) acquire(cost float64, priority Priority) {
+	q.mu.Lock()
+	if q.free > 0 {
+		q.free--
+		q.mu.Unlock()
+		return
+	}
+	q.seq++
+	w := &slotWaiter{cost: cost, priority: priority, seq: q.seq, queued: time.Now(), ready: make(chan struct{})}
+	q.waiting = append(q.waiting, w)
+	q.mu.Unlock()
+
+	<-w.ready
+}
+
+// release hands the caller's slot to the next waiter, or frees it.
+func (q *slotQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.free++
+		return
+	}
+
+	now := time.Now()
+	next := 0
+	for i := 1; i < len(q.waiting); i++ {
+		if q.before(q.waiting[i], q.waiting[next], now) {
+			next = i
+		}
+	}
+	w := q.waiting[next]
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+	close(w.ready)
+}
+
+// before reports whether a should get a slot ahead of b.
+func (q *slotQueue) before(a, b *slotWaiter, now time.Time) bool {
+	if !q.prioritize {
+		return a.seq < b.seq
+	}
+
+	aStarved := q.maxWait > 0 && now.Sub(a.queued) >= q.maxWait
+	bStarved := q.maxWait > 0 && now.Sub(b.queued) >= q.maxWait
+	switch {
+	case aStarved != bStarved:
+		return aStarved
+	case aStarved:
+		return a.seq < b.seq
+	case a.priority != b.priority:
+		return a.priority > b.priority
+	case a.cost != b.cost:
+		return a.cost < b.cost
+	}
+	return a.seq < b.seq
+}
@@ -0,0 +1,263 @@
+package statement
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startLog records the order jobs start in.
+type startLog struct {
+	mu     sync.Mutex
+	starts []string
+}
+
+func (l *startLog) add(name string) {
+	l.mu.Lock()
+	l.starts = append(l.starts, name)
+	l.mu.Unlock()
+}
+
+func (l *startLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.starts...)
+}
+
+func TestLimiterInterleavedAccountsNotStarved(t *testing.T) {
+	l := newLimiter(2, 1, false, 0)
+	log := &startLog{}
+
+	var wg sync.WaitGroup
+	run := func(account string) {
+		defer wg.Done()
+		release := l.acquire("", account, 1, PriorityNormal)
+		log.add(account)
+		time.Sleep(2 * time.Millisecond)
+		release()
+	}
+
+	// A bulk import queues 24 jobs, under differently written names of one
+	// account; a second account's 8 jobs arrive while it runs.
+	for i := range 24 {
+		wg.Add(1)
+		go run([]string{"Bulk", "bulk ", "BULK"}[i%3])
+	}
+	waitFor(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		slots := l.accounts[limiterKey("", "bulk")]
+		return slots != nil && slots.users == 24
+	})
+	for range 8 {
+		wg.Add(1)
+		go run("other")
+	}
+	wg.Wait()
+
+	var bulk, other int
+	for _, account := range log.starts {
+		if account == "other" {
+			other++
+			continue
+		}
+		bulk++
+		if bulk == 20 && other < 8 {
+			t.Errorf("bulk started %d jobs before other's %d were all started; starts: %v", bulk, 8, log.starts)
+		}
+	}
+	if bulk != 24 || other != 8 {
+		t.Fatalf("started %d bulk and %d other jobs, want 24 and 8", bulk, other)
+	}
+}
+
+func TestLimiterAccountWaitsBehindItself(t *testing.T) {
+	l := newLimiter(2, 2, false, 0)
+	log := &startLog{}
+
+	// The bulk account holds both global slots and queues more jobs.
+	hold := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := l.acquire("", "bulk", 1, PriorityNormal)
+			log.add("bulk")
+			<-hold
+			release()
+		}()
+	}
+	waitFor(t, func() bool { return len(log.snapshot()) == 2 })
+
+	done := make(chan struct{})
+	go func() {
+		release := l.acquire("", "other", 1, PriorityNormal)
+		log.add("other")
+		release()
+		close(done)
+	}()
+	waitFor(t, func() bool {
+		l.global.mu.Lock()
+		defer l.global.mu.Unlock()
+		return len(l.global.waiting) == 1
+	})
+
+	// The first global slot freed goes to the other account, not to the
+	// bulk jobs queued behind their own account's slots.
+	hold <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("other account still waiting after a bulk job finished")
+	}
+	if starts := log.snapshot(); starts[2] != "other" {
+		t.Errorf("third job started was %q, want other; starts: %v", starts[2], starts)
+	}
+
+	close(hold)
+	wg.Wait()
+}
+
+func TestLimiterAccountsPerOwner(t *testing.T) {
+	l := newLimiter(0, 1, false, 0)
+
+	release := l.acquire("alice", "Checking", 1, PriorityNormal)
+
+	// Another tenant's account of the same name has its own slot.
+	done := make(chan struct{})
+	go func() {
+		l.acquire("bob", "checking", 1, PriorityNormal)()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("bob's Checking waited for alice's")
+	}
+
+	// The owner's own account still waits for its slot.
+	started := make(chan struct{})
+	go func() {
+		l.acquire("alice", " CHECKING", 1, PriorityNormal)()
+		close(started)
+	}()
+	waitFor(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.accounts[limiterKey("alice", "checking")].users == 2
+	})
+	select {
+	case <-started:
+		t.Fatal("alice's second job started while her first held the slot")
+	default:
+	}
+
+	release()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("alice's second job still waiting after the slot was released")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queueOrder queues waiters on a slotQueue whose only slot is taken, one at a
+// time so their arrival order is fixed, then frees the slot and returns the
+// order they were served in. The first waiter is queued delay before the rest.
+func queueOrder(t *testing.T, q *slotQueue, waiters []slotWaiter, delay time.Duration) []int {
+	t.Helper()
+	q.free = 1
+	q.acquire(0, PriorityNormal)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i, w := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.acquire(w.cost, w.priority)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			q.release()
+		}()
+		waitFor(t, func() bool {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return len(q.waiting) == i+1
+		})
+		if i == 0 {
+			time.Sleep(delay)
+		}
+	}
+
+	q.release()
+	wg.Wait()
+	return order
+}
+
+func TestSlotQueueOrder(t *testing.T) {
+	waiters := []slotWaiter{
+		{cost: 50, priority: PriorityNormal},
+		{cost: 1, priority: PriorityLow},
+		{cost: 5, priority: PriorityNormal},
+		{cost: 80, priority: PriorityHigh},
+		{cost: 5, priority: PriorityNormal},
+		{cost: 2, priority: PriorityNormal},
+	}
+
+	tests := []struct {
+		name  string
+		queue *slotQueue
+		want  []int
+	}{
+		{
+			name:  "arrival order",
+			queue: &slotQueue{},
+			want:  []int{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:  "priority, then cost, then arrival",
+			queue: &slotQueue{prioritize: true},
+			want:  []int{3, 5, 2, 4, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := queueOrder(t, tt.queue, waiters, 0)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("served in order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlotQueueStarvation(t *testing.T) {
+	// The first waiter has waited maxWait by the time the slot is freed, so
+	// it goes ahead of cheaper and more urgent ones; those that haven't are
+	// still served by priority.
+	q := &slotQueue{prioritize: true, maxWait: 100 * time.Millisecond}
+	waiters := []slotWaiter{
+		{cost: 1000, priority: PriorityLow},
+		{cost: 2, priority: PriorityNormal},
+		{cost: 1, priority: PriorityHigh},
+	}
+	got := queueOrder(t, q, waiters, 120*time.Millisecond)
+	if want := []int{0, 2, 1}; !slices.Equal(got, want) {
+		t.Errorf("served in order %v, want %v", got, want)
+	}
+}
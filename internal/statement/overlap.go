@@ -0,0 +1,59 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// How uploads whose transaction dates overlap another statement of the same
+// account are handled. File hashes can't catch the same period exported in
+// two formats, but the dates can.
+const (
+	// OverlapOff doesn't look for overlaps.
+	OverlapOff = "off"
+	// OverlapWarn processes the statement and reports the overlaps.
+	OverlapWarn = "warn"
+	// OverlapBlock fails the statement before its transactions are stored.
+	OverlapBlock = "block"
+)
+
+// findOverlaps returns the other statements of the job's account whose
+// transaction dates overlap those of txns, leaving out the statement a forced
+// re-upload duplicates. Failing to look doesn't fail the statement.
+func (p *Processor) findOverlaps(j *job, txns []transaction.Transaction) []database.StatementPeriod {
+	if p.overlap == "" || p.overlap == OverlapOff || len(txns) == 0 || database.AccountKey(j.account) == "" {
+		return nil
+	}
+
+	from, to := txns[0].Date, txns[0].Date
+	for _, t := range txns[1:] {
+		from, to = min(from, t.Date), max(to, t.Date)
+	}
+
+	periods, err := p.store.OverlappingStatements(j.owner, j.account, from, to, j.statementID)
+	if err != nil {
+		p.store.Log(j.statementID, database.LevelWarn, "parse", "failed to check for overlapping statements: "+err.Error())
+		return nil
+	}
+
+	var overlaps []database.StatementPeriod
+	var ids []string
+	for _, period := range periods {
+		if period.StatementID == j.duplicateOf {
+			continue
+		}
+		overlaps = append(overlaps, period)
+		ids = append(ids, period.StatementID)
+	}
+	if len(overlaps) > 0 {
+		level := database.LevelWarn
+		if p.overlap == OverlapBlock {
+			level = database.LevelError
+		}
+		p.store.Log(j.statementID, level, "parse", fmt.Sprintf("Transactions from %s to %s overlap statements %s of the same account", from, to, strings.Join(ids, ", ")))
+	}
+	return overlaps
+}
@@ -0,0 +1,94 @@
+package statement
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// RawRow is a single table row paired with the headers of the table it came from.
+type RawRow struct {
+	// Headers are normalized and used to locate columns; RawHeaders are the
+	// headers as extracted.
+	Headers    []string
+	RawHeaders []string
+	Values     []string
+
+	// Account and AccountType name the section of a combined statement the
+	// row falls under, as set by AccountSplitter; empty otherwise.
+	Account     string
+	AccountType string
+}
+
+// HeaderNormalization cleans up extracted header names, so that "  Date ",
+// "Date" and, with Lowercase, "DATE" name the same column across statements.
+type HeaderNormalization struct {
+	// Enabled trims headers and collapses runs of whitespace into one space.
+	Enabled bool
+	// Lowercase also lowercases them.
+	Lowercase bool
+}
+
+// Normalize returns the normalized headers, or headers itself when
+// normalization is disabled.
+func (n HeaderNormalization) Normalize(headers []string) []string {
+	if !n.Enabled {
+		return headers
+	}
+	normalized := make([]string, len(headers))
+	for i, h := range headers {
+		h = strings.Join(strings.Fields(h), " ")
+		if n.Lowercase {
+			h = strings.ToLower(h)
+		}
+		normalized[i] = h
+	}
+	return normalized
+}
+
+// ParseTables flattens the tables of all extraction results into rows,
+// preserving document and table order. Headers are normalized with n.
+func ParseTables(results []kreuzberg.ExtractionResult, n HeaderNormalization) []RawRow {
+	var rows []RawRow
+
+	for _, result := range results {
+		for _, table := range result.Tables {
+			headers := n.Normalize(table.Headers)
+			for _, row := range table.Rows {
+				rows = append(rows, RawRow{Headers: headers, RawHeaders: table.Headers, Values: row})
+			}
+		}
+	}
+
+	return rows
+}
+
+// ParseTransactions converts rows into normalized transactions, locating the
+// columns with m. Rows that can't be parsed (summary lines, rows without a date
+// or amount) are skipped and counted; they remain available as raw rows.
+func ParseTransactions(rows []RawRow, m transaction.Mapping) (txns []transaction.Transaction, skipped int) {
+	for i, row := range rows {
+		t, err := transaction.ParseWith(i, row.Headers, row.Values, m)
+		if err != nil {
+			skipped++
+			continue
+		}
+		t.Account, t.AccountType = row.Account, row.AccountType
+		txns = append(txns, t)
+	}
+	return txns, skipped
+}
+
+// countDataRows counts the rows with at least one non-blank value. A table with
+// only a header row, or only blank rows, has none.
+func countDataRows(rows []RawRow) int {
+	var n int
+	for _, row := range rows {
+		if slices.ContainsFunc(row.Values, func(v string) bool { return strings.TrimSpace(v) != "" }) {
+			n++
+		}
+	}
+	return n
+}
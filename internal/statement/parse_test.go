@@ -0,0 +1,38 @@
+package statement
+
+import (
+	"testing"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+func TestParseTransactionsDebitCredit(t *testing.T) {
+	results := []kreuzberg.ExtractionResult{{Tables: []kreuzberg.Table{{
+		Headers: []string{"Date", "Description", "Debit", "Credit"},
+		Rows: [][]string{
+			{"2024-01-01", "Opening balance", "", ""},
+			{"2024-01-02", "Coffee", "3.50", ""},
+			{"2024-01-05", "Salary", "", "1,000.00"},
+			{"", "Page 1 of 2", "", ""},
+		},
+	}}}}
+
+	txns, skipped := ParseTransactions(ParseTables(results, HeaderNormalization{}), transaction.Mapping{})
+
+	if skipped != 2 {
+		t.Errorf("skipped %d rows, want 2", skipped)
+	}
+	want := []struct {
+		row   int
+		cents int64
+	}{{1, -350}, {2, 100000}}
+	if len(txns) != len(want) {
+		t.Fatalf("parsed %d transactions, want %d", len(txns), len(want))
+	}
+	for i, w := range want {
+		if txns[i].RowIndex != w.row || txns[i].AmountCents != w.cents {
+			t.Errorf("transaction %d = row %d, %d cents; want row %d, %d cents", i, txns[i].RowIndex, txns[i].AmountCents, w.row, w.cents)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// ErrInvalidParseStrategy is returned when an upload names a parse strategy
+// that isn't supported.
+var ErrInvalidParseStrategy = errors.New("invalid parse strategy")
+
+// ParseStrategy returns the parse strategy named in an upload: auto,
+// signed_amount or debit_credit. Empty means auto.
+func ParseStrategy(name string) (string, error) {
+	switch strategy := strings.ToLower(strings.TrimSpace(name)); strategy {
+	case "":
+		return transaction.StrategyAuto, nil
+	case transaction.StrategyAuto, transaction.StrategySignedAmount, transaction.StrategyDebitCredit:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("%w %q: must be auto, signed_amount or debit_credit", ErrInvalidParseStrategy, name)
+}
@@ -0,0 +1,196 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// PreviewResult is how an upload would parse, without anything being stored.
+type PreviewResult struct {
+	Filename string
+	MimeType string
+	Mapping  transaction.Mapping
+	Rows     []RawRow
+	// Extractor names what produced Rows, as in ProcessResult.
+	Extractor    string
+	Transactions []transaction.Transaction
+	Skipped      int
+	Warnings     []string
+	// Reconciliation is set when the upload included opening and closing balances.
+	Reconciliation   *transaction.Reconciliation
+	ProcessingTimeMs int64
+
+	// DetectedAccountType is inferred from the content when the upload didn't
+	// name an account type and detection is enabled.
+	DetectedAccountType   string
+	AccountTypeConfidence float64
+
+	// Charset is the encoding a text upload was decoded from; empty when it
+	// wasn't. Delimiter separated the fields of a CSV file; zero for others.
+	Charset   string
+	Delimiter rune
+}
+
+// Preview runs an upload through validation, extraction and transaction parsing
+// and returns the result without creating a statement or writing to the
+// database. CSV files are parsed directly rather than sent to Kreuzberg. A
+// non-zero override replaces the account's header profile, so mappings can be
+// tried out before they are saved.
+func (p *Processor) Preview(upload Upload, override transaction.Mapping) (*PreviewResult, error) {
+	start := time.Now()
+
+	upload.AccountName = p.resolveAccountName(upload.Owner, upload.AccountName)
+	accountType, err := p.accountTypes.Normalize(upload.AccountType)
+	if err != nil {
+		return nil, err
+	}
+
+	bal, err := parseBalances(upload.OpeningBalance, upload.ClosingBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	charset, err := ParseCharset(upload.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter, err := ParseDelimiter(upload.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	currency, err := parseCurrency(upload.Currency, p.currency)
+	if err != nil {
+		return nil, err
+	}
+
+	parseStrategy, err := ParseStrategy(upload.ParseStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only uploads, whose use of it is audited, get the internal allow-list.
+	mimeType, data, _, err := p.readUpload(upload.Filename, upload.Body, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	data, charsetName := p.decodeText(mimeType, data, charset)
+	result := &PreviewResult{Filename: upload.Filename, MimeType: mimeType, Charset: charsetName}
+
+	var results []kreuzberg.ExtractionResult
+	route := p.route(mimeType)
+	if mimeType == "text/csv" || route == RouteCSV {
+		if delimiter == 0 {
+			delimiter = DetectDelimiter(data)
+		}
+		result.Delimiter = delimiter
+		results, err = parseCSV(data, delimiter)
+	} else {
+		release := p.limiter.acquire(upload.Owner, upload.AccountName, p.cost(mimeType, len(data)), PriorityNormal)
+		results, err = p.kreuzberg.Extract(upload.Filename, data, mimeType)
+		release()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extraction failed: %w", err)
+	}
+
+	if accountType == "" && p.detector != nil {
+		result.DetectedAccountType, result.AccountTypeConfidence, _ = p.detector.Detect(results)
+	}
+
+	if p.mergeTables {
+		MergeTables(results)
+	}
+	filtered := p.tableFilterFor(upload.AccountName).Apply(results)
+	if kept, total := countTables(filtered), countTables(results); kept < total {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Kept %d of %d extracted tables", kept, total))
+	}
+	filtered, headerRows := SkipHeaderRows(filtered, p.headerRows)
+	if headerRows > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Skipped %d rows repeating the table header", headerRows))
+	}
+	result.Rows = ParseTables(filtered, p.headers)
+	result.Extractor = ExtractorKreuzberg
+	switch route {
+	case RouteCSV:
+		result.Extractor = ExtractorCSV
+	case RouteText:
+		result.Rows, result.Extractor = TextExtractor{}.Extract(results), TextExtractor{}.Name()
+	}
+	if countDataRows(result.Rows) == 0 {
+		if rows, name := p.fallback(results); rows != nil && route != RouteText {
+			result.Rows, result.Extractor = rows, name
+			result.Warnings = append(result.Warnings, fmt.Sprintf("No table rows were extracted; fallback extractor %s found %d rows", name, len(rows)))
+		} else {
+			result.Warnings = append(result.Warnings, "No data rows were extracted")
+		}
+	}
+
+	result.Mapping = override
+	if override == (transaction.Mapping{}) {
+		if result.Mapping, err = p.store.HeaderMapping(upload.Owner, upload.AccountName); err != nil {
+			result.Warnings = append(result.Warnings, "failed to load header profile: "+err.Error())
+		}
+	}
+	result.Mapping.InvertDebitCredit = p.invertsDebitCredit(upload.AccountName)
+	result.Mapping.SplitCurrency, result.Mapping.Currency = p.splitCurrency, currency
+	result.Mapping.Strategy = parseStrategy
+
+	result.Transactions, result.Skipped = ParseTransactions(result.Rows, result.Mapping)
+	if result.Skipped > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Skipped %d rows that could not be parsed as transactions", result.Skipped))
+	}
+
+	if rules, err := p.rules(upload.Owner); err != nil {
+		result.Warnings = append(result.Warnings, "failed to load category rules: "+err.Error())
+	} else {
+		transaction.Categorize(result.Transactions, rules)
+	}
+
+	if bal != nil {
+		if n := transaction.RunningBalances(result.Transactions, bal.opening); n > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d printed balances differ from the running balance computed from the opening balance", n))
+		}
+
+		var total int64
+		for _, t := range result.Transactions {
+			total += t.AmountCents
+		}
+		rec := transaction.Reconcile(bal.opening, bal.closing, total, p.tolerance)
+		if !rec.Reconciled {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Transactions are off by %s from the closing balance", transaction.FormatAmount(rec.DiscrepancyCents)))
+		}
+		result.Reconciliation = &rec
+	}
+
+	result.ProcessingTimeMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// parseCSV reads a CSV file into a single table whose first record is the
+// header. A leading UTF-8 byte order mark, as Excel writes, is skipped.
+func parseCSV(data []byte, delimiter rune) ([]kreuzberg.ExtractionResult, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, bomUTF8)))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+
+	result := kreuzberg.ExtractionResult{MimeType: "text/csv"}
+	if len(records) > 0 {
+		result.Tables = []kreuzberg.Table{{Headers: records[0], Rows: records[1:]}}
+	}
+
+	return []kreuzberg.ExtractionResult{result}, nil
+}
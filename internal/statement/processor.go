@@ -1,11 +1,23 @@
 package statement
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/exchange"
 	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/storage"
+	"github.com/billdaws/moneymanager/internal/transaction"
 )
 
 // ProcessResult contains the outcome of processing a statement upload.
@@ -16,113 +28,952 @@ type ProcessResult struct {
 	TransactionsExtracted int
 	ProcessingTimeMs      int64
 	Duplicate             bool
+	// DuplicateOf is the statement a forced upload duplicates; empty otherwise.
+	DuplicateOf string
+	// RetryScheduled is set when extraction timed out and will be retried
+	// in the background.
+	RetryScheduled bool
+	// Reconciliation is set when the upload included opening and closing balances.
+	Reconciliation *transaction.Reconciliation
+	// InternalType is the MIME type of a file accepted only through the
+	// internal allow-list; empty otherwise.
+	InternalType string
+	// Extractor names what produced the rows: ExtractorKreuzberg,
+	// ExtractorCSV or a fallback extractor's name. Empty unless the statement
+	// was processed.
+	Extractor string
+	// Accounts lists the accounts of a combined statement with their
+	// transaction counts; empty for single-account statements.
+	Accounts []DetectedAccount
+	// Overlaps lists the statements of the same account whose transaction
+	// dates overlap this one's, when overlaps are checked.
+	Overlaps []database.StatementPeriod
+	// ExpectedCount is the transaction count the upload expected, if it gave
+	// one; CountMismatch is set when the parsed count missed it.
+	ExpectedCount *int
+	CountMismatch bool
+	// TablesExported counts the extracted tables stored as CSV.
+	TablesExported int
 }
 
-// Processor orchestrates statement processing: validate → hash → dedup → extract → store.
+// ErrInvalidBalance is returned when an upload's opening or closing balance
+// can't be used.
+var ErrInvalidBalance = errors.New("invalid balance")
+
+// ErrInvalidCurrency is returned when an upload's currency isn't an ISO 4217
+// code.
+var ErrInvalidCurrency = errors.New("invalid currency")
+
+// ErrProcessingTimeout is returned when a statement's extraction runs past the
+// processing timeout.
+var ErrProcessingTimeout = errors.New("statement processing timed out")
+
+// ProcessorOptions configures a Processor.
+type ProcessorOptions struct {
+	MaxSizeMB int
+	// MaxSizeMBByType overrides MaxSizeMB for specific MIME types.
+	MaxSizeMBByType map[string]int
+	AllowedTypes    []string
+	// InternalAllowedTypes are accepted in addition to AllowedTypes for
+	// internal uploads.
+	InternalAllowedTypes []string
+	AccountTypes         AccountTypes
+	// ExtensionTypes enables strict MIME mode when set: each upload's filename
+	// extension (lowercase, with the dot) must map to its detected type.
+	ExtensionTypes map[string]string
+	// DetectCharset detects the charset of text uploads that don't name one
+	// and transcodes them to UTF-8 before extraction.
+	DetectCharset bool
+	// StatementLimits rejects uploads to accounts already holding their
+	// maximum number of statements.
+	StatementLimits StatementLimits
+	// PeriodOverlap is how statements overlapping the transaction dates of
+	// another of the same account are handled: OverlapOff, OverlapWarn or
+	// OverlapBlock.
+	PeriodOverlap string
+	// AccountTypeDetector, when set, infers the account type of uploads that
+	// don't supply one from the extracted content.
+	AccountTypeDetector *AccountTypeDetector
+	// AccountSplitter, when set, assigns the transactions of combined
+	// statements to the accounts found in them.
+	AccountSplitter *AccountSplitter
+	// AccountNames resolves the account name of each upload to the existing
+	// account it matches.
+	AccountNames AccountNames
+
+	// TableFilter selects the extracted tables parsed into rows.
+	// TableFiltersByAccount overrides it by lowercased account name.
+	TableFilter           TableFilter
+	TableFiltersByAccount map[string]TableFilter
+	// InvertDebitCredit lists the lowercased account names whose debit and
+	// credit columns use the opposite sign convention.
+	InvertDebitCredit []string
+	// HeaderNormalization cleans up table headers before rows are stored and
+	// parsed.
+	HeaderNormalization HeaderNormalization
+	// ExtractionRoutes maps MIME types to how their uploads are extracted:
+	// RouteTables, RouteCSV or RouteText. Other types take RouteTables.
+	ExtractionRoutes map[string]string
+	// HeaderRows skips table rows repeating the header before they're parsed:
+	// HeaderRowsOff, HeaderRowsFirst or HeaderRowsAny.
+	HeaderRows string
+	// FallbackExtractors are tried in order when the extracted tables hold no
+	// data rows; the rows of the first that finds any are used.
+	FallbackExtractors []FallbackExtractor
+	// StatementDate is how the statement date of uploads without one is
+	// filled in: StatementDateOff, StatementDateMax or StatementDateMonth.
+	StatementDate string
+	// Timezone is where the upload time falls on a calendar day when it
+	// stands in for the statement date. Nil means UTC.
+	Timezone *time.Location
+
+	// CategoryRules apply after the rules saved in the database, typically
+	// loaded from a rules file.
+	CategoryRules []transaction.Rule
+
+	// Hasher computes the file hash used for dedup; nil uses SHA256Hasher.
+	Hasher Hasher
+
+	// Files keeps the original uploads for download; nil disables it.
+	Files storage.FileStore
+
+	// Hooks are invoked in order at each pipeline stage.
+	Hooks []PipelineHook
+	// StoreImages persists images returned by Kreuzberg. Disable for privacy.
+	StoreImages bool
+	// StoreContent keeps the text extracted from each statement, searchable
+	// with the full-text index. Off by default, as it can be large.
+	StoreContent bool
+	// TableExport stores the extracted tables as CSV: TableExportOff,
+	// TableExportOn or TableExportOnly, which parses no transactions.
+	TableExport string
+	// MergeTables joins consecutive tables with the same headers, as
+	// multi-page statements are extracted, before they're exported or parsed.
+	MergeTables bool
+	// MaxImages and MaxChunks cap the images and text chunks kept from a
+	// statement's extraction results. Zero means unlimited.
+	MaxImages int
+	MaxChunks int
+	// MaxTableColumns drops extracted tables with more headers than this, and
+	// MaxHeaderLength truncates longer header names. Zero means unlimited.
+	MaxTableColumns int
+	MaxHeaderLength int
+
+	// FailOnHookError marks the statement as failed when a hook returns an
+	// error. Otherwise hook errors are logged and processing continues.
+	FailOnHookError bool
+
+	// FailOnEmpty marks a statement without data rows as failed instead of
+	// processed_empty.
+	FailOnEmpty bool
+
+	// TimeoutRetries is how many times an extraction that timed out is retried
+	// in the background, waiting RetryDelay before each attempt.
+	TimeoutRetries int
+	RetryDelay     time.Duration
+
+	// ProcessingTimeout bounds each extraction attempt of a statement, batch
+	// retries included, whatever the Kreuzberg timeouts; the extraction is
+	// cancelled and the statement marked timed_out. It's only retried like a
+	// Kreuzberg timeout when RetryProcessingTimeout is set. Zero means no
+	// limit.
+	ProcessingTimeout      time.Duration
+	RetryProcessingTimeout bool
+
+	// FailedRetry retries statements whose extraction failed for a transient
+	// reason, reprocessing their original from Files; see RunFailedRetries.
+	FailedRetry FailedRetryPolicy
+
+	// MaxConcurrent caps extractions in flight; MaxConcurrentPerAccount caps them
+	// for each account name. Zero means unlimited.
+	MaxConcurrent           int
+	MaxConcurrentPerAccount int
+	// Prioritize orders uploads waiting for one of the MaxConcurrent slots by
+	// priority and then estimated cost: file size times the CostWeights entry
+	// for its MIME type (1 when absent). Uploads waiting PriorityMaxWait or
+	// longer go first; zero means they never jump the queue.
+	Prioritize      bool
+	CostWeights     map[string]float64
+	PriorityMaxWait time.Duration
+
+	// ReconcileToleranceCents is the largest discrepancy between the printed
+	// closing balance and the parsed transactions that still reconciles.
+	ReconcileToleranceCents int64
+	// ExpectedCountTolerance is how many transactions the parsed count may
+	// differ by from an upload's ExpectedCount before it's flagged.
+	ExpectedCountTolerance int
+	// StageUploads stages every upload, as if it set Stage.
+	StageUploads bool
+	// DeterministicIDs derives statement IDs from the file hash and account
+	// with DeterministicID instead of picking random ones.
+	DeterministicIDs bool
+
+	// DefaultCurrency is the currency of uploads that don't name one.
+	// Converter, when set, converts transaction amounts to its base currency.
+	DefaultCurrency string
+	Converter       *exchange.Converter
+	// SplitCurrency takes a currency printed in amount cells for the
+	// currency of the transaction, over the statement's.
+	SplitCurrency bool
+}
+
+// Processor orchestrates statement processing: validate → hash → dedup → extract → parse → store.
 type Processor struct {
-	store        *Store
-	kreuzberg    *kreuzberg.Client
-	maxSizeMB    int
-	allowedTypes []string
-	logger       *slog.Logger
+	store           *Store
+	files           storage.FileStore
+	hasher          Hasher
+	kreuzberg       *kreuzberg.Client
+	sizeLimits      SizeLimits
+	allowedTypes    []string
+	internalTypes   []string
+	extensionTypes  map[string]string
+	detectCharset   bool
+	statementLimits StatementLimits
+	overlap         string
+	accountTypes    AccountTypes
+	accountNames    AccountNames
+	detector        *AccountTypeDetector
+	splitter        *AccountSplitter
+	storeImages     bool
+	storeContent    bool
+	tableExport     string
+	mergeTables     bool
+	maxImages       int
+	maxChunks       int
+	maxColumns      int
+	maxHeaderLength int
+	hooks           []PipelineHook
+	failOnHookError bool
+	failOnEmpty     bool
+	timeoutRetries  int
+	retryDelay      time.Duration
+	deadline        time.Duration
+	retryDeadline   bool
+	failedRetry     FailedRetryPolicy
+	limiter         *limiter
+	costWeights     map[string]float64
+	tolerance       int64
+	countTolerance  int
+	stage           bool
+	stableIDs       bool
+	tableFilter     TableFilter
+	tableFilters    map[string]TableFilter
+	invertAccounts  []string
+	headers         HeaderNormalization
+	headerRows      string
+	routes          map[string]string
+	fallbacks       []FallbackExtractor
+	statementDate   string
+	timezone        *time.Location
+	categoryRules   []transaction.Rule
+	currency        string
+	converter       *exchange.Converter
+	splitCurrency   bool
+	logger          *slog.Logger
+
+	// stop cancels pending retries; retries tracks their goroutines.
+	stop    chan struct{}
+	retries sync.WaitGroup
 }
 
 // NewProcessor creates a new Processor.
-func NewProcessor(store *Store, kreuzbergClient *kreuzberg.Client, maxSizeMB int, allowedTypes []string, logger *slog.Logger) *Processor {
+func NewProcessor(store *Store, kreuzbergClient *kreuzberg.Client, opts ProcessorOptions, logger *slog.Logger) *Processor {
+	hasher := opts.Hasher
+	if hasher == nil {
+		hasher = SHA256Hasher{}
+	}
+
 	return &Processor{
-		store:        store,
-		kreuzberg:    kreuzbergClient,
-		maxSizeMB:    maxSizeMB,
-		allowedTypes: allowedTypes,
-		logger:       logger,
+		store:           store,
+		files:           opts.Files,
+		hasher:          hasher,
+		kreuzberg:       kreuzbergClient,
+		sizeLimits:      SizeLimits{MaxSizeMB: opts.MaxSizeMB, ByType: opts.MaxSizeMBByType},
+		allowedTypes:    opts.AllowedTypes,
+		internalTypes:   opts.InternalAllowedTypes,
+		extensionTypes:  opts.ExtensionTypes,
+		detectCharset:   opts.DetectCharset,
+		statementLimits: opts.StatementLimits,
+		overlap:         opts.PeriodOverlap,
+		accountTypes:    opts.AccountTypes,
+		accountNames:    opts.AccountNames,
+		detector:        opts.AccountTypeDetector,
+		splitter:        opts.AccountSplitter,
+		storeImages:     opts.StoreImages,
+		storeContent:    opts.StoreContent,
+		tableExport:     opts.TableExport,
+		mergeTables:     opts.MergeTables,
+		maxImages:       opts.MaxImages,
+		maxChunks:       opts.MaxChunks,
+		maxColumns:      opts.MaxTableColumns,
+		maxHeaderLength: opts.MaxHeaderLength,
+		hooks:           opts.Hooks,
+		failOnHookError: opts.FailOnHookError,
+		failOnEmpty:     opts.FailOnEmpty,
+		timeoutRetries:  opts.TimeoutRetries,
+		retryDelay:      opts.RetryDelay,
+		deadline:        opts.ProcessingTimeout,
+		retryDeadline:   opts.RetryProcessingTimeout,
+		failedRetry:     opts.FailedRetry,
+		limiter:         newLimiter(opts.MaxConcurrent, opts.MaxConcurrentPerAccount, opts.Prioritize, opts.PriorityMaxWait),
+		costWeights:     opts.CostWeights,
+		tolerance:       opts.ReconcileToleranceCents,
+		countTolerance:  opts.ExpectedCountTolerance,
+		stage:           opts.StageUploads,
+		stableIDs:       opts.DeterministicIDs,
+		tableFilter:     opts.TableFilter,
+		tableFilters:    opts.TableFiltersByAccount,
+		invertAccounts:  opts.InvertDebitCredit,
+		headers:         opts.HeaderNormalization,
+		headerRows:      opts.HeaderRows,
+		routes:          opts.ExtractionRoutes,
+		fallbacks:       opts.FallbackExtractors,
+		statementDate:   opts.StatementDate,
+		timezone:        opts.Timezone,
+		categoryRules:   opts.CategoryRules,
+		currency:        opts.DefaultCurrency,
+		converter:       opts.Converter,
+		splitCurrency:   opts.SplitCurrency,
+		logger:          logger,
+		stop:            make(chan struct{}),
 	}
 }
 
+// Close cancels pending retries and waits for running ones to finish. Statements
+// whose retry was cancelled keep the timed_out status.
+func (p *Processor) Close() {
+	close(p.stop)
+	p.retries.Wait()
+}
+
+// Upload is a statement file submitted for processing, with its optional metadata.
+type Upload struct {
+	Filename      string
+	Body          io.Reader
+	AccountType   string
+	AccountName   string
+	StatementDate string
+	// OpeningBalance and ClosingBalance are the balances printed on the
+	// statement. Both or neither must be set.
+	OpeningBalance string
+	ClosingBalance string
+	// ExpectedCount is the number of transactions the statement holds, when
+	// the client knows it; the parsed count is checked against it.
+	ExpectedCount string
+	// Currency is the ISO 4217 code of the statement's amounts; empty uses
+	// the processor's default.
+	Currency string
+	// Priority is low, normal or high; empty is normal. It only matters while
+	// uploads wait for an extraction slot.
+	Priority string
+	// Force creates a new statement even if the file is a duplicate, linking
+	// it to the original.
+	Force bool
+	// Stage leaves the processed statement staged, its transactions held out
+	// of reports until it's committed.
+	Stage bool
+	// Owner is the tenant uploading the statement, or empty without tenant
+	// isolation. Duplicates, header profiles and category rules are looked up
+	// within the tenant.
+	Owner string
+	// Internal comes from a trusted caller, whose files may also be of the
+	// processor's InternalAllowedTypes.
+	Internal bool
+	// Charset is the character encoding of a text upload; empty detects it
+	// if the processor does. Other uploads ignore it.
+	Charset string
+	// Delimiter separates the fields of a CSV file parsed directly, as
+	// previews are: a comma, semicolon or tab. Empty detects it.
+	Delimiter string
+	// ParseStrategy chooses the columns amounts are read from: auto,
+	// signed_amount or debit_credit. Empty is auto.
+	ParseStrategy string
+	// Trailer, when set, is called once Body has been read and may fill in
+	// the other fields. A streamed form can send them after the file, so
+	// they aren't known until it has been read.
+	Trailer func(*Upload) error
+}
+
+// BatchItem is the outcome of processing one Upload in a batch.
+type BatchItem struct {
+	Result *ProcessResult
+	Err    error
+}
+
+// job tracks a created statement until processing completes.
+type job struct {
+	statementID   string
+	statementDate string
+	filename      string
+	account       string
+	accountType   string
+	owner         string
+	currency      string
+	priority      Priority
+	mimeType      string
+	data          []byte
+	start         time.Time
+	attempts      int
+	balances      *balances
+	expectedCount *int
+	stage         bool
+	parseStrategy string
+	duplicateOf   string
+	internalType  string
+	// retryAttempts counts the automatic retries after failures made so far.
+	retryAttempts int
+}
+
+// balances are the printed balances of a statement, in cents.
+type balances struct {
+	opening, closing int64
+}
+
 // Process handles the full lifecycle of a statement upload.
-func (p *Processor) Process(filename string, data []byte, accountType, accountName, statementDate string) (*ProcessResult, error) {
+func (p *Processor) Process(upload Upload) (*ProcessResult, error) {
+	j, duplicate, err := p.prepare(upload)
+	if err != nil || duplicate != nil {
+		return duplicate, err
+	}
+
+	// 6. Send to Kreuzberg for extraction.
+	results, err := p.extract(j)
+	return j.linked(p.finish(j, results, err))
+}
+
+// ProcessBatch processes several uploads, sending the new files of each account
+// to Kreuzberg in a single request. Results are returned in input order; a failure of one upload
+// doesn't affect the others.
+func (p *Processor) ProcessBatch(uploads []Upload) []BatchItem {
+	items := make([]BatchItem, len(uploads))
+
+	var jobs []*job
+	var positions []int
+	for i, upload := range uploads {
+		j, duplicate, err := p.prepare(upload)
+		switch {
+		case err != nil:
+			items[i].Err = err
+		case duplicate != nil:
+			items[i].Result = duplicate
+		default:
+			jobs = append(jobs, j)
+			positions = append(positions, i)
+		}
+	}
+
+	// Files routed to RouteCSV are parsed here rather than sent along.
+	var kept []*job
+	var keptPositions []int
+	for i, j := range jobs {
+		if p.route(j.mimeType) != RouteCSV {
+			kept, keptPositions = append(kept, j), append(keptPositions, positions[i])
+			continue
+		}
+		results, err := p.parseDirect(j)
+		result, err := j.linked(p.finish(j, results, err))
+		items[positions[i]] = BatchItem{Result: result, Err: err}
+	}
+	jobs, positions = kept, keptPositions
+
+	if len(jobs) == 0 {
+		return items
+	}
+
+	// 6. Send the new files to Kreuzberg, one request per account, so each
+	// request holds only its own account's extraction slot.
+	var keys []string
+	groups := make(map[string][]int)
+	for i, j := range jobs {
+		key := limiterKey(j.owner, j.account)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	for _, key := range keys {
+		group := make([]*job, len(groups[key]))
+		for k, i := range groups[key] {
+			group[k] = jobs[i]
+		}
+		for k, item := range p.extractBatch(group) {
+			items[positions[groups[key][k]]] = item
+		}
+	}
+
+	return items
+}
+
+// extractBatch sends the files of one account's jobs to Kreuzberg in a single
+// request, holding one of the account's extraction slots for the batch's
+// combined cost, and finishes each job.
+func (p *Processor) extractBatch(jobs []*job) []BatchItem {
+	inputs := make([]kreuzberg.FileInput, len(jobs))
+	var cost float64
+	priority := PriorityLow
+	for i, j := range jobs {
+		p.store.Log(j.statementID, database.LevelInfo, "extraction", fmt.Sprintf("Sending to Kreuzberg in a batch of %d files", len(jobs)))
+		inputs[i] = kreuzberg.FileInput{Filename: j.filename, Data: j.data, MimeType: j.mimeType}
+		cost += p.cost(j.mimeType, len(j.data))
+		priority = max(priority, j.priority)
+	}
+
+	release := p.limiter.acquire(jobs[0].owner, jobs[0].account, cost, priority)
+	ctx, cancel := p.processingContext()
+	started := time.Now()
+	batch := p.kreuzberg.ExtractBatch(ctx, inputs)
+	cancel()
+	release()
+
+	items := make([]BatchItem, len(jobs))
+	for i, j := range jobs {
+		var results []kreuzberg.ExtractionResult
+		if batch[i].Err == nil {
+			results = []kreuzberg.ExtractionResult{batch[i].Result}
+		}
+
+		extractErr := processingTimeout(ctx, batch[i].Err, started)
+		result, err := j.linked(p.finish(j, results, extractErr))
+		items[i] = BatchItem{Result: result, Err: err}
+	}
+	return items
+}
+
+// prepare validates an upload and creates its statement record. For a duplicate
+// file it returns the existing statement's result instead of a job.
+func (p *Processor) prepare(upload Upload) (*job, *ProcessResult, error) {
 	start := time.Now()
 
-	// 1. Validate file type and size.
-	mimeType, err := ValidateFile(data, p.maxSizeMB, p.allowedTypes)
+	// 1-2. Validate file type and size, hashing the content as it's read. The
+	// type is checked first, so an unsupported file is rejected before the
+	// rest of a streamed body is read.
+	hashes := newUploadHash(p.hasher)
+	mimeType, data, internalType, err := p.readUpload(upload.Filename, upload.Body, upload.Internal, hashes.Writer())
 	if err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+		return nil, nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if upload.Trailer != nil {
+		if err := upload.Trailer(&upload); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// 2. Compute SHA256 hash.
-	fileHash := HashFile(data)
+	accountType, err := p.accountTypes.Normalize(upload.AccountType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bal, err := parseBalances(upload.OpeningBalance, upload.ClosingBalance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expectedCount, err := parseExpectedCount(upload.ExpectedCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currency, err := parseCurrency(upload.Currency, p.currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	priority, err := ParsePriority(upload.Priority)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	charset, err := ParseCharset(upload.Charset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parseStrategy, err := ParseStrategy(upload.ParseStrategy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileHash, legacyHash := hashes.Sums(data, mimeType)
 
 	// 3. Check for duplicate.
-	existing, err := p.store.FindDuplicate(fileHash)
+	existing, err := p.findDuplicate(upload.Owner, fileHash, legacyHash)
 	if err != nil {
-		return nil, fmt.Errorf("duplicate check: %w", err)
+		return nil, nil, fmt.Errorf("duplicate check: %w", err)
 	}
-	if existing != nil {
-		return &ProcessResult{
+	var duplicateOf string
+	if existing != nil && upload.Force {
+		duplicateOf = existing.ID
+	} else if existing != nil {
+		return nil, &ProcessResult{
 			StatementID:           existing.ID,
 			Filename:              existing.Filename,
 			Status:                existing.Status,
 			TransactionsExtracted: existing.TransactionCount,
 			ProcessingTimeMs:      time.Since(start).Milliseconds(),
 			Duplicate:             true,
+			InternalType:          internalType,
 		}, nil
 	}
 
-	// 4. Create statement record.
-	statementID, err := p.store.CreateStatement(filename, fileHash, int64(len(data)), mimeType, accountType, accountName, statementDate)
+	account := p.resolveAccountName(upload.Owner, upload.AccountName)
+
+	// 4. Create statement record. A forced re-upload has the same file and
+	// account as its original, so it keeps a random ID, as does a file
+	// uploaded again after its statement was deleted.
+	var id string
+	if p.stableIDs && duplicateOf == "" {
+		id = DeterministicID(upload.Owner, account, fileHash)
+		taken, err := p.store.StatementIDTaken(id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("check statement id: %w", err)
+		}
+		if taken {
+			id = ""
+		}
+	}
+	limit := p.statementLimit(account)
+	statementID, err := p.store.CreateStatement(id, upload.Filename, fileHash, p.hasher.Name(), int64(len(data)), mimeType, accountType, account, upload.StatementDate, duplicateOf, upload.Owner, limit)
+	if errors.Is(err, database.ErrAccountFull) {
+		return nil, nil, fmt.Errorf("%w: account %q already has %d statements", ErrStatementLimit, account, limit)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("create statement: %w", err)
+		return nil, nil, fmt.Errorf("create statement: %w", err)
+	}
+	if account != upload.AccountName {
+		p.store.Log(statementID, database.LevelInfo, "upload", fmt.Sprintf("Account name %q resolved to the existing account %q", upload.AccountName, account))
 	}
 
-	p.store.Log(statementID, "info", "upload", "Statement created")
+	if duplicateOf != "" {
+		p.store.Log(statementID, database.LevelInfo, "upload", "Statement created as a forced re-upload of "+duplicateOf)
+	} else {
+		p.store.Log(statementID, database.LevelInfo, "upload", "Statement created")
+	}
+	if internalType != "" {
+		p.store.Log(statementID, database.LevelInfo, "upload", fmt.Sprintf("File type %s accepted through the internal allow-list", internalType))
+	}
+
+	// Keeping the original is best-effort; extraction doesn't depend on it.
+	if p.files != nil {
+		if err := p.files.Put(fileHash, data); err != nil {
+			p.store.Log(statementID, database.LevelWarn, "storage", "failed to store original file: "+err.Error())
+		}
+	}
+
+	// The original keeps its encoding; only what's extracted is transcoded.
+	data, charsetName := p.decodeText(mimeType, data, charset)
+	if charsetName != "" {
+		if err := p.store.SetSourceCharset(statementID, charsetName); err != nil {
+			return nil, nil, fmt.Errorf("set source charset: %w", err)
+		}
+		if charsetName != CharsetUTF8 {
+			p.store.Log(statementID, database.LevelInfo, "upload", fmt.Sprintf("Transcoded from %s to UTF-8", charsetName))
+		}
+	}
+
+	if bal != nil {
+		if err := p.store.SetBalances(statementID, bal.opening, bal.closing); err != nil {
+			return nil, nil, fmt.Errorf("set balances: %w", err)
+		}
+	}
+
+	if expectedCount != nil {
+		if err := p.store.SetExpectedCount(statementID, *expectedCount); err != nil {
+			return nil, nil, fmt.Errorf("set expected count: %w", err)
+		}
+	}
+
+	if currency != "" {
+		if err := p.store.SetCurrency(statementID, currency); err != nil {
+			return nil, nil, fmt.Errorf("set currency: %w", err)
+		}
+	}
+
+	stage := upload.Stage || p.stage
+	if stage {
+		if err := p.store.SetStage(statementID); err != nil {
+			return nil, nil, fmt.Errorf("set stage: %w", err)
+		}
+	}
+
+	if parseStrategy != transaction.StrategyAuto {
+		if err := p.store.SetParseStrategy(statementID, parseStrategy); err != nil {
+			return nil, nil, fmt.Errorf("set parse strategy: %w", err)
+		}
+	}
 
 	// 5. Mark as processing.
 	if err := p.store.MarkProcessing(statementID); err != nil {
-		return nil, fmt.Errorf("mark processing: %w", err)
+		return nil, nil, fmt.Errorf("mark processing: %w", err)
 	}
 
-	// 6. Send to Kreuzberg for extraction.
-	p.store.Log(statementID, "info", "extraction", "Sending to Kreuzberg")
+	return &job{
+		statementID:   statementID,
+		statementDate: upload.StatementDate,
+		filename:      upload.Filename,
+		account:       account,
+		accountType:   accountType,
+		owner:         upload.Owner,
+		currency:      currency,
+		priority:      priority,
+		mimeType:      mimeType,
+		data:          data,
+		start:         start,
+		balances:      bal,
+		expectedCount: expectedCount,
+		stage:         stage,
+		parseStrategy: parseStrategy,
+		duplicateOf:   duplicateOf,
+		internalType:  internalType,
+	}, nil, nil
+}
 
-	results, err := p.kreuzberg.Extract(filename, data, mimeType)
-	if err != nil {
-		p.store.Log(statementID, "error", "extraction", err.Error())
-		_ = p.store.MarkFailed(statementID, err.Error())
+// linked adds the job's link to the statement it duplicates, and the type it
+// was let through as, to a result.
+func (j *job) linked(result *ProcessResult, err error) (*ProcessResult, error) {
+	if result != nil {
+		result.DuplicateOf = j.duplicateOf
+		result.InternalType = j.internalType
+	}
+	return result, err
+}
+
+// extract sends a job to Kreuzberg once its account and the server have a free
+// extraction slot, or parses it directly when its type is routed to RouteCSV.
+func (p *Processor) extract(j *job) ([]kreuzberg.ExtractionResult, error) {
+	if p.route(j.mimeType) == RouteCSV {
+		return p.parseDirect(j)
+	}
+
+	release := p.limiter.acquire(j.owner, j.account, p.cost(j.mimeType, len(j.data)), j.priority)
+	defer release()
+
+	p.store.Log(j.statementID, database.LevelInfo, "extraction", "Sending to Kreuzberg")
+
+	ctx, cancel := p.processingContext()
+	defer cancel()
+	started := time.Now()
+	results, err := p.kreuzberg.ExtractReader(ctx, j.filename, bytes.NewReader(j.data), int64(len(j.data)), j.mimeType)
+	return results, processingTimeout(ctx, err, started)
+}
+
+// processingContext returns the context of an extraction attempt, cancelled
+// after the processing timeout if there is one.
+func (p *Processor) processingContext() (context.Context, context.CancelFunc) {
+	if p.deadline <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), p.deadline)
+}
+
+// processingTimeout replaces an extraction error caused by ctx's deadline with
+// ErrProcessingTimeout, noting how long the attempt ran.
+func processingTimeout(ctx context.Context, err error, started time.Time) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrProcessingTimeout, time.Since(started).Round(time.Millisecond))
+	}
+	return err
+}
+
+// finish records the extraction outcome for a job and, on success, parses and
+// stores the extracted rows.
+func (p *Processor) finish(j *job, results []kreuzberg.ExtractionResult, extractErr error) (*ProcessResult, error) {
+	statementID, filename, start := j.statementID, j.filename, j.start
+
+	if errors.Is(extractErr, kreuzberg.ErrTimeout) || errors.Is(extractErr, ErrProcessingTimeout) {
+		return p.timedOut(j, extractErr), nil
+	}
+
+	if extractErr != nil {
+		p.store.Log(statementID, database.LevelError, "extraction", extractErr.Error())
+		_ = p.store.MarkFailed(statementID, extractErr.Error())
 
 		p.logger.Error("kreuzberg extraction failed",
 			"statement_id", statementID,
-			"error", err,
+			"error", p.store.Redact(extractErr.Error()),
 		)
+		p.scheduleFailedRetry(j, extractErr)
 
-		return &ProcessResult{
-			StatementID:      statementID,
-			Filename:         filename,
-			Status:           "failed",
-			ProcessingTimeMs: time.Since(start).Milliseconds(),
-		}, nil
+		return p.failed(statementID, filename, start), nil
 	}
 
-	p.store.Log(statementID, "info", "extraction", fmt.Sprintf("Received %d extraction results", len(results)))
+	p.store.Log(statementID, database.LevelInfo, "extraction", fmt.Sprintf("Received %d extraction results", len(results)))
+	p.trimResults(statementID, results)
+
+	if j.accountType == "" {
+		p.detectAccountType(statementID, results)
+	}
 
-	// 7. Store table rows as raw transactions.
-	rowCount, err := p.store.StoreExtractionResults(statementID, results)
+	// Keep the full response for debugging; failure here doesn't fail the statement.
+	if err := p.store.SaveExtractionResults(statementID, results); err != nil {
+		p.store.Log(statementID, database.LevelWarn, "storage", "failed to save raw extraction results: "+err.Error())
+	}
+
+	if p.mergeTables {
+		if merged := MergeTables(results); merged > 0 {
+			p.store.Log(statementID, database.LevelInfo, "extraction", fmt.Sprintf("Merged %d tables repeating the headers of the table before them", merged))
+		}
+	}
+
+	if p.storeContent {
+		if err := p.store.StoreContent(statementID, results); err != nil {
+			p.store.Log(statementID, database.LevelWarn, "storage", "failed to store content: "+err.Error())
+		}
+	}
+
+	if p.storeImages {
+		imageCount, err := p.store.StoreImages(statementID, results)
+		if err != nil {
+			p.store.Log(statementID, database.LevelWarn, "storage", "failed to store images: "+err.Error())
+		} else if imageCount > 0 {
+			p.store.Log(statementID, database.LevelInfo, "storage", fmt.Sprintf("Stored %d images", imageCount))
+		}
+	}
+
+	if err := p.runHooks(statementID, "extraction", func(h PipelineHook) error {
+		return h.AfterExtraction(statementID, results)
+	}); err != nil {
+		return p.failed(statementID, filename, start), nil
+	}
+
+	var tablesExported int
+	if p.tableExport == TableExportOn || p.tableExport == TableExportOnly {
+		tablesExported = p.exportTables(statementID, results)
+	}
+	if p.tableExport == TableExportOnly {
+		return p.tablesOnly(j, tablesExported)
+	}
+
+	// 7. Flatten the selected tables into rows, or read them from the text for
+	// types routed to RouteText. The raw results saved above keep every table.
+	route := p.route(j.mimeType)
+	var tables []kreuzberg.ExtractionResult
+	var rows []RawRow
+	extractor := ExtractorKreuzberg
+	if route == RouteText {
+		rows, extractor = TextExtractor{}.Extract(results), TextExtractor{}.Name()
+		p.store.Log(statementID, database.LevelInfo, "parse", fmt.Sprintf("Read %d transaction lines from the extracted text", len(rows)))
+	} else {
+		var headerRows int
+		tables, headerRows = SkipHeaderRows(p.filterTables(j, results), p.headerRows)
+		if headerRows > 0 {
+			p.store.Log(statementID, database.LevelInfo, "parse", fmt.Sprintf("Skipped %d rows repeating the table header", headerRows))
+		}
+		rows = ParseTables(tables, p.headers)
+		if route == RouteCSV {
+			extractor = ExtractorCSV
+		}
+	}
+	if countDataRows(rows) == 0 && len(p.fallbacks) > 0 && route != RouteText {
+		if fallbackRows, name := p.fallback(results); fallbackRows != nil {
+			rows, extractor = fallbackRows, name
+			p.store.Log(statementID, database.LevelInfo, "parse", fmt.Sprintf("No table rows were extracted; fallback extractor %s found %d rows", name, len(rows)))
+		} else {
+			p.store.Log(statementID, database.LevelInfo, "parse", "No table rows were extracted and no fallback extractor found any")
+		}
+	}
+
+	// Fallback rows don't follow the tables, so only table rows are split.
+	var accounts []DetectedAccount
+	if p.splitter != nil && (extractor == ExtractorKreuzberg || extractor == ExtractorCSV) {
+		accounts = p.splitter.Split(tables, rows)
+	}
+
+	if err := p.runHooks(statementID, "parse", func(h PipelineHook) error {
+		return h.AfterParse(statementID, rows)
+	}); err != nil {
+		return p.failed(statementID, filename, start), nil
+	}
+
+	// Store rows as raw transactions.
+	rowCount, err := p.store.StoreRows(statementID, rows)
 	if err != nil {
-		p.store.Log(statementID, "error", "storage", err.Error())
+		p.store.Log(statementID, database.LevelError, "storage", err.Error())
 		_ = p.store.MarkFailed(statementID, err.Error())
 
-		return &ProcessResult{
-			StatementID:      statementID,
-			Filename:         filename,
-			Status:           "failed",
-			ProcessingTimeMs: time.Since(start).Milliseconds(),
-		}, nil
+		return p.failed(statementID, filename, start), nil
 	}
 
-	// 8. Mark as processed.
-	if err := p.store.MarkProcessed(statementID, rowCount); err != nil {
-		return nil, fmt.Errorf("mark processed: %w", err)
+	// A header row alone usually means a truncated download or the wrong file.
+	if countDataRows(rows) == 0 {
+		p.inferStatementDate(j, nil)
+		return p.empty(statementID, filename, start)
 	}
 
-	p.store.Log(statementID, "info", "complete", fmt.Sprintf("Processed %d transactions", rowCount))
+	// Parse rows into normalized transactions, using the account's header
+	// profile if it has one.
+	mapping, err := p.store.HeaderMapping(j.owner, j.account)
+	if err != nil {
+		p.store.Log(statementID, database.LevelWarn, "parse", "failed to load header profile: "+err.Error())
+	}
+	mapping.InvertDebitCredit = p.invertsDebitCredit(j.account)
+	mapping.SplitCurrency, mapping.Currency = p.splitCurrency, j.currency
+	if j.parseStrategy != "" && j.parseStrategy != transaction.StrategyAuto {
+		mapping.Strategy = j.parseStrategy
+		p.store.Log(statementID, database.LevelInfo, "parse", "Reading amounts with the "+j.parseStrategy+" parse strategy")
+	}
+
+	txns, skipped := ParseTransactions(rows, mapping)
+	if skipped > 0 {
+		p.store.Log(statementID, database.LevelWarn, "parse", fmt.Sprintf("Skipped %d rows that could not be parsed as transactions", skipped))
+	}
+	p.inferStatementDate(j, txns)
+	if len(accounts) > 0 {
+		countAccountTransactions(accounts, txns)
+		p.logAccounts(statementID, accounts)
+	}
+
+	if rules, err := p.rules(j.owner); err != nil {
+		p.store.Log(statementID, database.LevelWarn, "parse", "failed to load category rules: "+err.Error())
+	} else {
+		transaction.Categorize(txns, rules)
+	}
+
+	if j.balances != nil {
+		if n := transaction.RunningBalances(txns, j.balances.opening); n > 0 {
+			p.store.Log(statementID, database.LevelWarn, "parse", fmt.Sprintf("%d printed balances differ from the running balance computed from the opening balance", n))
+		}
+	}
+
+	if p.converter != nil {
+		p.convert(j, txns)
+	}
+
+	overlaps := p.findOverlaps(j, txns)
+	if len(overlaps) > 0 && p.overlap == OverlapBlock {
+		_ = p.store.MarkFailed(statementID, fmt.Sprintf("Transactions overlap %d other statements of the account", len(overlaps)))
+		result := p.failed(statementID, filename, start)
+		result.Overlaps = overlaps
+		return result, nil
+	}
+
+	conflicts, err := p.store.StoreTransactions(statementID, txns)
+	if err != nil {
+		p.store.Log(statementID, database.LevelError, "storage", err.Error())
+		_ = p.store.MarkFailed(statementID, err.Error())
+
+		return p.failed(statementID, filename, start), nil
+	}
+	if len(conflicts) > 0 {
+		p.store.Log(statementID, database.LevelWarn, "parse", fmt.Sprintf("Kept %d manually edited transactions that differ from the reparsed rows %v", len(conflicts), conflicts))
+	}
+
+	rec := p.reconcile(j)
+	mismatch := p.checkCount(j, len(txns))
+
+	// 8. Mark as processed, or staged until committed.
+	status := "processed"
+	if j.stage {
+		status = "staged"
+		if err := p.store.MarkStaged(statementID, rowCount); err != nil {
+			return nil, fmt.Errorf("mark staged: %w", err)
+		}
+		p.store.Log(statementID, database.LevelInfo, "complete", fmt.Sprintf("Staged %d transactions; commit the statement to include them in reports", rowCount))
+	} else {
+		if err := p.store.MarkProcessed(statementID, rowCount); err != nil {
+			return nil, fmt.Errorf("mark processed: %w", err)
+		}
+		p.store.Log(statementID, database.LevelInfo, "complete", fmt.Sprintf("Processed %d transactions", rowCount))
+	}
 
 	p.logger.Info("statement processed",
 		"statement_id", statementID,
@@ -134,8 +985,450 @@ func (p *Processor) Process(filename string, data []byte, accountType, accountNa
 	return &ProcessResult{
 		StatementID:           statementID,
 		Filename:              filename,
-		Status:                "processed",
+		Status:                status,
 		TransactionsExtracted: rowCount,
 		ProcessingTimeMs:      time.Since(start).Milliseconds(),
+		Reconciliation:        rec,
+		Extractor:             extractor,
+		Accounts:              accounts,
+		Overlaps:              overlaps,
+		ExpectedCount:         j.expectedCount,
+		CountMismatch:         mismatch,
+		TablesExported:        tablesExported,
+	}, nil
+}
+
+// fallback runs the fallback extractors in order over results whose tables
+// held no data rows, returning the rows of the first that finds any and its
+// name. It returns nil rows when none does.
+func (p *Processor) fallback(results []kreuzberg.ExtractionResult) ([]RawRow, string) {
+	for _, f := range p.fallbacks {
+		rows := f.Extract(results)
+		if countDataRows(rows) == 0 {
+			continue
+		}
+		for i := range rows {
+			rows[i].Headers = p.headers.Normalize(rows[i].RawHeaders)
+		}
+		return rows, f.Name()
+	}
+	return nil, ""
+}
+
+// filterTables applies the table filter for the job's account.
+func (p *Processor) filterTables(j *job, results []kreuzberg.ExtractionResult) []kreuzberg.ExtractionResult {
+	filtered := p.tableFilterFor(j.account).Apply(results)
+
+	if kept, total := countTables(filtered), countTables(results); kept < total {
+		p.store.Log(j.statementID, database.LevelInfo, "parse", fmt.Sprintf("Kept %d of %d extracted tables", kept, total))
+	}
+
+	return filtered
+}
+
+// trimResults drops images and chunks beyond the configured caps, counted
+// across all results, so a pathological response can't flood storage.
+func (p *Processor) trimResults(statementID string, results []kreuzberg.ExtractionResult) {
+	var images, chunks int
+	for i := range results {
+		images += len(results[i].Images)
+		chunks += len(results[i].Chunks)
+	}
+
+	if p.maxImages > 0 && images > p.maxImages {
+		keep := p.maxImages
+		for i := range results {
+			n := min(len(results[i].Images), keep)
+			results[i].Images = results[i].Images[:n]
+			keep -= n
+		}
+		p.store.Log(statementID, database.LevelWarn, "extraction", fmt.Sprintf("Kept %d of %d images", p.maxImages, images))
+	}
+
+	if p.maxChunks > 0 && chunks > p.maxChunks {
+		keep := p.maxChunks
+		for i := range results {
+			n := min(len(results[i].Chunks), keep)
+			results[i].Chunks = results[i].Chunks[:n]
+			keep -= n
+		}
+		p.store.Log(statementID, database.LevelWarn, "extraction", fmt.Sprintf("Kept %d of %d chunks", p.maxChunks, chunks))
+	}
+
+	p.trimTables(statementID, results)
+}
+
+// trimTables drops tables with more columns than maxColumns, which come from
+// malformed extractions rather than real statements, and truncates header
+// names longer than maxHeaderLength characters.
+func (p *Processor) trimTables(statementID string, results []kreuzberg.ExtractionResult) {
+	var truncated int
+	for i := range results {
+		tables := results[i].Tables[:0]
+		for _, table := range results[i].Tables {
+			if p.maxColumns > 0 && len(table.Headers) > p.maxColumns {
+				p.store.Log(statementID, database.LevelWarn, "extraction",
+					fmt.Sprintf("Dropped a table with %d columns (maximum %d)", len(table.Headers), p.maxColumns))
+				continue
+			}
+			if p.maxHeaderLength > 0 {
+				for j, header := range table.Headers {
+					if runes := []rune(header); len(runes) > p.maxHeaderLength {
+						table.Headers[j] = string(runes[:p.maxHeaderLength])
+						truncated++
+					}
+				}
+			}
+			tables = append(tables, table)
+		}
+		results[i].Tables = tables
+	}
+
+	if truncated > 0 {
+		p.store.Log(statementID, database.LevelWarn, "extraction",
+			fmt.Sprintf("Truncated %d table headers to %d characters", truncated, p.maxHeaderLength))
+	}
+}
+
+// detectAccountType infers and stores the account type of a statement uploaded
+// without one. Failing to detect it doesn't fail the statement.
+func (p *Processor) detectAccountType(statementID string, results []kreuzberg.ExtractionResult) {
+	if p.detector == nil {
+		return
+	}
+
+	accountType, confidence, ok := p.detector.Detect(results)
+	if !ok {
+		p.store.Log(statementID, database.LevelInfo, "parse", "Could not detect the account type from the content")
+		return
+	}
+
+	if err := p.store.SetInferredAccountType(statementID, accountType, confidence); err != nil {
+		p.store.Log(statementID, database.LevelWarn, "storage", "failed to store detected account type: "+err.Error())
+		return
+	}
+	p.store.Log(statementID, database.LevelInfo, "parse", fmt.Sprintf("Detected account type %s (confidence %.2f)", accountType, confidence))
+}
+
+// rules returns the category rules of an owner in the order they apply: those
+// saved in the database, then the configured ones.
+func (p *Processor) rules(owner string) ([]transaction.Rule, error) {
+	stored, err := p.store.CategoryRules(owner)
+	if err != nil {
+		return nil, err
+	}
+	return append(stored, p.categoryRules...), nil
+}
+
+// tableFilterFor returns the table filter for an account name.
+func (p *Processor) tableFilterFor(account string) TableFilter {
+	if filter, ok := p.tableFilters[strings.ToLower(strings.TrimSpace(account))]; ok {
+		return filter
+	}
+	return p.tableFilter
+}
+
+// invertsDebitCredit reports whether an account's debit and credit columns use
+// the opposite sign convention.
+func (p *Processor) invertsDebitCredit(account string) bool {
+	return slices.Contains(p.invertAccounts, strings.ToLower(strings.TrimSpace(account)))
+}
+
+func countTables(results []kreuzberg.ExtractionResult) int {
+	var n int
+	for i := range results {
+		n += len(results[i].Tables)
+	}
+	return n
+}
+
+// reconcile checks the stored transactions against the balances printed on the
+// statement, if any were given. A statement that doesn't reconcile is flagged
+// for review but still processed.
+func (p *Processor) reconcile(j *job) *transaction.Reconciliation {
+	if j.balances == nil {
+		return nil
+	}
+
+	rec, err := p.store.Reconcile(j.statementID, j.balances.opening, j.balances.closing, p.tolerance)
+	if err != nil {
+		p.store.Log(j.statementID, database.LevelWarn, "reconcile", "failed to reconcile balances: "+err.Error())
+		return nil
+	}
+
+	if rec.Reconciled {
+		p.store.Log(j.statementID, database.LevelInfo, "reconcile", "Transactions reconcile with the statement balances")
+	} else {
+		p.store.Log(j.statementID, database.LevelWarn, "reconcile", fmt.Sprintf("Transactions are off by %s from the closing balance; flagged for review", transaction.FormatAmount(rec.DiscrepancyCents)))
+		p.logger.Warn("statement does not reconcile",
+			"statement_id", j.statementID,
+			"discrepancy_cents", rec.DiscrepancyCents,
+		)
+	}
+
+	return &rec
+}
+
+// timedOut records an extraction timeout and, while attempts remain, schedules
+// a retry. Statements that ran past the processing timeout are only retried
+// when retryDeadline is set.
+func (p *Processor) timedOut(j *job, extractErr error) *ProcessResult {
+	j.attempts++
+	deadline := errors.Is(extractErr, ErrProcessingTimeout)
+	retry := j.attempts <= p.timeoutRetries && (!deadline || p.retryDeadline)
+
+	message := fmt.Sprintf("%s (attempt %d of %d)", extractErr.Error(), j.attempts, p.timeoutRetries+1)
+	if retry {
+		message += fmt.Sprintf(", retrying in %s", p.retryDelay)
+	}
+	p.store.Log(j.statementID, database.LevelWarn, "extraction", message)
+	_ = p.store.MarkTimedOut(j.statementID, extractErr.Error())
+
+	msg := "kreuzberg extraction timed out"
+	if deadline {
+		msg = "statement processing timed out"
+	}
+	p.logger.Warn(msg,
+		"statement_id", j.statementID,
+		"attempt", j.attempts,
+		"retry", retry,
+		"elapsed_ms", time.Since(j.start).Milliseconds(),
+		"error", p.store.Redact(extractErr.Error()),
+	)
+
+	if retry {
+		p.retry(j)
+	}
+
+	return &ProcessResult{
+		StatementID:      j.statementID,
+		Filename:         j.filename,
+		Status:           "timed_out",
+		ProcessingTimeMs: time.Since(j.start).Milliseconds(),
+		RetryScheduled:   retry,
+	}
+}
+
+// retry extracts the job again in the background after the retry delay.
+func (p *Processor) retry(j *job) {
+	p.retries.Add(1)
+	go func() {
+		defer p.retries.Done()
+
+		select {
+		case <-p.stop:
+			p.store.Log(j.statementID, database.LevelWarn, "extraction", "Retry cancelled by shutdown")
+			return
+		case <-time.After(p.retryDelay):
+		}
+
+		if err := p.store.MarkProcessing(j.statementID); err != nil {
+			p.logger.Error("retry failed", "statement_id", j.statementID, "error", err)
+			return
+		}
+		p.store.Log(j.statementID, database.LevelInfo, "extraction", fmt.Sprintf("Retrying extraction (attempt %d of %d)", j.attempts+1, p.timeoutRetries+1))
+
+		results, err := p.extract(j)
+		if _, err := p.finish(j, results, err); err != nil {
+			p.logger.Error("retry failed", "statement_id", j.statementID, "error", err)
+		}
+	}()
+}
+
+// runHooks invokes fn for each configured hook. Hook errors are recorded in the
+// processing log; when FailOnHookError is set the first error also marks the
+// statement as failed and is returned.
+func (p *Processor) runHooks(statementID, stage string, fn func(PipelineHook) error) error {
+	for _, hook := range p.hooks {
+		if err := fn(hook); err != nil {
+			p.store.Log(statementID, database.LevelError, stage, "pipeline hook failed: "+err.Error())
+			p.logger.Log(context.Background(), database.LevelError.Slog(), "pipeline hook failed",
+				"statement_id", statementID,
+				"stage", stage,
+				"error", err,
+			)
+
+			if p.failOnHookError {
+				_ = p.store.MarkFailed(statementID, fmt.Sprintf("%s hook: %v", stage, err))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// empty finishes a statement whose tables held no data rows: it's marked
+// processed_empty with a warning, or failed when failOnEmpty is set.
+func (p *Processor) empty(statementID, filename string, start time.Time) (*ProcessResult, error) {
+	const msg = "No data rows were extracted; the file may be truncated or not a statement"
+
+	// The statement log and the application log report the same level.
+	level := database.LevelWarn
+	if p.failOnEmpty {
+		level = database.LevelError
+	}
+	p.store.Log(statementID, level, "parse", msg)
+	p.logger.Log(context.Background(), level.Slog(), "statement has no data rows",
+		"statement_id", statementID,
+		"filename", filename,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	if p.failOnEmpty {
+		_ = p.store.MarkFailed(statementID, msg)
+		return p.failed(statementID, filename, start), nil
+	}
+
+	if err := p.store.MarkProcessedEmpty(statementID); err != nil {
+		return nil, fmt.Errorf("mark processed empty: %w", err)
+	}
+
+	return &ProcessResult{
+		StatementID:      statementID,
+		Filename:         filename,
+		Status:           "processed_empty",
+		ProcessingTimeMs: time.Since(start).Milliseconds(),
 	}, nil
 }
+
+// failed builds the result returned for a statement that was marked as failed.
+func (p *Processor) failed(statementID, filename string, start time.Time) *ProcessResult {
+	return &ProcessResult{
+		StatementID:      statementID,
+		Filename:         filename,
+		Status:           "failed",
+		ProcessingTimeMs: time.Since(start).Milliseconds(),
+	}
+}
+
+// parseBalances parses the printed balances of an upload. It returns nil when
+// neither is given.
+func parseBalances(opening, closing string) (*balances, error) {
+	if opening == "" && closing == "" {
+		return nil, nil
+	}
+	if opening == "" || closing == "" {
+		return nil, fmt.Errorf("%w: opening_balance and closing_balance must be given together", ErrInvalidBalance)
+	}
+
+	openingCents, err := transaction.ParseAmount(opening)
+	if err != nil {
+		return nil, fmt.Errorf("%w: opening_balance: %v", ErrInvalidBalance, err)
+	}
+	closingCents, err := transaction.ParseAmount(closing)
+	if err != nil {
+		return nil, fmt.Errorf("%w: closing_balance: %v", ErrInvalidBalance, err)
+	}
+
+	return &balances{opening: openingCents, closing: closingCents}, nil
+}
+
+// cost estimates the extraction cost of a file from its size and type.
+func (p *Processor) cost(mimeType string, size int) float64 {
+	weight, ok := p.costWeights[mimeType]
+	if !ok {
+		weight = 1
+	}
+	return float64(size) * weight
+}
+
+// parseCurrency normalizes an upload's ISO 4217 currency code, falling back to
+// def when it's empty.
+func parseCurrency(value, def string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if code == "" {
+		return strings.ToUpper(def), nil
+	}
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("%w %q: must be a three-letter ISO 4217 code", ErrInvalidCurrency, value)
+	}
+	return code, nil
+}
+
+// convert sets the base currency amount of each transaction at the rate on
+// its date, from the currency printed with its amount or else the
+// statement's. Transactions without a rate are flagged and keep a nil amount;
+// they don't fail the statement.
+func (p *Processor) convert(j *job, txns []transaction.Transaction) {
+	var missing int
+	var lastErr error
+	missingCurrency := j.currency
+	for i := range txns {
+		currency := j.currency
+		if txns[i].Currency != "" {
+			currency = txns[i].Currency
+		}
+		cents, err := p.converter.Convert(context.Background(), txns[i].AmountCents, currency, txns[i].Date)
+		if err != nil {
+			txns[i].RateMissing = true
+			missing++
+			lastErr, missingCurrency = err, currency
+			continue
+		}
+		txns[i].BaseAmountCents = &cents
+	}
+
+	if missing > 0 {
+		p.store.Log(j.statementID, database.LevelWarn, "parse", fmt.Sprintf("No %s to %s exchange rate for %d transactions; their base amounts are empty: %v",
+			missingCurrency, p.converter.Base, missing, lastErr))
+	}
+}
+
+// findDuplicate looks up a statement of the owner with the same file hash.
+// Statements hashed before a different algorithm or salt was configured are
+// still matched when their raw SHA256 hash is identical.
+func (p *Processor) findDuplicate(owner, fileHash, legacyHash string) (*database.Statement, error) {
+	existing, err := p.store.FindDuplicate(owner, fileHash, p.hasher.Name())
+	if err != nil || existing != nil || legacyHash == "" {
+		return existing, err
+	}
+	return p.store.FindDuplicate(owner, legacyHash, HashSHA256)
+}
+
+// readUpload sniffs the MIME type from the first bytes of r and rejects
+// unsupported files, and in strict mode files whose extension names another
+// type, before reading the remainder. Internal uploads may also be of the
+// internal allowed types; internalType is set when one was needed. The body is
+// copied to w, when not nil, as it is read.
+func (p *Processor) readUpload(filename string, r io.Reader, internal bool, w io.Writer) (mimeType string, data []byte, internalType string, err error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return "", nil, "", fmt.Errorf("read file: %w", err)
+	}
+
+	mimeType, err = ValidateType(head, p.allowedTypes)
+	if err != nil && internal && len(p.internalTypes) > 0 {
+		if mimeType, err = ValidateType(head, p.internalTypes); err == nil {
+			internalType = mimeType
+		}
+	}
+	if err != nil {
+		return "", nil, "", err
+	}
+	if p.extensionTypes != nil {
+		if err := CheckExtension(filename, mimeType, p.extensionTypes); err != nil {
+			return "", nil, "", err
+		}
+	}
+
+	// Read one byte past the limit so oversized files can be detected
+	// without buffering them in full.
+	maxSizeMB := p.sizeLimits.For(mimeType)
+	maxBytes := int64(maxSizeMB) * 1024 * 1024
+
+	var body io.Reader = io.LimitReader(br, maxBytes+1)
+	if w != nil {
+		body = io.TeeReader(body, w)
+	}
+	data, err = io.ReadAll(body)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("read file: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return "", nil, "", fmt.Errorf("%w: exceeds maximum %d MB for %s", ErrFileTooLarge, maxSizeMB, mimeType)
+	}
+
+	return mimeType, data, internalType, nil
+}
@@ -0,0 +1,132 @@
+package statement
+
+import (
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// newTestStore opens a store on a migrated database in a temporary directory.
+func newTestStore(t *testing.T) (*Store, *database.DB) {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "metadata.db"), database.Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return NewStore(db, nil, false), db
+}
+
+// newTestProcessor creates a processor without a Kreuzberg client, on a new
+// test store. Unless opts says otherwise, it accepts PDF and CSV files of up
+// to 10 MB.
+func newTestProcessor(t *testing.T, opts ProcessorOptions) (*Processor, *database.DB) {
+	t.Helper()
+	store, db := newTestStore(t)
+	if opts.MaxSizeMB == 0 {
+		opts.MaxSizeMB = 10
+	}
+	if opts.AllowedTypes == nil {
+		opts.AllowedTypes = []string{"application/pdf", "text/csv"}
+	}
+	p := NewProcessor(store, nil, opts, slog.New(slog.DiscardHandler))
+	t.Cleanup(p.Close)
+	return p, db
+}
+
+// createTestStatement creates a statement of an account for tests to attach
+// logs and transactions to.
+func createTestStatement(t *testing.T, db *database.DB, owner, account, fileHash string) string {
+	t.Helper()
+	id, err := db.CreateStatement("", "statement.csv", fileHash, "sha256", 100, "text/csv", "checking", account, "", "", owner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// logMessages returns the messages a statement has logged.
+func logMessages(t *testing.T, db *database.DB, statementID string) []string {
+	t.Helper()
+	entries, err := db.StatementLogs(statementID, database.LogFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, e := range entries {
+		messages = append(messages, e.Message)
+	}
+	return messages
+}
+
+func TestTrimTablesOversized(t *testing.T) {
+	store, db := newTestStore(t)
+	id := createTestStatement(t, db, "", "Checking", "hash")
+	p := &Processor{store: store, maxColumns: 6, maxHeaderLength: 12}
+
+	// A malformed extraction: one table with 500 columns, one with
+	// run-on header names, and one well-formed table.
+	wide := kreuzberg.Table{Headers: make([]string, 500), Rows: [][]string{make([]string, 500)}}
+	for i := range wide.Headers {
+		wide.Headers[i] = "Column"
+	}
+	results := []kreuzberg.ExtractionResult{
+		{Tables: []kreuzberg.Table{
+			wide,
+			{Headers: []string{"Date", "Description of the transaction as printed", "Amount"}, Rows: [][]string{{"2024-01-02", "Coffee", "-3.50"}}},
+		}},
+		{Tables: []kreuzberg.Table{
+			{Headers: []string{"Datum", "Beschreibung", "Betrag"}, Rows: [][]string{{"02.01.2024", "Café Müller", "-3,50"}}},
+			{Headers: []string{"Überweisungsempfänger"}},
+		}},
+	}
+
+	p.trimTables(id, results)
+
+	if got := len(results[0].Tables); got != 1 {
+		t.Fatalf("first result kept %d tables, want 1 after dropping the 500-column one", got)
+	}
+	if got, want := results[0].Tables[0].Headers, []string{"Date", "Description ", "Amount"}; !slices.Equal(got, want) {
+		t.Errorf("headers = %q, want %q", got, want)
+	}
+	if got, want := results[1].Tables[0].Headers, []string{"Datum", "Beschreibung", "Betrag"}; !slices.Equal(got, want) {
+		t.Errorf("headers within the limit = %q, want %q", got, want)
+	}
+	// Truncation counts characters, not bytes.
+	if got, want := results[1].Tables[1].Headers[0], "Überweisungs"; got != want {
+		t.Errorf("truncated header = %q, want %q", got, want)
+	}
+
+	logs := strings.Join(logMessages(t, db, id), "\n")
+	for _, want := range []string{"Dropped a table with 500 columns (maximum 6)", "Truncated 2 table headers to 12 characters"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs don't mention %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestTrimTablesUnlimited(t *testing.T) {
+	store, db := newTestStore(t)
+	id := createTestStatement(t, db, "", "Checking", "hash")
+	p := &Processor{store: store}
+
+	headers := make([]string, 500)
+	for i := range headers {
+		headers[i] = strings.Repeat("x", 300)
+	}
+	results := []kreuzberg.ExtractionResult{{Tables: []kreuzberg.Table{{Headers: headers}}}}
+
+	p.trimTables(id, results)
+
+	if len(results[0].Tables) != 1 || len(results[0].Tables[0].Headers[0]) != 300 {
+		t.Error("tables were trimmed without limits")
+	}
+	if logs := logMessages(t, db, id); len(logs) != 0 {
+		t.Errorf("logged %q without limits", logs)
+	}
+}
@@ -0,0 +1,48 @@
+package statement
+
+import (
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// Extraction routes: how uploads of a MIME type are turned into rows.
+const (
+	// RouteTables sends the file to Kreuzberg and parses the tables it
+	// extracts, as every type is by default.
+	RouteTables = "tables"
+	// RouteCSV parses a text file as CSV without Kreuzberg.
+	RouteCSV = "csv"
+	// RouteText sends the file to Kreuzberg, which OCRs images, and reads
+	// transaction lines from the extracted text as TextExtractor does,
+	// ignoring any tables.
+	RouteText = "text"
+)
+
+// ExtractorCSV names the rows of files parsed as CSV without Kreuzberg.
+const ExtractorCSV = "csv"
+
+// route returns the extraction route for a MIME type.
+func (p *Processor) route(mimeType string) string {
+	if route, ok := p.routes[mimeType]; ok {
+		return route
+	}
+	return RouteTables
+}
+
+// parseDirect parses a job routed to RouteCSV, in place of extraction.
+func (p *Processor) parseDirect(j *job) ([]kreuzberg.ExtractionResult, error) {
+	delimiter := DetectDelimiter(j.data)
+	p.store.Log(j.statementID, database.LevelInfo, "extraction", "Parsing as CSV without Kreuzberg (delimiter "+delimiterName(delimiter)+")")
+	return parseCSV(j.data, delimiter)
+}
+
+// delimiterName spells out a CSV delimiter for logs.
+func delimiterName(d rune) string {
+	switch d {
+	case ';':
+		return "semicolon"
+	case '\t':
+		return "tab"
+	}
+	return "comma"
+}
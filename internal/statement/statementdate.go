@@ -0,0 +1,83 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// Strategies for filling in the statement date of uploads without one.
+const (
+	// StatementDateOff leaves the statement date empty.
+	StatementDateOff = "off"
+	// StatementDateMax uses the latest transaction date.
+	StatementDateMax = "max"
+	// StatementDateMonth uses the latest transaction date within the month
+	// holding the most transactions, ignoring stray ones from other months.
+	StatementDateMonth = "month"
+)
+
+// StatementDateUpload records a statement date taken from the upload time
+// because no transactions parsed.
+const StatementDateUpload = "upload_time"
+
+// InferStatementDate derives a statement date from the transactions using
+// strategy. It reports false when there are no transactions or the strategy is
+// StatementDateOff.
+func InferStatementDate(txns []transaction.Transaction, strategy string) (string, bool) {
+	if len(txns) == 0 || strategy != StatementDateMax && strategy != StatementDateMonth {
+		return "", false
+	}
+
+	// Dates are YYYY-MM-DD, so they order as strings and the first seven
+	// characters are the month.
+	month := ""
+	if strategy == StatementDateMonth {
+		counts := make(map[string]int)
+		for _, t := range txns {
+			m := t.Date[:7]
+			counts[m]++
+			// Ties go to the later month.
+			if counts[m] > counts[month] || counts[m] == counts[month] && m > month {
+				month = m
+			}
+		}
+	}
+
+	latest := ""
+	for _, t := range txns {
+		if month != "" && !strings.HasPrefix(t.Date, month) {
+			continue
+		}
+		latest = max(latest, t.Date)
+	}
+	return latest, true
+}
+
+// inferStatementDate fills in the statement date of a job uploaded without
+// one, from txns or, when none parsed, from the day of the upload time in the
+// configured timezone. Failing to store it doesn't fail the statement.
+func (p *Processor) inferStatementDate(j *job, txns []transaction.Transaction) {
+	if j.statementDate != "" || p.statementDate == "" || p.statementDate == StatementDateOff {
+		return
+	}
+
+	source := p.statementDate
+	date, ok := InferStatementDate(txns, p.statementDate)
+	if !ok {
+		loc := p.timezone
+		if loc == nil {
+			loc = time.UTC
+		}
+		source, date = StatementDateUpload, j.start.In(loc).Format(time.DateOnly)
+	}
+
+	if err := p.store.SetInferredStatementDate(j.statementID, date, source); err != nil {
+		p.store.Log(j.statementID, database.LevelWarn, "parse", "failed to store inferred statement date: "+err.Error())
+		return
+	}
+	p.store.Log(j.statementID, database.LevelInfo, "parse", fmt.Sprintf("Inferred statement date %s (%s)", date, source))
+}
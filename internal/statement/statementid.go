@@ -0,0 +1,18 @@
+package statement
+
+import (
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/google/uuid"
+)
+
+// statementIDNamespace is the namespace of deterministic statement IDs.
+var statementIDNamespace = uuid.MustParse("be46c06a-7348-4a53-a2e0-0920e38c43d3")
+
+// DeterministicID derives a statement ID from the file hash, the account and
+// the tenant uploading it, as a name-based (version 5) UUID: the same file
+// under the same account always gets the same ID. Account names are compared
+// as AccountKey does.
+func DeterministicID(owner, account, fileHash string) string {
+	name := owner + "\x00" + database.AccountKey(account) + "\x00" + fileHash
+	return uuid.NewSHA1(statementIDNamespace, []byte(name)).String()
+}
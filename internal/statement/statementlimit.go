@@ -0,0 +1,35 @@
+package statement
+
+import (
+	"errors"
+
+	"github.com/billdaws/moneymanager/internal/database"
+)
+
+// ErrStatementLimit is returned when an upload would take an account past its
+// maximum number of statements.
+var ErrStatementLimit = errors.New("statement limit reached")
+
+// StatementLimits caps the live statements of each account. Zero is unlimited.
+type StatementLimits struct {
+	PerAccount int
+	// ByAccount overrides PerAccount by lowercased account name.
+	ByAccount map[string]int
+}
+
+// For returns the limit for an account, falling back to PerAccount.
+func (l StatementLimits) For(accountName string) int {
+	if n, ok := l.ByAccount[database.AccountKey(accountName)]; ok {
+		return n
+	}
+	return l.PerAccount
+}
+
+// statementLimit returns the limit on an account's statements, or zero when
+// uploads to it aren't limited. Uploads without an account name aren't.
+func (p *Processor) statementLimit(accountName string) int {
+	if database.AccountKey(accountName) == "" {
+		return 0
+	}
+	return p.statementLimits.For(accountName)
+}
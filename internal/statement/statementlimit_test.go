@@ -0,0 +1,132 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// csvDirect parses CSV uploads without a Kreuzberg client.
+var csvDirect = map[string]string{"text/csv": RouteCSV}
+
+// uploadCSV processes a small CSV for an account, distinct per n so it isn't
+// taken for a duplicate.
+func uploadCSV(p *Processor, owner, account string, n int) (*ProcessResult, error) {
+	csv := fmt.Sprintf("Date,Description,Amount\n2024-01-%02d,Coffee,-3.50\n", n)
+	return p.Process(Upload{
+		Filename:    "statement.csv",
+		Body:        strings.NewReader(csv),
+		AccountName: account,
+		Owner:       owner,
+	})
+}
+
+func TestStatementLimit(t *testing.T) {
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		StatementLimits: StatementLimits{
+			PerAccount: 2,
+			ByAccount:  map[string]int{"savings": 1, "archive": 0},
+		},
+	})
+
+	for n := 1; n <= 2; n++ {
+		if _, err := uploadCSV(p, "alice", "Checking", n); err != nil {
+			t.Fatalf("upload %d: %v", n, err)
+		}
+	}
+	// Account names are matched case- and whitespace-insensitively.
+	_, err := uploadCSV(p, "alice", " checking ", 3)
+	if !errors.Is(err, ErrStatementLimit) {
+		t.Fatalf("third upload error = %v, want ErrStatementLimit", err)
+	}
+	if count, _ := db.CountAccountStatements("alice", "Checking"); count != 2 {
+		t.Errorf("account has %d statements after the rejected upload, want 2", count)
+	}
+
+	// The limit is per owner and per account.
+	if _, err := uploadCSV(p, "bob", "Checking", 3); err != nil {
+		t.Errorf("another owner's upload: %v", err)
+	}
+	if _, err := uploadCSV(p, "alice", "Credit Card", 3); err != nil {
+		t.Errorf("another account's upload: %v", err)
+	}
+	// Uploads without an account aren't limited.
+	for n := 4; n <= 6; n++ {
+		if _, err := uploadCSV(p, "alice", "", n); err != nil {
+			t.Errorf("upload %d without an account: %v", n, err)
+		}
+	}
+
+	// ByAccount overrides the default, and an override of zero is unlimited.
+	if _, err := uploadCSV(p, "alice", "Savings", 7); err != nil {
+		t.Fatalf("first savings upload: %v", err)
+	}
+	if _, err := uploadCSV(p, "alice", "Savings", 8); !errors.Is(err, ErrStatementLimit) {
+		t.Errorf("second savings upload error = %v, want ErrStatementLimit", err)
+	}
+	for n := 9; n <= 11; n++ {
+		if _, err := uploadCSV(p, "alice", "Archive", n); err != nil {
+			t.Errorf("archive upload %d: %v", n, err)
+		}
+	}
+}
+
+func TestStatementLimitIgnoresDeleted(t *testing.T) {
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		StatementLimits:  StatementLimits{PerAccount: 1},
+	})
+
+	first, err := uploadCSV(p, "", "Checking", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploadCSV(p, "", "Checking", 2); !errors.Is(err, ErrStatementLimit) {
+		t.Fatalf("second upload error = %v, want ErrStatementLimit", err)
+	}
+
+	if err := db.SoftDeleteStatement(first.StatementID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploadCSV(p, "", "Checking", 2); err != nil {
+		t.Errorf("upload after deleting the account's statement: %v", err)
+	}
+}
+
+func TestStatementLimitConcurrent(t *testing.T) {
+	const limit, uploads = 5, 20
+	p, db := newTestProcessor(t, ProcessorOptions{
+		ExtractionRoutes: csvDirect,
+		StatementLimits:  StatementLimits{PerAccount: limit},
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, uploads)
+	for n := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[n] = uploadCSV(p, "", "Checking", n+1)
+		}()
+	}
+	wg.Wait()
+
+	var accepted int
+	for n, err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, ErrStatementLimit):
+			t.Errorf("upload %d: %v", n+1, err)
+		}
+	}
+	if accepted != limit {
+		t.Errorf("accepted %d concurrent uploads, want %d", accepted, limit)
+	}
+	if count, _ := db.CountAccountStatements("", "Checking"); count != limit {
+		t.Errorf("account has %d statements, want %d", count, limit)
+	}
+}
@@ -1,32 +1,73 @@
 package statement
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/billdaws/moneymanager/internal/database"
 	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/redact"
+	"github.com/billdaws/moneymanager/internal/transaction"
 )
 
 // Store wraps DB operations for the statement domain.
 type Store struct {
-	db *database.DB
+	db       *database.DB
+	redactor *redact.Redactor
+	// redactRaw also redacts extracted rows and raw results before they are stored.
+	redactRaw bool
 }
 
-// NewStore creates a new Store.
-func NewStore(db *database.DB) *Store {
-	return &Store{db: db}
+// NewStore creates a new Store. Log messages and error messages are always passed
+// through redactor; extracted data only when redactRaw is set. A nil redactor
+// disables redaction.
+func NewStore(db *database.DB, redactor *redact.Redactor, redactRaw bool) *Store {
+	return &Store{
+		db:        db,
+		redactor:  redactor,
+		redactRaw: redactRaw,
+	}
+}
+
+// FindDuplicate checks if the owner already has a file with the same hash,
+// computed by the same algorithm. Returns the existing statement or nil. A
+// statement merged into another is represented by the one it was merged
+// into; once that one is deleted, the file is no longer a duplicate.
+func (s *Store) FindDuplicate(owner, fileHash, hashAlgorithm string) (*database.Statement, error) {
+	existing, err := s.db.GetStatementByHash(owner, fileHash, hashAlgorithm)
+	if err != nil || existing == nil || existing.MergedInto == "" {
+		return existing, err
+	}
+	return s.db.GetStatement(existing.MergedInto)
+}
+
+// StatementIDTaken reports whether any statement, soft-deleted ones included,
+// has the ID.
+func (s *Store) StatementIDTaken(id string) (bool, error) {
+	return s.db.StatementIDTaken(id)
+}
+
+// CreateStatement creates a new statement record, with a random ID when id is
+// empty. A positive accountLimit refuses it with database.ErrAccountFull when
+// the account is already full.
+func (s *Store) CreateStatement(id, filename, fileHash, hashAlgorithm string, fileSize int64, mimeType, accountType, accountName, statementDate, duplicateOf, owner string, accountLimit int) (string, error) {
+	return s.db.CreateStatement(id, filename, fileHash, hashAlgorithm, fileSize, mimeType, accountType, accountName, statementDate, duplicateOf, owner, accountLimit)
 }
 
-// FindDuplicate checks if a file with the same hash already exists.
-// Returns the existing statement or nil.
-func (s *Store) FindDuplicate(fileHash string) (*database.Statement, error) {
-	return s.db.GetStatementByHash(fileHash)
+// AccountNames returns the names of the owner's accounts, or of all accounts
+// when owner is empty, in the order they were first used.
+func (s *Store) AccountNames(owner string) ([]string, error) {
+	return s.db.AccountNames(owner)
 }
 
-// CreateStatement creates a new statement record.
-func (s *Store) CreateStatement(filename, fileHash string, fileSize int64, mimeType, accountType, accountName, statementDate string) (string, error) {
-	return s.db.CreateStatement(filename, fileHash, fileSize, mimeType, accountType, accountName, statementDate)
+// OverlappingStatements returns the owner's other statements of an account
+// whose transaction dates overlap from..to.
+func (s *Store) OverlappingStatements(owner, accountName, from, to, excludeID string) ([]database.StatementPeriod, error) {
+	return s.db.OverlappingStatements(owner, accountName, from, to, excludeID)
 }
 
 // MarkProcessing sets the statement status to "processing".
@@ -34,33 +75,273 @@ func (s *Store) MarkProcessing(id string) error {
 	return s.db.UpdateStatus(id, "processing")
 }
 
-// StoreExtractionResults stores the table rows from a Kreuzberg extraction as raw transactions.
+// StoreRows stores parsed table rows as raw transactions.
 // Returns the total number of rows stored.
-func (s *Store) StoreExtractionResults(statementID string, results []kreuzberg.ExtractionResult) (int, error) {
-	totalRows := 0
+func (s *Store) StoreRows(statementID string, rows []RawRow) (int, error) {
+	for i, row := range rows {
+		headersJSON, err := json.Marshal(row.Headers)
+		if err != nil {
+			return i, fmt.Errorf("marshal headers: %w", err)
+		}
+		rawHeadersJSON, err := json.Marshal(row.RawHeaders)
+		if err != nil {
+			return i, fmt.Errorf("marshal raw headers: %w", err)
+		}
+
+		values := row.Values
+		if s.redactRaw {
+			values = s.redactor.RedactAll(slices.Clone(values))
+		}
+
+		rowJSON, err := json.Marshal(values)
+		if err != nil {
+			return i, fmt.Errorf("marshal row: %w", err)
+		}
+
+		if _, err := s.db.InsertTransactionRaw(statementID, i, string(headersJSON), string(rawHeadersJSON), string(rowJSON)); err != nil {
+			return i, fmt.Errorf("insert row %d: %w", i, err)
+		}
+	}
+
+	return len(rows), nil
+}
+
+// StoreTransactions replaces the parsed transactions of a statement, preserving
+// manually edited ones. Returns the row indexes whose reparsed values conflict
+// with a manual edit.
+func (s *Store) StoreTransactions(statementID string, txns []transaction.Transaction) ([]int, error) {
+	rows := make([]database.Transaction, len(txns))
+	for i, t := range txns {
+		description := t.Description
+		if s.redactRaw {
+			description = s.redactor.Redact(description)
+		}
+
+		rows[i] = database.Transaction{
+			StatementID: statementID,
+			RowIndex:    t.RowIndex,
+			Date:        t.Date,
+			Description: description,
+			AmountCents: t.AmountCents,
+			Category:    t.Category,
+			Merchant:    t.Merchant,
+			Reference:   t.Reference,
+			Type:        t.Type,
+
+			BalanceCents:            t.BalanceCents,
+			BalanceDiscrepancyCents: t.BalanceDiscrepancyCents,
+
+			BaseAmountCents: t.BaseAmountCents,
+			RateMissing:     t.RateMissing,
+			Currency:        t.Currency,
+
+			AccountName: t.Account,
+			AccountType: t.AccountType,
+		}
+	}
+
+	return s.db.ReplaceTransactions(statementID, rows)
+}
+
+// SetBalances records the balances printed on a statement.
+func (s *Store) SetBalances(statementID string, openingCents, closingCents int64) error {
+	return s.db.SetBalances(statementID, openingCents, closingCents)
+}
+
+// SetCurrency records the currency of a statement's amounts.
+func (s *Store) SetCurrency(statementID, currency string) error {
+	return s.db.SetCurrency(statementID, currency)
+}
+
+// SetExpectedCount records the transaction count an upload expected.
+func (s *Store) SetExpectedCount(statementID string, count int) error {
+	return s.db.SetExpectedCount(statementID, count)
+}
+
+// SetStage marks a statement to be staged once processed.
+func (s *Store) SetStage(statementID string) error {
+	return s.db.SetStage(statementID)
+}
+
+// SetParseStrategy records the parse strategy a statement was uploaded with.
+func (s *Store) SetParseStrategy(statementID, strategy string) error {
+	return s.db.SetParseStrategy(statementID, strategy)
+}
+
+// SetCountMismatch records whether the parsed transaction count missed the
+// expected one.
+func (s *Store) SetCountMismatch(statementID string, mismatch bool) error {
+	return s.db.SetCountMismatch(statementID, mismatch)
+}
+
+// SetSourceCharset records the encoding a text statement was decoded from.
+func (s *Store) SetSourceCharset(statementID, charset string) error {
+	return s.db.SetSourceCharset(statementID, charset)
+}
+
+// SetInferredStatementDate records a statement date derived by strategy
+// rather than supplied with the upload.
+func (s *Store) SetInferredStatementDate(statementID, date, strategy string) error {
+	return s.db.SetInferredStatementDate(statementID, date, strategy)
+}
+
+// SetInferredAccountType records an account type detected from the statement's
+// content, with the detector's confidence.
+func (s *Store) SetInferredAccountType(statementID, accountType string, confidence float64) error {
+	return s.db.SetInferredAccountType(statementID, accountType, confidence)
+}
+
+// Reconcile compares a statement's balances with the sum of its stored
+// transactions and records the outcome.
+func (s *Store) Reconcile(statementID string, openingCents, closingCents, toleranceCents int64) (transaction.Reconciliation, error) {
+	total, err := s.db.SumTransactions(statementID)
+	if err != nil {
+		return transaction.Reconciliation{}, err
+	}
+
+	rec := transaction.Reconcile(openingCents, closingCents, total, toleranceCents)
+	if err := s.db.SetReconciliation(statementID, rec.Reconciled, rec.DiscrepancyCents); err != nil {
+		return transaction.Reconciliation{}, fmt.Errorf("save reconciliation: %w", err)
+	}
+	return rec, nil
+}
+
+// HeaderMapping returns the owner's header mapping profile of an account.
+// Accounts without a profile, and uploads without an account, get the zero
+// Mapping, which detects columns by header name.
+func (s *Store) HeaderMapping(owner, accountName string) (transaction.Mapping, error) {
+	if database.ProfileKey(accountName) == "" {
+		return transaction.Mapping{}, nil
+	}
+
+	profile, err := s.db.GetHeaderProfile(owner, accountName)
+	if err != nil || profile == nil {
+		return transaction.Mapping{}, err
+	}
+
+	return transaction.Mapping{
+		Date:        profile.DateHeader,
+		Description: profile.DescriptionHeader,
+		Amount:      profile.AmountHeader,
+		Merchant:    profile.MerchantHeader,
+		Reference:   profile.ReferenceHeader,
+		Type:        profile.TypeHeader,
+	}, nil
+}
+
+// CategoryRules returns the owner's stored categorization rules in the order
+// they apply.
+func (s *Store) CategoryRules(owner string) ([]transaction.Rule, error) {
+	stored, err := s.db.ListCategoryRules(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]transaction.Rule, len(stored))
+	for i, r := range stored {
+		rules[i] = transaction.Rule{Pattern: r.Pattern, Category: r.Category}
+	}
+	return rules, nil
+}
+
+// SaveExtractionResults persists the full Kreuzberg response for debugging.
+// Image payloads are dropped; only their metadata is kept.
+func (s *Store) SaveExtractionResults(statementID string, results []kreuzberg.ExtractionResult) error {
+	stripped := make([]kreuzberg.ExtractionResult, len(results))
+	for i, result := range results {
+		images := make([]kreuzberg.Image, len(result.Images))
+		for j, image := range result.Images {
+			image.Content = ""
+			images[j] = image
+		}
+		result.Images = images
+
+		if s.redactRaw {
+			result = s.redactResult(result)
+		}
+		stripped[i] = result
+	}
+
+	resultsJSON, err := json.Marshal(stripped)
+	if err != nil {
+		return fmt.Errorf("marshal extraction results: %w", err)
+	}
+
+	return s.db.InsertExtractionResults(statementID, string(resultsJSON))
+}
+
+// StoreImages decodes and stores the images returned by Kreuzberg.
+// Images whose content isn't valid base64 are skipped.
+// Returns the number of images stored.
+func (s *Store) StoreImages(statementID string, results []kreuzberg.ExtractionResult) (int, error) {
+	stored := 0
 
 	for _, result := range results {
-		for _, table := range result.Tables {
-			headersJSON, err := json.Marshal(table.Headers)
-			if err != nil {
-				return totalRows, fmt.Errorf("marshal headers: %w", err)
+		for _, image := range result.Images {
+			content, err := base64.StdEncoding.DecodeString(image.Content)
+			if err != nil || len(content) == 0 {
+				s.Log(statementID, database.LevelWarn, "storage", fmt.Sprintf("skipping image %q: invalid content", image.ID))
+				continue
 			}
 
-			for _, row := range table.Rows {
-				rowJSON, err := json.Marshal(row)
-				if err != nil {
-					return totalRows, fmt.Errorf("marshal row: %w", err)
-				}
+			if _, err := s.db.InsertImage(statementID, image.ID, image.MimeType, content); err != nil {
+				return stored, fmt.Errorf("insert image %q: %w", image.ID, err)
+			}
+			stored++
+		}
+	}
+
+	return stored, nil
+}
 
-				if _, err := s.db.InsertTransactionRaw(statementID, totalRows, string(headersJSON), string(rowJSON)); err != nil {
-					return totalRows, fmt.Errorf("insert row %d: %w", totalRows, err)
+// StoreContent stores the text of the extraction results, one document after
+// another, replacing the text stored before. Results without text store
+// nothing.
+func (s *Store) StoreContent(statementID string, results []kreuzberg.ExtractionResult) error {
+	var docs []string
+	for _, result := range results {
+		if strings.TrimSpace(result.Content) != "" {
+			docs = append(docs, result.Content)
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	content := strings.Join(docs, "\n\n")
+	if s.redactRaw {
+		content = s.redactor.Redact(content)
+	}
+	return s.db.ReplaceContent(statementID, content)
+}
+
+// StoreTableExports stores every extracted table as CSV, numbered across the
+// results in order, replacing the tables stored before. Returns the number of
+// tables stored.
+func (s *Store) StoreTableExports(statementID string, results []kreuzberg.ExtractionResult) (int, error) {
+	var tables []database.TableExport
+	for _, result := range results {
+		for _, table := range result.Tables {
+			rows := table.Rows
+			if s.redactRaw {
+				rows = make([][]string, len(table.Rows))
+				for i, row := range table.Rows {
+					rows[i] = s.redactor.RedactAll(slices.Clone(row))
 				}
-				totalRows++
 			}
+			tables = append(tables, database.TableExport{
+				Index:   len(tables),
+				Columns: len(table.Headers),
+				Rows:    len(rows),
+				Content: TableCSV(table.Headers, rows),
+			})
 		}
 	}
 
-	return totalRows, nil
+	if err := s.db.ReplaceTableExports(statementID, tables); err != nil {
+		return 0, err
+	}
+	return len(tables), nil
 }
 
 // MarkProcessed marks a statement as processed with a transaction count.
@@ -68,13 +349,79 @@ func (s *Store) MarkProcessed(id string, transactionCount int) error {
 	return s.db.MarkProcessed(id, transactionCount)
 }
 
+// MarkStaged marks a statement as staged with a transaction count.
+func (s *Store) MarkStaged(id string, transactionCount int) error {
+	return s.db.MarkStaged(id, transactionCount)
+}
+
+// MarkProcessedEmpty marks a statement as processed without any data rows.
+func (s *Store) MarkProcessedEmpty(id string) error {
+	return s.db.MarkProcessedEmpty(id)
+}
+
 // MarkFailed marks a statement as failed with an error message.
 func (s *Store) MarkFailed(id, errorMessage string) error {
-	return s.db.MarkFailed(id, errorMessage)
+	return s.db.MarkFailed(id, s.redactor.Redact(errorMessage))
+}
+
+// MarkTimedOut marks a statement whose extraction timed out.
+func (s *Store) MarkTimedOut(id, errorMessage string) error {
+	return s.db.MarkTimedOut(id, s.redactor.Redact(errorMessage))
+}
+
+// ScheduleRetry sets when a failed statement is next retried automatically.
+func (s *Store) ScheduleRetry(id string, at time.Time) error {
+	return s.db.ScheduleRetry(id, at)
+}
+
+// DueRetries returns the failed statements whose automatic retry is due.
+func (s *Store) DueRetries(now time.Time) ([]string, error) {
+	return s.db.ListDueRetries(now)
+}
+
+// StartRetry claims a failed statement for its scheduled retry, reporting
+// false if it's no longer waiting for one.
+func (s *Store) StartRetry(id string) (bool, error) {
+	return s.db.StartRetry(id)
+}
+
+// Statement returns a statement by ID, or nil if not found.
+func (s *Store) Statement(id string) (*database.Statement, error) {
+	return s.db.GetStatement(id)
 }
 
 // Log writes a processing log entry.
-func (s *Store) Log(statementID, level, stage, message string) {
+func (s *Store) Log(statementID string, level database.Level, stage, message string) {
 	// Best-effort logging; errors are silently ignored.
-	_ = s.db.InsertLogEntry(statementID, level, stage, message)
+	_ = s.db.InsertLogEntry(statementID, level, stage, s.redactor.Redact(message))
+}
+
+// Redact masks sensitive numbers in text that may echo extracted content.
+func (s *Store) Redact(text string) string {
+	return s.redactor.Redact(text)
+}
+
+// redactResult returns a copy of result with its text content redacted.
+func (s *Store) redactResult(result kreuzberg.ExtractionResult) kreuzberg.ExtractionResult {
+	result.Content = s.redactor.Redact(result.Content)
+
+	chunks := make([]kreuzberg.Chunk, len(result.Chunks))
+	for i, chunk := range result.Chunks {
+		chunk.Content = s.redactor.Redact(chunk.Content)
+		chunks[i] = chunk
+	}
+	result.Chunks = chunks
+
+	tables := make([]kreuzberg.Table, len(result.Tables))
+	for i, table := range result.Tables {
+		rows := make([][]string, len(table.Rows))
+		for j, row := range table.Rows {
+			rows[j] = s.redactor.RedactAll(slices.Clone(row))
+		}
+		table.Rows = rows
+		tables[i] = table
+	}
+	result.Tables = tables
+
+	return result
 }
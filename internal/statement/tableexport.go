@@ -0,0 +1,99 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/billdaws/moneymanager/internal/database"
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+	"github.com/billdaws/moneymanager/internal/transaction"
+)
+
+// Table export modes.
+const (
+	// TableExportOff keeps extracted tables only in the raw extraction results.
+	TableExportOff = "off"
+	// TableExportOn also stores every extracted table as CSV.
+	TableExportOn = "on"
+	// TableExportOnly stores the tables as CSV and parses no transactions.
+	TableExportOnly = "only"
+)
+
+// TableCSV renders an extracted table as CSV, headers first. Cells starting
+// with =, +, - or @ that aren't amounts are prefixed with a quote, so a
+// spreadsheet opening the file shows them rather than evaluating them.
+func TableCSV(headers []string, rows [][]string) []byte {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	for _, record := range append([][]string{headers}, rows...) {
+		cells := make([]string, len(record))
+		for i, cell := range record {
+			cells[i] = spreadsheetCell(cell)
+		}
+		_ = cw.Write(cells)
+	}
+	cw.Flush()
+	return buf.Bytes()
+}
+
+// spreadsheetCell quotes a cell a spreadsheet would evaluate as a formula.
+func spreadsheetCell(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@", rune(s[0])) {
+		return s
+	}
+	if _, err := transaction.ParseAmount(s); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+// exportTables stores the extracted tables of a statement as CSV, returning
+// how many there were. Failing to store them doesn't fail the statement.
+func (p *Processor) exportTables(statementID string, results []kreuzberg.ExtractionResult) int {
+	n, err := p.store.StoreTableExports(statementID, results)
+	if err != nil {
+		p.store.Log(statementID, database.LevelWarn, "storage", "failed to export tables: "+err.Error())
+		return 0
+	}
+	if n > 0 {
+		p.store.Log(statementID, database.LevelInfo, "storage", fmt.Sprintf("Exported %d tables as CSV", n))
+	}
+	return n
+}
+
+// tablesOnly finishes a statement in TableExportOnly mode once its tables are
+// exported: processed without transactions, or empty when no table was found.
+func (p *Processor) tablesOnly(j *job, tables int) (*ProcessResult, error) {
+	p.inferStatementDate(j, nil)
+	if tables == 0 {
+		return p.empty(j.statementID, j.filename, j.start)
+	}
+
+	if err := p.store.MarkProcessed(j.statementID, 0); err != nil {
+		return nil, fmt.Errorf("mark processed: %w", err)
+	}
+	p.store.Log(j.statementID, database.LevelInfo, "complete", fmt.Sprintf("Exported %d tables; transactions are not parsed in table export only mode", tables))
+
+	p.logger.Info("statement tables exported",
+		"statement_id", j.statementID,
+		"filename", j.filename,
+		"tables", tables,
+		"duration_ms", time.Since(j.start).Milliseconds(),
+	)
+
+	extractor := ExtractorKreuzberg
+	if p.route(j.mimeType) == RouteCSV {
+		extractor = ExtractorCSV
+	}
+	return &ProcessResult{
+		StatementID:      j.statementID,
+		Filename:         j.filename,
+		Status:           "processed",
+		ProcessingTimeMs: time.Since(j.start).Milliseconds(),
+		Extractor:        extractor,
+		TablesExported:   tables,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package statement
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// MergeTables joins the consecutive tables of each document that share a
+// header signature, as Kreuzberg returns a multi-page statement with its
+// header repeated on every page, and drops the rows of merged tables that
+// repeat the header. Headers match ignoring case and extra whitespace.
+// Returns how many tables were merged into the one before them.
+func MergeTables(results []kreuzberg.ExtractionResult) int {
+	var merged int
+	for i := range results {
+		var groups [][]kreuzberg.Table
+		for _, table := range results[i].Tables {
+			if last := len(groups) - 1; last >= 0 && len(table.Headers) > 0 && sameHeaders(groups[last][0].Headers, table.Headers) {
+				groups[last] = append(groups[last], table)
+				continue
+			}
+			groups = append(groups, []kreuzberg.Table{table})
+		}
+
+		tables := make([]kreuzberg.Table, len(groups))
+		for j, group := range groups {
+			tables[j] = group[0]
+			if len(group) == 1 {
+				continue
+			}
+			merged += len(group) - 1
+			var rows [][]string
+			for _, table := range group {
+				for _, row := range table.Rows {
+					if !sameHeaders(table.Headers, row) {
+						rows = append(rows, row)
+					}
+				}
+			}
+			tables[j].Rows = rows
+		}
+		results[i].Tables = tables
+	}
+	return merged
+}
+
+// sameHeaders reports whether two header rows have the same signature, or a
+// row repeats a table's headers.
+func sameHeaders(a, b []string) bool {
+	return slices.EqualFunc(a, b, sameHeader)
+}
+
+func sameHeader(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
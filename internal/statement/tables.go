@@ -0,0 +1,125 @@
+package statement
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/kreuzberg"
+)
+
+// Table filter modes.
+const (
+	TablesAll     = "all"
+	TablesLargest = "largest"
+	TablesIndex   = "index"
+	TablesHeaders = "headers"
+)
+
+// TableFilter selects which extracted tables of each document are parsed into
+// rows, so summary tables don't end up mixed in with transactions. The zero
+// value keeps every table.
+type TableFilter struct {
+	Mode string
+	// Indexes are the zero-based table positions kept in TablesIndex mode.
+	Indexes []int
+	// Headers must all appear, case-insensitively, in a table's headers for it
+	// to be kept in TablesHeaders mode.
+	Headers []string
+}
+
+// ParseTableFilter parses a filter spec: "all", "largest", "index=0|2" or
+// "headers=date|amount".
+func ParseTableFilter(spec string) (TableFilter, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	mode, arg, _ := strings.Cut(spec, "=")
+
+	switch mode {
+	case "", TablesAll:
+		return TableFilter{Mode: TablesAll}, nil
+	case TablesLargest:
+		return TableFilter{Mode: TablesLargest}, nil
+	case TablesIndex:
+		var indexes []int
+		for _, v := range strings.Split(arg, "|") {
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || i < 0 {
+				return TableFilter{}, fmt.Errorf("invalid table index %q", v)
+			}
+			indexes = append(indexes, i)
+		}
+		return TableFilter{Mode: TablesIndex, Indexes: indexes}, nil
+	case TablesHeaders:
+		var headers []string
+		for _, v := range strings.Split(arg, "|") {
+			if v = strings.TrimSpace(v); v != "" {
+				headers = append(headers, v)
+			}
+		}
+		if len(headers) == 0 {
+			return TableFilter{}, fmt.Errorf("headers filter needs at least one header")
+		}
+		return TableFilter{Mode: TablesHeaders, Headers: headers}, nil
+	default:
+		return TableFilter{}, fmt.Errorf("unknown table filter %q", spec)
+	}
+}
+
+// Apply returns a copy of results keeping only the selected tables of each
+// document. The input is left untouched.
+func (f TableFilter) Apply(results []kreuzberg.ExtractionResult) []kreuzberg.ExtractionResult {
+	if f.Mode == "" || f.Mode == TablesAll {
+		return results
+	}
+
+	filtered := make([]kreuzberg.ExtractionResult, len(results))
+	for i, result := range results {
+		result.Tables = f.tables(result.Tables)
+		filtered[i] = result
+	}
+	return filtered
+}
+
+func (f TableFilter) tables(tables []kreuzberg.Table) []kreuzberg.Table {
+	var kept []kreuzberg.Table
+
+	switch f.Mode {
+	case TablesLargest:
+		largest := -1
+		for i, t := range tables {
+			if largest < 0 || len(t.Rows) > len(tables[largest].Rows) {
+				largest = i
+			}
+		}
+		if largest >= 0 {
+			kept = append(kept, tables[largest])
+		}
+	case TablesIndex:
+		for i, t := range tables {
+			if slices.Contains(f.Indexes, i) {
+				kept = append(kept, t)
+			}
+		}
+	case TablesHeaders:
+		for _, t := range tables {
+			if hasHeaders(t.Headers, f.Headers) {
+				kept = append(kept, t)
+			}
+		}
+	}
+
+	return kept
+}
+
+// hasHeaders reports whether every wanted header appears in headers.
+func hasHeaders(headers, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.ContainsFunc(headers, func(h string) bool {
+			return strings.EqualFold(strings.TrimSpace(h), w)
+		}) {
+			return false
+		}
+	}
+	return true
+}
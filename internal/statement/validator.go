@@ -1,30 +1,82 @@
 package statement
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"slices"
+	"strings"
 )
 
-// ValidateFile checks that the file data is within size limits and has an allowed MIME type.
+// ErrFileTooLarge is returned for a file over the size limit for its type.
+var ErrFileTooLarge = errors.New("file too large")
+
+// sniffLen is the number of leading bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// SizeLimits are the maximum upload sizes in MB, optionally overridden per MIME type.
+type SizeLimits struct {
+	MaxSizeMB int
+	ByType    map[string]int
+}
+
+// For returns the size limit for a MIME type, falling back to MaxSizeMB.
+func (l SizeLimits) For(mimeType string) int {
+	if mb, ok := l.ByType[mimeType]; ok {
+		return mb
+	}
+	return l.MaxSizeMB
+}
+
+// Largest returns the highest limit of any type, for bounding request bodies
+// before the type is known.
+func (l SizeLimits) Largest() int {
+	largest := l.MaxSizeMB
+	for _, mb := range l.ByType {
+		largest = max(largest, mb)
+	}
+	return largest
+}
+
+// ValidateFile checks that the file data has an allowed MIME type and is within
+// the size limit for that type. With extensionTypes set (strict mode), the
+// filename's extension must also map to the detected type; see CheckExtension.
 // It returns the detected MIME type.
-func ValidateFile(data []byte, maxSizeMB int, allowedTypes []string) (string, error) {
-	maxBytes := int64(maxSizeMB) * 1024 * 1024
-	if int64(len(data)) > maxBytes {
-		return "", fmt.Errorf("file size %d bytes exceeds maximum %d MB", len(data), maxSizeMB)
+func ValidateFile(filename string, data []byte, limits SizeLimits, allowedTypes []string, extensionTypes map[string]string) (string, error) {
+	mimeType, err := ValidateType(data, allowedTypes)
+	if err != nil {
+		return "", err
 	}
 
-	if len(data) == 0 {
+	if extensionTypes != nil {
+		if err := CheckExtension(filename, mimeType, extensionTypes); err != nil {
+			return "", err
+		}
+	}
+
+	maxSizeMB := limits.For(mimeType)
+	if int64(len(data)) > int64(maxSizeMB)*1024*1024 {
+		return "", fmt.Errorf("%w: %d bytes exceeds maximum %d MB for %s", ErrFileTooLarge, len(data), maxSizeMB, mimeType)
+	}
+
+	return mimeType, nil
+}
+
+// ValidateType detects the MIME type from the leading bytes of a file and checks
+// it against the allowed types. Only the first 512 bytes of head are inspected, so
+// callers can reject unsupported files before reading the rest of the body.
+// It returns the detected MIME type.
+func ValidateType(head []byte, allowedTypes []string) (string, error) {
+	if len(head) == 0 {
 		return "", fmt.Errorf("file is empty")
 	}
 
-	mimeType := http.DetectContentType(data)
+	mimeType := http.DetectContentType(head)
 
 	// http.DetectContentType returns "application/octet-stream" for PDFs,
 	// so also check for the PDF magic bytes.
-	if len(data) >= 5 && string(data[:5]) == "%PDF-" {
+	if len(head) >= 5 && string(head[:5]) == "%PDF-" {
 		mimeType = "application/pdf"
 	}
 
@@ -32,8 +84,11 @@ func ValidateFile(data []byte, maxSizeMB int, allowedTypes []string) (string, er
 		return mimeType, nil
 	}
 
-	// Also accept text/plain as CSV (DetectContentType returns text/plain for CSV files).
-	if mimeType == "text/plain; charset=utf-8" || mimeType == "text/plain" {
+	// Also accept text/plain as CSV (DetectContentType returns text/plain for CSV
+	// files) in any charset, including UTF-16 without a byte order mark, which
+	// it takes for binary.
+	utf16 := detectUTF16(head[:min(len(head), sniffLen)]) != nil
+	if strings.HasPrefix(mimeType, "text/plain") || mimeType == "application/octet-stream" && utf16 {
 		if slices.Contains(allowedTypes, "text/csv") {
 			return "text/csv", nil
 		}
@@ -42,8 +97,18 @@ func ValidateFile(data []byte, maxSizeMB int, allowedTypes []string) (string, er
 	return "", fmt.Errorf("file type %q is not allowed", mimeType)
 }
 
-// HashFile returns the hex-encoded SHA256 hash of the data.
-func HashFile(data []byte) string {
-	h := sha256.Sum256(data)
-	return hex.EncodeToString(h[:])
+// CheckExtension cross-checks a detected MIME type against the filename's
+// extension, so that e.g. a PDF named statement.csv is rejected. extensionTypes
+// maps lowercase extensions, with their leading dot, to MIME types; files with
+// an unmapped extension are rejected too.
+func CheckExtension(filename, mimeType string, extensionTypes map[string]string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	expected, ok := extensionTypes[ext]
+	if !ok {
+		return fmt.Errorf("file extension %q is not recognized", ext)
+	}
+	if expected != mimeType {
+		return fmt.Errorf("file extension %q does not match the detected type %q", ext, mimeType)
+	}
+	return nil
 }
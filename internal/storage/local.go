@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local stores statement files in a directory, named by their hash.
+type Local struct {
+	dir string
+}
+
+// NewLocal creates the directory if needed and returns a Local rooted at it.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create file storage directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Put writes data under its hash. The file is written to a temporary name and
+// renamed, so a partially written file is never served.
+func (l *Local) Put(hash string, data []byte) error {
+	path, err := l.path(hash)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("store file: %w", err)
+	}
+	return nil
+}
+
+// Get opens the file stored under hash.
+func (l *Local) Get(hash string) (File, error) {
+	path, err := l.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &localFile{File: f, modTime: info.ModTime()}, nil
+}
+
+// Delete removes the file stored under hash, if any.
+func (l *Local) Delete(hash string) error {
+	path, err := l.path(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove file: %w", err)
+	}
+	return nil
+}
+
+// path returns the location of a hash.
+func (l *Local) path(hash string) (string, error) {
+	if err := validHash(hash); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, hash), nil
+}
+
+type localFile struct {
+	*os.File
+	modTime time.Time
+}
+
+func (f *localFile) ModTime() time.Time { return f.modTime }
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config locates an S3 bucket and the credentials to use it.
+type S3Config struct {
+	// Endpoint is the base URL of an S3-compatible service, e.g.
+	// http://minio:9000; empty uses AWS in Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every object key, e.g. "statements/".
+	Prefix string
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as most S3-compatible services other than AWS need.
+	PathStyle bool
+	// SessionToken is only set for temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Timeout bounds each request to the bucket.
+	Timeout time.Duration
+}
+
+// S3 stores statement files as objects in an S3 bucket, named by their hash.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	cfg        S3Config
+	base       *url.URL
+	httpClient *http.Client
+}
+
+// NewS3 returns an S3 store for the bucket in cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+	return &S3{cfg: cfg, base: base, httpClient: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Put uploads data under its hash. Objects are content-addressed, so
+// uploading one again just replaces it with the same bytes.
+func (s *S3) Put(hash string, data []byte) error {
+	resp, err := s.do(http.MethodPut, hash, data)
+	if err != nil {
+		return fmt.Errorf("store file: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("store file: %w", s3Error(resp))
+	}
+	return nil
+}
+
+// Get downloads the object stored under hash. It's held in memory, as
+// statement files are bounded by the upload size limit.
+func (s *S3) Get(hash string) (File, error) {
+	resp, err := s.do(http.MethodGet, hash, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("get file %s: %w", hash, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("get file: %w", s3Error(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &s3File{Reader: bytes.NewReader(data), modTime: modTime}, nil
+}
+
+// Delete removes the object stored under hash. Deleting a missing object
+// succeeds, as S3 does.
+func (s *S3) Delete(hash string) error {
+	resp, err := s.do(http.MethodDelete, hash, nil)
+	if err != nil {
+		return fmt.Errorf("remove file: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("remove file: %w", s3Error(resp))
+	}
+	return nil
+}
+
+// do sends a signed request for the object stored under hash.
+func (s *S3) do(method, hash string, body []byte) (*http.Response, error) {
+	if err := validHash(hash); err != nil {
+		return nil, err
+	}
+	key := s.cfg.Prefix + hash
+	u := *s.base
+	u.Path, u.RawPath = s.base.Path+"/"+key, s.base.EscapedPath()+"/"+escapeKey(key)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now().UTC())
+	return s.httpClient.Do(req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := []string{req.URL.Host, payloadHash, amzDate}
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+		headers = append(headers, "x-amz-security-token")
+		values = append(values, s.cfg.SessionToken)
+	}
+
+	var canonicalHeaders strings.Builder
+	for i, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[i] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapeKey percent-encodes an object key the way S3 expects it signed:
+// everything but unreserved characters and the slashes between segments.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			(c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Error describes an unexpected response, with the start of its body,
+// which holds S3's error code and message.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+type s3File struct {
+	*bytes.Reader
+	modTime time.Time
+}
+
+func (f *s3File) ModTime() time.Time { return f.modTime }
+
+func (f *s3File) Close() error { return nil }
@@ -0,0 +1,42 @@
+// Package storage keeps the original statement files, on disk or in an S3
+// bucket.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// FileStore persists statement files by their SHA256 hash. Files are never
+// modified once stored, so putting a hash that's already stored does nothing.
+type FileStore interface {
+	// Put stores data under its hash.
+	Put(hash string, data []byte) error
+	// Get opens the file stored under hash. It returns an error satisfying
+	// errors.Is(err, fs.ErrNotExist) if there is none.
+	Get(hash string) (File, error)
+	// Delete removes the file stored under hash, if any.
+	Delete(hash string) error
+}
+
+// File is a stored file opened for reading.
+type File interface {
+	io.ReadSeekCloser
+	// ModTime is when the file was stored.
+	ModTime() time.Time
+}
+
+// validHash rejects anything that isn't a plain hex digest, so a hash can
+// never escape the directory or prefix files are stored under.
+func validHash(hash string) error {
+	if len(hash) != 64 {
+		return fmt.Errorf("invalid file hash %q", hash)
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("invalid file hash %q", hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Package sysmem reads how much memory is left for the process, on the host or
+// under the memory limit of the container it runs in, and how much it uses.
+package sysmem
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Stats is a snapshot of memory use, in bytes.
+type Stats struct {
+	// Available is the memory that can still be allocated without swapping:
+	// the host's MemAvailable or, under a cgroup memory limit, the room left
+	// below it if that's less.
+	Available uint64
+	// Limit is the cgroup memory limit or, without one, the host's total
+	// memory. Limit and Available are zero where they can't be read, e.g. on
+	// systems other than Linux.
+	Limit uint64
+	// Process is the memory the Go runtime has obtained from the OS; Heap is
+	// the part holding live and not yet collected objects.
+	Process uint64
+	Heap    uint64
+}
+
+// Known reports whether the available memory could be read.
+func (s Stats) Known() bool { return s.Limit > 0 }
+
+// cgroupFiles locates the memory limit, the usage and the statistics holding
+// the reclaimable page cache in cgroup v2 and v1.
+var cgroupFiles = []struct{ limit, usage, stat, inactiveFile string }{
+	{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory.current", "/sys/fs/cgroup/memory.stat", "inactive_file"},
+	{"/sys/fs/cgroup/memory/memory.limit_in_bytes", "/sys/fs/cgroup/memory/memory.usage_in_bytes", "/sys/fs/cgroup/memory/memory.stat", "total_inactive_file"},
+}
+
+// Read takes a snapshot of memory use.
+func Read() Stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := Stats{Process: ms.Sys, Heap: ms.HeapAlloc}
+
+	if info, err := readFields("/proc/meminfo"); err == nil {
+		// /proc/meminfo reports kB.
+		s.Limit, s.Available = info["MemTotal"]*1024, info["MemAvailable"]*1024
+	}
+
+	for _, f := range cgroupFiles {
+		limit, err := readUint(f.limit)
+		if err != nil {
+			continue
+		}
+		// cgroup v1 reports an unset limit as a huge number rather than "max".
+		if s.Limit > 0 && limit >= s.Limit {
+			break
+		}
+		usage, err := readUint(f.usage)
+		if err != nil {
+			break
+		}
+		// Inactive page cache is reclaimed before the limit is hit, so it
+		// doesn't count against it.
+		if stat, err := readFields(f.stat); err == nil {
+			usage -= min(usage, stat[f.inactiveFile])
+		}
+		headroom := limit - min(limit, usage)
+		if s.Limit > 0 {
+			headroom = min(headroom, s.Available)
+		}
+		s.Limit, s.Available = limit, headroom
+		break
+	}
+	return s
+}
+
+// readUint reads a file holding a single number.
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readFields reads a file of "name value" or "name: value unit" lines, as
+// /proc/meminfo and memory.stat are, into a map of the values.
+func readFields(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fields := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+			fields[strings.TrimSuffix(parts[0], ":")] = v
+		}
+	}
+	return fields, scanner.Err()
+}
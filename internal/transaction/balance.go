@@ -0,0 +1,26 @@
+package transaction
+
+// RunningBalances sets BalanceCents on each transaction, in order, starting from
+// openingCents. A balance printed on the row is preferred over the computed one
+// and becomes the base for the rows after it; when they differ, the difference
+// (printed - computed) is kept in BalanceDiscrepancyCents. Returns the number of
+// rows whose printed balance differs.
+func RunningBalances(txns []Transaction, openingCents int64) (discrepancies int) {
+	running := openingCents
+	for i := range txns {
+		running += txns[i].AmountCents
+
+		if printed := txns[i].BalanceCents; printed != nil {
+			txns[i].BalanceDiscrepancyCents = *printed - running
+			if txns[i].BalanceDiscrepancyCents != 0 {
+				discrepancies++
+			}
+			running = *printed
+			continue
+		}
+
+		balance := running
+		txns[i].BalanceCents = &balance
+	}
+	return discrepancies
+}
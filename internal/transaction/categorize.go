@@ -0,0 +1,31 @@
+package transaction
+
+import "strings"
+
+// Rule assigns Category to transactions whose description contains Pattern,
+// compared case-insensitively.
+type Rule struct {
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"`
+}
+
+// Matches reports whether the rule applies to a description.
+func (r Rule) Matches(description string) bool {
+	return r.Pattern != "" && strings.Contains(strings.ToLower(description), strings.ToLower(r.Pattern))
+}
+
+// Categorize sets the category of each uncategorized transaction to that of the
+// first matching rule.
+func Categorize(txns []Transaction, rules []Rule) {
+	for i := range txns {
+		if txns[i].Category != "" {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.Matches(txns[i].Description) {
+				txns[i].Category = rule.Category
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package transaction
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// minorUnits lists the ISO 4217 currencies whose minor unit isn't two digits.
+var minorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorUnits returns the number of decimal places used by a currency code.
+func MinorUnits(currency string) int {
+	if digits, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// FormatCurrency renders cents with the decimal places of currency, e.g.
+// 123400 → "1234" for JPY and -350 → "-3.500" for KWD. Amounts are rounded
+// half away from zero when the currency has no minor unit.
+func FormatCurrency(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	switch MinorUnits(currency) {
+	case 0:
+		return fmt.Sprintf("%s%d", sign, (cents+50)/100)
+	case 3:
+		return fmt.Sprintf("%s%d.%03d", sign, cents/100, cents%100*10)
+	default:
+		return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+	}
+}
+
+// currencySymbols are the symbols SplitCurrency recognizes, longest first so
+// "US$" isn't read as "$". A bare "$" has no code of its own.
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"}, {"CA$", "CAD"}, {"AU$", "AUD"}, {"NZ$", "NZD"},
+	{"C$", "CAD"}, {"A$", "AUD"}, {"€", "EUR"}, {"£", "GBP"}, {"$", ""},
+}
+
+// dollarCurrencies are the currencies written with a bare "$".
+var dollarCurrencies = []string{"USD", "CAD", "AUD", "NZD", "HKD", "SGD", "MXN"}
+
+// SplitCurrency separates the currency from an amount cell such as
+// "$1,234.56 USD", "-€12.00" or "GBP 5.00", returning the amount and the ISO
+// 4217 code, or an empty code when the cell names none. A leading or trailing
+// three-letter code wins over a symbol. A bare "$" is taken for def when
+// that's a dollar currency, and for USD otherwise.
+func SplitCurrency(s, def string) (amount, currency string) {
+	s = strings.TrimSpace(s)
+	if code, rest, ok := cutCode(s); ok {
+		s, currency = rest, code
+	}
+
+	for _, sym := range currencySymbols {
+		i := strings.Index(s, sym.symbol)
+		if i < 0 {
+			continue
+		}
+		s = s[:i] + s[i+len(sym.symbol):]
+		if currency == "" {
+			currency = sym.code
+		}
+		if currency == "" {
+			currency = "USD"
+			if def = strings.ToUpper(def); slices.Contains(dollarCurrencies, def) {
+				currency = def
+			}
+		}
+		break
+	}
+	return strings.TrimSpace(s), currency
+}
+
+// cutCode cuts a three-letter upper-case code from the start or end of s.
+func cutCode(s string) (code, rest string, ok bool) {
+	end := len(s)
+	for end > 0 && isUpper(s[end-1]) {
+		end--
+	}
+	if len(s)-end == 3 {
+		return s[end:], strings.TrimSpace(s[:end]), true
+	}
+
+	start := 0
+	for start < len(s) && isUpper(s[start]) {
+		start++
+	}
+	if start == 3 {
+		return s[:start], strings.TrimSpace(s[start:]), true
+	}
+	return "", s, false
+}
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
@@ -0,0 +1,99 @@
+package transaction
+
+import "testing"
+
+func TestSplitCurrency(t *testing.T) {
+	tests := []struct {
+		cell, def    string
+		wantAmount   string
+		wantCurrency string
+	}{
+		{"12.00", "USD", "12.00", ""},
+		{"  -3.50 ", "", "-3.50", ""},
+		{"$1,234.56 USD", "CAD", "1,234.56", "USD"},
+		{"EUR 5.00", "", "5.00", "EUR"},
+		{"GBP-5.00", "", "-5.00", "GBP"},
+		{"-€12.00", "", "-12.00", "EUR"},
+		{"€ 12,00", "USD", "12,00", "EUR"},
+		{"£7.25", "", "7.25", "GBP"},
+		{"US$9.99", "CAD", "9.99", "USD"},
+		{"C$9.99", "", "9.99", "CAD"},
+		{"A$9.99", "", "9.99", "AUD"},
+		{"-$4.00", "", "-4.00", "USD"},
+		{"$4.00", "cad", "4.00", "CAD"},
+		{"$4.00", "EUR", "4.00", "USD"},
+		// A code wins over a symbol.
+		{"$4.00 AUD", "CAD", "4.00", "AUD"},
+		// Only a code of three letters is taken.
+		{"4.00 US", "", "4.00 US", ""},
+		{"4.00 EURO", "", "4.00 EURO", ""},
+	}
+	for _, tt := range tests {
+		amount, currency := SplitCurrency(tt.cell, tt.def)
+		if amount != tt.wantAmount || currency != tt.wantCurrency {
+			t.Errorf("SplitCurrency(%q, %q) = %q, %q; want %q, %q", tt.cell, tt.def, amount, currency, tt.wantAmount, tt.wantCurrency)
+		}
+	}
+}
+
+func TestParseMixedCurrencies(t *testing.T) {
+	headers := []string{"Date", "Description", "Amount", "Balance"}
+	rows := []struct {
+		values       []string
+		wantCents    int64
+		wantCurrency string
+		wantBalance  int64
+	}{
+		{[]string{"2024-01-02", "Coffee", "-$3.50", "$996.50"}, -350, "CAD", 99650},
+		{[]string{"2024-01-03", "Hotel", "-€120.00", "€876.50"}, -12000, "EUR", 87650},
+		{[]string{"2024-01-04", "Train", "GBP -45.00", "831.50 GBP"}, -4500, "GBP", 83150},
+		{[]string{"2024-01-05", "Refund", "1,000.00 USD", "$1,831.50"}, 100000, "USD", 183150},
+		{[]string{"2024-01-06", "Fee", "-1.00", "1830.50"}, -100, "", 183050},
+	}
+
+	m := Mapping{SplitCurrency: true, Currency: "CAD"}
+	for i, row := range rows {
+		txn, err := ParseWith(i, headers, row.values, m)
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if txn.AmountCents != row.wantCents || txn.Currency != row.wantCurrency {
+			t.Errorf("row %d = %d %q, want %d %q", i, txn.AmountCents, txn.Currency, row.wantCents, row.wantCurrency)
+		}
+		if txn.BalanceCents == nil || *txn.BalanceCents != row.wantBalance {
+			t.Errorf("row %d balance = %v, want %d", i, txn.BalanceCents, row.wantBalance)
+		}
+	}
+
+	// Without splitting, symbols are dropped and the currency is the
+	// statement's, while codes leave the amount unparseable.
+	txn, err := ParseWith(1, headers, rows[1].values, Mapping{})
+	if err != nil || txn.AmountCents != -12000 || txn.Currency != "" {
+		t.Errorf("unsplit symbol = %d %q, %v; want -12000 with no currency", txn.AmountCents, txn.Currency, err)
+	}
+	if _, err := ParseWith(2, headers, rows[2].values, Mapping{}); err == nil {
+		t.Error("parsed an amount with a currency code without SplitCurrency")
+	}
+}
+
+func TestParseMixedCurrenciesDebitCredit(t *testing.T) {
+	headers := []string{"Date", "Description", "Debit", "Credit"}
+	m := Mapping{SplitCurrency: true}
+
+	txn, err := ParseWith(0, headers, []string{"2024-01-02", "Hotel", "€120.00", ""}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.AmountCents != -12000 || txn.Currency != "EUR" {
+		t.Errorf("debit = %d %q, want -12000 EUR", txn.AmountCents, txn.Currency)
+	}
+
+	// The debit's currency is taken when both cells have one.
+	txn, err = ParseWith(1, headers, []string{"2024-01-03", "Exchange", "GBP 10.00", "EUR 12.00"}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.AmountCents != 200 || txn.Currency != "GBP" {
+		t.Errorf("debit and credit = %d %q, want 200 GBP", txn.AmountCents, txn.Currency)
+	}
+}
@@ -0,0 +1,127 @@
+package transaction
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Change pairs a transaction of the earlier version with its counterpart in the
+// later one. Fields lists what differs: date, description and/or amount.
+type Change struct {
+	Before int // index into the earlier transactions
+	After  int // index into the later transactions
+	Fields []string
+}
+
+// Diff is the difference between two versions of a statement's transactions.
+// Indexes refer to the slices passed to Compare.
+type Diff struct {
+	Added     []int // later transactions without a counterpart
+	Removed   []int // earlier transactions without a counterpart
+	Changed   []Change
+	Unchanged int
+}
+
+// matchers pair transactions that agree on two of the three key fields, tried
+// in order once exact matches are taken: a corrected description first, then
+// a corrected amount, then a corrected date.
+var matchers = []func(a, b *Transaction) bool{
+	func(a, b *Transaction) bool { return a.Date == b.Date && a.AmountCents == b.AmountCents },
+	func(a, b *Transaction) bool {
+		return a.Date == b.Date && fuzzyDescription(a.Description) == fuzzyDescription(b.Description)
+	},
+	func(a, b *Transaction) bool {
+		return a.AmountCents == b.AmountCents && fuzzyDescription(a.Description) == fuzzyDescription(b.Description)
+	},
+}
+
+// Compare matches the transactions of two versions of a statement by date,
+// amount and description. Descriptions are compared ignoring case, punctuation
+// and spacing. Pairs agreeing on all three are unchanged; pairs agreeing on two
+// are changed; the rest are added or removed.
+func Compare(before, after []Transaction) Diff {
+	var diff Diff
+	matchedBefore := make([]bool, len(before))
+	matchedAfter := make([]bool, len(after))
+
+	// Exact matches, consumed in row order so repeated transactions pair up.
+	exact := make(map[string][]int)
+	for i := range before {
+		k := diffKey(&before[i])
+		exact[k] = append(exact[k], i)
+	}
+	for j := range after {
+		k := diffKey(&after[j])
+		if candidates := exact[k]; len(candidates) > 0 {
+			matchedBefore[candidates[0]] = true
+			matchedAfter[j] = true
+			exact[k] = candidates[1:]
+			diff.Unchanged++
+		}
+	}
+
+	for _, match := range matchers {
+		for j := range after {
+			if matchedAfter[j] {
+				continue
+			}
+			for i := range before {
+				if matchedBefore[i] || !match(&before[i], &after[j]) {
+					continue
+				}
+				matchedBefore[i] = true
+				matchedAfter[j] = true
+				diff.Changed = append(diff.Changed, Change{Before: i, After: j, Fields: changedFields(&before[i], &after[j])})
+				break
+			}
+		}
+	}
+
+	// Report changes in the order of the later version.
+	slices.SortFunc(diff.Changed, func(a, b Change) int { return a.After - b.After })
+
+	for j := range after {
+		if !matchedAfter[j] {
+			diff.Added = append(diff.Added, j)
+		}
+	}
+	for i := range before {
+		if !matchedBefore[i] {
+			diff.Removed = append(diff.Removed, i)
+		}
+	}
+
+	return diff
+}
+
+// diffKey identifies a transaction for exact matching.
+func diffKey(t *Transaction) string {
+	return t.Date + "|" + FormatAmount(t.AmountCents) + "|" + fuzzyDescription(t.Description)
+}
+
+// changedFields lists the fields that differ between two matched transactions.
+func changedFields(a, b *Transaction) []string {
+	var fields []string
+	if a.Date != b.Date {
+		fields = append(fields, "date")
+	}
+	if fuzzyDescription(a.Description) != fuzzyDescription(b.Description) {
+		fields = append(fields, "description")
+	}
+	if a.AmountCents != b.AmountCents {
+		fields = append(fields, "amount")
+	}
+	return fields
+}
+
+// fuzzyDescription lowercases a description and drops everything but letters
+// and digits, so "AMAZON.COM*1234" and "Amazon.com 1234" compare equal.
+func fuzzyDescription(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
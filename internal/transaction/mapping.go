@@ -0,0 +1,134 @@
+package transaction
+
+import "strings"
+
+// Parse strategies choose the columns the amount of a row is read from.
+const (
+	// StrategyAuto reads an amount column, or debit and credit columns when
+	// there's none.
+	StrategyAuto = "auto"
+	// StrategySignedAmount only reads a signed amount column.
+	StrategySignedAmount = "signed_amount"
+	// StrategyDebitCredit only reads debit and credit columns, even in a
+	// table that also has an amount column.
+	StrategyDebitCredit = "debit_credit"
+)
+
+// Mapping names the source headers holding the canonical fields in one
+// account's statements, e.g. Date: "Posted". Empty fields fall back to header
+// detection.
+type Mapping struct {
+	Date        string
+	Description string
+	Amount      string
+	// Merchant, Reference and Type name the optional columns.
+	Merchant  string
+	Reference string
+	Type      string
+	// InvertDebitCredit treats debit columns as money entering the account
+	// and credit columns as money leaving it.
+	InvertDebitCredit bool
+	// SplitCurrency takes a currency symbol or code printed in the amount
+	// cells, e.g. "$1,234.56 USD", for the currency of the row. Currency is
+	// the statement's, which a bare "$" is read as when it's a dollar currency.
+	SplitCurrency bool
+	Currency      string
+	// Strategy is the parse strategy; empty is StrategyAuto.
+	Strategy string
+}
+
+// Columns resolves the mapping against a table's headers. A mapped header that
+// isn't in the table resolves to -1, so tables from other layouts are skipped;
+// a mapped amount also rules out debit and credit columns. The strategy then
+// rules out the amount columns it doesn't read.
+func (m Mapping) Columns(headers []string) Columns {
+	cols := DetectColumns(headers)
+	if m.Date != "" {
+		cols.Date = indexOfHeader(headers, m.Date)
+	}
+	if m.Description != "" {
+		cols.Description = indexOfHeader(headers, m.Description)
+	}
+	if m.Amount != "" {
+		cols.Amount = indexOfHeader(headers, m.Amount)
+		cols.Debit, cols.Credit = -1, -1
+	}
+	if m.Merchant != "" {
+		cols.Merchant = indexOfHeader(headers, m.Merchant)
+	}
+	if m.Reference != "" {
+		cols.Reference = indexOfHeader(headers, m.Reference)
+	}
+	if m.Type != "" {
+		cols.Type = indexOfHeader(headers, m.Type)
+	}
+
+	switch m.Strategy {
+	case StrategySignedAmount:
+		cols.Debit, cols.Credit = -1, -1
+	case StrategyDebitCredit:
+		// Debit and credit columns are taken even when the profile maps an
+		// amount column.
+		detected := DetectColumns(headers)
+		cols.Amount, cols.Debit, cols.Credit = -1, detected.Debit, detected.Credit
+	}
+	return cols
+}
+
+func indexOfHeader(headers []string, name string) int {
+	for i, h := range headers {
+		if strings.EqualFold(strings.Join(strings.Fields(h), " "), strings.Join(strings.Fields(name), " ")) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Keywords that suggest a field when no header matches exactly.
+var (
+	dateKeywords        = []string{"date", "posted"}
+	descriptionKeywords = []string{"desc", "detail", "memo", "payee", "narrative", "merchant"}
+	amountKeywords      = []string{"amount", "amt"}
+)
+
+// Suggest proposes a mapping for a table's headers: exact matches of the known
+// header names first, then headers containing a telling keyword. No amount is
+// suggested for tables with debit and credit columns, which are combined. The
+// optional columns are only suggested on an exact match.
+func Suggest(headers []string) Mapping {
+	cols := DetectColumns(headers)
+	pick := func(i int, keywords []string) string {
+		if i < 0 {
+			i = findKeyword(headers, keywords)
+		}
+		if i < 0 {
+			return ""
+		}
+		return strings.TrimSpace(headers[i])
+	}
+
+	amount := ""
+	if !cols.DebitCredit() {
+		amount = pick(cols.Amount, amountKeywords)
+	}
+
+	return Mapping{
+		Date:        pick(cols.Date, dateKeywords),
+		Description: pick(cols.Description, descriptionKeywords),
+		Amount:      amount,
+		Merchant:    pick(cols.Merchant, nil),
+		Reference:   pick(cols.Reference, nil),
+		Type:        pick(cols.Type, nil),
+	}
+}
+
+func findKeyword(headers, keywords []string) int {
+	for _, keyword := range keywords {
+		for i, h := range headers {
+			if strings.Contains(strings.ToLower(h), keyword) {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,311 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction is a normalized transaction parsed from a statement row.
+type Transaction struct {
+	RowIndex    int
+	Date        string // YYYY-MM-DD
+	Description string
+	AmountCents int64 // negative for money leaving the account
+	Category    string
+	// Merchant, Reference (e.g. a check number) and Type (e.g. "POS", "ACH")
+	// are taken from their own columns when the statement has them.
+	Merchant  string
+	Reference string
+	Type      string
+	// BalanceCents is the running balance after this transaction: the one
+	// printed on the row, or one computed by RunningBalances. Nil when unknown.
+	BalanceCents *int64
+	// BalanceDiscrepancyCents is the printed balance minus the computed one.
+	BalanceDiscrepancyCents int64
+	// BaseAmountCents is the amount converted to the base currency; nil when
+	// not converted. RateMissing is set when no exchange rate was found.
+	BaseAmountCents *int64
+	RateMissing     bool
+	// Currency is the ISO 4217 code printed with the amount when currencies
+	// are split from amounts; empty for the statement's currency.
+	Currency string
+	// Account and AccountType identify the account a transaction belongs to
+	// on a statement combining several; empty otherwise.
+	Account     string
+	AccountType string
+}
+
+// ErrNoColumns is returned when a row's headers don't identify the required columns.
+var ErrNoColumns = errors.New("no date/description/amount columns found")
+
+// ErrNoAmount is returned for rows whose debit and credit cells are both blank.
+var ErrNoAmount = errors.New("no debit or credit amount")
+
+// Columns holds the indexes of the canonical fields within a row; -1 when absent.
+// Debit and Credit locate separate columns for money leaving and entering the
+// account, used when there's no Amount column.
+type Columns struct {
+	Date        int
+	Description int
+	Amount      int
+	Balance     int
+	Debit       int
+	Credit      int
+	Merchant    int
+	Reference   int
+	Type        int
+}
+
+// DebitCredit reports whether the amount is split across debit and credit columns.
+func (c Columns) DebitCredit() bool {
+	return c.Amount < 0 && c.Debit >= 0 && c.Credit >= 0
+}
+
+// Header names (lower-case) recognized for each canonical field, in priority order.
+var (
+	dateHeaders        = []string{"date", "transaction date", "posted date", "posting date", "posted", "trans date", "value date"}
+	descriptionHeaders = []string{"description", "details", "memo", "payee", "narrative", "transaction", "name"}
+	amountHeaders      = []string{"amount", "transaction amount", "value", "amt"}
+	balanceHeaders     = []string{"balance", "running balance", "ledger balance", "available balance"}
+	debitHeaders       = []string{"debit", "debits", "debit amount", "withdrawal", "withdrawals", "withdrawal amount", "money out", "paid out"}
+	creditHeaders      = []string{"credit", "credits", "credit amount", "deposit", "deposits", "deposit amount", "money in", "paid in"}
+	merchantHeaders    = []string{"merchant", "merchant name", "vendor", "counterparty"}
+	referenceHeaders   = []string{"reference", "reference number", "ref", "ref no", "ref no.", "check number", "check no", "check no.", "check #", "cheque number", "cheque no"}
+	typeHeaders        = []string{"type", "transaction type", "trans type", "tran type"}
+)
+
+// DetectColumns finds the date, description and amount columns by header
+// name, along with the optional ones.
+func DetectColumns(headers []string) Columns {
+	return Columns{
+		Date:        findHeader(headers, dateHeaders),
+		Description: findHeader(headers, descriptionHeaders),
+		Amount:      findHeader(headers, amountHeaders),
+		Balance:     findHeader(headers, balanceHeaders),
+		Debit:       findHeader(headers, debitHeaders),
+		Credit:      findHeader(headers, creditHeaders),
+		Merchant:    findHeader(headers, merchantHeaders),
+		Reference:   findHeader(headers, referenceHeaders),
+		Type:        findHeader(headers, typeHeaders),
+	}
+}
+
+func findHeader(headers, candidates []string) int {
+	for _, candidate := range candidates {
+		for i, h := range headers {
+			if strings.ToLower(strings.TrimSpace(h)) == candidate {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Parse converts a row into a Transaction using its table headers.
+func Parse(rowIndex int, headers, values []string) (Transaction, error) {
+	return ParseWith(rowIndex, headers, values, Mapping{})
+}
+
+// ParseWith converts a row into a Transaction, locating the columns with m.
+// Without an amount column, separate debit and credit columns are combined
+// into the amount; rows with neither filled in fail with ErrNoAmount. With
+// m.SplitCurrency, a currency printed in the amount cells is cut from them
+// and becomes the transaction's.
+func ParseWith(rowIndex int, headers, values []string, m Mapping) (Transaction, error) {
+	cols := m.Columns(headers)
+	if cols.Date < 0 || cols.Amount < 0 && !cols.DebitCredit() {
+		return Transaction{}, ErrNoColumns
+	}
+
+	date, err := ParseDate(cell(values, cols.Date))
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	var currency string
+	amountCell := func(i int) string {
+		value := cell(values, i)
+		if !m.SplitCurrency {
+			return value
+		}
+		value, code := SplitCurrency(value, m.Currency)
+		if currency == "" {
+			currency = code
+		}
+		return value
+	}
+
+	var amount int64
+	if cols.DebitCredit() {
+		amount, err = debitCreditAmount(amountCell(cols.Debit), amountCell(cols.Credit), m.InvertDebitCredit)
+	} else {
+		amount, err = ParseAmount(amountCell(cols.Amount))
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	t := Transaction{
+		RowIndex:    rowIndex,
+		Date:        date,
+		Description: strings.Join(strings.Fields(cell(values, cols.Description)), " "),
+		AmountCents: amount,
+		Merchant:    strings.Join(strings.Fields(cell(values, cols.Merchant)), " "),
+		Reference:   strings.Join(strings.Fields(cell(values, cols.Reference)), " "),
+		Type:        strings.Join(strings.Fields(cell(values, cols.Type)), " "),
+		Currency:    currency,
+	}
+	// A balance column is optional; blank or unparseable cells are left
+	// unknown. Its currency is the amount's.
+	if cols.Balance >= 0 {
+		balanceCell := cell(values, cols.Balance)
+		if m.SplitCurrency {
+			balanceCell, _ = SplitCurrency(balanceCell, m.Currency)
+		}
+		if balance, err := ParseAmount(balanceCell); err == nil {
+			t.BalanceCents = &balance
+		}
+	}
+	return t, nil
+}
+
+// debitCreditAmount combines a debit and a credit cell into a signed amount:
+// debits leave the account and credits enter it, whichever sign they're
+// printed with, and a row with both is their net. invert swaps the two, for
+// statements that use the opposite convention.
+func debitCreditAmount(debit, credit string, invert bool) (int64, error) {
+	if debit == "" && credit == "" {
+		return 0, ErrNoAmount
+	}
+
+	var cents int64
+	if debit != "" {
+		d, err := ParseAmount(debit)
+		if err != nil {
+			return 0, err
+		}
+		cents -= abs(d)
+	}
+	if credit != "" {
+		c, err := ParseAmount(credit)
+		if err != nil {
+			return 0, err
+		}
+		cents += abs(c)
+	}
+
+	if invert {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+func abs(cents int64) int64 {
+	if cents < 0 {
+		return -cents
+	}
+	return cents
+}
+
+func cell(values []string, i int) string {
+	if i < 0 || i >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[i])
+}
+
+// dateLayouts are the date formats accepted by ParseDate, tried in order.
+// US month-first formats win over day-first ones for ambiguous dates.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"1/2/06",
+	"01-02-2006",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"02-Jan-2006",
+	"2006-01-02T15:04:05Z07:00",
+}
+
+// ParseDate parses a date in any of the supported formats and returns it as YYYY-MM-DD.
+func ParseDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized date %q", s)
+}
+
+// ParseAmount parses a monetary amount into cents. It accepts currency symbols,
+// thousands separators, a leading or trailing minus sign, and parentheses for
+// negatives, e.g. "$1,234.56", "-3.50", "3.50-", "(12.00)".
+func ParseAmount(s string) (int64, error) {
+	original := s
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '$', '€', '£', ',', ' ':
+			return -1
+		}
+		return r
+	}, s)
+
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		negative = !negative
+		s = rest
+	} else if rest, ok := strings.CutSuffix(s, "-"); ok {
+		negative = !negative
+		s = rest
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("unrecognized amount %q", original)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("unrecognized amount %q: too many decimal places", original)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("unrecognized amount %q", original)
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+// FormatAmount renders cents as a decimal string with two places, e.g. -350 → "-3.50".
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
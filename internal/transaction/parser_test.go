@@ -0,0 +1,141 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDebitCredit(t *testing.T) {
+	headers := []string{"Date", "Description", "Debit", "Credit", "Balance"}
+
+	tests := []struct {
+		name    string
+		headers []string
+		values  []string
+		mapping Mapping
+		want    int64
+		wantErr error
+	}{
+		{
+			name:   "only debit",
+			values: []string{"2024-01-02", "Coffee", "3.50", "", "996.50"},
+			want:   -350,
+		},
+		{
+			name:   "only credit",
+			values: []string{"2024-01-05", "Salary", "", "1,000.00", "1996.50"},
+			want:   100000,
+		},
+		{
+			name:   "debit printed negative",
+			values: []string{"2024-01-02", "Coffee", "-3.50", "", ""},
+			want:   -350,
+		},
+		{
+			name:   "both filled in",
+			values: []string{"2024-01-03", "Refund and fee", "2.00", "10.00", ""},
+			want:   800,
+		},
+		{
+			name:    "both empty",
+			values:  []string{"2024-01-04", "Opening balance", "", "", "1000.00"},
+			wantErr: ErrNoAmount,
+		},
+		{
+			name:    "both blank",
+			values:  []string{"2024-01-04", "Opening balance", "  ", " ", "1000.00"},
+			wantErr: ErrNoAmount,
+		},
+		{
+			name:    "short row",
+			values:  []string{"2024-01-04", "Opening balance"},
+			wantErr: ErrNoAmount,
+		},
+		{
+			name:    "unparseable debit",
+			values:  []string{"2024-01-02", "Coffee", "n/a", "", ""},
+			wantErr: errAny,
+		},
+		{
+			name:    "only debit, inverted",
+			values:  []string{"2024-01-02", "Card payment", "50.00", "", ""},
+			mapping: Mapping{InvertDebitCredit: true},
+			want:    5000,
+		},
+		{
+			name:    "only credit, inverted",
+			values:  []string{"2024-01-05", "Purchase", "", "25.00", ""},
+			mapping: Mapping{InvertDebitCredit: true},
+			want:    -2500,
+		},
+		{
+			name:    "withdrawal and deposit headers",
+			headers: []string{"Posted Date", "Payee", "Withdrawals", "Deposits"},
+			values:  []string{"01/02/2024", "ATM", "40.00", ""},
+			want:    -4000,
+		},
+		{
+			name:    "money out and money in headers",
+			headers: []string{"Date", "Details", "Money In", "Money Out"},
+			values:  []string{"2024-01-02", "Transfer", "75.25", ""},
+			want:    7525,
+		},
+		{
+			name:    "amount column preferred",
+			headers: []string{"Date", "Description", "Amount", "Debit", "Credit"},
+			values:  []string{"2024-01-02", "Coffee", "-3.50", "", "99.00"},
+			want:    -350,
+		},
+		{
+			name:    "debit_credit strategy over an amount column",
+			headers: []string{"Date", "Description", "Amount", "Debit", "Credit"},
+			values:  []string{"2024-01-02", "Coffee", "3.50", "3.50", ""},
+			mapping: Mapping{Strategy: StrategyDebitCredit},
+			want:    -350,
+		},
+		{
+			name:    "signed_amount strategy without an amount column",
+			values:  []string{"2024-01-02", "Coffee", "3.50", "", ""},
+			mapping: Mapping{Strategy: StrategySignedAmount},
+			wantErr: ErrNoColumns,
+		},
+		{
+			name:    "debit without credit column",
+			headers: []string{"Date", "Description", "Debit"},
+			values:  []string{"2024-01-02", "Coffee", "3.50"},
+			wantErr: ErrNoColumns,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.headers
+			if h == nil {
+				h = headers
+			}
+			got, err := ParseWith(3, h, tt.values, tt.mapping)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatalf("ParseWith() = %+v, want an error", got)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseWith() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("ParseWith() error = %v", err)
+			}
+			if got.AmountCents != tt.want {
+				t.Errorf("AmountCents = %d, want %d", got.AmountCents, tt.want)
+			}
+			if got.RowIndex != 3 {
+				t.Errorf("RowIndex = %d, want 3", got.RowIndex)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in table tests.
+var errAny = errors.New("any error")
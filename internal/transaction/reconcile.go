@@ -0,0 +1,31 @@
+package transaction
+
+// Reconciliation compares a statement's printed balances with its parsed
+// transactions. Amounts are in cents.
+type Reconciliation struct {
+	OpeningCents int64
+	ClosingCents int64
+	TotalCents   int64 // sum of the transaction amounts
+	// DiscrepancyCents is closing - (opening + total); zero when the parse matches.
+	DiscrepancyCents int64
+	Reconciled       bool
+}
+
+// Reconcile checks opening + total == closing, allowing a difference of up to
+// toleranceCents either way.
+func Reconcile(openingCents, closingCents, totalCents, toleranceCents int64) Reconciliation {
+	discrepancy := closingCents - (openingCents + totalCents)
+
+	abs := discrepancy
+	if abs < 0 {
+		abs = -abs
+	}
+
+	return Reconciliation{
+		OpeningCents:     openingCents,
+		ClosingCents:     closingCents,
+		TotalCents:       totalCents,
+		DiscrepancyCents: discrepancy,
+		Reconciled:       abs <= toleranceCents,
+	}
+}
@@ -0,0 +1,67 @@
+package transaction
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/billdaws/moneymanager/internal/jsonschema"
+)
+
+// RulesSchema is the JSON Schema a category rules file must satisfy.
+//
+//go:embed rules.schema.json
+var RulesSchema []byte
+
+var rulesSchema = must(jsonschema.Compile(RulesSchema))
+
+func must(s *jsonschema.Schema, err error) *jsonschema.Schema {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// RulesError lists every problem found in a rules document.
+type RulesError struct {
+	Problems []jsonschema.Problem
+}
+
+func (e *RulesError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "invalid category rules: " + strings.Join(msgs, "; ")
+}
+
+// ParseRules validates a rules document against RulesSchema and returns its
+// rules in order. Validation failures are returned as a *RulesError.
+func ParseRules(data []byte) ([]Rule, error) {
+	if problems := rulesSchema.Validate(data); len(problems) > 0 {
+		return nil, &RulesError{Problems: problems}
+	}
+
+	var doc struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode category rules: %w", err)
+	}
+	return doc.Rules, nil
+}
+
+// LoadRules reads and validates a rules file.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read category rules: %w", err)
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}